@@ -22,6 +22,12 @@ func TestFriendManagement(t *testing.T) {
 	t.Run("测试更新好友备注", testUpdateFriendRemark)
 	t.Run("测试删除好友", testDeleteFriend)
 	t.Run("测试重复发送好友请求", testDuplicateFriendRequest)
+	t.Run("测试拉黑后发送好友请求", testBlockedFriendRequest)
+	t.Run("测试好友标签", testFriendTags)
+	t.Run("测试好友推荐", testFriendRecommendations)
+	t.Run("测试名片邀请", testFriendInvite)
+	t.Run("测试同群添加隐私", testGroupStrangerPrivacy)
+	t.Run("测试验证问题答错上限", testFriendAnswerLimit)
 }
 
 // 准备测试用户
@@ -73,7 +79,10 @@ func testSearchFriend(t *testing.T) {
 
 	if resp.Code == 0 {
 		dataMap, ok := resp.Data.(map[string]interface{})
-		if ok && dataMap["user_id"] == TestUser2.UserID {
+		if _, hasEmail := dataMap["email"]; hasEmail {
+			AddTestResult("搜索用户", "FAIL", duration, "搜索结果泄露了邮箱")
+			t.Errorf("✗ 搜索结果不应返回邮箱: %v", dataMap)
+		} else if ok && dataMap["user_id"] == TestUser2.UserID {
 			AddTestResult("搜索用户", "PASS", duration, "")
 			t.Logf("✓ 搜索用户成功")
 		} else {
@@ -402,3 +411,272 @@ func testDuplicateFriendRequest(t *testing.T) {
 		t.Logf("⚠ 允许重复发送好友请求（可能是设计如此）")
 	}
 }
+
+// testBlockedFriendRequest 测试拉黑后发送好友请求（被拉黑方无感知，拉黑方收不到请求）
+func testBlockedFriendRequest(t *testing.T) {
+	start := time.Now()
+
+	// 用户2拉黑用户1
+	blockResp, _ := makeRequest(t, "POST", BaseURL+"/friends/block", map[string]interface{}{
+		"user_id": TestUser1.UserID,
+	}, TestUser2.Token)
+	if blockResp.Code != 0 {
+		AddTestResult("拉黑后发送好友请求", "FAIL", time.Since(start), fmt.Sprintf("拉黑失败: %s", blockResp.Msg))
+		t.Fatalf("✗ 拉黑失败: %s", blockResp.Msg)
+	}
+	defer makeRequest(t, "DELETE", fmt.Sprintf("%s/friends/block/%s", BaseURL, TestUser1.UserID), nil, TestUser2.Token)
+
+	// 被拉黑的用户1发送好友请求，应照常返回成功
+	resp, _ := makeRequest(t, "POST", BaseURL+"/friends/send-request", map[string]interface{}{
+		"to_user_id": TestUser2.UserID,
+		"message":    "再加一次",
+	}, TestUser1.Token)
+	if resp.Code != 0 {
+		AddTestResult("拉黑后发送好友请求", "FAIL", time.Since(start), "被拉黑方收到了失败提示")
+		t.Errorf("✗ 被拉黑方不应感知拉黑状态: %s", resp.Msg)
+		return
+	}
+
+	// 用户2收到的请求中不应出现用户1
+	listResp, _ := makeRequest(t, "GET", BaseURL+"/friends/received-requests?status=0", nil, TestUser2.Token)
+	duration := time.Since(start)
+	dataList, _ := listResp.Data.([]interface{})
+	for _, item := range dataList {
+		reqMap, _ := item.(map[string]interface{})
+		if reqMap["from_user_id"] == TestUser1.UserID {
+			AddTestResult("拉黑后发送好友请求", "FAIL", duration, "拉黑方仍收到请求")
+			t.Errorf("✗ 拉黑方仍收到被拉黑用户的好友请求")
+			return
+		}
+	}
+
+	AddTestResult("拉黑后发送好友请求", "PASS", duration, "")
+	t.Logf("✓ 拉黑后好友请求被静默拦截")
+}
+
+// testFriendTags 测试好友标签：按标签筛选好友列表，按标签邀请好友进群
+func testFriendTags(t *testing.T) {
+	start := time.Now()
+	owner := registerTestUser(t, "tag_test", 1)
+	colleague := registerTestUser(t, "tag_test", 2)
+	classmate := registerTestUser(t, "tag_test", 3)
+	makeTestFriends(t, colleague, owner)
+	makeTestFriends(t, classmate, owner)
+
+	tagResp, _ := makeRequest(t, "POST", BaseURL+"/friends/tags", map[string]interface{}{
+		"name":       "同事",
+		"friend_ids": []string{colleague.UserID},
+	}, owner.Token)
+	if tagResp.Code != 0 {
+		AddTestResult("好友标签", "FAIL", time.Since(start), fmt.Sprintf("创建标签失败: %s", tagResp.Msg))
+		t.Fatalf("✗ 创建好友标签失败: %s", tagResp.Msg)
+	}
+	tagID := int(dataMapOf(tagResp)["id"].(float64))
+
+	// 按标签筛选的好友列表只包含标签成员
+	listResp, _ := makeRequest(t, "GET", fmt.Sprintf("%s/friends/list?tag_id=%d", BaseURL, tagID), nil, owner.Token)
+	friends := dataListOf(listResp)
+	if len(friends) != 1 || friends[0].(map[string]interface{})["friend_id"] != colleague.UserID {
+		AddTestResult("好友标签", "FAIL", time.Since(start), "按标签筛选的好友列表不正确")
+		t.Fatalf("✗ 按标签筛选的好友列表不正确: %v", friends)
+	}
+
+	// 按标签邀请进群
+	groupID := createTestGroup(t, owner, "标签邀请测试群")
+	inviteResp, _ := makeRequest(t, "POST", fmt.Sprintf("%s/groups/%s/invite", BaseURL, groupID), map[string]interface{}{
+		"tag_ids": []int{tagID},
+	}, owner.Token)
+	members := groupMemberIDs(t, groupID, owner)
+	duration := time.Since(start)
+
+	if inviteResp.Code == 0 && members[colleague.UserID] && !members[classmate.UserID] {
+		AddTestResult("好友标签", "PASS", duration, "")
+		t.Logf("✓ 好友标签筛选和按标签邀请正常")
+	} else {
+		AddTestResult("好友标签", "FAIL", duration, fmt.Sprintf("邀请: code=%d, 成员: %v", inviteResp.Code, members))
+		t.Errorf("✗ 按标签邀请进群结果不正确: %v", members)
+	}
+}
+
+// testFriendRecommendations 测试可能认识的人：推荐二度好友，不推荐已是好友的用户
+func testFriendRecommendations(t *testing.T) {
+	start := time.Now()
+	user := registerTestUser(t, "recommend_test", 1)
+	friend := registerTestUser(t, "recommend_test", 2)
+	friendOfFriend := registerTestUser(t, "recommend_test", 3)
+	makeTestFriends(t, user, friend)
+	makeTestFriends(t, friend, friendOfFriend)
+
+	resp, _ := makeRequest(t, "GET", BaseURL+"/friends/recommendations?limit=20", nil, user.Token)
+	duration := time.Since(start)
+	if resp.Code != 0 {
+		AddTestResult("好友推荐", "FAIL", duration, fmt.Sprintf("code=%d, msg=%s", resp.Code, resp.Msg))
+		t.Fatalf("✗ 获取好友推荐失败: %s", resp.Msg)
+	}
+
+	var recommended map[string]interface{}
+	for _, item := range dataListOf(resp) {
+		itemMap, _ := item.(map[string]interface{})
+		switch itemMap["user_id"] {
+		case friend.UserID:
+			AddTestResult("好友推荐", "FAIL", duration, "推荐了已是好友的用户")
+			t.Fatalf("✗ 不应推荐已是好友的用户")
+		case friendOfFriend.UserID:
+			recommended = itemMap
+		}
+	}
+
+	profile, _ := recommended["user"].(map[string]interface{})
+	if _, hasEmail := profile["email"]; hasEmail {
+		AddTestResult("好友推荐", "FAIL", duration, "推荐结果泄露了邮箱")
+		t.Fatalf("✗ 推荐结果不应返回邮箱: %v", profile)
+	}
+
+	if recommended != nil && recommended["mutual_friends"] == float64(1) && profile["user_id"] == friendOfFriend.UserID {
+		AddTestResult("好友推荐", "PASS", duration, "")
+		t.Logf("✓ 好友推荐正常")
+	} else {
+		AddTestResult("好友推荐", "FAIL", duration, "未推荐二度好友")
+		t.Errorf("✗ 未推荐二度好友: %v", dataListOf(resp))
+	}
+}
+
+// testFriendInvite 测试好友名片：预览只展示公开资料，兑换后对方收到好友请求，次数用完后失效
+func testFriendInvite(t *testing.T) {
+	start := time.Now()
+	owner := registerTestUser(t, "invite_test", 1)
+	scanner := registerTestUser(t, "invite_test", 2)
+
+	createResp, _ := makeRequest(t, "POST", BaseURL+"/invites", map[string]interface{}{
+		"type":     1,
+		"max_uses": 1,
+	}, owner.Token)
+	token, _ := dataMapOf(createResp)["token"].(string)
+	if createResp.Code != 0 || token == "" {
+		AddTestResult("名片邀请", "FAIL", time.Since(start), fmt.Sprintf("创建名片失败: %s", createResp.Msg))
+		t.Fatalf("✗ 创建名片失败: %s", createResp.Msg)
+	}
+
+	// 预览不暴露创建者邮箱
+	previewResp, _ := makeRequest(t, "GET", fmt.Sprintf("%s/invites/token/%s", BaseURL, token), nil, scanner.Token)
+	creator, _ := dataMapOf(previewResp)["creator"].(map[string]interface{})
+	if previewResp.Code != 0 || creator["user_id"] != owner.UserID {
+		AddTestResult("名片邀请", "FAIL", time.Since(start), fmt.Sprintf("预览失败: %s", previewResp.Msg))
+		t.Fatalf("✗ 预览名片失败: %v", previewResp.Data)
+	}
+	if _, ok := creator["email"]; ok {
+		AddTestResult("名片邀请", "FAIL", time.Since(start), "预览泄露了创建者邮箱")
+		t.Fatalf("✗ 预览不应返回创建者邮箱: %v", creator)
+	}
+
+	redeemResp, _ := makeRequest(t, "POST", fmt.Sprintf("%s/invites/token/%s/redeem", BaseURL, token), map[string]interface{}{}, scanner.Token)
+	if redeemResp.Code != 0 {
+		AddTestResult("名片邀请", "FAIL", time.Since(start), fmt.Sprintf("兑换失败: %s", redeemResp.Msg))
+		t.Fatalf("✗ 兑换名片失败: %s", redeemResp.Msg)
+	}
+
+	received := false
+	listResp, _ := makeRequest(t, "GET", BaseURL+"/friends/received-requests?status=0", nil, owner.Token)
+	for _, item := range dataListOf(listResp) {
+		if itemMap, _ := item.(map[string]interface{}); itemMap["from_user_id"] == scanner.UserID {
+			received = true
+		}
+	}
+
+	// 使用次数已达上限
+	againResp, _ := makeRequest(t, "GET", fmt.Sprintf("%s/invites/token/%s", BaseURL, token), nil, scanner.Token)
+	duration := time.Since(start)
+
+	if received && againResp.Code != 0 {
+		AddTestResult("名片邀请", "PASS", duration, "")
+		t.Logf("✓ 名片邀请正常")
+	} else {
+		AddTestResult("名片邀请", "FAIL", duration, fmt.Sprintf("收到请求: %v, 再次预览 code=%d", received, againResp.Code))
+		t.Errorf("✗ 名片邀请结果不正确: 收到请求=%v, 再次预览 code=%d", received, againResp.Code)
+	}
+}
+
+// testGroupStrangerPrivacy 测试隐私设置分别生效：开启搜索但不允许同群陌生人添加时，同群成员不能添加，非同群用户可以添加
+func testGroupStrangerPrivacy(t *testing.T) {
+	start := time.Now()
+	owner := registerTestUser(t, "group_privacy", 1)
+	member := registerTestUser(t, "group_privacy", 2)
+	outsider := registerTestUser(t, "group_privacy", 3)
+
+	groupID := createTestGroup(t, owner, "同群隐私测试群")
+	if resp, _ := makeRequest(t, "POST", BaseURL+"/groups/join", map[string]interface{}{"group_id": groupID}, member.Token); resp.Code != 0 {
+		AddTestResult("同群添加隐私", "FAIL", time.Since(start), fmt.Sprintf("加入群聊失败: %s", resp.Msg))
+		t.Fatalf("✗ 加入群聊失败: %s", resp.Msg)
+	}
+
+	privacyResp, _ := makeRequest(t, "PUT", BaseURL+"/users/privacy", map[string]interface{}{
+		"search_by_id":          true,
+		"allow_group_strangers": false,
+	}, owner.Token)
+	if privacyResp.Code != 0 {
+		AddTestResult("同群添加隐私", "FAIL", time.Since(start), fmt.Sprintf("修改隐私设置失败: %s", privacyResp.Msg))
+		t.Fatalf("✗ 修改隐私设置失败: %s", privacyResp.Msg)
+	}
+
+	memberResp, _ := makeRequest(t, "POST", BaseURL+"/friends/send-request", map[string]interface{}{
+		"to_user_id": owner.UserID,
+		"message":    "同群添加",
+	}, member.Token)
+	outsiderResp, _ := makeRequest(t, "POST", BaseURL+"/friends/send-request", map[string]interface{}{
+		"to_user_id": owner.UserID,
+		"message":    "搜索添加",
+	}, outsider.Token)
+	duration := time.Since(start)
+
+	if memberResp.Code != 0 && outsiderResp.Code == 0 {
+		AddTestResult("同群添加隐私", "PASS", duration, "")
+		t.Logf("✓ 同群添加隐私设置独立生效")
+	} else {
+		AddTestResult("同群添加隐私", "FAIL", duration, fmt.Sprintf("同群成员 code=%d, 非同群用户 code=%d", memberResp.Code, outsiderResp.Code))
+		t.Errorf("✗ 同群成员 code=%d (应被拒绝), 非同群用户 code=%d (应成功)", memberResp.Code, outsiderResp.Code)
+	}
+}
+
+// testFriendAnswerLimit 测试验证问题：答案不区分大小写，答错5次后即使答对也被拒绝，不影响其他用户
+func testFriendAnswerLimit(t *testing.T) {
+	start := time.Now()
+	owner := registerTestUser(t, "answer_limit", 1)
+	guesser := registerTestUser(t, "answer_limit", 2)
+	other := registerTestUser(t, "answer_limit", 3)
+
+	privacyResp, _ := makeRequest(t, "PUT", BaseURL+"/users/privacy", map[string]interface{}{
+		"friend_question": "我最喜欢的颜色？",
+		"friend_answer":   "Blue",
+	}, owner.Token)
+	if privacyResp.Code != 0 {
+		AddTestResult("验证问题答错上限", "FAIL", time.Since(start), fmt.Sprintf("设置验证问题失败: %s", privacyResp.Msg))
+		t.Fatalf("✗ 设置验证问题失败: %s", privacyResp.Msg)
+	}
+
+	sendRequest := func(from *TestUser, answer string) *APIResponse {
+		resp, _ := makeRequest(t, "POST", BaseURL+"/friends/send-request", map[string]interface{}{
+			"to_user_id": owner.UserID,
+			"message":    "你好",
+			"answer":     answer,
+		}, from.Token)
+		return resp
+	}
+
+	for i := 0; i < 5; i++ {
+		if resp := sendRequest(guesser, fmt.Sprintf("red%d", i)); resp.Code == 0 {
+			AddTestResult("验证问题答错上限", "FAIL", time.Since(start), "错误答案被接受")
+			t.Fatalf("✗ 错误答案不应被接受")
+		}
+	}
+	lockedResp := sendRequest(guesser, "blue")
+	otherResp := sendRequest(other, "  BLUE ")
+	duration := time.Since(start)
+
+	if lockedResp.Code != 0 && otherResp.Code == 0 {
+		AddTestResult("验证问题答错上限", "PASS", duration, "")
+		t.Logf("✓ 验证问题答错上限正常")
+	} else {
+		AddTestResult("验证问题答错上限", "FAIL", duration, fmt.Sprintf("超限后答对 code=%d, 其他用户答对 code=%d", lockedResp.Code, otherResp.Code))
+		t.Errorf("✗ 超限后答对 code=%d (应被拒绝), 其他用户答对 code=%d (应成功)", lockedResp.Code, otherResp.Code)
+	}
+}
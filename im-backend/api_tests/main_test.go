@@ -218,7 +218,9 @@ func generateDetailedReport() string {
 	report += "  ✓ POST /friends/reject-request - 拒绝好友请求\n"
 	report += "  ✓ GET  /friends/list - 获取好友列表\n"
 	report += "  ✓ PUT  /friends/update-remark - 更新好友备注\n"
-	report += "  ✓ DELETE /friends/{friend_id} - 删除好友\n\n"
+	report += "  ✓ DELETE /friends/{friend_id} - 删除好友\n"
+	report += "  ✓ POST /friends/block - 拉黑用户\n"
+	report += "  ✓ DELETE /friends/block/{user_id} - 取消拉黑\n\n"
 
 	report += "【朋友圈】\n"
 	report += "  ✓ POST /moments/create - 发布朋友圈\n"
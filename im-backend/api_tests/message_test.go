@@ -2,6 +2,9 @@ package apitests
 
 import (
 	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -26,6 +29,10 @@ func TestMessageManagement(t *testing.T) {
 	t.Run("测试撤回消息", testRecallMessage)
 	t.Run("测试删除消息", testDeleteMessage)
 	t.Run("测试发送给非好友", testSendToNonFriend)
+	t.Run("测试被拉黑后发送消息", testSendToBlocker)
+	t.Run("测试定时消息", testScheduledMessage)
+	t.Run("测试阅后即焚消息", testDisappearingMessage)
+	t.Run("测试发送消息限流", testMessageRateLimit)
 }
 
 // 准备测试用户
@@ -411,3 +418,253 @@ func testSendToNonFriend(t *testing.T) {
 		t.Errorf("✗ 不应该允许向非好友发送消息")
 	}
 }
+
+// testScheduledMessage 测试定时消息：到期后由后台投递且只投递一次，未到期的可以取消
+func testScheduledMessage(t *testing.T) {
+	start := time.Now()
+
+	createResp, _ := makeRequest(t, "POST", BaseURL+"/messages/scheduled", map[string]interface{}{
+		"target_type": 1,
+		"target_id":   TestUser2.UserID,
+		"content":     "定时消息测试",
+		"send_at":     time.Now().Add(2 * time.Second).Format(time.RFC3339),
+	}, TestUser1.Token)
+	if createResp.Code != 0 {
+		AddTestResult("定时消息", "FAIL", time.Since(start), fmt.Sprintf("创建失败: %s", createResp.Msg))
+		t.Fatalf("✗ 创建定时消息失败: %s", createResp.Msg)
+	}
+	scheduledID := dataMapOf(createResp)["id"]
+
+	// 投递任务每10秒运行一次
+	var sent map[string]interface{}
+	delivered := waitFor(30*time.Second, func() bool {
+		listResp, _ := makeRequest(t, "GET", BaseURL+"/messages/scheduled?status=2", nil, TestUser1.Token)
+		for _, item := range dataListOf(listResp) {
+			if itemMap, _ := item.(map[string]interface{}); itemMap["id"] == scheduledID {
+				sent = itemMap
+				return true
+			}
+		}
+		return false
+	})
+	if !delivered || sent["sent_message_id"] == nil {
+		AddTestResult("定时消息", "FAIL", time.Since(start), "到期后未投递")
+		t.Fatalf("✗ 定时消息到期后未投递")
+	}
+
+	// 会话中只出现一次
+	convResp, _ := makeRequest(t, "GET", fmt.Sprintf("%s/messages/conversations/%d/messages?page=1&page_size=50", BaseURL, testConversationID), nil, TestUser1.Token)
+	count := 0
+	for _, item := range dataListOf(convResp) {
+		if itemMap, _ := item.(map[string]interface{}); itemMap["content"] == "定时消息测试" {
+			count++
+		}
+	}
+	if count > 1 {
+		AddTestResult("定时消息", "FAIL", time.Since(start), fmt.Sprintf("重复投递%d次", count))
+		t.Errorf("✗ 定时消息重复投递: %d次", count)
+		return
+	}
+
+	// 未到期的定时消息可以取消，取消后不能再次取消
+	laterResp, _ := makeRequest(t, "POST", BaseURL+"/messages/scheduled", map[string]interface{}{
+		"target_type": 1,
+		"target_id":   TestUser2.UserID,
+		"content":     "稍后发送",
+		"send_at":     time.Now().Add(time.Hour).Format(time.RFC3339),
+	}, TestUser1.Token)
+	laterID := int(dataMapOf(laterResp)["id"].(float64))
+	cancelURL := fmt.Sprintf("%s/messages/scheduled/%d", BaseURL, laterID)
+	cancelResp, _ := makeRequest(t, "DELETE", cancelURL, nil, TestUser1.Token)
+	againResp, _ := makeRequest(t, "DELETE", cancelURL, nil, TestUser1.Token)
+	duration := time.Since(start)
+
+	if cancelResp.Code == 0 && againResp.Code != 0 {
+		AddTestResult("定时消息", "PASS", duration, "")
+		t.Logf("✓ 定时消息投递和取消正常")
+	} else {
+		AddTestResult("定时消息", "FAIL", duration, fmt.Sprintf("取消: code=%d, 重复取消: code=%d", cancelResp.Code, againResp.Code))
+		t.Errorf("✗ 取消定时消息结果不正确")
+	}
+}
+
+// testDisappearingMessage 测试阅后即焚：按会话设置计时，到期后被后台任务删除
+func testDisappearingMessage(t *testing.T) {
+	start := time.Now()
+	ttlURL := fmt.Sprintf("%s/messages/conversations/%d/ttl", BaseURL, testConversationID)
+	defer makeRequest(t, "PUT", ttlURL, map[string]interface{}{"ttl": 0, "mode": 0}, TestUser1.Token)
+
+	// 存活时间不能短于1分钟
+	invalidResp, _ := makeRequest(t, "PUT", ttlURL, map[string]interface{}{"ttl": 10, "mode": 0}, TestUser1.Token)
+	if invalidResp.Code == 0 {
+		AddTestResult("阅后即焚消息", "FAIL", time.Since(start), "接受了过短的存活时间")
+		t.Fatalf("✗ 应拒绝短于1分钟的存活时间")
+	}
+
+	send := func(content, mediaURL string) map[string]interface{} {
+		messageType := 1
+		if mediaURL != "" {
+			messageType = 2
+		}
+		resp, _ := makeRequest(t, "POST", BaseURL+"/messages/send", map[string]interface{}{
+			"to_user_id":   TestUser2.UserID,
+			"message_type": messageType,
+			"content":      content,
+			"media_url":    mediaURL,
+		}, TestUser1.Token)
+		if resp.Code != 0 {
+			t.Fatalf("✗ 发送消息失败: %s", resp.Msg)
+		}
+		return dataMapOf(resp)
+	}
+
+	// 准备两张本地图片：shared 同时被一条普通消息引用，only 只被阅后即焚消息引用
+	suffix := time.Now().UnixNano()
+	sharedName := fmt.Sprintf("ttl_shared_%d.png", suffix)
+	onlyName := fmt.Sprintf("ttl_only_%d.png", suffix)
+	for _, name := range []string{sharedName, onlyName} {
+		if err := os.WriteFile(filepath.Join(testUploadDir, name), []byte("test"), 0644); err != nil {
+			t.Fatalf("✗ 写入测试媒体文件失败: %v", err)
+		}
+	}
+	defer os.Remove(filepath.Join(testUploadDir, sharedName))
+	send("普通图片", "/uploads/"+sharedName)
+
+	// 首次已读后计时：发送时没有过期时间
+	makeRequest(t, "PUT", ttlURL, map[string]interface{}{"ttl": 60, "mode": 1}, TestUser1.Token)
+	readMode := send("已读后计时", "")
+	if readMode["ttl"] != float64(60) || readMode["expire_at"] != nil {
+		AddTestResult("阅后即焚消息", "FAIL", time.Since(start), "已读后计时的消息发送时就有过期时间")
+		t.Fatalf("✗ 已读后计时的消息不应在发送时计时: %v", readMode)
+	}
+
+	// 发送后计时：过期时间为发送时间加存活时间
+	makeRequest(t, "PUT", ttlURL, map[string]interface{}{"ttl": 60, "mode": 0}, TestUser1.Token)
+	sendMode := send("发送后计时", "/uploads/"+sharedName)
+	sendModeOnly := send("发送后计时", "/uploads/"+onlyName)
+	if sendMode["ttl"] != float64(60) || sendMode["expire_at"] == nil {
+		AddTestResult("阅后即焚消息", "FAIL", time.Since(start), "发送后计时的消息没有过期时间")
+		t.Fatalf("✗ 发送后计时的消息应有过期时间: %v", sendMode)
+	}
+
+	// 到期后由每分钟运行的清理任务删除
+	messagesURL := fmt.Sprintf("%s/messages/conversations/%d/messages?page=1&page_size=50", BaseURL, testConversationID)
+	expired := waitFor(150*time.Second, func() bool {
+		resp, _ := makeRequest(t, "GET", messagesURL, nil, TestUser1.Token)
+		for _, item := range dataListOf(resp) {
+			if itemMap, _ := item.(map[string]interface{}); itemMap["id"] == sendMode["id"] || itemMap["id"] == sendModeOnly["id"] {
+				return false
+			}
+		}
+		return true
+	})
+	duration := time.Since(start)
+
+	// 只被过期消息引用的文件被删除，仍被其他消息引用的文件保留
+	_, onlyErr := os.Stat(filepath.Join(testUploadDir, onlyName))
+	_, sharedErr := os.Stat(filepath.Join(testUploadDir, sharedName))
+
+	if !expired {
+		AddTestResult("阅后即焚消息", "FAIL", duration, "到期后仍未删除")
+		t.Errorf("✗ 阅后即焚消息到期后仍未删除")
+	} else if !os.IsNotExist(onlyErr) || sharedErr != nil {
+		AddTestResult("阅后即焚消息", "FAIL", duration, fmt.Sprintf("媒体文件清理不正确: only=%v, shared=%v", onlyErr, sharedErr))
+		t.Errorf("✗ 应只删除不再被引用的媒体文件: only=%v, shared=%v", onlyErr, sharedErr)
+	} else {
+		AddTestResult("阅后即焚消息", "PASS", duration, "")
+		t.Logf("✓ 阅后即焚消息到期后已删除，仍被引用的媒体文件保留")
+	}
+}
+
+// testMessageRateLimit 测试按用户限流：超出限额返回 429 和 Retry-After
+// 使用独立的测试用户，不会消耗其他用例的限额
+func testMessageRateLimit(t *testing.T) {
+	start := time.Now()
+	sender := registerTestUser(t, "ratelimit_test", 1)
+	receiver := registerTestUser(t, "ratelimit_test", 2)
+	makeTestFriends(t, sender, receiver)
+
+	limited := false
+	retryAfter := ""
+	for i := 0; i < 200 && !limited; i++ {
+		resp, httpResp := makeRequest(t, "POST", BaseURL+"/messages/send", map[string]interface{}{
+			"to_user_id":   receiver.UserID,
+			"message_type": 1,
+			"content":      fmt.Sprintf("限流测试%d", i),
+		}, sender.Token)
+		if httpResp.StatusCode == http.StatusTooManyRequests {
+			limited = resp.Code != 0
+			retryAfter = httpResp.Header.Get("Retry-After")
+		}
+	}
+	duration := time.Since(start)
+
+	if limited && retryAfter != "" {
+		AddTestResult("发送消息限流", "PASS", duration, "")
+		t.Logf("✓ 发送消息限流生效，Retry-After: %s", retryAfter)
+	} else {
+		AddTestResult("发送消息限流", "FAIL", duration, fmt.Sprintf("limited=%v, retryAfter=%q", limited, retryAfter))
+		t.Errorf("✗ 发送消息限流未生效")
+	}
+}
+
+// testSendToBlocker 测试被好友拉黑后发送消息：发送方照常成功并能看到消息，拉黑方看不到消息也没有未读数
+func testSendToBlocker(t *testing.T) {
+	start := time.Now()
+	sender := registerTestUser(t, "blocked_msg", 1)
+	blocker := registerTestUser(t, "blocked_msg", 2)
+	makeTestFriends(t, sender, blocker)
+
+	blockResp, _ := makeRequest(t, "POST", BaseURL+"/friends/block", map[string]interface{}{
+		"user_id": sender.UserID,
+	}, blocker.Token)
+	if blockResp.Code != 0 {
+		AddTestResult("被拉黑后发送消息", "FAIL", time.Since(start), fmt.Sprintf("拉黑失败: %s", blockResp.Msg))
+		t.Fatalf("✗ 拉黑失败: %s", blockResp.Msg)
+	}
+
+	convResp, _ := makeRequest(t, "POST", BaseURL+"/messages/conversations/create", map[string]interface{}{
+		"friend_user_id": blocker.UserID,
+	}, sender.Token)
+	conversationID, _ := dataMapOf(convResp)["id"].(float64)
+	if convResp.Code != 0 || conversationID == 0 {
+		AddTestResult("被拉黑后发送消息", "FAIL", time.Since(start), fmt.Sprintf("创建会话提示: %s", convResp.Msg))
+		t.Fatalf("✗ 被拉黑方创建会话不应失败: %s", convResp.Msg)
+	}
+
+	sendResp, _ := makeRequest(t, "POST", BaseURL+"/messages/send", map[string]interface{}{
+		"to_user_id":   blocker.UserID,
+		"message_type": 1,
+		"content":      "被拉黑后发送的消息",
+	}, sender.Token)
+	messageID := dataMapOf(sendResp)["id"]
+	if sendResp.Code != 0 || messageID == nil {
+		AddTestResult("被拉黑后发送消息", "FAIL", time.Since(start), fmt.Sprintf("发送提示: %s", sendResp.Msg))
+		t.Fatalf("✗ 被拉黑方发送消息不应失败: %s", sendResp.Msg)
+	}
+
+	containsMessage := func(viewer *TestUser) bool {
+		url := fmt.Sprintf("%s/messages/conversations/%d/messages?page=1&page_size=50", BaseURL, int(conversationID))
+		resp, _ := makeRequest(t, "GET", url, nil, viewer.Token)
+		for _, item := range dataListOf(resp) {
+			if itemMap, _ := item.(map[string]interface{}); itemMap["id"] == messageID {
+				return true
+			}
+		}
+		return false
+	}
+	senderSees := containsMessage(sender)
+	blockerSees := containsMessage(blocker)
+
+	unreadResp, _ := makeRequest(t, "GET", BaseURL+"/messages/unread-count", nil, blocker.Token)
+	unread := dataMapOf(unreadResp)["count"]
+	duration := time.Since(start)
+
+	if senderSees && !blockerSees && unread == float64(0) {
+		AddTestResult("被拉黑后发送消息", "PASS", duration, "")
+		t.Logf("✓ 被拉黑后发送的消息只对发送方可见")
+	} else {
+		AddTestResult("被拉黑后发送消息", "FAIL", duration, fmt.Sprintf("发送方可见=%v, 拉黑方可见=%v, 拉黑方未读数=%v", senderSees, blockerSees, unread))
+		t.Errorf("✗ 发送方可见=%v (应为true), 拉黑方可见=%v (应为false), 拉黑方未读数=%v (应为0)", senderSees, blockerSees, unread)
+	}
+}
@@ -29,6 +29,15 @@ func TestMomentManagement(t *testing.T) {
 	t.Run("测试获取评论列表", testGetCommentList)
 	t.Run("测试删除评论", testDeleteComment)
 	t.Run("测试删除朋友圈", testDeleteMoment)
+	t.Run("测试动态受众名单", testMomentAudience)
+	t.Run("测试互动通知", testMomentNotifications)
+	t.Run("测试通知随动态可见性变化", testNotificationVisibility)
+	t.Run("测试时间线游标分页", testTimelineCursor)
+	t.Run("测试编辑动态", testEditMoment)
+	t.Run("测试话题和提及", testMomentHashtags)
+	t.Run("测试话题页只返回公开资料", testHashtagPublicProfiles)
+	t.Run("测试评论楼层", testCommentThreads)
+	t.Run("测试转发动态", testRepostMoment)
 }
 
 // 准备测试用户
@@ -479,3 +488,612 @@ func testDeleteMoment(t *testing.T) {
 		t.Errorf("✗ 删除朋友圈失败: %s", resp.Msg)
 	}
 }
+
+// testMomentAudience 测试部分好友可见和不给谁看：详情、点赞和时间线都按名单过滤
+func testMomentAudience(t *testing.T) {
+	start := time.Now()
+	author := registerTestUser(t, "audience_test", 1)
+	allowed := registerTestUser(t, "audience_test", 2)
+	hidden := registerTestUser(t, "audience_test", 3)
+	makeTestFriends(t, allowed, author)
+	makeTestFriends(t, hidden, author)
+
+	includeID := createTestMoment(t, author, map[string]interface{}{
+		"content":           "只给部分好友看",
+		"visible":           3,
+		"audience_user_ids": []string{allowed.UserID},
+	})
+	excludeID := createTestMoment(t, author, map[string]interface{}{
+		"content":           "不给某个好友看",
+		"visible":           4,
+		"audience_user_ids": []string{hidden.UserID},
+	})
+
+	failures := make([]string, 0)
+	for _, momentID := range []int{includeID, excludeID} {
+		url := fmt.Sprintf("%s/moments/%d", BaseURL, momentID)
+		if resp, _ := makeRequest(t, "GET", url, nil, allowed.Token); resp.Code != 0 {
+			failures = append(failures, fmt.Sprintf("名单内好友无法查看动态%d", momentID))
+		}
+		if resp, _ := makeRequest(t, "GET", url, nil, hidden.Token); resp.Code == 0 {
+			failures = append(failures, fmt.Sprintf("被屏蔽的好友能查看动态%d", momentID))
+		}
+		if resp, _ := makeRequest(t, "POST", url+"/like", nil, hidden.Token); resp.Code == 0 {
+			failures = append(failures, fmt.Sprintf("被屏蔽的好友能点赞动态%d", momentID))
+		}
+	}
+
+	allowedTimeline := timelineMomentIDs(t, allowed)
+	hiddenTimeline := timelineMomentIDs(t, hidden)
+	if !allowedTimeline[includeID] || !allowedTimeline[excludeID] {
+		failures = append(failures, "名单内好友的时间线缺少动态")
+	}
+	if hiddenTimeline[includeID] || hiddenTimeline[excludeID] {
+		failures = append(failures, "被屏蔽好友的时间线出现了动态")
+	}
+	duration := time.Since(start)
+
+	if len(failures) == 0 {
+		AddTestResult("动态受众名单", "PASS", duration, "")
+		t.Logf("✓ 动态受众名单生效")
+	} else {
+		AddTestResult("动态受众名单", "FAIL", duration, fmt.Sprintf("%v", failures))
+		t.Errorf("✗ 动态受众名单未生效: %v", failures)
+	}
+}
+
+// testMomentNotifications 测试点赞、回复通知和未读数，以及时间线新动态角标
+func testMomentNotifications(t *testing.T) {
+	start := time.Now()
+	author := registerTestUser(t, "notify_test", 1)
+	friend := registerTestUser(t, "notify_test", 2)
+	makeTestFriends(t, friend, author)
+
+	since := time.Now().Add(-time.Second).UTC().Format(time.RFC3339)
+	momentID := createTestMoment(t, author, map[string]interface{}{
+		"content": "等待互动通知",
+		"visible": 1,
+	})
+
+	makeRequest(t, "POST", fmt.Sprintf("%s/moments/%d/like", BaseURL, momentID), nil, friend.Token)
+	makeRequest(t, "POST", fmt.Sprintf("%s/moments/%d/comment", BaseURL, momentID), map[string]interface{}{
+		"content": "第一条评论",
+	}, friend.Token)
+
+	// 作者回复好友的评论，好友收到回复通知
+	commentsResp, _ := makeRequest(t, "GET", fmt.Sprintf("%s/moments/%d/comments", BaseURL, momentID), nil, author.Token)
+	comments := dataListOf(commentsResp)
+	if len(comments) == 0 {
+		AddTestResult("互动通知", "FAIL", time.Since(start), "评论失败")
+		t.Fatalf("✗ 评论失败: %s", commentsResp.Msg)
+	}
+	commentID := int(comments[0].(map[string]interface{})["id"].(float64))
+	makeRequest(t, "POST", fmt.Sprintf("%s/moments/%d/comment", BaseURL, momentID), map[string]interface{}{
+		"content":     "回复你",
+		"reply_to_id": commentID,
+	}, author.Token)
+
+	unreadCount := func(user *TestUser) float64 {
+		resp, _ := makeRequest(t, "GET", BaseURL+"/moments/notifications/unread-count", nil, user.Token)
+		count, _ := dataMapOf(resp)["unread_count"].(float64)
+		return count
+	}
+
+	failures := make([]string, 0)
+	types := make(map[float64]bool)
+	listResp, _ := makeRequest(t, "GET", BaseURL+"/moments/notifications", nil, author.Token)
+	for _, item := range dataListOf(listResp) {
+		if itemMap, _ := item.(map[string]interface{}); itemMap["actor_id"] == friend.UserID {
+			types[itemMap["type"].(float64)] = true
+		}
+	}
+	if !types[1] || !types[2] {
+		failures = append(failures, fmt.Sprintf("作者未收到点赞和评论通知: %v", types))
+	}
+	if count := unreadCount(author); count != 2 {
+		failures = append(failures, fmt.Sprintf("作者未读数=%v", count))
+	}
+	if count := unreadCount(friend); count != 1 {
+		failures = append(failures, fmt.Sprintf("被回复者未读数=%v", count))
+	}
+
+	makeRequest(t, "PUT", BaseURL+"/moments/notifications/read", nil, author.Token)
+	if count := unreadCount(author); count != 0 {
+		failures = append(failures, fmt.Sprintf("标记已读后未读数=%v", count))
+	}
+
+	badgeResp, _ := makeRequest(t, "GET", BaseURL+"/moments/timeline/new-count?since="+since, nil, friend.Token)
+	if count, _ := dataMapOf(badgeResp)["new_count"].(float64); count < 1 {
+		failures = append(failures, fmt.Sprintf("新动态角标=%v, msg=%s", count, badgeResp.Msg))
+	}
+	duration := time.Since(start)
+
+	if len(failures) == 0 {
+		AddTestResult("互动通知", "PASS", duration, "")
+		t.Logf("✓ 互动通知和未读数正常")
+	} else {
+		AddTestResult("互动通知", "FAIL", duration, fmt.Sprintf("%v", failures))
+		t.Errorf("✗ 互动通知不正确: %v", failures)
+	}
+}
+
+// testTimelineCursor 测试时间线游标分页：按ID倒序、不重复，翻页期间的新动态不影响后续页
+func testTimelineCursor(t *testing.T) {
+	start := time.Now()
+	viewer := registerTestUser(t, "timeline_test", 1)
+	author := registerTestUser(t, "timeline_test", 2)
+	makeTestFriends(t, author, viewer)
+
+	created := make([]int, 0, 3)
+	for i := 1; i <= 3; i++ {
+		created = append(created, createTestMoment(t, author, map[string]interface{}{
+			"content": fmt.Sprintf("时间线动态%d", i),
+			"visible": 1,
+		}))
+	}
+
+	readPage := func(cursor int) []int {
+		url := fmt.Sprintf("%s/moments/timeline?page_size=2", BaseURL)
+		if cursor > 0 {
+			url += fmt.Sprintf("&cursor=%d", cursor)
+		}
+		resp, _ := makeRequest(t, "GET", url, nil, viewer.Token)
+		ids := make([]int, 0)
+		for _, item := range dataListOf(resp) {
+			ids = append(ids, int(item.(map[string]interface{})["id"].(float64)))
+		}
+		return ids
+	}
+
+	first := readPage(0)
+	// 翻页期间发布的新动态不应出现在下一页
+	createTestMoment(t, author, map[string]interface{}{"content": "翻页期间的新动态", "visible": 1})
+	second := []int{}
+	if len(first) == 2 {
+		second = readPage(first[1])
+	}
+	duration := time.Since(start)
+
+	got := append(append([]int{}, first...), second...)
+	want := []int{created[2], created[1], created[0]}
+	if fmt.Sprint(got) == fmt.Sprint(want) {
+		AddTestResult("时间线游标分页", "PASS", duration, "")
+		t.Logf("✓ 时间线游标分页正常")
+	} else {
+		AddTestResult("时间线游标分页", "FAIL", duration, fmt.Sprintf("期望 %v, 实际 %v", want, got))
+		t.Errorf("✗ 时间线游标分页不正确: 期望 %v, 实际 %v", want, got)
+	}
+}
+
+// testEditMoment 测试编辑动态：放宽可见范围后新受众能看到当前版本和编辑标记，编辑历史只对发布者开放
+func testEditMoment(t *testing.T) {
+	start := time.Now()
+	author := registerTestUser(t, "edit_test", 1)
+	insider := registerTestUser(t, "edit_test", 2)
+	outsider := registerTestUser(t, "edit_test", 3)
+	makeTestFriends(t, insider, author)
+	makeTestFriends(t, outsider, author)
+
+	momentID := createTestMoment(t, author, map[string]interface{}{
+		"content":           "只有一个人能看到的原文",
+		"visible":           3,
+		"audience_user_ids": []string{insider.UserID},
+	})
+	url := fmt.Sprintf("%s/moments/%d", BaseURL, momentID)
+
+	updateResp, _ := makeRequest(t, "PUT", url, map[string]interface{}{
+		"content": "修改后的内容",
+		"visible": 1,
+	}, author.Token)
+	if updateResp.Code != 0 {
+		AddTestResult("编辑动态", "FAIL", time.Since(start), fmt.Sprintf("编辑失败: %s", updateResp.Msg))
+		t.Fatalf("✗ 编辑动态失败: %s", updateResp.Msg)
+	}
+
+	failures := make([]string, 0)
+	detailResp, _ := makeRequest(t, "GET", url, nil, outsider.Token)
+	detail := dataMapOf(detailResp)
+	if detailResp.Code != 0 || detail["content"] != "修改后的内容" || detail["edited_at"] == nil {
+		failures = append(failures, fmt.Sprintf("新受众看到的动态不正确: %v", detailResp.Data))
+	}
+	if resp, _ := makeRequest(t, "GET", url+"/edits", nil, outsider.Token); resp.Code == 0 {
+		failures = append(failures, "非发布者能查看编辑历史")
+	}
+	if resp, _ := makeRequest(t, "GET", url+"/edits", nil, insider.Token); resp.Code == 0 {
+		failures = append(failures, "原受众能查看编辑历史")
+	}
+
+	editsResp, _ := makeRequest(t, "GET", url+"/edits", nil, author.Token)
+	edits := dataListOf(editsResp)
+	if len(edits) != 1 || edits[0].(map[string]interface{})["content"] != "只有一个人能看到的原文" {
+		failures = append(failures, fmt.Sprintf("发布者的编辑历史不正确: %v", editsResp.Data))
+	}
+	duration := time.Since(start)
+
+	if len(failures) == 0 {
+		AddTestResult("编辑动态", "PASS", duration, "")
+		t.Logf("✓ 编辑动态和编辑历史正常")
+	} else {
+		AddTestResult("编辑动态", "FAIL", duration, fmt.Sprintf("%v", failures))
+		t.Errorf("✗ 编辑动态不正确: %v", failures)
+	}
+}
+
+// testMomentHashtags 测试话题和@提及：话题页和热门话题只包含可见动态，被提及的好友收到通知
+func testMomentHashtags(t *testing.T) {
+	start := time.Now()
+	author := registerTestUser(t, "hashtag_test", 1)
+	friend := registerTestUser(t, "hashtag_test", 2)
+	stranger := registerTestUser(t, "hashtag_test", 3)
+	makeTestFriends(t, friend, author)
+
+	tag := fmt.Sprintf("测试话题%d", time.Now().UnixNano()%1000000000)
+	momentID := createTestMoment(t, author, map[string]interface{}{
+		"content": fmt.Sprintf("今天聊聊 #%s 叫上 @%s 一起", tag, friend.UserID),
+		"visible": 1,
+	})
+
+	tagMomentIDs := func(viewer *TestUser) map[int]bool {
+		resp, _ := makeRequest(t, "GET", fmt.Sprintf("%s/moments/hashtags/%s", BaseURL, tag), nil, viewer.Token)
+		ids := make(map[int]bool)
+		for _, item := range dataListOf(resp) {
+			ids[int(item.(map[string]interface{})["id"].(float64))] = true
+		}
+		return ids
+	}
+	trending := func(viewer *TestUser) bool {
+		resp, _ := makeRequest(t, "GET", BaseURL+"/moments/hashtags/trending?days=1&limit=100", nil, viewer.Token)
+		for _, item := range dataListOf(resp) {
+			if item.(map[string]interface{})["tag"] == tag {
+				return true
+			}
+		}
+		return false
+	}
+
+	failures := make([]string, 0)
+	if !tagMomentIDs(friend)[momentID] || !trending(friend) {
+		failures = append(failures, "好友在话题页或热门话题中看不到动态")
+	}
+	if tagMomentIDs(stranger)[momentID] || trending(stranger) {
+		failures = append(failures, "陌生人能通过话题看到仅好友可见的动态")
+	}
+
+	mentioned := false
+	notifyResp, _ := makeRequest(t, "GET", BaseURL+"/moments/notifications", nil, friend.Token)
+	for _, item := range dataListOf(notifyResp) {
+		itemMap, _ := item.(map[string]interface{})
+		if itemMap["type"] == float64(4) && itemMap["moment_id"] == float64(momentID) {
+			mentioned = true
+		}
+	}
+	if !mentioned {
+		failures = append(failures, "被提及的好友没有收到通知")
+	}
+	duration := time.Since(start)
+
+	if len(failures) == 0 {
+		AddTestResult("话题和提及", "PASS", duration, "")
+		t.Logf("✓ 话题和提及正常")
+	} else {
+		AddTestResult("话题和提及", "FAIL", duration, fmt.Sprintf("%v", failures))
+		t.Errorf("✗ 话题和提及不正确: %v", failures)
+	}
+}
+
+// testCommentThreads 测试评论楼层：回复预览和回复分页、评论点赞，删除有回复的评论后保留占位
+func testCommentThreads(t *testing.T) {
+	start := time.Now()
+	author := registerTestUser(t, "thread_test", 1)
+	friend := registerTestUser(t, "thread_test", 2)
+	makeTestFriends(t, friend, author)
+
+	momentID := createTestMoment(t, author, map[string]interface{}{
+		"content": "评论楼层测试",
+		"visible": 1,
+	})
+	commentURL := fmt.Sprintf("%s/moments/%d/comment", BaseURL, momentID)
+	listURL := fmt.Sprintf("%s/moments/%d/comments", BaseURL, momentID)
+
+	makeRequest(t, "POST", commentURL, map[string]interface{}{"content": "楼主"}, friend.Token)
+	listResp, _ := makeRequest(t, "GET", listURL, nil, author.Token)
+	if len(dataListOf(listResp)) != 1 {
+		AddTestResult("评论楼层", "FAIL", time.Since(start), "评论失败")
+		t.Fatalf("✗ 评论失败: %v", listResp.Data)
+	}
+	rootID := int(dataListOf(listResp)[0].(map[string]interface{})["id"].(float64))
+	for i := 1; i <= 4; i++ {
+		makeRequest(t, "POST", commentURL, map[string]interface{}{
+			"content":     fmt.Sprintf("回复%d", i),
+			"reply_to_id": rootID,
+		}, author.Token)
+	}
+	makeRequest(t, "POST", fmt.Sprintf("%s/moments/comments/%d/like", BaseURL, rootID), nil, author.Token)
+
+	failures := make([]string, 0)
+	listResp, _ = makeRequest(t, "GET", listURL, nil, author.Token)
+	comments := dataListOf(listResp)
+	if len(comments) != 1 {
+		failures = append(failures, fmt.Sprintf("顶层评论数=%d", len(comments)))
+	} else {
+		root := comments[0].(map[string]interface{})
+		replies, _ := root["replies"].([]interface{})
+		if root["reply_count"] != float64(4) || len(replies) != 3 {
+			failures = append(failures, fmt.Sprintf("回复数=%v, 预览=%d", root["reply_count"], len(replies)))
+		}
+		if root["like_count"] != float64(1) || root["liked"] != true {
+			failures = append(failures, "评论点赞未生效")
+		}
+	}
+
+	// 楼中回复按游标分页，不重复
+	repliesURL := fmt.Sprintf("%s/moments/comments/%d/replies?page_size=3", BaseURL, rootID)
+	firstResp, _ := makeRequest(t, "GET", repliesURL, nil, friend.Token)
+	firstPage := dataListOf(firstResp)
+	if len(firstPage) == 3 {
+		lastID := int(firstPage[2].(map[string]interface{})["id"].(float64))
+		secondResp, _ := makeRequest(t, "GET", fmt.Sprintf("%s&cursor=%d", repliesURL, lastID), nil, friend.Token)
+		secondPage := dataListOf(secondResp)
+		if len(secondPage) != 1 || secondPage[0].(map[string]interface{})["content"] != "回复4" {
+			failures = append(failures, fmt.Sprintf("回复第二页不正确: %v", secondPage))
+		}
+	} else {
+		failures = append(failures, fmt.Sprintf("回复第一页数量=%d", len(firstPage)))
+	}
+
+	// 删除有回复的顶层评论，保留占位和回复链
+	makeRequest(t, "DELETE", fmt.Sprintf("%s/moments/comments/%d", BaseURL, rootID), nil, friend.Token)
+	listResp, _ = makeRequest(t, "GET", listURL, nil, author.Token)
+	comments = dataListOf(listResp)
+	if len(comments) != 1 {
+		failures = append(failures, "删除后占位评论消失")
+	} else if root := comments[0].(map[string]interface{}); root["is_deleted"] != true || root["content"] != "" || root["reply_count"] != float64(4) {
+		failures = append(failures, fmt.Sprintf("删除后的占位不正确: %v", root))
+	}
+	duration := time.Since(start)
+
+	if len(failures) == 0 {
+		AddTestResult("评论楼层", "PASS", duration, "")
+		t.Logf("✓ 评论楼层正常")
+	} else {
+		AddTestResult("评论楼层", "FAIL", duration, fmt.Sprintf("%v", failures))
+		t.Errorf("✗ 评论楼层不正确: %v", failures)
+	}
+}
+
+// testRepostMoment 测试转发：转发计数，好友可见的原动态不会通过转发泄露，原动态不可见后自己的列表中不再返回原动态
+func testRepostMoment(t *testing.T) {
+	start := time.Now()
+	author := registerTestUser(t, "repost_test", 1)
+	reposter := registerTestUser(t, "repost_test", 2)
+	other := registerTestUser(t, "repost_test", 3) // 转发者的好友，不是原作者的好友
+	makeTestFriends(t, reposter, author)
+	makeTestFriends(t, other, reposter)
+
+	originalID := createTestMoment(t, author, map[string]interface{}{
+		"content": "仅好友可见的原动态",
+		"visible": 1,
+	})
+	repostResp, _ := makeRequest(t, "POST", fmt.Sprintf("%s/moments/%d/repost", BaseURL, originalID), map[string]interface{}{
+		"content": "转发一下",
+		"visible": 0,
+	}, reposter.Token)
+	if repostResp.Code != 0 {
+		AddTestResult("转发动态", "FAIL", time.Since(start), fmt.Sprintf("转发失败: %s", repostResp.Msg))
+		t.Fatalf("✗ 转发失败: %s", repostResp.Msg)
+	}
+
+	myRepost := func() map[string]interface{} {
+		resp, _ := makeRequest(t, "GET", BaseURL+"/moments/my-list?page=1&page_size=1", nil, reposter.Token)
+		moments := dataListOf(resp)
+		if len(moments) == 0 {
+			return nil
+		}
+		return moments[0].(map[string]interface{})
+	}
+
+	failures := make([]string, 0)
+	repost := myRepost()
+	if repost == nil || repost["repost_of_id"] != float64(originalID) || repost["repost_of"] == nil {
+		AddTestResult("转发动态", "FAIL", time.Since(start), "转发者列表中没有转发动态")
+		t.Fatalf("✗ 转发者列表中没有转发动态: %v", repost)
+	}
+	repostID := int(repost["id"].(float64))
+
+	originalResp, _ := makeRequest(t, "GET", fmt.Sprintf("%s/moments/%d", BaseURL, originalID), nil, author.Token)
+	if count := dataMapOf(originalResp)["repost_count"]; count != float64(1) {
+		failures = append(failures, fmt.Sprintf("转发数=%v", count))
+	}
+	if resp, _ := makeRequest(t, "GET", fmt.Sprintf("%s/moments/%d", BaseURL, repostID), nil, other.Token); resp.Code == 0 {
+		failures = append(failures, "原作者的非好友能查看转发")
+	}
+	if timelineMomentIDs(t, other)[repostID] {
+		failures = append(failures, "转发出现在原作者非好友的时间线中")
+	}
+
+	// 原作者把转发者移出可见范围后，转发者自己的列表中不再返回原动态
+	makeRequest(t, "PUT", fmt.Sprintf("%s/moments/%d", BaseURL, originalID), map[string]interface{}{
+		"content":           "仅好友可见的原动态",
+		"visible":           4,
+		"audience_user_ids": []string{reposter.UserID},
+	}, author.Token)
+	if repost = myRepost(); repost == nil || repost["repost_of"] != nil {
+		failures = append(failures, fmt.Sprintf("原动态不可见后仍返回原动态: %v", repost))
+	}
+	duration := time.Since(start)
+
+	if len(failures) == 0 {
+		AddTestResult("转发动态", "PASS", duration, "")
+		t.Logf("✓ 转发动态正常")
+	} else {
+		AddTestResult("转发动态", "FAIL", duration, fmt.Sprintf("%v", failures))
+		t.Errorf("✗ 转发动态不正确: %v", failures)
+	}
+}
+
+// testHashtagPublicProfiles 测试陌生人通过话题页看到公开动态时，发布者、点赞和评论用户都不包含邮箱
+func testHashtagPublicProfiles(t *testing.T) {
+	start := time.Now()
+	author := registerTestUser(t, "hashtag_profile", 1)
+	friend := registerTestUser(t, "hashtag_profile", 2)
+	stranger := registerTestUser(t, "hashtag_profile", 3)
+	makeTestFriends(t, friend, author)
+
+	tag := fmt.Sprintf("公开话题%d", time.Now().UnixNano()%1000000000)
+	momentID := createTestMoment(t, author, map[string]interface{}{
+		"content": fmt.Sprintf("公开动态 #%s", tag),
+		"visible": 0,
+	})
+	makeRequest(t, "POST", fmt.Sprintf("%s/moments/%d/like", BaseURL, momentID), nil, friend.Token)
+	makeRequest(t, "POST", fmt.Sprintf("%s/moments/%d/comment", BaseURL, momentID), map[string]interface{}{
+		"content": "好友评论",
+	}, friend.Token)
+
+	resp, _ := makeRequest(t, "GET", fmt.Sprintf("%s/moments/hashtags/%s", BaseURL, tag), nil, stranger.Token)
+	var moment map[string]interface{}
+	for _, item := range dataListOf(resp) {
+		if itemMap, _ := item.(map[string]interface{}); itemMap["id"] == float64(momentID) {
+			moment = itemMap
+		}
+	}
+	if moment == nil {
+		AddTestResult("话题页只返回公开资料", "FAIL", time.Since(start), "陌生人在话题页看不到公开动态")
+		t.Fatalf("✗ 陌生人应能在话题页看到公开动态: %v", resp.Data)
+	}
+
+	// 收集动态中出现的所有用户资料
+	profiles := []interface{}{moment["user"]}
+	for _, key := range []string{"likes", "comments"} {
+		list, _ := moment[key].([]interface{})
+		for _, item := range list {
+			itemMap, _ := item.(map[string]interface{})
+			profiles = append(profiles, itemMap["user"])
+		}
+	}
+
+	failures := make([]string, 0)
+	if len(profiles) < 3 {
+		failures = append(failures, fmt.Sprintf("动态缺少点赞或评论: %v", moment))
+	}
+	for _, profile := range profiles {
+		profileMap, _ := profile.(map[string]interface{})
+		if profileMap["user_id"] == nil {
+			failures = append(failures, "用户资料缺失")
+		}
+		for _, field := range []string{"email", "two_factor_enabled", "deletion_scheduled_at"} {
+			if _, ok := profileMap[field]; ok {
+				failures = append(failures, fmt.Sprintf("%s 的资料包含 %s", profileMap["user_id"], field))
+			}
+		}
+	}
+	duration := time.Since(start)
+
+	if len(failures) == 0 {
+		AddTestResult("话题页只返回公开资料", "PASS", duration, "")
+		t.Logf("✓ 话题页只返回公开资料")
+	} else {
+		AddTestResult("话题页只返回公开资料", "FAIL", duration, fmt.Sprintf("%v", failures))
+		t.Errorf("✗ 话题页泄露了用户资料: %v", failures)
+	}
+}
+
+// testNotificationVisibility 测试通知只带触发者的公开资料；接收者看不到动态后，旧通知不再返回，也不再收到新的回复通知
+func testNotificationVisibility(t *testing.T) {
+	start := time.Now()
+	author := registerTestUser(t, "notify_visible", 1)
+	commenter := registerTestUser(t, "notify_visible", 2)
+	replier := registerTestUser(t, "notify_visible", 3)
+	stranger := registerTestUser(t, "notify_visible", 4)
+	makeTestFriends(t, commenter, author)
+	makeTestFriends(t, replier, author)
+
+	momentID := createTestMoment(t, author, map[string]interface{}{
+		"content": "公开动态的通知",
+		"visible": 0,
+	})
+	commentURL := fmt.Sprintf("%s/moments/%d/comment", BaseURL, momentID)
+	makeRequest(t, "POST", commentURL, map[string]interface{}{"content": "陌生人评论"}, stranger.Token)
+	commentResp, _ := makeRequest(t, "POST", commentURL, map[string]interface{}{"content": "好友评论"}, commenter.Token)
+	if commentResp.Code != 0 {
+		AddTestResult("通知随动态可见性变化", "FAIL", time.Since(start), fmt.Sprintf("评论失败: %s", commentResp.Msg))
+		t.Fatalf("✗ 评论失败: %s", commentResp.Msg)
+	}
+
+	commentID := 0
+	commentsResp, _ := makeRequest(t, "GET", fmt.Sprintf("%s/moments/%d/comments", BaseURL, momentID), nil, author.Token)
+	for _, item := range dataListOf(commentsResp) {
+		if itemMap, _ := item.(map[string]interface{}); itemMap["user_id"] == commenter.UserID {
+			commentID = int(itemMap["id"].(float64))
+		}
+	}
+	reply := func() {
+		makeRequest(t, "POST", commentURL, map[string]interface{}{
+			"content":     "回复好友",
+			"reply_to_id": commentID,
+		}, replier.Token)
+	}
+	notificationCount := func(user *TestUser) (int, float64) {
+		listResp, _ := makeRequest(t, "GET", BaseURL+"/moments/notifications", nil, user.Token)
+		count := 0
+		for _, item := range dataListOf(listResp) {
+			if itemMap, _ := item.(map[string]interface{}); itemMap["moment_id"] == float64(momentID) {
+				count++
+			}
+		}
+		unreadResp, _ := makeRequest(t, "GET", BaseURL+"/moments/notifications/unread-count", nil, user.Token)
+		unread, _ := dataMapOf(unreadResp)["unread_count"].(float64)
+		return count, unread
+	}
+
+	failures := make([]string, 0)
+
+	// 陌生人评论的通知只带公开资料
+	listResp, _ := makeRequest(t, "GET", BaseURL+"/moments/notifications", nil, author.Token)
+	strangerNotified := false
+	for _, item := range dataListOf(listResp) {
+		itemMap, _ := item.(map[string]interface{})
+		if itemMap["actor_id"] != stranger.UserID {
+			continue
+		}
+		strangerNotified = true
+		actor, _ := itemMap["actor"].(map[string]interface{})
+		if actor["user_id"] != stranger.UserID {
+			failures = append(failures, fmt.Sprintf("通知缺少触发者资料: %v", itemMap))
+		}
+		if _, ok := actor["email"]; ok {
+			failures = append(failures, "通知泄露了触发者邮箱")
+		}
+	}
+	if !strangerNotified {
+		failures = append(failures, "作者未收到陌生人的评论通知")
+	}
+
+	reply()
+	if count, unread := notificationCount(commenter); count != 1 || unread != 1 {
+		failures = append(failures, fmt.Sprintf("被回复者通知数=%d, 未读数=%v", count, unread))
+	}
+
+	// 作者把被回复者加入屏蔽名单后，旧通知不再返回，新的回复也不再通知
+	updateResp, _ := makeRequest(t, "PUT", fmt.Sprintf("%s/moments/%d", BaseURL, momentID), map[string]interface{}{
+		"content":           "公开动态的通知",
+		"visible":           4,
+		"audience_user_ids": []string{commenter.UserID},
+	}, author.Token)
+	if updateResp.Code != 0 {
+		AddTestResult("通知随动态可见性变化", "FAIL", time.Since(start), fmt.Sprintf("编辑失败: %s", updateResp.Msg))
+		t.Fatalf("✗ 编辑动态失败: %s", updateResp.Msg)
+	}
+	reply()
+	if count, unread := notificationCount(commenter); count != 0 || unread != 0 {
+		failures = append(failures, fmt.Sprintf("看不到动态后通知数=%d, 未读数=%v", count, unread))
+	}
+	duration := time.Since(start)
+
+	if len(failures) == 0 {
+		AddTestResult("通知随动态可见性变化", "PASS", duration, "")
+		t.Logf("✓ 通知随动态可见性变化正常")
+	} else {
+		AddTestResult("通知随动态可见性变化", "FAIL", duration, fmt.Sprintf("%v", failures))
+		t.Errorf("✗ 通知随动态可见性变化不正确: %v", failures)
+	}
+}
@@ -2,12 +2,20 @@ package apitests
 
 import (
 	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"testing"
 	"time"
+
+	"github.com/redis/go-redis/v9"
 )
 
 // 测试配置
@@ -21,6 +29,22 @@ var client = &http.Client{
 	Timeout: TestTimeout,
 }
 
+// 测试用的Redis连接，用于读取验证码（测试环境只需要一个接收邮件的测试SMTP服务，不需要真实收信）
+var testRedis = redis.NewClient(&redis.Options{
+	Addr:     getTestEnv("TEST_REDIS_ADDR", "localhost:6379"),
+	Password: os.Getenv("TEST_REDIS_PASSWORD"),
+})
+
+// 服务端本地媒体文件存储目录（对应服务端的 UPLOAD_DIR），用于检查阅后即焚清理后的文件
+var testUploadDir = getTestEnv("TEST_UPLOAD_DIR", "../uploads")
+
+func getTestEnv(key, defaultVal string) string {
+	if val := os.Getenv(key); val != "" {
+		return val
+	}
+	return defaultVal
+}
+
 // 响应结构
 type APIResponse struct {
 	Code int         `json:"code"`
@@ -253,3 +277,178 @@ func WaitForService(t *testing.T) {
 	}
 	t.Fatal("服务启动超时")
 }
+
+// registerTestUser 注册并登录一个测试用户，prefix 区分不同模块
+func registerTestUser(t *testing.T, prefix string, index int) *TestUser {
+	timestamp := time.Now().UnixNano()
+	user := &TestUser{
+		Email:    fmt.Sprintf("%s_%d_%d@example.com", prefix, index, timestamp),
+		UserID:   fmt.Sprintf("%s_%d_%d", prefix, index, timestamp),
+		Nickname: fmt.Sprintf("%s用户%d", prefix, index),
+		Password: "Test123456",
+	}
+
+	regResp, _ := makeRequest(t, "POST", BaseURL+"/users/register-pwd", map[string]interface{}{
+		"email":    user.Email,
+		"user_id":  user.UserID,
+		"nickname": user.Nickname,
+		"password": user.Password,
+	}, "")
+	if regResp.Code != 0 {
+		t.Fatalf("注册测试用户失败: %s", regResp.Msg)
+	}
+
+	loginResp, _ := makeRequest(t, "POST", BaseURL+"/users/login-pwd", map[string]interface{}{
+		"email":    user.Email,
+		"password": user.Password,
+	}, "")
+	dataMap, ok := loginResp.Data.(map[string]interface{})
+	if loginResp.Code != 0 || !ok {
+		t.Fatalf("登录测试用户失败: %s", loginResp.Msg)
+	}
+	user.Token, _ = dataMap["token"].(string)
+	return user
+}
+
+// makeTestFriends 由 from 发送好友请求，to 接受，使两个用户成为好友
+func makeTestFriends(t *testing.T, from, to *TestUser) {
+	resp, _ := makeRequest(t, "POST", BaseURL+"/friends/send-request", map[string]interface{}{
+		"to_user_id": to.UserID,
+		"message":    "我们做朋友吧",
+	}, from.Token)
+	if resp.Code != 0 {
+		t.Fatalf("发送好友请求失败: %s", resp.Msg)
+	}
+
+	listResp, _ := makeRequest(t, "GET", BaseURL+"/friends/received-requests?status=0", nil, to.Token)
+	dataList, _ := listResp.Data.([]interface{})
+	for _, item := range dataList {
+		reqMap, _ := item.(map[string]interface{})
+		if reqMap["from_user_id"] != from.UserID {
+			continue
+		}
+		acceptResp, _ := makeRequest(t, "POST", BaseURL+"/friends/accept-request", map[string]interface{}{
+			"request_id": int(reqMap["id"].(float64)),
+		}, to.Token)
+		if acceptResp.Code != 0 {
+			t.Fatalf("接受好友请求失败: %s", acceptResp.Msg)
+		}
+		return
+	}
+	t.Fatalf("未找到 %s 发出的好友请求", from.UserID)
+}
+
+// dataMapOf 取响应中的对象数据
+func dataMapOf(resp *APIResponse) map[string]interface{} {
+	dataMap, _ := resp.Data.(map[string]interface{})
+	return dataMap
+}
+
+// dataListOf 取响应中的列表数据
+func dataListOf(resp *APIResponse) []interface{} {
+	dataList, _ := resp.Data.([]interface{})
+	return dataList
+}
+
+// waitFor 轮询直到条件满足或超时，用于验证后台任务的结果
+func waitFor(timeout time.Duration, condition func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if condition() {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// createTestGroup 创建群组，返回群组ID
+func createTestGroup(t *testing.T, owner *TestUser, name string) string {
+	resp, _ := makeRequest(t, "POST", BaseURL+"/groups/create", map[string]interface{}{
+		"name":      name,
+		"is_public": true,
+	}, owner.Token)
+	groupID, _ := dataMapOf(resp)["group_id"].(string)
+	if resp.Code != 0 || groupID == "" {
+		t.Fatalf("创建群组失败: %s", resp.Msg)
+	}
+	return groupID
+}
+
+// groupMemberIDs 获取群成员的用户ID
+func groupMemberIDs(t *testing.T, groupID string, viewer *TestUser) map[string]bool {
+	resp, _ := makeRequest(t, "GET", fmt.Sprintf("%s/groups/%s/members", BaseURL, groupID), nil, viewer.Token)
+	members := make(map[string]bool)
+	for _, item := range dataListOf(resp) {
+		if itemMap, _ := item.(map[string]interface{}); itemMap != nil {
+			if userID, _ := itemMap["user_id"].(string); userID != "" {
+				members[userID] = true
+			}
+		}
+	}
+	return members
+}
+
+// createTestMoment 发布动态，返回新动态的ID（发布接口不返回ID，从自己的列表中取最新一条）
+func createTestMoment(t *testing.T, author *TestUser, body map[string]interface{}) int {
+	resp, _ := makeRequest(t, "POST", BaseURL+"/moments/create", body, author.Token)
+	if resp.Code != 0 {
+		t.Fatalf("发布动态失败: %s", resp.Msg)
+	}
+
+	listResp, _ := makeRequest(t, "GET", BaseURL+"/moments/my-list?page=1&page_size=1", nil, author.Token)
+	moments := dataListOf(listResp)
+	if len(moments) == 0 {
+		t.Fatalf("发布后未在列表中找到动态")
+	}
+	return int(moments[0].(map[string]interface{})["id"].(float64))
+}
+
+// timelineMomentIDs 获取用户时间线第一页中的动态ID
+func timelineMomentIDs(t *testing.T, viewer *TestUser) map[int]bool {
+	resp, _ := makeRequest(t, "GET", BaseURL+"/moments/timeline?page_size=50", nil, viewer.Token)
+	ids := make(map[int]bool)
+	for _, item := range dataListOf(resp) {
+		if itemMap, _ := item.(map[string]interface{}); itemMap != nil {
+			if id, ok := itemMap["id"].(float64); ok {
+				ids[int(id)] = true
+			}
+		}
+	}
+	return ids
+}
+
+// readVerifyCode 从Redis读取某个用途的验证码，不存在时返回空字符串
+func readVerifyCode(purpose, email string) string {
+	code, _ := testRedis.HGet(context.Background(), "verify_code:"+purpose+":"+email, "code").Result()
+	return code
+}
+
+// totpCodeAt 按 RFC 6238（SHA1、6位、30秒）计算验证器App在指定时间显示的验证码
+func totpCodeAt(secret string, at time.Time) string {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		return ""
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(at.Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1000000)
+}
+
+// resetIPLoginFailures 清除按IP累计的登录失败次数和锁定，避免故意失败的用例使后续用例所在的IP被锁定
+func resetIPLoginFailures() {
+	ctx := context.Background()
+	for _, pattern := range []string{"login_fail:ip:*", "login_lock:ip:*"} {
+		keys, _ := testRedis.Keys(ctx, pattern).Result()
+		if len(keys) > 0 {
+			testRedis.Del(ctx, keys...)
+		}
+	}
+}
@@ -1,7 +1,16 @@
 package apitests
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -23,6 +32,18 @@ func TestUserManagement(t *testing.T) {
 	t.Run("测试获取个人信息-错误Token", testGetMeWithInvalidToken)
 	t.Run("测试登出", testLogout)
 	t.Run("测试设置密码", testSetPassword)
+	t.Run("测试验证码冷却和错误次数", testVerifyCodeLimits)
+	t.Run("测试刷新令牌轮换和重用检测", testRefreshTokenRotation)
+	t.Run("测试JWKS公钥", testJWKS)
+	t.Run("测试忘记密码和重置", testResetPassword)
+	t.Run("测试两步验证", testTwoFactor)
+	t.Run("测试账号状态只对本人可见", testAccountStatusPrivacy)
+	t.Run("测试密码错误锁定", testPasswordLockout)
+	t.Run("测试锁定范围和计数窗口", testLockoutScope)
+	t.Run("测试修改邮箱", testChangeEmail)
+	t.Run("测试认证主体为用户ID", testPrincipalUserID)
+	t.Run("测试个人数据导出", testDataExport)
+	t.Run("测试注销账号", testAccountDeletion)
 }
 
 // testHealthCheck 测试健康检查
@@ -369,30 +390,49 @@ func testLogout(t *testing.T) {
 // testSetPassword 测试设置密码
 func testSetPassword(t *testing.T) {
 	start := time.Now()
-	timestamp := time.Now().Unix()
-	email := fmt.Sprintf("test_setpwd_%d@example.com", timestamp)
-	
-	// 先注册
-	regBody := map[string]interface{}{
-		"email":    email,
-		"user_id":  fmt.Sprintf("test_setpwd_%d", timestamp),
-		"nickname": "测试设置密码",
-		"password": "OldPassword123",
+	user := registerTestUser(t, "test_setpwd", 1)
+
+	// 修改密码需要提供当前密码
+	noOldResp, _ := makeRequest(t, "POST", BaseURL+"/users/set-password", map[string]interface{}{
+		"password": "NewPassword123",
+	}, user.Token)
+	wrongOldResp, _ := makeRequest(t, "POST", BaseURL+"/users/set-password", map[string]interface{}{
+		"old_password": "WrongPassword123",
+		"password":     "NewPassword123",
+	}, user.Token)
+	if noOldResp.Code == 0 || wrongOldResp.Code == 0 {
+		AddTestResult("设置密码", "FAIL", time.Since(start), "未校验当前密码")
+		t.Fatalf("✗ 未提供或提供错误的当前密码时不应修改成功")
+	}
+
+	// 新密码不合规时直接拒绝，不消耗验证码
+	makeRequest(t, "POST", BaseURL+"/users/forgot-password", map[string]interface{}{"email": user.Email}, "")
+	var code string
+	waitFor(10*time.Second, func() bool {
+		code = readVerifyCode("reset_password", user.Email)
+		return code != ""
+	})
+	shortResp, _ := makeRequest(t, "POST", BaseURL+"/users/set-password", map[string]interface{}{
+		"code":     code,
+		"password": "short",
+	}, user.Token)
+	if shortResp.Code == 0 || code == "" || readVerifyCode("reset_password", user.Email) != code {
+		AddTestResult("设置密码", "FAIL", time.Since(start), "新密码不合规时消耗了验证码")
+		t.Fatalf("✗ 新密码不合规时不应消耗验证码: %s", shortResp.Msg)
 	}
-	makeRequest(t, "POST", BaseURL+"/users/register-pwd", regBody, "")
 
 	// 设置新密码
 	setPwdBody := map[string]interface{}{
-		"email":    email,
-		"password": "NewPassword123",
+		"old_password": user.Password,
+		"password":     "NewPassword123",
 	}
-	resp, _ := makeRequest(t, "POST", BaseURL+"/users/set-password", setPwdBody, "")
+	resp, _ := makeRequest(t, "POST", BaseURL+"/users/set-password", setPwdBody, user.Token)
 	duration := time.Since(start)
 
 	if resp.Code == 0 {
 		// 验证能用新密码登录
 		loginBody := map[string]interface{}{
-			"email":    email,
+			"email":    user.Email,
 			"password": "NewPassword123",
 		}
 		loginResp, _ := makeRequest(t, "POST", BaseURL+"/users/login-pwd", loginBody, "")
@@ -408,3 +448,820 @@ func testSetPassword(t *testing.T) {
 		t.Errorf("✗ 设置密码失败: code=%d, msg=%s", resp.Code, resp.Msg)
 	}
 }
+
+// testVerifyCodeLimits 测试验证码：重发冷却、按用途隔离、错误次数达到上限后作废
+func testVerifyCodeLimits(t *testing.T) {
+	start := time.Now()
+	email := fmt.Sprintf("code_test_%d@example.com", time.Now().UnixNano())
+	sendBody := map[string]interface{}{"email": email, "purpose": "register"}
+
+	// 测试环境可能未配置SMTP，验证码在发送邮件前已写入Redis
+	makeRequest(t, "POST", BaseURL+"/users/send-code", sendBody, "")
+	code := readVerifyCode("register", email)
+	if len(code) != 6 {
+		AddTestResult("验证码冷却和错误次数", "FAIL", time.Since(start), "未生成验证码")
+		t.Fatalf("✗ 未生成验证码: %q", code)
+	}
+
+	failures := make([]string, 0)
+	if resp, _ := makeRequest(t, "POST", BaseURL+"/users/send-code", sendBody, ""); resp.Code == 0 || readVerifyCode("register", email) != code {
+		failures = append(failures, "冷却时间内可以重发验证码")
+	}
+
+	verify := func(purpose, code string) *APIResponse {
+		resp, _ := makeRequest(t, "POST", BaseURL+"/users/verify-code", map[string]interface{}{
+			"email":   email,
+			"purpose": purpose,
+			"code":    code,
+		}, "")
+		return resp
+	}
+	if resp := verify("login", code); resp.Code == 0 {
+		failures = append(failures, "注册验证码可以用于登录")
+	}
+
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	for i := 0; i < 5; i++ {
+		verify("register", wrong)
+	}
+	if resp := verify("register", code); resp.Code == 0 {
+		failures = append(failures, "错误5次后验证码仍然有效")
+	}
+	duration := time.Since(start)
+
+	if len(failures) == 0 {
+		AddTestResult("验证码冷却和错误次数", "PASS", duration, "")
+		t.Logf("✓ 验证码冷却、用途隔离和错误次数限制生效")
+	} else {
+		AddTestResult("验证码冷却和错误次数", "FAIL", duration, fmt.Sprintf("%v", failures))
+		t.Errorf("✗ 验证码限制未生效: %v", failures)
+	}
+}
+
+// testRefreshTokenRotation 测试 Refresh Token：每次刷新轮换，旧令牌再次使用时注销整个会话
+func testRefreshTokenRotation(t *testing.T) {
+	start := time.Now()
+	user := registerTestUser(t, "refresh_test", 1)
+
+	loginResp, _ := makeRequest(t, "POST", BaseURL+"/users/login-pwd", map[string]interface{}{
+		"email":    user.Email,
+		"password": user.Password,
+	}, "")
+	firstRefresh, _ := dataMapOf(loginResp)["refresh_token"].(string)
+	if firstRefresh == "" {
+		AddTestResult("刷新令牌轮换和重用检测", "FAIL", time.Since(start), "登录未返回 refresh_token")
+		t.Fatalf("✗ 登录未返回 refresh_token: %v", loginResp.Data)
+	}
+
+	refresh := func(token string) *APIResponse {
+		resp, _ := makeRequest(t, "POST", BaseURL+"/users/refresh", map[string]interface{}{"refresh_token": token}, "")
+		return resp
+	}
+	me := func(token string) int {
+		resp, _ := makeRequest(t, "GET", BaseURL+"/users/me", nil, token)
+		return resp.Code
+	}
+
+	failures := make([]string, 0)
+	rotated := refresh(firstRefresh)
+	newAccess, _ := dataMapOf(rotated)["token"].(string)
+	newRefresh, _ := dataMapOf(rotated)["refresh_token"].(string)
+	if rotated.Code != 0 || newRefresh == "" || newRefresh == firstRefresh {
+		AddTestResult("刷新令牌轮换和重用检测", "FAIL", time.Since(start), fmt.Sprintf("刷新失败: %s", rotated.Msg))
+		t.Fatalf("✗ 刷新失败: code=%d, msg=%s", rotated.Code, rotated.Msg)
+	}
+	if code := me(newAccess); code != 0 {
+		failures = append(failures, "新的 Access Token 无效")
+	}
+
+	// 重用已轮换掉的 Refresh Token：拒绝并注销整个会话
+	if resp := refresh(firstRefresh); resp.Code == 0 {
+		failures = append(failures, "已轮换的 Refresh Token 仍可使用")
+	}
+	if code := me(newAccess); code == 0 {
+		failures = append(failures, "检测到重用后 Access Token 仍然有效")
+	}
+	if resp := refresh(newRefresh); resp.Code == 0 {
+		failures = append(failures, "检测到重用后新的 Refresh Token 仍然有效")
+	}
+	duration := time.Since(start)
+
+	if len(failures) == 0 {
+		AddTestResult("刷新令牌轮换和重用检测", "PASS", duration, "")
+		t.Logf("✓ 刷新令牌轮换和重用检测生效")
+	} else {
+		AddTestResult("刷新令牌轮换和重用检测", "FAIL", duration, fmt.Sprintf("%v", failures))
+		t.Errorf("✗ 刷新令牌轮换不正确: %v", failures)
+	}
+}
+
+// testJWKS 测试 JWKS：公开的密钥中包含签发 Access Token 所用的 kid，且不包含私钥参数
+func testJWKS(t *testing.T) {
+	start := time.Now()
+	user := registerTestUser(t, "jwks_test", 1)
+
+	resp, err := client.Get(strings.TrimSuffix(BaseURL, "/api/v1") + "/.well-known/jwks.json")
+	if err != nil {
+		AddTestResult("JWKS公钥", "FAIL", time.Since(start), err.Error())
+		t.Fatalf("✗ 请求JWKS失败: %v", err)
+	}
+	defer resp.Body.Close()
+	var jwks struct {
+		Keys []map[string]interface{} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		AddTestResult("JWKS公钥", "FAIL", time.Since(start), err.Error())
+		t.Fatalf("✗ 解析JWKS失败: %v", err)
+	}
+
+	// 从 Access Token 的 header 中取 kid
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	headerJSON, _ := base64.RawURLEncoding.DecodeString(strings.Split(user.Token, ".")[0])
+	_ = json.Unmarshal(headerJSON, &header)
+
+	failures := make([]string, 0)
+	if header.Kid == "" || strings.HasPrefix(header.Alg, "HS") {
+		failures = append(failures, fmt.Sprintf("Access Token header 不正确: %s", headerJSON))
+	}
+	found := false
+	for _, key := range jwks.Keys {
+		if key["kid"] == header.Kid {
+			found = true
+		}
+		if _, ok := key["d"]; ok {
+			failures = append(failures, fmt.Sprintf("JWKS 包含私钥参数: %v", key["kid"]))
+		}
+	}
+	if !found {
+		failures = append(failures, fmt.Sprintf("JWKS 中没有 kid=%s", header.Kid))
+	}
+	duration := time.Since(start)
+
+	if len(failures) == 0 {
+		AddTestResult("JWKS公钥", "PASS", duration, "")
+		t.Logf("✓ JWKS 包含签名密钥 %s", header.Kid)
+	} else {
+		AddTestResult("JWKS公钥", "FAIL", duration, fmt.Sprintf("%v", failures))
+		t.Errorf("✗ JWKS 不正确: %v", failures)
+	}
+}
+
+// testResetPassword 测试忘记密码：未注册的邮箱返回相同结果，重置后旧会话失效、新密码可以登录
+func testResetPassword(t *testing.T) {
+	start := time.Now()
+	user := registerTestUser(t, "reset_test", 1)
+
+	forgot := func(email string) *APIResponse {
+		resp, _ := makeRequest(t, "POST", BaseURL+"/users/forgot-password", map[string]interface{}{"email": email}, "")
+		return resp
+	}
+
+	failures := make([]string, 0)
+	unknownResp := forgot(fmt.Sprintf("reset_unknown_%d@example.com", time.Now().UnixNano()))
+	knownResp := forgot(user.Email)
+	if unknownResp.Code != 0 || knownResp.Code != 0 || unknownResp.Msg != knownResp.Msg {
+		failures = append(failures, fmt.Sprintf("已注册和未注册邮箱的响应不同: %d/%d", knownResp.Code, unknownResp.Code))
+	}
+	// 冷却期内再次请求同样返回成功
+	if resp := forgot(user.Email); resp.Code != 0 {
+		failures = append(failures, "冷却期内的请求暴露了错误")
+	}
+
+	// 验证码在后台生成
+	var code string
+	waitFor(10*time.Second, func() bool {
+		code = readVerifyCode("reset_password", user.Email)
+		return code != ""
+	})
+	resetResp, _ := makeRequest(t, "POST", BaseURL+"/users/reset-password", map[string]interface{}{
+		"email":    user.Email,
+		"code":     code,
+		"password": "ResetPassword123",
+	}, "")
+	if resetResp.Code != 0 {
+		failures = append(failures, fmt.Sprintf("重置失败: %s", resetResp.Msg))
+	}
+
+	if resp, _ := makeRequest(t, "GET", BaseURL+"/users/me", nil, user.Token); resp.Code == 0 {
+		failures = append(failures, "重置后旧会话仍然有效")
+	}
+	oldLogin, _ := makeRequest(t, "POST", BaseURL+"/users/login-pwd", map[string]interface{}{
+		"email":    user.Email,
+		"password": user.Password,
+	}, "")
+	newLogin, _ := makeRequest(t, "POST", BaseURL+"/users/login-pwd", map[string]interface{}{
+		"email":    user.Email,
+		"password": "ResetPassword123",
+	}, "")
+	if oldLogin.Code == 0 || newLogin.Code != 0 {
+		failures = append(failures, "重置后的登录结果不正确")
+	}
+	duration := time.Since(start)
+
+	if len(failures) == 0 {
+		AddTestResult("忘记密码和重置", "PASS", duration, "")
+		t.Logf("✓ 忘记密码和重置正常")
+	} else {
+		AddTestResult("忘记密码和重置", "FAIL", duration, fmt.Sprintf("%v", failures))
+		t.Errorf("✗ 忘记密码和重置不正确: %v", failures)
+	}
+}
+
+// testTwoFactor 测试两步验证：开启后登录需要第二步，恢复码只能用一次，验证码错误按账号累计并锁定
+func testTwoFactor(t *testing.T) {
+	start := time.Now()
+	defer resetIPLoginFailures()
+
+	enable := func(user *TestUser) (string, []interface{}) {
+		setupResp, _ := makeRequest(t, "POST", BaseURL+"/users/2fa/setup", nil, user.Token)
+		secret, _ := dataMapOf(setupResp)["secret"].(string)
+		enableResp, _ := makeRequest(t, "POST", BaseURL+"/users/2fa/enable", map[string]interface{}{
+			"code": totpCodeAt(secret, time.Now()),
+		}, user.Token)
+		codes, _ := dataMapOf(enableResp)["recovery_codes"].([]interface{})
+		if secret == "" || enableResp.Code != 0 || len(codes) == 0 {
+			AddTestResult("两步验证", "FAIL", time.Since(start), fmt.Sprintf("开启失败: %s / %s", setupResp.Msg, enableResp.Msg))
+			t.Fatalf("✗ 开启两步验证失败: %s / %s", setupResp.Msg, enableResp.Msg)
+		}
+		return secret, codes
+	}
+	challenge := func(user *TestUser) (string, *http.Response) {
+		resp, httpResp := makeRequest(t, "POST", BaseURL+"/users/login-pwd", map[string]interface{}{
+			"email":    user.Email,
+			"password": user.Password,
+		}, "")
+		data := dataMapOf(resp)
+		if _, hasToken := data["token"]; hasToken {
+			t.Fatalf("✗ 开启两步验证后第一步直接返回了登录令牌")
+		}
+		token, _ := data["challenge_token"].(string)
+		return token, httpResp
+	}
+	verify := func(token, code string) (*APIResponse, *http.Response) {
+		return makeRequest(t, "POST", BaseURL+"/users/2fa/verify", map[string]interface{}{
+			"challenge_token": token,
+			"code":            code,
+		}, "")
+	}
+
+	failures := make([]string, 0)
+	user := registerTestUser(t, "twofa_test", 1)
+	secret, recoveryCodes := enable(user)
+
+	// 开启时已使用当前时间步的验证码，登录使用下一个时间步的验证码（允许一个时间步的误差）
+	token, _ := challenge(user)
+	if resp, _ := verify(token, totpCodeAt(secret, time.Now().Add(30*time.Second))); resp.Code != 0 || dataMapOf(resp)["token"] == nil {
+		failures = append(failures, fmt.Sprintf("TOTP 验证失败: %s", resp.Msg))
+	}
+	if resp, _ := verify(token, recoveryCodes[0].(string)); resp.Code == 0 {
+		failures = append(failures, "挑战令牌可重复使用")
+	}
+
+	// 恢复码只能使用一次
+	token, _ = challenge(user)
+	if resp, _ := verify(token, recoveryCodes[0].(string)); resp.Code != 0 {
+		failures = append(failures, fmt.Sprintf("恢复码验证失败: %s", resp.Msg))
+	}
+	token, _ = challenge(user)
+	if resp, _ := verify(token, recoveryCodes[0].(string)); resp.Code == 0 {
+		failures = append(failures, "恢复码可以重复使用")
+	}
+
+	// 每个挑战令牌只错一次，错误仍按账号累计：第3次后账号被临时锁定，正确的密码也无法登录
+	locked := registerTestUser(t, "twofa_test", 2)
+	enable(locked)
+	for i := 0; i < 3; i++ {
+		token, _ := challenge(locked)
+		verify(token, "000000")
+	}
+	if _, httpResp := challenge(locked); httpResp.StatusCode != http.StatusTooManyRequests {
+		failures = append(failures, fmt.Sprintf("两步验证连续失败后账号未被锁定: HTTP %d", httpResp.StatusCode))
+	}
+	duration := time.Since(start)
+
+	if len(failures) == 0 {
+		AddTestResult("两步验证", "PASS", duration, "")
+		t.Logf("✓ 两步验证流程正常，验证码错误按账号锁定")
+	} else {
+		AddTestResult("两步验证", "FAIL", duration, fmt.Sprintf("%v", failures))
+		t.Errorf("✗ 两步验证不正确: %v", failures)
+	}
+}
+
+// testPasswordLockout 测试密码错误锁定：登录、修改密码的当前密码和注销账号的密码共用账号失败计数
+func testPasswordLockout(t *testing.T) {
+	start := time.Now()
+	defer resetIPLoginFailures()
+	user := registerTestUser(t, "lockout_test", 1)
+
+	login := func(password string) (*APIResponse, *http.Response) {
+		return makeRequest(t, "POST", BaseURL+"/users/login-pwd", map[string]interface{}{
+			"email":    user.Email,
+			"password": password,
+		}, "")
+	}
+	// waitUnlocked 按 Retry-After 等待锁定结束
+	waitUnlocked := func(httpResp *http.Response) {
+		seconds, _ := strconv.Atoi(httpResp.Header.Get("Retry-After"))
+		time.Sleep(time.Duration(seconds) * time.Second)
+	}
+
+	failures := make([]string, 0)
+
+	// 连续3次密码错误后临时锁定，锁定期间正确的密码也被拒绝
+	for i := 0; i < 3; i++ {
+		login("WrongPassword123")
+	}
+	_, httpResp := login(user.Password)
+	if httpResp.StatusCode != http.StatusTooManyRequests || httpResp.Header.Get("Retry-After") == "" {
+		failures = append(failures, fmt.Sprintf("登录连续失败后未锁定: HTTP %d", httpResp.StatusCode))
+	}
+	waitUnlocked(httpResp)
+	resp, _ := login(user.Password)
+	token, _ := dataMapOf(resp)["token"].(string)
+	if resp.Code != 0 || token == "" {
+		AddTestResult("密码错误锁定", "FAIL", time.Since(start), fmt.Sprintf("锁定结束后无法登录: %s", resp.Msg))
+		t.Fatalf("✗ 锁定结束后无法登录: %s", resp.Msg)
+	}
+
+	// 修改密码时的当前密码错误同样计数
+	for i := 0; i < 3; i++ {
+		makeRequest(t, "POST", BaseURL+"/users/set-password", map[string]interface{}{
+			"old_password": "WrongPassword123",
+			"password":     "NewPassword123",
+		}, token)
+	}
+	if _, httpResp = login(user.Password); httpResp.StatusCode != http.StatusTooManyRequests {
+		failures = append(failures, fmt.Sprintf("修改密码连续失败后未锁定: HTTP %d", httpResp.StatusCode))
+	}
+	waitUnlocked(httpResp)
+
+	// 注销账号时的密码错误同样计数，锁定期间正确的密码也被拒绝
+	makeRequest(t, "POST", BaseURL+"/users/me/deletion", map[string]interface{}{"password": "WrongPassword123"}, token)
+	if _, httpResp = makeRequest(t, "POST", BaseURL+"/users/me/deletion", map[string]interface{}{"password": user.Password}, token); httpResp.StatusCode != http.StatusTooManyRequests {
+		failures = append(failures, fmt.Sprintf("注销账号密码错误后未锁定: HTTP %d", httpResp.StatusCode))
+	}
+
+	// 登录失败写入登录记录
+	historyResp, _ := makeRequest(t, "GET", BaseURL+"/users/login-history", nil, token)
+	failed := 0
+	for _, item := range dataListOf(historyResp) {
+		if entry, ok := item.(map[string]interface{}); ok && entry["success"] == false {
+			failed++
+		}
+	}
+	if failed < 3 {
+		failures = append(failures, fmt.Sprintf("登录记录中失败记录 %d 条, want >= 3", failed))
+	}
+	duration := time.Since(start)
+
+	if len(failures) == 0 {
+		AddTestResult("密码错误锁定", "PASS", duration, "")
+		t.Logf("✓ 登录、修改密码和注销账号的密码错误共用计数并锁定")
+	} else {
+		AddTestResult("密码错误锁定", "FAIL", duration, fmt.Sprintf("%v", failures))
+		t.Errorf("✗ 密码错误锁定不正确: %v", failures)
+	}
+}
+
+// testChangeEmail 测试修改邮箱：两个邮箱的验证码都正确才生效，原有会话注销，之后只能用新邮箱登录
+func testChangeEmail(t *testing.T) {
+	start := time.Now()
+	user := registerTestUser(t, "email_test", 1)
+	other := registerTestUser(t, "email_test", 2)
+	newEmail := fmt.Sprintf("email_test_new_%d@example.com", time.Now().UnixNano())
+
+	failures := make([]string, 0)
+	if resp, _ := makeRequest(t, "POST", BaseURL+"/users/change-email", map[string]interface{}{"new_email": other.Email}, user.Token); resp.Code == 0 {
+		failures = append(failures, "可以修改为已注册的邮箱")
+	}
+
+	resp, _ := makeRequest(t, "POST", BaseURL+"/users/change-email", map[string]interface{}{"new_email": newEmail}, user.Token)
+	oldCode := readVerifyCode("change_email", user.Email)
+	newCode := readVerifyCode("change_email", newEmail)
+	if resp.Code != 0 {
+		if oldCode != "" {
+			// 验证码已生成但邮件发送失败，修改邮箱需要两封邮件都发送成功
+			AddTestResult("修改邮箱", "SKIP", time.Since(start), "需要配置SMTP")
+			t.Skipf("修改邮箱需要配置SMTP: %s", resp.Msg)
+		}
+		AddTestResult("修改邮箱", "FAIL", time.Since(start), resp.Msg)
+		t.Fatalf("✗ 请求修改邮箱失败: %s", resp.Msg)
+	}
+
+	confirm := func(oldCode, newCode string) *APIResponse {
+		resp, _ := makeRequest(t, "POST", BaseURL+"/users/change-email/confirm", map[string]interface{}{
+			"old_code": oldCode,
+			"new_code": newCode,
+		}, user.Token)
+		return resp
+	}
+	// 新邮箱的验证码错误时不生效，也不作废正确的验证码
+	if resp := confirm(oldCode, "000000"); resp.Code == 0 {
+		failures = append(failures, "新邮箱验证码错误时修改成功")
+	}
+	confirmResp := confirm(oldCode, newCode)
+	if confirmResp.Code != 0 {
+		failures = append(failures, fmt.Sprintf("确认修改失败: %s", confirmResp.Msg))
+	}
+	newToken, _ := dataMapOf(confirmResp)["token"].(string)
+
+	if resp, _ := makeRequest(t, "GET", BaseURL+"/users/me", nil, user.Token); resp.Code == 0 {
+		failures = append(failures, "修改邮箱后原有会话仍然有效")
+	}
+	if resp, _ := makeRequest(t, "GET", BaseURL+"/users/me", nil, newToken); resp.Code != 0 || dataMapOf(resp)["email"] != newEmail {
+		failures = append(failures, "新令牌无效或邮箱未更新")
+	}
+
+	oldLogin, _ := makeRequest(t, "POST", BaseURL+"/users/login-pwd", map[string]interface{}{
+		"email":    user.Email,
+		"password": user.Password,
+	}, "")
+	newLogin, _ := makeRequest(t, "POST", BaseURL+"/users/login-pwd", map[string]interface{}{
+		"email":    newEmail,
+		"password": user.Password,
+	}, "")
+	if oldLogin.Code == 0 || newLogin.Code != 0 {
+		failures = append(failures, "修改邮箱后的登录结果不正确")
+	}
+	duration := time.Since(start)
+
+	if len(failures) == 0 {
+		AddTestResult("修改邮箱", "PASS", duration, "")
+		t.Logf("✓ 修改邮箱流程正常")
+	} else {
+		AddTestResult("修改邮箱", "FAIL", duration, fmt.Sprintf("%v", failures))
+		t.Errorf("✗ 修改邮箱不正确: %v", failures)
+	}
+}
+
+// testPrincipalUserID 测试认证主体：令牌携带不可变的用户ID，刷新后不变，资源按用户ID判断归属
+func testPrincipalUserID(t *testing.T) {
+	start := time.Now()
+	owner := registerTestUser(t, "principal_test", 1)
+	friend := registerTestUser(t, "principal_test", 2)
+	makeTestFriends(t, owner, friend)
+
+	tokenUserID := func(token string) string {
+		parts := strings.Split(token, ".")
+		if len(parts) != 3 {
+			return ""
+		}
+		payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		var claims struct {
+			UserID string `json:"uid"`
+		}
+		_ = json.Unmarshal(payload, &claims)
+		return claims.UserID
+	}
+
+	failures := make([]string, 0)
+	if uid := tokenUserID(owner.Token); uid != owner.UserID {
+		failures = append(failures, fmt.Sprintf("Access Token 的 uid = %q, want %q", uid, owner.UserID))
+	}
+
+	// 刷新后的令牌仍是同一主体，可以操作自己发布的动态
+	momentID := createTestMoment(t, owner, map[string]interface{}{"content": "认证主体测试"})
+	loginResp, _ := makeRequest(t, "POST", BaseURL+"/users/login-pwd", map[string]interface{}{
+		"email":    owner.Email,
+		"password": owner.Password,
+	}, "")
+	refreshToken, _ := dataMapOf(loginResp)["refresh_token"].(string)
+	refreshResp, _ := makeRequest(t, "POST", BaseURL+"/users/refresh", map[string]interface{}{"refresh_token": refreshToken}, "")
+	refreshedToken, _ := dataMapOf(refreshResp)["token"].(string)
+	if uid := tokenUserID(refreshedToken); uid != owner.UserID {
+		failures = append(failures, fmt.Sprintf("刷新后的 uid = %q, want %q", uid, owner.UserID))
+	}
+
+	detailResp, _ := makeRequest(t, "GET", fmt.Sprintf("%s/moments/%d", BaseURL, momentID), nil, friend.Token)
+	if author, _ := dataMapOf(detailResp)["user_id"].(string); author != owner.UserID {
+		failures = append(failures, fmt.Sprintf("动态作者 = %q, want %q", author, owner.UserID))
+	}
+	if resp, _ := makeRequest(t, "DELETE", fmt.Sprintf("%s/moments/%d", BaseURL, momentID), nil, friend.Token); resp.Code == 0 {
+		failures = append(failures, "好友可以删除他人的动态")
+	}
+	if resp, _ := makeRequest(t, "DELETE", fmt.Sprintf("%s/moments/%d", BaseURL, momentID), nil, refreshedToken); resp.Code != 0 {
+		failures = append(failures, fmt.Sprintf("刷新后的令牌无法删除自己的动态: %s", resp.Msg))
+	}
+	duration := time.Since(start)
+
+	if len(failures) == 0 {
+		AddTestResult("认证主体为用户ID", "PASS", duration, "")
+		t.Logf("✓ 令牌和资源归属均使用用户ID")
+	} else {
+		AddTestResult("认证主体为用户ID", "FAIL", duration, fmt.Sprintf("%v", failures))
+		t.Errorf("✗ 认证主体不正确: %v", failures)
+	}
+}
+
+// testDataExport 测试个人数据导出：后台生成 ZIP，包含资料、消息和动态，只有本人可以下载
+func testDataExport(t *testing.T) {
+	start := time.Now()
+	user := registerTestUser(t, "export_test", 1)
+	friend := registerTestUser(t, "export_test", 2)
+	makeTestFriends(t, user, friend)
+
+	makeRequest(t, "POST", BaseURL+"/messages/send", map[string]interface{}{
+		"to_user_id":   friend.UserID,
+		"message_type": 1,
+		"content":      "导出测试消息",
+	}, user.Token)
+	createTestMoment(t, user, map[string]interface{}{"content": "导出测试动态"})
+
+	// 后台任务每分钟处理一次
+	var downloadURL string
+	waitFor(90*time.Second, func() bool {
+		resp, _ := makeRequest(t, "GET", BaseURL+"/users/me/export", nil, user.Token)
+		downloadURL, _ = dataMapOf(resp)["download_url"].(string)
+		return downloadURL != ""
+	})
+	if downloadURL == "" {
+		AddTestResult("个人数据导出", "FAIL", time.Since(start), "导出未在90秒内完成")
+		t.Fatalf("✗ 导出未在90秒内完成")
+	}
+
+	download := func(token string) (int, []byte) {
+		req, _ := http.NewRequest("GET", strings.TrimSuffix(BaseURL, "/api/v1")+downloadURL, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("下载导出失败: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, body
+	}
+
+	failures := make([]string, 0)
+	status, body := download(user.Token)
+	files := make(map[string]string)
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if status != http.StatusOK || err != nil {
+		failures = append(failures, fmt.Sprintf("下载的不是有效的 ZIP: HTTP %d, %v", status, err))
+	} else {
+		for _, f := range archive.File {
+			rc, err := f.Open()
+			if err != nil {
+				continue
+			}
+			content, _ := io.ReadAll(rc)
+			rc.Close()
+			files[f.Name] = string(content)
+		}
+	}
+	for name, want := range map[string]string{
+		"profile.json":  user.UserID,
+		"messages.json": "导出测试消息",
+		"moments.json":  "导出测试动态",
+		"friends.json":  friend.UserID,
+	} {
+		if !strings.Contains(files[name], want) {
+			failures = append(failures, fmt.Sprintf("%s 中缺少 %s", name, want))
+		}
+	}
+	if strings.Contains(files["profile.json"], "\"password\"") {
+		failures = append(failures, "profile.json 包含密码哈希")
+	}
+
+	// 其他用户不能下载
+	if status, body := download(friend.Token); status == http.StatusOK && bytes.HasPrefix(body, []byte("PK")) {
+		failures = append(failures, "其他用户可以下载导出文件")
+	}
+	duration := time.Since(start)
+
+	if len(failures) == 0 {
+		AddTestResult("个人数据导出", "PASS", duration, "")
+		t.Logf("✓ 个人数据导出内容正确")
+	} else {
+		AddTestResult("个人数据导出", "FAIL", duration, fmt.Sprintf("%v", failures))
+		t.Errorf("✗ 个人数据导出不正确: %v", failures)
+	}
+}
+
+// testAccountDeletion 测试注销账号：冷静期内可以撤销；到期清除后群主转让或群组解散，账号无法再登录
+// 清除部分需要服务端设置 ACCOUNT_DELETION_GRACE=0s，否则跳过
+func testAccountDeletion(t *testing.T) {
+	start := time.Now()
+	user := registerTestUser(t, "deletion_test", 1)
+	member := registerTestUser(t, "deletion_test", 2)
+	makeTestFriends(t, user, member)
+
+	requestDeletion := func() *APIResponse {
+		resp, _ := makeRequest(t, "POST", BaseURL+"/users/me/deletion", map[string]interface{}{"password": user.Password}, user.Token)
+		return resp
+	}
+
+	failures := make([]string, 0)
+	if resp, _ := makeRequest(t, "POST", BaseURL+"/users/me/deletion", map[string]interface{}{}, user.Token); resp.Code == 0 {
+		failures = append(failures, "未提供密码时申请成功")
+	}
+	if resp := requestDeletion(); resp.Code != 0 || dataMapOf(resp)["deletion_scheduled_at"] == nil {
+		failures = append(failures, fmt.Sprintf("申请注销失败: %s", resp.Msg))
+	}
+	if resp := requestDeletion(); resp.Code == 0 {
+		failures = append(failures, "可以重复申请注销")
+	}
+	if resp, _ := makeRequest(t, "DELETE", BaseURL+"/users/me/deletion", nil, user.Token); resp.Code != 0 {
+		failures = append(failures, fmt.Sprintf("撤销注销失败: %s", resp.Msg))
+	}
+	if resp, _ := makeRequest(t, "GET", BaseURL+"/users/me", nil, user.Token); dataMapOf(resp)["deletion_scheduled_at"] != nil {
+		failures = append(failures, "撤销后仍有计划清除时间")
+	}
+
+	// 一个有其他成员的群（群主转让）和一个只有自己的群（解散）
+	sharedGroup := createTestGroup(t, user, "注销转让测试群")
+	makeRequest(t, "POST", BaseURL+"/groups/join", map[string]interface{}{"group_id": sharedGroup}, member.Token)
+	soloGroup := createTestGroup(t, user, "注销解散测试群")
+
+	resp := requestDeletion()
+	scheduledAt, _ := time.Parse(time.RFC3339Nano, fmt.Sprint(dataMapOf(resp)["deletion_scheduled_at"]))
+	if resp.Code != 0 {
+		failures = append(failures, fmt.Sprintf("再次申请注销失败: %s", resp.Msg))
+	} else if time.Until(scheduledAt) > time.Minute {
+		duration := time.Since(start)
+		if len(failures) > 0 {
+			AddTestResult("注销账号", "FAIL", duration, fmt.Sprintf("%v", failures))
+			t.Fatalf("✗ 注销账号不正确: %v", failures)
+		}
+		AddTestResult("注销账号", "SKIP", duration, "清除部分需要 ACCOUNT_DELETION_GRACE=0s")
+		t.Skipf("申请和撤销正常；清除部分需要服务端设置 ACCOUNT_DELETION_GRACE=0s")
+	}
+
+	// 后台任务每分钟处理一次，清除后无法登录
+	purged := waitFor(90*time.Second, func() bool {
+		loginResp, _ := makeRequest(t, "POST", BaseURL+"/users/login-pwd", map[string]interface{}{
+			"email":    user.Email,
+			"password": user.Password,
+		}, "")
+		return loginResp.Code != 0
+	})
+	if !purged {
+		failures = append(failures, "清除后仍可以登录")
+	}
+	if resp, _ := makeRequest(t, "GET", BaseURL+"/users/me", nil, user.Token); resp.Code == 0 {
+		failures = append(failures, "清除后原有会话仍然有效")
+	}
+
+	infoResp, _ := makeRequest(t, "GET", BaseURL+"/groups/"+sharedGroup, nil, member.Token)
+	if owner, _ := dataMapOf(infoResp)["owner_id"].(string); owner != member.UserID {
+		failures = append(failures, fmt.Sprintf("群主未转让: owner=%q", owner))
+	}
+	if members := groupMemberIDs(t, sharedGroup, member); members[user.UserID] {
+		failures = append(failures, "已注销用户仍在群中")
+	}
+	if resp, _ := makeRequest(t, "POST", BaseURL+"/groups/join", map[string]interface{}{"group_id": soloGroup}, member.Token); resp.Code == 0 {
+		failures = append(failures, "只有群主的群未解散")
+	}
+
+	friendsResp, _ := makeRequest(t, "GET", BaseURL+"/friends/list", nil, member.Token)
+	for _, item := range dataListOf(friendsResp) {
+		if strings.Contains(fmt.Sprint(item), user.UserID) {
+			failures = append(failures, "好友关系未解除")
+			break
+		}
+	}
+	duration := time.Since(start)
+
+	if len(failures) == 0 {
+		AddTestResult("注销账号", "PASS", duration, "")
+		t.Logf("✓ 注销申请、撤销和清除正常")
+	} else {
+		AddTestResult("注销账号", "FAIL", duration, fmt.Sprintf("%v", failures))
+		t.Errorf("✗ 注销账号不正确: %v", failures)
+	}
+}
+
+// testAccountStatusPrivacy 测试两步验证、注销计划等账号状态只在本人的资料中返回，好友列表中看不到
+func testAccountStatusPrivacy(t *testing.T) {
+	start := time.Now()
+	user := registerTestUser(t, "status_privacy", 1)
+	friend := registerTestUser(t, "status_privacy", 2)
+	makeTestFriends(t, friend, user)
+
+	setupResp, _ := makeRequest(t, "POST", BaseURL+"/users/2fa/setup", nil, user.Token)
+	secret, _ := dataMapOf(setupResp)["secret"].(string)
+	enableResp, _ := makeRequest(t, "POST", BaseURL+"/users/2fa/enable", map[string]interface{}{
+		"code": totpCodeAt(secret, time.Now()),
+	}, user.Token)
+	if secret == "" || enableResp.Code != 0 {
+		AddTestResult("账号状态只对本人可见", "FAIL", time.Since(start), fmt.Sprintf("开启两步验证失败: %s / %s", setupResp.Msg, enableResp.Msg))
+		t.Fatalf("✗ 开启两步验证失败: %s / %s", setupResp.Msg, enableResp.Msg)
+	}
+
+	failures := make([]string, 0)
+	meResp, _ := makeRequest(t, "GET", BaseURL+"/users/me", nil, user.Token)
+	if me := dataMapOf(meResp); me["two_factor_enabled"] != true {
+		failures = append(failures, fmt.Sprintf("本人资料中没有两步验证状态: %v", me))
+	}
+
+	// 好友申请注销，冷静期内撤销
+	deletionResp, _ := makeRequest(t, "POST", BaseURL+"/users/me/deletion", map[string]interface{}{
+		"password": friend.Password,
+	}, friend.Token)
+	if deletionResp.Code != 0 {
+		AddTestResult("账号状态只对本人可见", "FAIL", time.Since(start), fmt.Sprintf("申请注销失败: %s", deletionResp.Msg))
+		t.Fatalf("✗ 申请注销失败: %s", deletionResp.Msg)
+	}
+	defer makeRequest(t, "DELETE", BaseURL+"/users/me/deletion", nil, friend.Token)
+	friendMeResp, _ := makeRequest(t, "GET", BaseURL+"/users/me", nil, friend.Token)
+	if me := dataMapOf(friendMeResp); me["deletion_scheduled_at"] == nil {
+		failures = append(failures, fmt.Sprintf("本人资料中没有注销计划: %v", me))
+	}
+
+	// 双方的好友列表中都看不到对方的账号状态
+	checkFriendList := func(viewer, target *TestUser) {
+		listResp, _ := makeRequest(t, "GET", BaseURL+"/friends/list", nil, viewer.Token)
+		found := false
+		for _, item := range dataListOf(listResp) {
+			itemMap, _ := item.(map[string]interface{})
+			profile, _ := itemMap["friend_user"].(map[string]interface{})
+			if profile["user_id"] != target.UserID {
+				continue
+			}
+			found = true
+			for _, field := range []string{"two_factor_enabled", "deletion_scheduled_at"} {
+				if _, ok := profile[field]; ok {
+					failures = append(failures, fmt.Sprintf("好友列表泄露了 %s", field))
+				}
+			}
+		}
+		if !found {
+			failures = append(failures, fmt.Sprintf("%s 的好友列表中没有 %s", viewer.UserID, target.UserID))
+		}
+	}
+	checkFriendList(friend, user)
+	checkFriendList(user, friend)
+	duration := time.Since(start)
+
+	if len(failures) == 0 {
+		AddTestResult("账号状态只对本人可见", "PASS", duration, "")
+		t.Logf("✓ 账号状态只对本人可见")
+	} else {
+		AddTestResult("账号状态只对本人可见", "FAIL", duration, fmt.Sprintf("%v", failures))
+		t.Errorf("✗ 账号状态可见范围不正确: %v", failures)
+	}
+}
+
+// testLockoutScope 测试账号锁定只作用于失败来源的IP，失败计数窗口从第一次失败起固定，不随后续失败延长
+func testLockoutScope(t *testing.T) {
+	start := time.Now()
+	defer resetIPLoginFailures()
+	ctx := context.Background()
+	user := registerTestUser(t, "lock_scope", 1)
+
+	login := func(password string) (*APIResponse, *http.Response) {
+		return makeRequest(t, "POST", BaseURL+"/users/login-pwd", map[string]interface{}{
+			"email":    user.Email,
+			"password": password,
+		}, "")
+	}
+	failKey := func() string {
+		keys, _ := testRedis.Keys(ctx, "login_fail:account:"+user.UserID+":*").Result()
+		if len(keys) != 1 {
+			return ""
+		}
+		return keys[0]
+	}
+
+	failures := make([]string, 0)
+
+	login("WrongPassword123")
+	key := failKey()
+	if key == "" {
+		AddTestResult("锁定范围和计数窗口", "FAIL", time.Since(start), "失败计数没有按账号和IP记录")
+		t.Fatalf("✗ 失败计数没有按账号和IP记录")
+	}
+	firstTTL, _ := testRedis.TTL(ctx, key).Result()
+	time.Sleep(2 * time.Second)
+	login("WrongPassword123")
+	if secondTTL, _ := testRedis.TTL(ctx, key).Result(); secondTTL >= firstTTL {
+		failures = append(failures, fmt.Sprintf("再次失败延长了计数窗口: %v -> %v", firstTTL, secondTTL))
+	}
+
+	// 其他IP上的锁定不影响当前IP登录
+	otherLock := "login_lock:account:" + user.UserID + ":203.0.113.9"
+	testRedis.Set(ctx, otherLock, 1, time.Minute)
+	defer testRedis.Del(ctx, otherLock)
+	resp, httpResp := login(user.Password)
+	if resp.Code != 0 || httpResp.StatusCode == http.StatusTooManyRequests {
+		failures = append(failures, fmt.Sprintf("其他IP的锁定影响了当前IP: HTTP %d, %s", httpResp.StatusCode, resp.Msg))
+	}
+	if failKey() != "" {
+		failures = append(failures, "登录成功后失败计数未清零")
+	}
+	duration := time.Since(start)
+
+	if len(failures) == 0 {
+		AddTestResult("锁定范围和计数窗口", "PASS", duration, "")
+		t.Logf("✓ 锁定范围和计数窗口正常")
+	} else {
+		AddTestResult("锁定范围和计数窗口", "FAIL", duration, fmt.Sprintf("%v", failures))
+		t.Errorf("✗ 锁定范围和计数窗口不正确: %v", failures)
+	}
+}
@@ -15,7 +15,8 @@ func main() {
 	// 初始化依赖
 	pkg.InitPostgres()
 	pkg.InitRedis()
-	pkg.InitHub() // 初始化WebSocket Hub
+	pkg.InitJWTKeys() // 加载JWT签名密钥
+	pkg.InitHub()     // 初始化WebSocket Hub
 
 	// 路由
 	r := router.InitRouter()
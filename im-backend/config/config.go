@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -30,8 +31,44 @@ type Config struct {
 	SMTPPass string
 
 	// JWT
-	JWTSecret     string
-	JWTExpiration int // JWT过期时间（小时）
+	JWTSecret       string // 邀请令牌的HMAC密钥
+	JWTKeysDir      string // Access Token 签名密钥目录（PEM），文件名为 kid
+	JWTSigningKeyID string // 当前用于签名的 kid，目录中只有一个私钥时可不填
+	JWTEphemeralKey bool   // 未配置密钥目录时允许使用临时密钥（仅限本地开发）
+	JWTAccessTTL    string // Access Token 有效期，如 15m
+	JWTRefreshTTL   string // Refresh Token 有效期，每次刷新后重新计算，如 720h
+
+	// 媒体文件
+	UploadDir string // 本地媒体文件存储目录
+
+	// 账号数据
+	ExportDir            string // 个人数据导出文件（ZIP）存储目录
+	AccountDeletionGrace string // 申请注销后的冷静期，到期后清除数据，如 168h
+
+	// 邀请链接
+	InviteBaseURL string // 邀请链接前缀，二维码内容为前缀+邀请令牌
+
+	// 限流（规则格式为 次数/周期，如 5/10m）
+	RateLimitEnabled        bool
+	RateLimitTrustedProxies int    // 服务前的可信反向代理层数，大于0时从 X-Forwarded-For 右侧取客户端IP
+	RateLimitGlobal         string // 所有接口，按IP
+	RateLimitCode           string // 发送验证码，按IP
+	RateLimitAuth           string // 登录注册，按IP
+	RateLimitMessage        string // 发送消息，按用户
+
+	// OIDC 单点登录
+	OIDCProviders   []OIDCProviderConfig
+	OIDCRedirectURL string // 回调地址前缀，实际回调地址为 前缀+提供方名称+"/callback"
+}
+
+// OIDCProviderConfig 单个 OIDC 身份提供方
+// 通过 OIDC_PROVIDERS=corp,google 启用，每个提供方读取 OIDC_<名称>_ISSUER 等配置
+type OIDCProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string // 公共客户端（仅 PKCE）可留空
+	Scopes       string // 空格分隔，默认 openid email profile
 }
 
 var Cfg *Config
@@ -44,8 +81,14 @@ func LoadConfig() {
 	redisDB, _ := strconv.Atoi(getEnv("REDIS_DB", "0"))
 	smtpPort, _ := strconv.Atoi(getEnv("SMTP_PORT", "587"))
 
-	// JWT过期时间
-	jwtExpiration, _ := strconv.Atoi(getEnv("JWT_EXPIRATION", "8"))
+	// 可信代理层数；兼容旧配置 RATE_LIMIT_TRUST_PROXY=true（视为一层代理）
+	trustedProxies, err := strconv.Atoi(getEnv("RATE_LIMIT_TRUSTED_PROXIES", "0"))
+	if err != nil || trustedProxies < 0 {
+		trustedProxies = 0
+	}
+	if trustedProxies == 0 && os.Getenv("RATE_LIMIT_TRUST_PROXY") == "true" {
+		trustedProxies = 1
+	}
 
 	Cfg = &Config{
 		AppPort: os.Getenv("APP_PORT"),
@@ -69,8 +112,34 @@ func LoadConfig() {
 		SMTPPass: os.Getenv("SMTP_PASS"),
 
 		// JWT配置
-		JWTSecret:     getEnv("JWT_SECRET", ""),
-		JWTExpiration: jwtExpiration,
+		JWTSecret:       getEnv("JWT_SECRET", ""),
+		JWTKeysDir:      getEnv("JWT_KEYS_DIR", ""),
+		JWTEphemeralKey: getEnv("JWT_EPHEMERAL_KEY", "false") == "true",
+		JWTSigningKeyID: getEnv("JWT_SIGNING_KEY_ID", ""),
+		JWTAccessTTL:    getEnv("JWT_ACCESS_TTL", "15m"),
+		JWTRefreshTTL:   getEnv("JWT_REFRESH_TTL", "720h"),
+
+		// 媒体文件
+		UploadDir: getEnv("UPLOAD_DIR", "uploads"),
+
+		// 账号数据
+		ExportDir:            getEnv("EXPORT_DIR", "exports"),
+		AccountDeletionGrace: getEnv("ACCOUNT_DELETION_GRACE", "168h"),
+
+		// 邀请链接
+		InviteBaseURL: getEnv("INVITE_BASE_URL", "esyim://invite/"),
+
+		// 限流
+		RateLimitEnabled:        getEnv("RATE_LIMIT_ENABLED", "true") == "true",
+		RateLimitTrustedProxies: trustedProxies,
+		RateLimitGlobal:         getEnv("RATE_LIMIT_GLOBAL", "600/1m"),
+		RateLimitCode:           getEnv("RATE_LIMIT_CODE", "5/10m"),
+		RateLimitAuth:           getEnv("RATE_LIMIT_AUTH", "30/1m"),
+		RateLimitMessage:        getEnv("RATE_LIMIT_MESSAGE", "60/1m"),
+
+		// OIDC 单点登录
+		OIDCProviders:   loadOIDCProviders(),
+		OIDCRedirectURL: getEnv("OIDC_REDIRECT_URL", "http://localhost:8080/api/v1/users/oidc/"),
 	}
 
 	log.Println("✅ 配置加载完成")
@@ -82,3 +151,28 @@ func getEnv(key, defaultVal string) string {
 	}
 	return defaultVal
 }
+
+// loadOIDCProviders 读取 OIDC_PROVIDERS 中列出的身份提供方，缺少 issuer 或 client_id 的忽略
+func loadOIDCProviders() []OIDCProviderConfig {
+	var providers []OIDCProviderConfig
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		provider := OIDCProviderConfig{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			Scopes:       getEnv(prefix+"SCOPES", "openid email profile"),
+		}
+		if provider.Issuer == "" || provider.ClientID == "" {
+			log.Printf("⚠️ OIDC 提供方 %s 缺少 %sISSUER 或 %sCLIENT_ID，已忽略", name, prefix, prefix)
+			continue
+		}
+		providers = append(providers, provider)
+	}
+	return providers
+}
@@ -13,8 +13,8 @@ func NewFriendController(friendService *service.FriendService) *FriendController
 }
 
 // SendRequest 发送好友请求
-func (c *FriendController) SendRequest(fromUserID, toUserID, message string) error {
-	return c.friendService.SendFriendRequest(fromUserID, toUserID, message)
+func (c *FriendController) SendRequest(fromUserID, toUserID, message, answer string) error {
+	return c.friendService.SendFriendRequest(fromUserID, toUserID, message, answer)
 }
 
 // AcceptRequest 接受好友请求
@@ -28,8 +28,8 @@ func (c *FriendController) RejectRequest(requestID uint, userID string) error {
 }
 
 // GetFriendList 获取好友列表
-func (c *FriendController) GetFriendList(userID string) (interface{}, error) {
-	return c.friendService.GetFriendList(userID)
+func (c *FriendController) GetFriendList(userID string, tagID uint) (interface{}, error) {
+	return c.friendService.GetFriendList(userID, tagID)
 }
 
 // DeleteFriend 删除好友
@@ -53,6 +53,46 @@ func (c *FriendController) GetSentRequests(userID string, status int) (interface
 }
 
 // SearchFriend 搜索好友
-func (c *FriendController) SearchFriend(userID string) (interface{}, error) {
-	return c.friendService.SearchFriend(userID)
+func (c *FriendController) SearchFriend(viewerID, userID, email string) (interface{}, error) {
+	return c.friendService.SearchFriend(viewerID, userID, email)
+}
+
+// GetRecommendations 获取可能认识的人
+func (c *FriendController) GetRecommendations(userID string, limit int) (interface{}, error) {
+	return c.friendService.GetRecommendations(userID, limit)
+}
+
+// BlockUser 拉黑用户
+func (c *FriendController) BlockUser(userID, targetID string) error {
+	return c.friendService.BlockUser(userID, targetID)
+}
+
+// UnblockUser 取消拉黑
+func (c *FriendController) UnblockUser(userID, targetID string) error {
+	return c.friendService.UnblockUser(userID, targetID)
+}
+
+// GetBlockList 获取黑名单列表
+func (c *FriendController) GetBlockList(userID string) (interface{}, error) {
+	return c.friendService.GetBlockList(userID)
+}
+
+// CreateTag 创建好友标签
+func (c *FriendController) CreateTag(userID, name string, friendIDs []string) (interface{}, error) {
+	return c.friendService.CreateTag(userID, name, friendIDs)
+}
+
+// GetTags 获取好友标签列表
+func (c *FriendController) GetTags(userID string) (interface{}, error) {
+	return c.friendService.GetTags(userID)
+}
+
+// UpdateTag 修改好友标签
+func (c *FriendController) UpdateTag(tagID uint, userID, name string, friendIDs []string) (interface{}, error) {
+	return c.friendService.UpdateTag(tagID, userID, name, friendIDs)
+}
+
+// DeleteTag 删除好友标签
+func (c *FriendController) DeleteTag(tagID uint, userID string) error {
+	return c.friendService.DeleteTag(tagID, userID)
 }
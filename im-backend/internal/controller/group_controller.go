@@ -51,6 +51,11 @@ func (c *GroupController) JoinGroup(groupID, userID string) error {
 	return c.groupService.JoinGroup(groupID, userID)
 }
 
+// InviteMembers 邀请好友入群
+func (c *GroupController) InviteMembers(groupID, operatorID string, userIDs []string, tagIDs []uint) (int, error) {
+	return c.groupService.InviteMembers(groupID, operatorID, userIDs, tagIDs)
+}
+
 // LeaveGroup 退出群组
 func (c *GroupController) LeaveGroup(groupID, userID string) error {
 	return c.groupService.LeaveGroup(groupID, userID)
@@ -97,3 +102,8 @@ func (c *GroupController) MarkGroupMessagesAsRead(groupID, userID string) error
 func (c *GroupController) GetUserUnreadGroupMessages(groupID, userID string) (interface{}, error) {
 	return c.groupService.GetUserUnreadGroupMessages(groupID, userID)
 }
+
+// SetMessageTTL 设置群消息存活时间
+func (c *GroupController) SetMessageTTL(groupID, userID string, ttl, mode int) error {
+	return c.groupService.SetMessageTTL(groupID, userID, ttl, mode)
+}
@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"im-backend/internal/service"
+)
+
+type InviteController struct {
+	inviteService *service.InviteService
+}
+
+func NewInviteController(inviteService *service.InviteService) *InviteController {
+	return &InviteController{inviteService: inviteService}
+}
+
+// CreateInvite 创建邀请链接
+func (c *InviteController) CreateInvite(creatorID string, inviteType int, groupID string, expireIn, maxUses int, skipApproval bool) (interface{}, error) {
+	return c.inviteService.CreateInvite(creatorID, inviteType, groupID, expireIn, maxUses, skipApproval)
+}
+
+// GetInvites 获取邀请链接列表
+func (c *InviteController) GetInvites(userID, groupID string) (interface{}, error) {
+	return c.inviteService.GetInvites(userID, groupID)
+}
+
+// RevokeInvite 撤销邀请链接
+func (c *InviteController) RevokeInvite(id uint, userID string) error {
+	return c.inviteService.RevokeInvite(id, userID)
+}
+
+// GetInviteQRCode 获取邀请二维码PNG
+func (c *InviteController) GetInviteQRCode(id uint, userID string) ([]byte, error) {
+	return c.inviteService.GetInviteQRCode(id, userID)
+}
+
+// GetInviteByToken 预览邀请
+func (c *InviteController) GetInviteByToken(token string) (interface{}, error) {
+	return c.inviteService.GetInviteByToken(token)
+}
+
+// RedeemInvite 兑换邀请
+func (c *InviteController) RedeemInvite(token, userID, message string) (interface{}, error) {
+	return c.inviteService.RedeemInvite(token, userID, message)
+}
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"im-backend/internal/model"
 	"im-backend/internal/service"
 )
 
@@ -13,7 +14,7 @@ func NewMessageController(messageService *service.MessageService) *MessageContro
 }
 
 // SendMessage 发送消息
-func (c *MessageController) SendMessage(fromUserID, toUserID string, messageType int, content, mediaURL string) (interface{}, error) {
+func (c *MessageController) SendMessage(fromUserID, toUserID string, messageType int, content, mediaURL string) (*model.Message, error) {
 	return c.messageService.SendMessage(fromUserID, toUserID, messageType, content, mediaURL)
 }
 
@@ -66,3 +67,8 @@ func (c *MessageController) GetConversationUnreadCount(conversationID uint, user
 func (c *MessageController) GetOrCreateConversation(user1ID, user2ID string) (interface{}, error) {
 	return c.messageService.GetOrCreateConversation(user1ID, user2ID)
 }
+
+// SetConversationTTL 设置会话消息存活时间
+func (c *MessageController) SetConversationTTL(conversationID uint, userID string, ttl, mode int) error {
+	return c.messageService.SetConversationTTL(conversationID, userID, ttl, mode)
+}
@@ -2,6 +2,7 @@ package controller
 
 import (
 	"im-backend/internal/service"
+	"time"
 )
 
 type MomentController struct {
@@ -13,8 +14,8 @@ func NewMomentController(momentService *service.MomentService) *MomentController
 }
 
 // CreateMoment 发布朋友圈动态
-func (c *MomentController) CreateMoment(userID, content, images, location string, visible int) error {
-	return c.momentService.CreateMoment(userID, content, images, location, visible)
+func (c *MomentController) CreateMoment(userID, content, images, location string, visible int, audienceUserIDs []string, audienceTagIDs []uint) error {
+	return c.momentService.CreateMoment(userID, content, images, location, visible, audienceUserIDs, audienceTagIDs)
 }
 
 // GetMomentByID 获取动态详情
@@ -27,11 +28,41 @@ func (c *MomentController) GetMyMoments(userID string, page, pageSize int) (inte
 	return c.momentService.GetMyMoments(userID, page, pageSize)
 }
 
+// GetTimeline 按游标获取朋友圈时间线
+func (c *MomentController) GetTimeline(userID string, cursor uint, pageSize int) (interface{}, error) {
+	return c.momentService.GetTimeline(userID, cursor, pageSize)
+}
+
 // GetFriendMoments 获取好友的朋友圈列表
 func (c *MomentController) GetFriendMoments(userID string, page, pageSize int) (interface{}, error) {
 	return c.momentService.GetFriendMoments(userID, page, pageSize)
 }
 
+// RepostMoment 转发动态
+func (c *MomentController) RepostMoment(momentID uint, userID, content string, visible int, audienceUserIDs []string, audienceTagIDs []uint) error {
+	return c.momentService.RepostMoment(momentID, userID, content, visible, audienceUserIDs, audienceTagIDs)
+}
+
+// UpdateMoment 编辑动态
+func (c *MomentController) UpdateMoment(momentID uint, userID, content, images, location string, visible int, audienceUserIDs []string, audienceTagIDs []uint) (interface{}, error) {
+	return c.momentService.UpdateMoment(momentID, userID, content, images, location, visible, audienceUserIDs, audienceTagIDs)
+}
+
+// GetMomentEdits 获取动态编辑历史
+func (c *MomentController) GetMomentEdits(momentID uint, userID string) (interface{}, error) {
+	return c.momentService.GetMomentEdits(momentID, userID)
+}
+
+// GetHashtagMoments 获取话题下的动态
+func (c *MomentController) GetHashtagMoments(tag, userID string, cursor uint, pageSize int) (interface{}, error) {
+	return c.momentService.GetHashtagMoments(tag, userID, cursor, pageSize)
+}
+
+// GetTrendingHashtags 获取热门话题
+func (c *MomentController) GetTrendingHashtags(userID string, days, limit int) (interface{}, error) {
+	return c.momentService.GetTrendingHashtags(userID, days, limit)
+}
+
 // DeleteMoment 删除动态
 func (c *MomentController) DeleteMoment(momentID uint, userID string) error {
 	return c.momentService.DeleteMoment(momentID, userID)
@@ -63,6 +94,41 @@ func (c *MomentController) DeleteComment(commentID uint, userID string) error {
 }
 
 // GetCommentList 获取评论列表
-func (c *MomentController) GetCommentList(momentID uint, userID string) (interface{}, error) {
-	return c.momentService.GetCommentList(momentID, userID)
+func (c *MomentController) GetCommentList(momentID uint, userID string, cursor uint, pageSize int) (interface{}, error) {
+	return c.momentService.GetCommentList(momentID, userID, cursor, pageSize)
+}
+
+// GetCommentReplies 获取评论楼中的回复
+func (c *MomentController) GetCommentReplies(commentID uint, userID string, cursor uint, pageSize int) (interface{}, error) {
+	return c.momentService.GetCommentReplies(commentID, userID, cursor, pageSize)
+}
+
+// LikeComment 点赞评论
+func (c *MomentController) LikeComment(commentID uint, userID string) error {
+	return c.momentService.LikeComment(commentID, userID)
+}
+
+// UnlikeComment 取消评论点赞
+func (c *MomentController) UnlikeComment(commentID uint, userID string) error {
+	return c.momentService.UnlikeComment(commentID, userID)
+}
+
+// GetNotifications 获取互动通知列表
+func (c *MomentController) GetNotifications(userID string, page, pageSize int) (interface{}, error) {
+	return c.momentService.GetNotifications(userID, page, pageSize)
+}
+
+// GetUnreadNotificationCount 获取未读互动通知数
+func (c *MomentController) GetUnreadNotificationCount(userID string) (int64, error) {
+	return c.momentService.GetUnreadNotificationCount(userID)
+}
+
+// MarkNotificationsRead 标记互动通知为已读
+func (c *MomentController) MarkNotificationsRead(userID string, ids []uint) error {
+	return c.momentService.MarkNotificationsRead(userID, ids)
+}
+
+// GetNewTimelineCount 获取时间线新动态数
+func (c *MomentController) GetNewTimelineCount(userID string, since time.Time) (int64, error) {
+	return c.momentService.GetNewTimelineCount(userID, since)
 }
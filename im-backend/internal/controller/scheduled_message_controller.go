@@ -0,0 +1,29 @@
+package controller
+
+import (
+	"im-backend/internal/service"
+	"time"
+)
+
+type ScheduledMessageController struct {
+	scheduledService *service.ScheduledMessageService
+}
+
+func NewScheduledMessageController(scheduledService *service.ScheduledMessageService) *ScheduledMessageController {
+	return &ScheduledMessageController{scheduledService: scheduledService}
+}
+
+// CreateScheduledMessage 创建定时消息
+func (c *ScheduledMessageController) CreateScheduledMessage(userID string, targetType int, targetID string, messageType int, content, mediaURL, atUsers string, sendAt time.Time) (interface{}, error) {
+	return c.scheduledService.CreateScheduledMessage(userID, targetType, targetID, messageType, content, mediaURL, atUsers, sendAt)
+}
+
+// GetScheduledMessages 获取定时消息列表
+func (c *ScheduledMessageController) GetScheduledMessages(userID string, status, page, pageSize int) (interface{}, error) {
+	return c.scheduledService.GetScheduledMessages(userID, status, page, pageSize)
+}
+
+// CancelScheduledMessage 取消定时消息
+func (c *ScheduledMessageController) CancelScheduledMessage(id uint, userID string) error {
+	return c.scheduledService.CancelScheduledMessage(id, userID)
+}
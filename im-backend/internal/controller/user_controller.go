@@ -2,17 +2,22 @@ package controller
 
 import (
 	"context"
+	"im-backend/internal/model"
 	"im-backend/internal/pkg"
 	"im-backend/internal/service"
 )
 
 type UserController struct {
-	userService *service.UserService
-	codeService *service.CodeService
+	userService      *service.UserService
+	codeService      *service.CodeService
+	twoFactorService *service.TwoFactorService
+	oidcService      *service.OIDCService
+	loginGuard       *service.LoginGuard
+	accountService   *service.AccountService
 }
 
-func NewUserController(userService *service.UserService, codeService *service.CodeService) *UserController {
-	return &UserController{userService, codeService}
+func NewUserController(userService *service.UserService, codeService *service.CodeService, twoFactorService *service.TwoFactorService, oidcService *service.OIDCService, loginGuard *service.LoginGuard, accountService *service.AccountService) *UserController {
+	return &UserController{userService, codeService, twoFactorService, oidcService, loginGuard, accountService}
 }
 
 // Register 注册
@@ -22,28 +27,116 @@ func (c *UserController) Register(email, code, userID, nickname string) error {
 }
 
 // Login 登录
-func (c *UserController) Login(email, code string) (map[string]interface{}, error) {
+func (c *UserController) Login(email, code string, client service.LoginClient) (map[string]interface{}, error) {
 	ctx := context.Background()
 	user, err := c.userService.Login(ctx, email, code)
 	if err != nil {
 		return nil, err
 	}
 
-	// 生成 Token 并存入 Redis
-	token, err := pkg.GenerateToken(user.Email, c.userService.RDB)
+	return c.completeLogin(user, model.LoginMethodCode, client)
+}
+
+// completeLogin 第一步验证通过后：开启两步验证的用户返回挑战令牌，否则直接签发登录令牌
+func (c *UserController) completeLogin(user *model.User, method string, client service.LoginClient) (map[string]interface{}, error) {
+	if user.TwoFactorEnabled {
+		challenge, err := c.twoFactorService.CreateChallenge(user.UserID, method)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"two_factor_required": challenge.TwoFactorRequired,
+			"challenge_token":     challenge.ChallengeToken,
+			"expires_in":          challenge.ExpiresIn,
+		}, nil
+	}
+	return c.issueTokens(user, method, client)
+}
+
+// issueTokens 创建登录会话，签发 Access Token 和 Refresh Token，并记录登录
+func (c *UserController) issueTokens(user *model.User, method string, client service.LoginClient) (map[string]interface{}, error) {
+	tokens, err := pkg.GenerateToken(user.UserID, user.Email, c.userService.RDB)
 	if err != nil {
 		return nil, err
 	}
+	c.loginGuard.RecordSuccess(user, method, client)
 
 	return map[string]interface{}{
-		"token": token,
-		"user":  user,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+		"user":          user.Self(),
 	}, nil
 }
 
-// Me 获取用户信息
-func (c *UserController) Me(email string) (interface{}, error) {
-	return c.userService.FindByEmail(email)
+// VerifyTwoFactorLogin 登录第二步：用挑战令牌和 TOTP 验证码（或恢复码）换取登录令牌
+func (c *UserController) VerifyTwoFactorLogin(challengeToken, code string, client service.LoginClient) (map[string]interface{}, error) {
+	user, method, err := c.twoFactorService.VerifyChallenge(challengeToken, code, client)
+	if err != nil {
+		return nil, err
+	}
+	return c.issueTokens(user, method, client)
+}
+
+// OIDCProviders 已配置的单点登录提供方
+func (c *UserController) OIDCProviders() []string {
+	return c.oidcService.Providers()
+}
+
+// OIDCAuthorizationURL 生成单点登录的授权地址
+func (c *UserController) OIDCAuthorizationURL(provider string) (string, error) {
+	return c.oidcService.AuthorizationURL(provider)
+}
+
+// OIDCCallback 单点登录回调，与其他登录方式一样需要通过两步验证
+func (c *UserController) OIDCCallback(provider, state, code string, client service.LoginClient) (map[string]interface{}, error) {
+	user, err := c.oidcService.Callback(provider, state, code)
+	if err != nil {
+		return nil, err
+	}
+	return c.completeLogin(user, model.LoginMethodOIDC, client)
+}
+
+// SetupTwoFactor 获取两步验证密钥
+func (c *UserController) SetupTwoFactor(userID string) (interface{}, error) {
+	return c.twoFactorService.Setup(userID)
+}
+
+// EnableTwoFactor 确认并开启两步验证
+func (c *UserController) EnableTwoFactor(userID, code string) (interface{}, error) {
+	codes, err := c.twoFactorService.Enable(userID, code)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"recovery_codes": codes}, nil
+}
+
+// DisableTwoFactor 关闭两步验证
+func (c *UserController) DisableTwoFactor(userID, code string, client service.LoginClient) error {
+	return c.twoFactorService.Disable(userID, code, client)
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码
+func (c *UserController) RegenerateRecoveryCodes(userID, code string, client service.LoginClient) (interface{}, error) {
+	codes, err := c.twoFactorService.RegenerateRecoveryCodes(userID, code, client)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"recovery_codes": codes}, nil
+}
+
+// TwoFactorStatus 查询两步验证状态
+func (c *UserController) TwoFactorStatus(userID string) (interface{}, error) {
+	return c.twoFactorService.Status(userID)
+}
+
+// Me 获取用户信息（包含只对本人可见的账号状态）
+func (c *UserController) Me(userID string) (interface{}, error) {
+	user, err := c.userService.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	return user.Self(), nil
 }
 
 // Logout 登出
@@ -54,8 +147,19 @@ func (c *UserController) Logout(tokenString string) error {
 		return err
 	}
 
-	// 用 userID 删除 Redis 中的 token
-	return pkg.DeleteToken(claims.Email, c.userService.RDB)
+	// 注销当前会话
+	return pkg.DeleteToken(claims.UserID, claims.SessionID, c.userService.RDB)
+}
+
+// Refresh 使用 Refresh Token 换取新的令牌对
+func (c *UserController) Refresh(refreshToken string) (*pkg.TokenPair, error) {
+	return pkg.RefreshToken(refreshToken, c.userService.RDB, func(email string) (string, error) {
+		user, err := c.userService.Repo.FindByEmail(email)
+		if err != nil {
+			return "", err
+		}
+		return user.UserID, nil
+	})
 }
 
 // RegisterWithPassword 注册（邮箱+密码）
@@ -64,40 +168,123 @@ func (c *UserController) RegisterWithPassword(email, userID, nickname, password
 }
 
 // LoginWithPassword 登录（User ID/Email + 密码）
-func (c *UserController) LoginWithPassword(account, password string) (map[string]interface{}, error) {
+// 账号或IP连续失败后临时锁定，锁定期间即使密码正确也拒绝登录
+func (c *UserController) LoginWithPassword(account, password string, client service.LoginClient) (map[string]interface{}, error) {
+	if err := c.loginGuard.Check(account, client.IP); err != nil {
+		return nil, err
+	}
+
 	user, err := c.userService.LoginWithPassword(context.Background(), account, password)
 	if err != nil {
+		c.loginGuard.RecordFailure(account, client, err.Error())
 		return nil, err
 	}
 
-	token, err := pkg.GenerateToken(user.Email, c.userService.RDB)
+	return c.completeLogin(user, model.LoginMethodPassword, client)
+}
+
+// LoginHistory 查询登录记录
+func (c *UserController) LoginHistory(userID string, cursor uint, pageSize int) (interface{}, error) {
+	return c.loginGuard.GetHistory(userID, cursor, pageSize)
+}
+
+// ChangePassword 设置或修改密码
+func (c *UserController) ChangePassword(userID, sessionID, oldPassword, code, newPassword string, client service.LoginClient) error {
+	return c.userService.ChangePassword(context.Background(), userID, sessionID, oldPassword, code, newPassword, client)
+}
+
+// ForgotPassword 发送重置密码验证码
+func (c *UserController) ForgotPassword(email string) error {
+	return c.userService.SendResetCode(context.Background(), email)
+}
+
+// ResetPassword 通过验证码重置密码
+func (c *UserController) ResetPassword(email, code, password string) error {
+	return c.userService.ResetPassword(context.Background(), email, code, password)
+}
+
+// RequestEmailChange 修改邮箱：向当前邮箱和新邮箱发送验证码
+func (c *UserController) RequestEmailChange(userID, newEmail string) error {
+	return c.userService.RequestEmailChange(context.Background(), userID, newEmail)
+}
+
+// ConfirmEmailChange 确认修改邮箱，原有会话全部注销，为当前客户端签发新邮箱的令牌
+func (c *UserController) ConfirmEmailChange(userID, oldCode, newCode string) (map[string]interface{}, error) {
+	user, err := c.userService.ConfirmEmailChange(context.Background(), userID, oldCode, newCode)
 	if err != nil {
 		return nil, err
 	}
 
+	tokens, err := pkg.GenerateToken(user.UserID, user.Email, c.userService.RDB)
+	if err != nil {
+		return nil, err
+	}
 	return map[string]interface{}{
-		"token": token,
-		"user":  user,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+		"user":          user.Self(),
 	}, nil
 }
 
-// SetPassword 设置密码
-func (c *UserController) SetPassword(email, password string) error {
-	return c.userService.SetPassword(context.Background(), email, password)
+// SendCode 发送邮件验证码
+func (c *UserController) SendCode(email, purpose string) error {
+	return c.codeService.SendCode(email, c.codePurpose(email, purpose))
 }
 
-// SendCode 发送邮件验证码
-func (c *UserController) SendCode(email string) error {
-	return c.codeService.SendCode(email)
+// VerifyCode 验证邮件验证码（不消耗）
+func (c *UserController) VerifyCode(email, purpose, code string) (bool, error) {
+	return c.codeService.VerifyCode(email, c.codePurpose(email, purpose), code)
+}
+
+// codePurpose 未指定用途时兼容旧客户端：已注册的邮箱按登录处理，否则按注册处理
+func (c *UserController) codePurpose(email, purpose string) string {
+	if purpose != "" {
+		return purpose
+	}
+	if _, err := c.userService.Repo.FindByEmail(email); err == nil {
+		return service.CodePurposeLogin
+	}
+	return service.CodePurposeRegister
+}
+
+// ExportData 获取个人数据导出任务，没有可用的导出时创建新任务
+func (c *UserController) ExportData(userID string) (interface{}, error) {
+	return c.accountService.RequestExport(userID)
+}
+
+// ExportFile 获取已完成的导出文件路径
+func (c *UserController) ExportFile(userID string, exportID uint) (string, error) {
+	path, _, err := c.accountService.GetExportFile(userID, exportID)
+	return path, err
+}
+
+// RequestDeletion 申请注销账号，返回计划清除数据的时间
+func (c *UserController) RequestDeletion(userID, password, code, twoFactorCode string, client service.LoginClient) (interface{}, error) {
+	at, err := c.accountService.RequestDeletion(context.Background(), userID, password, code, twoFactorCode, client)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"deletion_scheduled_at": at}, nil
+}
+
+// CancelDeletion 撤销注销
+func (c *UserController) CancelDeletion(userID string) error {
+	return c.accountService.CancelDeletion(context.Background(), userID)
+}
+
+// GetPrivacy 获取隐私设置
+func (c *UserController) GetPrivacy(userID string) (interface{}, error) {
+	return c.userService.GetPrivacy(context.Background(), userID)
 }
 
-// VerifyCode 验证邮件验证码
-func (c *UserController) VerifyCode(email, code string) (bool, error) {
-	return c.codeService.VerifyCode(email, code)
+// UpdatePrivacy 修改隐私设置
+func (c *UserController) UpdatePrivacy(userID string, update service.PrivacyUpdate) (interface{}, error) {
+	return c.userService.UpdatePrivacy(context.Background(), userID, update)
 }
 
 // UpdateProfile 更新用户资料
-func (c *UserController) UpdateProfile(email string, nickname, avatar *string) error {
+func (c *UserController) UpdateProfile(userID string, nickname, avatar *string) error {
 	ctx := context.Background()
-	return c.userService.UpdateProfile(ctx, email, nickname, avatar)
+	return c.userService.UpdateProfile(ctx, userID, nickname, avatar)
 }
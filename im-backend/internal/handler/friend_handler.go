@@ -2,9 +2,9 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"im-backend/internal/controller"
 	"im-backend/internal/pkg"
-	"im-backend/internal/repository"
 	"net/http"
 	"strconv"
 
@@ -13,24 +13,21 @@ import (
 
 type FriendHandler struct {
 	controller *controller.FriendController
-	userRepo   *repository.UserRepository
 }
 
-func NewFriendHandler(controller *controller.FriendController, userRepo *repository.UserRepository) *FriendHandler {
+func NewFriendHandler(controller *controller.FriendController) *FriendHandler {
 	return &FriendHandler{
 		controller: controller,
-		userRepo:   userRepo,
 	}
 }
 
-// getUserID 从Context的Email获取user_id
+// getUserID 获取当前认证用户的user_id
 func (h *FriendHandler) getUserID(r *http.Request) (string, error) {
-	email := pkg.GetUserIDFromContext(r.Context())
-	user, err := h.userRepo.FindByEmail(email)
-	if err != nil {
-		return "", err
+	userID := pkg.GetUserIDFromContext(r.Context())
+	if userID == "" {
+		return "", errors.New("未认证")
 	}
-	return user.UserID, nil
+	return userID, nil
 }
 
 // SendRequest 发送好友请求
@@ -38,6 +35,7 @@ func (h *FriendHandler) SendRequest(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		ToUserID string `json:"to_user_id"`
 		Message  string `json:"message"`
+		Answer   string `json:"answer"` // 对方设置了好友验证问题时必填
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -51,7 +49,7 @@ func (h *FriendHandler) SendRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.controller.SendRequest(userID, req.ToUserID, req.Message); err != nil {
+	if err := h.controller.SendRequest(userID, req.ToUserID, req.Message, req.Answer); err != nil {
 		pkg.Error(w, 500, err.Error())
 		return
 	}
@@ -117,7 +115,17 @@ func (h *FriendHandler) GetFriendList(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	friends, err := h.controller.GetFriendList(userID)
+	var tagID uint
+	if tagIDStr := r.URL.Query().Get("tag_id"); tagIDStr != "" {
+		id, err := strconv.ParseUint(tagIDStr, 10, 32)
+		if err != nil {
+			pkg.Error(w, 400, "无效的标签ID")
+			return
+		}
+		tagID = uint(id)
+	}
+
+	friends, err := h.controller.GetFriendList(userID, tagID)
 	if err != nil {
 		pkg.Error(w, 500, err.Error())
 		return
@@ -224,15 +232,22 @@ func (h *FriendHandler) GetSentRequests(w http.ResponseWriter, r *http.Request)
 	pkg.Success(w, requests)
 }
 
-// SearchFriend 搜索好友
+// SearchFriend 搜索好友（user_id 或 email 二选一）
 func (h *FriendHandler) SearchFriend(w http.ResponseWriter, r *http.Request) {
 	userID := r.URL.Query().Get("user_id")
-	if userID == "" {
-		pkg.Error(w, 400, "用户ID不能为空")
+	email := r.URL.Query().Get("email")
+	if userID == "" && email == "" {
+		pkg.Error(w, 400, "用户ID或邮箱不能为空")
+		return
+	}
+
+	viewerID, err := h.getUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, "用户不存在")
 		return
 	}
 
-	user, err := h.controller.SearchFriend(userID)
+	user, err := h.controller.SearchFriend(viewerID, userID, email)
 	if err != nil {
 		pkg.Error(w, 500, err.Error())
 		return
@@ -240,3 +255,194 @@ func (h *FriendHandler) SearchFriend(w http.ResponseWriter, r *http.Request) {
 
 	pkg.Success(w, user)
 }
+
+// GetRecommendations 获取可能认识的人
+func (h *FriendHandler) GetRecommendations(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, "用户不存在")
+		return
+	}
+
+	limit := 20
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil {
+			limit = l
+		}
+	}
+
+	recommendations, err := h.controller.GetRecommendations(userID, limit)
+	if err != nil {
+		pkg.Error(w, 500, err.Error())
+		return
+	}
+
+	pkg.Success(w, recommendations)
+}
+
+// BlockUser 拉黑用户
+func (h *FriendHandler) BlockUser(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID string `json:"user_id"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == "" {
+		pkg.Error(w, 400, "请求参数错误")
+		return
+	}
+
+	userID, err := h.getUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, "用户不存在")
+		return
+	}
+
+	if err := h.controller.BlockUser(userID, req.UserID); err != nil {
+		pkg.Error(w, 500, err.Error())
+		return
+	}
+
+	pkg.Success(w, "已加入黑名单")
+}
+
+// UnblockUser 取消拉黑
+func (h *FriendHandler) UnblockUser(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	targetID := vars["user_id"]
+
+	if targetID == "" {
+		pkg.Error(w, 400, "用户ID不能为空")
+		return
+	}
+
+	userID, err := h.getUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, "用户不存在")
+		return
+	}
+
+	if err := h.controller.UnblockUser(userID, targetID); err != nil {
+		pkg.Error(w, 500, err.Error())
+		return
+	}
+
+	pkg.Success(w, "已移出黑名单")
+}
+
+// GetBlockList 获取黑名单列表
+func (h *FriendHandler) GetBlockList(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, "用户不存在")
+		return
+	}
+
+	blocks, err := h.controller.GetBlockList(userID)
+	if err != nil {
+		pkg.Error(w, 500, err.Error())
+		return
+	}
+
+	pkg.Success(w, blocks)
+}
+
+// CreateTag 创建好友标签
+func (h *FriendHandler) CreateTag(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name      string   `json:"name"`
+		FriendIDs []string `json:"friend_ids"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.Error(w, 400, "请求参数错误")
+		return
+	}
+
+	userID, err := h.getUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, "用户不存在")
+		return
+	}
+
+	tag, err := h.controller.CreateTag(userID, req.Name, req.FriendIDs)
+	if err != nil {
+		pkg.Error(w, 500, err.Error())
+		return
+	}
+
+	pkg.Success(w, tag)
+}
+
+// GetTags 获取好友标签列表
+func (h *FriendHandler) GetTags(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, "用户不存在")
+		return
+	}
+
+	tags, err := h.controller.GetTags(userID)
+	if err != nil {
+		pkg.Error(w, 500, err.Error())
+		return
+	}
+
+	pkg.Success(w, tags)
+}
+
+// UpdateTag 修改好友标签（名称和/或成员）
+func (h *FriendHandler) UpdateTag(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	tagID, err := strconv.ParseUint(vars["tag_id"], 10, 32)
+	if err != nil {
+		pkg.Error(w, 400, "无效的标签ID")
+		return
+	}
+
+	var req struct {
+		Name      string   `json:"name"`
+		FriendIDs []string `json:"friend_ids"` // 不传表示不修改成员，传空数组表示清空
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.Error(w, 400, "请求参数错误")
+		return
+	}
+
+	userID, err := h.getUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, "用户不存在")
+		return
+	}
+
+	tag, err := h.controller.UpdateTag(uint(tagID), userID, req.Name, req.FriendIDs)
+	if err != nil {
+		pkg.Error(w, 500, err.Error())
+		return
+	}
+
+	pkg.Success(w, tag)
+}
+
+// DeleteTag 删除好友标签
+func (h *FriendHandler) DeleteTag(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	tagID, err := strconv.ParseUint(vars["tag_id"], 10, 32)
+	if err != nil {
+		pkg.Error(w, 400, "无效的标签ID")
+		return
+	}
+
+	userID, err := h.getUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, "用户不存在")
+		return
+	}
+
+	if err := h.controller.DeleteTag(uint(tagID), userID); err != nil {
+		pkg.Error(w, 500, err.Error())
+		return
+	}
+
+	pkg.Success(w, "标签已删除")
+}
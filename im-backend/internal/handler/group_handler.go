@@ -2,9 +2,9 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"im-backend/internal/controller"
 	"im-backend/internal/pkg"
-	"im-backend/internal/repository"
 	"net/http"
 	"strconv"
 
@@ -13,21 +13,28 @@ import (
 
 type GroupHandler struct {
 	groupController *controller.GroupController
-	userRepo        *repository.UserRepository
 }
 
-func NewGroupHandler(groupController *controller.GroupController, userRepo *repository.UserRepository) *GroupHandler {
+func NewGroupHandler(groupController *controller.GroupController) *GroupHandler {
 	return &GroupHandler{
 		groupController: groupController,
-		userRepo:        userRepo,
 	}
 }
 
+// getCurrentUserID 获取当前认证用户的user_id
+func (h *GroupHandler) getCurrentUserID(r *http.Request) (string, error) {
+	userID := pkg.GetUserIDFromContext(r.Context())
+	if userID == "" {
+		return "", errors.New("未认证")
+	}
+	return userID, nil
+}
+
 // ==================== Group 管理 ====================
 
 // CreateGroup 创建群组
 func (h *GroupHandler) CreateGroup(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value("user_id").(string)
+	userID := pkg.GetUserIDFromContext(r.Context())
 
 	var req struct {
 		Name         string `json:"name"`
@@ -72,7 +79,7 @@ func (h *GroupHandler) CreateGroup(w http.ResponseWriter, r *http.Request) {
 
 // GetGroupInfo 获取群组信息
 func (h *GroupHandler) GetGroupInfo(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value("user_id").(string)
+	userID := pkg.GetUserIDFromContext(r.Context())
 	vars := mux.Vars(r)
 	groupID := vars["group_id"]
 
@@ -92,7 +99,7 @@ func (h *GroupHandler) GetGroupInfo(w http.ResponseWriter, r *http.Request) {
 
 // UpdateGroupInfo 更新群组信息
 func (h *GroupHandler) UpdateGroupInfo(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value("user_id").(string)
+	userID := pkg.GetUserIDFromContext(r.Context())
 	vars := mux.Vars(r)
 	groupID := vars["group_id"]
 
@@ -123,7 +130,7 @@ func (h *GroupHandler) UpdateGroupInfo(w http.ResponseWriter, r *http.Request) {
 
 // DeleteGroup 解散群组
 func (h *GroupHandler) DeleteGroup(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value("user_id").(string)
+	userID := pkg.GetUserIDFromContext(r.Context())
 	vars := mux.Vars(r)
 	groupID := vars["group_id"]
 
@@ -143,7 +150,7 @@ func (h *GroupHandler) DeleteGroup(w http.ResponseWriter, r *http.Request) {
 
 // GetUserGroups 获取用户加入的群组列表
 func (h *GroupHandler) GetUserGroups(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value("user_id").(string)
+	userID := pkg.GetUserIDFromContext(r.Context())
 
 	// 获取分页参数
 	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
@@ -193,7 +200,7 @@ func (h *GroupHandler) SearchGroups(w http.ResponseWriter, r *http.Request) {
 
 // JoinGroup 加入群组
 func (h *GroupHandler) JoinGroup(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value("user_id").(string)
+	userID := pkg.GetUserIDFromContext(r.Context())
 
 	var req struct {
 		GroupID string `json:"group_id"`
@@ -218,9 +225,50 @@ func (h *GroupHandler) JoinGroup(w http.ResponseWriter, r *http.Request) {
 	pkg.Success(w, "加入群组成功")
 }
 
+// InviteMembers 邀请好友入群（支持按好友标签选择）
+func (h *GroupHandler) InviteMembers(w http.ResponseWriter, r *http.Request) {
+	operatorID, err := h.getCurrentUserID(r)
+	if err != nil {
+		pkg.Error(w, 4001, err.Error())
+		return
+	}
+	vars := mux.Vars(r)
+	groupID := vars["group_id"]
+
+	if groupID == "" {
+		pkg.Error(w, 4001, "群组ID不能为空")
+		return
+	}
+
+	var req struct {
+		UserIDs []string `json:"user_ids"`
+		TagIDs  []uint   `json:"tag_ids"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.Error(w, 4001, "请求参数格式错误")
+		return
+	}
+
+	if len(req.UserIDs) == 0 && len(req.TagIDs) == 0 {
+		pkg.Error(w, 4001, "请选择要邀请的好友或标签")
+		return
+	}
+
+	count, err := h.groupController.InviteMembers(groupID, operatorID, req.UserIDs, req.TagIDs)
+	if err != nil {
+		pkg.Error(w, 4002, err.Error())
+		return
+	}
+
+	pkg.Success(w, map[string]interface{}{
+		"invited_count": count,
+	})
+}
+
 // LeaveGroup 退出群组
 func (h *GroupHandler) LeaveGroup(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value("user_id").(string)
+	userID := pkg.GetUserIDFromContext(r.Context())
 	vars := mux.Vars(r)
 	groupID := vars["group_id"]
 
@@ -240,7 +288,7 @@ func (h *GroupHandler) LeaveGroup(w http.ResponseWriter, r *http.Request) {
 
 // KickMember 踢出成员
 func (h *GroupHandler) KickMember(w http.ResponseWriter, r *http.Request) {
-	operatorID := r.Context().Value("user_id").(string)
+	operatorID := pkg.GetUserIDFromContext(r.Context())
 	vars := mux.Vars(r)
 	groupID := vars["group_id"]
 
@@ -274,7 +322,7 @@ func (h *GroupHandler) KickMember(w http.ResponseWriter, r *http.Request) {
 
 // SetMemberRole 设置成员角色
 func (h *GroupHandler) SetMemberRole(w http.ResponseWriter, r *http.Request) {
-	operatorID := r.Context().Value("user_id").(string)
+	operatorID := pkg.GetUserIDFromContext(r.Context())
 	vars := mux.Vars(r)
 	groupID := vars["group_id"]
 
@@ -309,7 +357,7 @@ func (h *GroupHandler) SetMemberRole(w http.ResponseWriter, r *http.Request) {
 
 // GetGroupMembers 获取群成员列表
 func (h *GroupHandler) GetGroupMembers(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value("user_id").(string)
+	userID := pkg.GetUserIDFromContext(r.Context())
 	vars := mux.Vars(r)
 	groupID := vars["group_id"]
 
@@ -342,7 +390,7 @@ func (h *GroupHandler) GetGroupMembers(w http.ResponseWriter, r *http.Request) {
 
 // SendGroupMessage 发送群消息
 func (h *GroupHandler) SendGroupMessage(w http.ResponseWriter, r *http.Request) {
-	fromUserID := r.Context().Value("user_id").(string)
+	fromUserID := pkg.GetUserIDFromContext(r.Context())
 
 	var req struct {
 		GroupID     string `json:"group_id"`
@@ -384,7 +432,7 @@ func (h *GroupHandler) SendGroupMessage(w http.ResponseWriter, r *http.Request)
 
 // GetGroupMessages 获取群消息历史
 func (h *GroupHandler) GetGroupMessages(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value("user_id").(string)
+	userID := pkg.GetUserIDFromContext(r.Context())
 	vars := mux.Vars(r)
 	groupID := vars["group_id"]
 
@@ -415,7 +463,7 @@ func (h *GroupHandler) GetGroupMessages(w http.ResponseWriter, r *http.Request)
 
 // RecallGroupMessage 撤回群消息
 func (h *GroupHandler) RecallGroupMessage(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value("user_id").(string)
+	userID := pkg.GetUserIDFromContext(r.Context())
 	vars := mux.Vars(r)
 	messageIDStr := vars["message_id"]
 
@@ -436,7 +484,7 @@ func (h *GroupHandler) RecallGroupMessage(w http.ResponseWriter, r *http.Request
 
 // MarkGroupMessagesAsRead 标记群消息为已读
 func (h *GroupHandler) MarkGroupMessagesAsRead(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value("user_id").(string)
+	userID := pkg.GetUserIDFromContext(r.Context())
 	vars := mux.Vars(r)
 	groupID := vars["group_id"]
 
@@ -456,7 +504,7 @@ func (h *GroupHandler) MarkGroupMessagesAsRead(w http.ResponseWriter, r *http.Re
 
 // GetUserUnreadGroupMessages 获取用户在群组中的未读消息数
 func (h *GroupHandler) GetUserUnreadGroupMessages(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value("user_id").(string)
+	userID := pkg.GetUserIDFromContext(r.Context())
 	vars := mux.Vars(r)
 	groupID := vars["group_id"]
 
@@ -475,3 +523,36 @@ func (h *GroupHandler) GetUserUnreadGroupMessages(w http.ResponseWriter, r *http
 		"count": count,
 	})
 }
+
+// SetMessageTTL 设置群消息存活时间（阅后即焚）
+func (h *GroupHandler) SetMessageTTL(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getCurrentUserID(r)
+	if err != nil {
+		pkg.Error(w, 4001, err.Error())
+		return
+	}
+	vars := mux.Vars(r)
+	groupID := vars["group_id"]
+
+	if groupID == "" {
+		pkg.Error(w, 4001, "群组ID不能为空")
+		return
+	}
+
+	var req struct {
+		TTL  int `json:"ttl"`  // 存活时间（秒），0表示关闭
+		Mode int `json:"mode"` // 0-发送后计时，1-首次已读后计时
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.Error(w, 4001, "请求参数格式错误")
+		return
+	}
+
+	if err := h.groupController.SetMessageTTL(groupID, userID, req.TTL, req.Mode); err != nil {
+		pkg.Error(w, 4002, err.Error())
+		return
+	}
+
+	pkg.Success(w, "消息存活时间已更新")
+}
@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"im-backend/internal/controller"
+	"im-backend/internal/pkg"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type InviteHandler struct {
+	controller *controller.InviteController
+}
+
+func NewInviteHandler(controller *controller.InviteController) *InviteHandler {
+	return &InviteHandler{
+		controller: controller,
+	}
+}
+
+// getCurrentUserID 获取当前认证用户的user_id
+func (h *InviteHandler) getCurrentUserID(r *http.Request) (string, error) {
+	userID := pkg.GetUserIDFromContext(r.Context())
+	if userID == "" {
+		return "", errors.New("未认证")
+	}
+	return userID, nil
+}
+
+// CreateInvite 创建邀请链接
+func (h *InviteHandler) CreateInvite(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Type         int    `json:"type"`          // 1-好友名片，2-群邀请
+		GroupID      string `json:"group_id"`      // 群邀请必填
+		ExpireIn     int    `json:"expire_in"`     // 有效期（秒），0表示永不过期
+		MaxUses      int    `json:"max_uses"`      // 最大使用次数，0表示不限
+		SkipApproval bool   `json:"skip_approval"` // 群邀请是否跳过入群审批
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.Error(w, 400, "请求参数错误")
+		return
+	}
+
+	userID, err := h.getCurrentUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, err.Error())
+		return
+	}
+
+	invite, err := h.controller.CreateInvite(userID, req.Type, req.GroupID, req.ExpireIn, req.MaxUses, req.SkipApproval)
+	if err != nil {
+		pkg.Error(w, 500, err.Error())
+		return
+	}
+
+	pkg.Success(w, invite)
+}
+
+// GetInvites 获取邀请链接列表
+func (h *InviteHandler) GetInvites(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getCurrentUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, err.Error())
+		return
+	}
+
+	invites, err := h.controller.GetInvites(userID, r.URL.Query().Get("group_id"))
+	if err != nil {
+		pkg.Error(w, 500, err.Error())
+		return
+	}
+
+	pkg.Success(w, invites)
+}
+
+// RevokeInvite 撤销邀请链接
+func (h *InviteHandler) RevokeInvite(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		pkg.Error(w, 400, "无效的邀请ID")
+		return
+	}
+
+	userID, err := h.getCurrentUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, err.Error())
+		return
+	}
+
+	if err := h.controller.RevokeInvite(uint(id), userID); err != nil {
+		pkg.Error(w, 500, err.Error())
+		return
+	}
+
+	pkg.Success(w, "邀请已撤销")
+}
+
+// GetInviteQRCode 获取邀请二维码（PNG图片）
+func (h *InviteHandler) GetInviteQRCode(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		pkg.Error(w, 400, "无效的邀请ID")
+		return
+	}
+
+	userID, err := h.getCurrentUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, err.Error())
+		return
+	}
+
+	image, err := h.controller.GetInviteQRCode(uint(id), userID)
+	if err != nil {
+		pkg.Error(w, 500, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(image)
+}
+
+// GetInviteByToken 预览邀请
+func (h *InviteHandler) GetInviteByToken(w http.ResponseWriter, r *http.Request) {
+	invite, err := h.controller.GetInviteByToken(mux.Vars(r)["token"])
+	if err != nil {
+		pkg.Error(w, 500, err.Error())
+		return
+	}
+
+	pkg.Success(w, invite)
+}
+
+// RedeemInvite 兑换邀请
+func (h *InviteHandler) RedeemInvite(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Message string `json:"message"` // 好友验证信息（可选，默认使用预填内容）
+	}
+	// 请求体可选
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			pkg.Error(w, 400, "请求参数错误")
+			return
+		}
+	}
+
+	userID, err := h.getCurrentUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, err.Error())
+		return
+	}
+
+	invite, err := h.controller.RedeemInvite(mux.Vars(r)["token"], userID, req.Message)
+	if err != nil {
+		pkg.Error(w, 500, err.Error())
+		return
+	}
+
+	pkg.Success(w, invite)
+}
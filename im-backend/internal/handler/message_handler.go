@@ -10,7 +10,6 @@ import (
 	"strconv"
 
 	"errors"
-	"im-backend/internal/repository"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
@@ -19,10 +18,9 @@ import (
 type MessageHandler struct {
 	controller *controller.MessageController
 	upgrader   websocket.Upgrader
-	userRepo   *repository.UserRepository
 }
 
-func NewMessageHandler(controller *controller.MessageController, userRepo *repository.UserRepository) *MessageHandler {
+func NewMessageHandler(controller *controller.MessageController) *MessageHandler {
 	return &MessageHandler{
 		controller: controller,
 		upgrader: websocket.Upgrader{
@@ -30,7 +28,6 @@ func NewMessageHandler(controller *controller.MessageController, userRepo *repos
 			WriteBufferSize: 1024,
 			CheckOrigin:     func(r *http.Request) bool { return true },
 		},
-		userRepo: userRepo,
 	}
 }
 
@@ -66,7 +63,7 @@ func (h *MessageHandler) WebSocketHandler(w http.ResponseWriter, r *http.Request
 			pkg.Error(w, 4001, "Token无效或过期")
 			return
 		}
-		userID = claims.Email
+		userID = claims.UserID
 		log.Printf("✅ Token验证成功, 用户: %s", userID)
 	}
 
@@ -99,17 +96,13 @@ func (h *MessageHandler) WebSocketHandler(w http.ResponseWriter, r *http.Request
 	go client.ReadPump()
 }
 
-// getCurrentUserID 将上下文中的email映射为user_id
+// getCurrentUserID 获取当前认证用户的user_id
 func (h *MessageHandler) getCurrentUserID(r *http.Request) (string, error) {
-	email := pkg.GetUserIDFromContext(r.Context())
-	if email == "" {
+	userID := pkg.GetUserIDFromContext(r.Context())
+	if userID == "" {
 		return "", errors.New("未认证")
 	}
-	user, err := h.userRepo.FindByEmail(email)
-	if err != nil || user == nil {
-		return "", errors.New("用户不存在")
-	}
-	return user.UserID, nil
+	return userID, nil
 }
 
 // SendMessage 发送消息（HTTP接口）
@@ -149,10 +142,9 @@ func (h *MessageHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 通过Email进行WebSocket推送
-	toUser, _ := h.userRepo.FindByUserID(req.ToUserID)
-	if toUser != nil && pkg.GlobalHub.IsUserOnline(toUser.Email) {
-		_ = pkg.GlobalHub.SendToUser(toUser.Email, message)
+	// 通过WebSocket推送给在线的接收方（被对方拉黑时不推送）
+	if !message.HiddenFromReceiver && pkg.GlobalHub.IsUserOnline(req.ToUserID) {
+		_ = pkg.GlobalHub.SendToUser(req.ToUserID, message)
 	}
 
 	pkg.Success(w, message)
@@ -318,3 +310,35 @@ func (h *MessageHandler) GetOrCreateConversation(w http.ResponseWriter, r *http.
 	}
 	pkg.Success(w, conversation)
 }
+
+// SetConversationTTL 设置会话消息存活时间（阅后即焚）
+func (h *MessageHandler) SetConversationTTL(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	conversationIDStr := vars["conversation_id"]
+	conversationID, err := strconv.ParseUint(conversationIDStr, 10, 32)
+	if err != nil {
+		pkg.Error(w, 400, "会话ID格式错误")
+		return
+	}
+
+	var req struct {
+		TTL  int `json:"ttl"`  // 存活时间（秒），0表示关闭
+		Mode int `json:"mode"` // 0-发送后计时，1-首次已读后计时
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.Error(w, 400, "请求参数错误")
+		return
+	}
+
+	userID, err := h.getCurrentUserID(r)
+	if err != nil {
+		pkg.Error(w, 4001, err.Error())
+		return
+	}
+
+	if err := h.controller.SetConversationTTL(uint(conversationID), userID, req.TTL, req.Mode); err != nil {
+		pkg.Error(w, 500, err.Error())
+		return
+	}
+	pkg.Success(w, "消息存活时间已更新")
+}
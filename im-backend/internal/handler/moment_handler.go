@@ -2,10 +2,12 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"im-backend/internal/controller"
 	"im-backend/internal/pkg"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -15,7 +17,18 @@ type MomentHandler struct {
 }
 
 func NewMomentHandler(controller *controller.MomentController) *MomentHandler {
-	return &MomentHandler{controller: controller}
+	return &MomentHandler{
+		controller: controller,
+	}
+}
+
+// getUserID 获取当前认证用户的user_id
+func (h *MomentHandler) getUserID(r *http.Request) (string, error) {
+	userID := pkg.GetUserIDFromContext(r.Context())
+	if userID == "" {
+		return "", errors.New("未认证")
+	}
+	return userID, nil
 }
 
 // CreateMoment 发布朋友圈动态
@@ -24,7 +37,11 @@ func (h *MomentHandler) CreateMoment(w http.ResponseWriter, r *http.Request) {
 		Content  string `json:"content"`
 		Images   string `json:"images"` // JSON数组字符串，如：["url1", "url2"]
 		Location string `json:"location"`
-		Visible  int    `json:"visible"` // 0-所有人，1-仅好友，2-私密
+		Visible  int    `json:"visible"` // 0-所有人，1-仅好友，2-私密，3-部分好友可见，4-不给谁看
+
+		// 可见范围为3或4时的好友名单，可按好友标签选择
+		AudienceUserIDs []string `json:"audience_user_ids"`
+		AudienceTagIDs  []uint   `json:"audience_tag_ids"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -33,9 +50,13 @@ func (h *MomentHandler) CreateMoment(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 从上下文获取当前用户ID
-	userID := pkg.GetUserIDFromContext(r.Context())
+	userID, err := h.getUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, "用户不存在")
+		return
+	}
 
-	if err := h.controller.CreateMoment(userID, req.Content, req.Images, req.Location, req.Visible); err != nil {
+	if err := h.controller.CreateMoment(userID, req.Content, req.Images, req.Location, req.Visible, req.AudienceUserIDs, req.AudienceTagIDs); err != nil {
 		pkg.Error(w, 500, err.Error())
 		return
 	}
@@ -55,7 +76,11 @@ func (h *MomentHandler) GetMomentByID(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 从上下文获取当前用户ID
-	userID := pkg.GetUserIDFromContext(r.Context())
+	userID, err := h.getUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, "用户不存在")
+		return
+	}
 
 	moment, err := h.controller.GetMomentByID(uint(momentID), userID)
 	if err != nil {
@@ -69,7 +94,11 @@ func (h *MomentHandler) GetMomentByID(w http.ResponseWriter, r *http.Request) {
 // GetMyMoments 获取自己的朋友圈列表
 func (h *MomentHandler) GetMyMoments(w http.ResponseWriter, r *http.Request) {
 	// 从上下文获取当前用户ID
-	userID := pkg.GetUserIDFromContext(r.Context())
+	userID, err := h.getUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, "用户不存在")
+		return
+	}
 
 	// 获取分页参数
 	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
@@ -93,7 +122,11 @@ func (h *MomentHandler) GetMyMoments(w http.ResponseWriter, r *http.Request) {
 // GetFriendMoments 获取好友的朋友圈时间线
 func (h *MomentHandler) GetFriendMoments(w http.ResponseWriter, r *http.Request) {
 	// 从上下文获取当前用户ID
-	userID := pkg.GetUserIDFromContext(r.Context())
+	userID, err := h.getUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, "用户不存在")
+		return
+	}
 
 	// 获取分页参数
 	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
@@ -105,7 +138,143 @@ func (h *MomentHandler) GetFriendMoments(w http.ResponseWriter, r *http.Request)
 		pageSize = 20
 	}
 
-	moments, err := h.controller.GetFriendMoments(userID, page, pageSize)
+	// 传入 cursor（上一页最后一条动态的ID）时按游标读取缓存的时间线；
+	// 旧客户端仅传 page 时，第一页同样走时间线，后续页保留按页码查询
+	var moments interface{}
+	cursor, _ := strconv.ParseUint(r.URL.Query().Get("cursor"), 10, 64)
+	if cursor > 0 || page == 1 {
+		moments, err = h.controller.GetTimeline(userID, uint(cursor), pageSize)
+	} else {
+		moments, err = h.controller.GetFriendMoments(userID, page, pageSize)
+	}
+	if err != nil {
+		pkg.Error(w, 500, err.Error())
+		return
+	}
+
+	pkg.Success(w, moments)
+}
+
+// RepostMoment 转发动态
+func (h *MomentHandler) RepostMoment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	momentID, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		pkg.Error(w, 400, "动态ID格式错误")
+		return
+	}
+
+	var req struct {
+		Content string `json:"content"` // 转发评论（可选）
+		Visible int    `json:"visible"`
+
+		AudienceUserIDs []string `json:"audience_user_ids"`
+		AudienceTagIDs  []uint   `json:"audience_tag_ids"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.Error(w, 400, "请求参数错误")
+		return
+	}
+
+	// 从上下文获取当前用户ID
+	userID, err := h.getUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, "用户不存在")
+		return
+	}
+
+	if err := h.controller.RepostMoment(uint(momentID), userID, req.Content, req.Visible, req.AudienceUserIDs, req.AudienceTagIDs); err != nil {
+		pkg.Error(w, 500, err.Error())
+		return
+	}
+
+	pkg.Success(w, "转发成功")
+}
+
+// UpdateMoment 编辑动态
+func (h *MomentHandler) UpdateMoment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	momentID, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		pkg.Error(w, 400, "动态ID格式错误")
+		return
+	}
+
+	var req struct {
+		Content  string `json:"content"`
+		Images   string `json:"images"`
+		Location string `json:"location"`
+		Visible  int    `json:"visible"`
+
+		AudienceUserIDs []string `json:"audience_user_ids"`
+		AudienceTagIDs  []uint   `json:"audience_tag_ids"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.Error(w, 400, "请求参数错误")
+		return
+	}
+
+	// 从上下文获取当前用户ID
+	userID, err := h.getUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, "用户不存在")
+		return
+	}
+
+	moment, err := h.controller.UpdateMoment(uint(momentID), userID, req.Content, req.Images, req.Location, req.Visible, req.AudienceUserIDs, req.AudienceTagIDs)
+	if err != nil {
+		pkg.Error(w, 500, err.Error())
+		return
+	}
+
+	pkg.Success(w, moment)
+}
+
+// GetMomentEdits 获取动态编辑历史
+func (h *MomentHandler) GetMomentEdits(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	momentID, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		pkg.Error(w, 400, "动态ID格式错误")
+		return
+	}
+
+	// 从上下文获取当前用户ID
+	userID, err := h.getUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, "用户不存在")
+		return
+	}
+
+	edits, err := h.controller.GetMomentEdits(uint(momentID), userID)
+	if err != nil {
+		pkg.Error(w, 500, err.Error())
+		return
+	}
+
+	pkg.Success(w, edits)
+}
+
+// GetHashtagMoments 获取话题下的动态
+func (h *MomentHandler) GetHashtagMoments(w http.ResponseWriter, r *http.Request) {
+	tag := mux.Vars(r)["tag"]
+
+	// 从上下文获取当前用户ID
+	userID, err := h.getUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, "用户不存在")
+		return
+	}
+
+	cursor, _ := strconv.ParseUint(r.URL.Query().Get("cursor"), 10, 64)
+	pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+
+	moments, err := h.controller.GetHashtagMoments(tag, userID, uint(cursor), pageSize)
 	if err != nil {
 		pkg.Error(w, 500, err.Error())
 		return
@@ -114,6 +283,33 @@ func (h *MomentHandler) GetFriendMoments(w http.ResponseWriter, r *http.Request)
 	pkg.Success(w, moments)
 }
 
+// GetTrendingHashtags 获取热门话题
+func (h *MomentHandler) GetTrendingHashtags(w http.ResponseWriter, r *http.Request) {
+	// 从上下文获取当前用户ID
+	userID, err := h.getUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, "用户不存在")
+		return
+	}
+
+	days, _ := strconv.Atoi(r.URL.Query().Get("days"))
+	if days <= 0 {
+		days = 7
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = 10
+	}
+
+	trends, err := h.controller.GetTrendingHashtags(userID, days, limit)
+	if err != nil {
+		pkg.Error(w, 500, err.Error())
+		return
+	}
+
+	pkg.Success(w, trends)
+}
+
 // DeleteMoment 删除动态
 func (h *MomentHandler) DeleteMoment(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -126,7 +322,11 @@ func (h *MomentHandler) DeleteMoment(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 从上下文获取当前用户ID
-	userID := pkg.GetUserIDFromContext(r.Context())
+	userID, err := h.getUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, "用户不存在")
+		return
+	}
 
 	if err := h.controller.DeleteMoment(uint(momentID), userID); err != nil {
 		pkg.Error(w, 500, err.Error())
@@ -148,7 +348,11 @@ func (h *MomentHandler) LikeMoment(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 从上下文获取当前用户ID
-	userID := pkg.GetUserIDFromContext(r.Context())
+	userID, err := h.getUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, "用户不存在")
+		return
+	}
 
 	if err := h.controller.LikeMoment(uint(momentID), userID); err != nil {
 		pkg.Error(w, 500, err.Error())
@@ -170,7 +374,11 @@ func (h *MomentHandler) UnlikeMoment(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 从上下文获取当前用户ID
-	userID := pkg.GetUserIDFromContext(r.Context())
+	userID, err := h.getUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, "用户不存在")
+		return
+	}
 
 	if err := h.controller.UnlikeMoment(uint(momentID), userID); err != nil {
 		pkg.Error(w, 500, err.Error())
@@ -192,7 +400,11 @@ func (h *MomentHandler) GetLikeList(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 从上下文获取当前用户ID
-	userID := pkg.GetUserIDFromContext(r.Context())
+	userID, err := h.getUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, "用户不存在")
+		return
+	}
 
 	likes, err := h.controller.GetLikeList(uint(momentID), userID)
 	if err != nil {
@@ -230,7 +442,11 @@ func (h *MomentHandler) CommentMoment(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 从上下文获取当前用户ID
-	userID := pkg.GetUserIDFromContext(r.Context())
+	userID, err := h.getUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, "用户不存在")
+		return
+	}
 
 	if err := h.controller.CommentMoment(uint(momentID), userID, req.Content, req.ReplyToID); err != nil {
 		pkg.Error(w, 500, err.Error())
@@ -252,7 +468,11 @@ func (h *MomentHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 从上下文获取当前用户ID
-	userID := pkg.GetUserIDFromContext(r.Context())
+	userID, err := h.getUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, "用户不存在")
+		return
+	}
 
 	if err := h.controller.DeleteComment(uint(commentID), userID); err != nil {
 		pkg.Error(w, 500, err.Error())
@@ -274,9 +494,19 @@ func (h *MomentHandler) GetCommentList(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 从上下文获取当前用户ID
-	userID := pkg.GetUserIDFromContext(r.Context())
+	userID, err := h.getUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, "用户不存在")
+		return
+	}
+
+	cursor, _ := strconv.ParseUint(r.URL.Query().Get("cursor"), 10, 64)
+	pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+	if pageSize <= 0 {
+		pageSize = 20
+	}
 
-	comments, err := h.controller.GetCommentList(uint(momentID), userID)
+	comments, err := h.controller.GetCommentList(uint(momentID), userID, uint(cursor), pageSize)
 	if err != nil {
 		pkg.Error(w, 500, err.Error())
 		return
@@ -284,3 +514,180 @@ func (h *MomentHandler) GetCommentList(w http.ResponseWriter, r *http.Request) {
 
 	pkg.Success(w, comments)
 }
+
+// GetCommentReplies 获取评论楼中的回复
+func (h *MomentHandler) GetCommentReplies(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	commentID, err := strconv.ParseUint(vars["comment_id"], 10, 32)
+	if err != nil {
+		pkg.Error(w, 400, "评论ID格式错误")
+		return
+	}
+
+	// 从上下文获取当前用户ID
+	userID, err := h.getUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, "用户不存在")
+		return
+	}
+
+	cursor, _ := strconv.ParseUint(r.URL.Query().Get("cursor"), 10, 64)
+	pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+
+	replies, err := h.controller.GetCommentReplies(uint(commentID), userID, uint(cursor), pageSize)
+	if err != nil {
+		pkg.Error(w, 500, err.Error())
+		return
+	}
+
+	pkg.Success(w, replies)
+}
+
+// LikeComment 点赞评论
+func (h *MomentHandler) LikeComment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	commentID, err := strconv.ParseUint(vars["comment_id"], 10, 32)
+	if err != nil {
+		pkg.Error(w, 400, "评论ID格式错误")
+		return
+	}
+
+	// 从上下文获取当前用户ID
+	userID, err := h.getUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, "用户不存在")
+		return
+	}
+
+	if err := h.controller.LikeComment(uint(commentID), userID); err != nil {
+		pkg.Error(w, 500, err.Error())
+		return
+	}
+
+	pkg.Success(w, "点赞成功")
+}
+
+// UnlikeComment 取消评论点赞
+func (h *MomentHandler) UnlikeComment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	commentID, err := strconv.ParseUint(vars["comment_id"], 10, 32)
+	if err != nil {
+		pkg.Error(w, 400, "评论ID格式错误")
+		return
+	}
+
+	// 从上下文获取当前用户ID
+	userID, err := h.getUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, "用户不存在")
+		return
+	}
+
+	if err := h.controller.UnlikeComment(uint(commentID), userID); err != nil {
+		pkg.Error(w, 500, err.Error())
+		return
+	}
+
+	pkg.Success(w, "已取消点赞")
+}
+
+// GetNotifications 获取互动通知列表
+func (h *MomentHandler) GetNotifications(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, "用户不存在")
+		return
+	}
+
+	// 获取分页参数
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page <= 0 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+
+	notifications, err := h.controller.GetNotifications(userID, page, pageSize)
+	if err != nil {
+		pkg.Error(w, 500, err.Error())
+		return
+	}
+
+	pkg.Success(w, notifications)
+}
+
+// GetUnreadNotificationCount 获取未读互动通知数
+func (h *MomentHandler) GetUnreadNotificationCount(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, "用户不存在")
+		return
+	}
+
+	count, err := h.controller.GetUnreadNotificationCount(userID)
+	if err != nil {
+		pkg.Error(w, 500, err.Error())
+		return
+	}
+
+	pkg.Success(w, map[string]interface{}{
+		"unread_count": count,
+	})
+}
+
+// MarkNotificationsRead 标记互动通知为已读
+func (h *MomentHandler) MarkNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		IDs []uint `json:"ids"` // 为空时标记全部
+	}
+	// 请求体可选
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			pkg.Error(w, 400, "请求参数错误")
+			return
+		}
+	}
+
+	userID, err := h.getUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, "用户不存在")
+		return
+	}
+
+	if err := h.controller.MarkNotificationsRead(userID, req.IDs); err != nil {
+		pkg.Error(w, 500, err.Error())
+		return
+	}
+
+	pkg.Success(w, "已标记为已读")
+}
+
+// GetNewTimelineCount 获取某时间之后时间线中的新动态数（用于"新动态"角标）
+func (h *MomentHandler) GetNewTimelineCount(w http.ResponseWriter, r *http.Request) {
+	since, err := time.Parse(time.RFC3339, r.URL.Query().Get("since"))
+	if err != nil {
+		pkg.Error(w, 400, "since 参数格式错误，应为RFC3339时间")
+		return
+	}
+
+	userID, err := h.getUserID(r)
+	if err != nil {
+		pkg.Error(w, 401, "用户不存在")
+		return
+	}
+
+	count, err := h.controller.GetNewTimelineCount(userID, since)
+	if err != nil {
+		pkg.Error(w, 500, err.Error())
+		return
+	}
+
+	pkg.Success(w, map[string]interface{}{
+		"new_count": count,
+	})
+}
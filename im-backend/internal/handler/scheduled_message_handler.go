@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"im-backend/internal/controller"
+	"im-backend/internal/pkg"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type ScheduledMessageHandler struct {
+	controller *controller.ScheduledMessageController
+}
+
+func NewScheduledMessageHandler(controller *controller.ScheduledMessageController) *ScheduledMessageHandler {
+	return &ScheduledMessageHandler{
+		controller: controller,
+	}
+}
+
+// getCurrentUserID 获取当前认证用户的user_id
+func (h *ScheduledMessageHandler) getCurrentUserID(r *http.Request) (string, error) {
+	userID := pkg.GetUserIDFromContext(r.Context())
+	if userID == "" {
+		return "", errors.New("未认证")
+	}
+	return userID, nil
+}
+
+// CreateScheduledMessage 创建定时消息
+func (h *ScheduledMessageHandler) CreateScheduledMessage(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		TargetType  int       `json:"target_type"` // 1-私聊，2-群聊
+		TargetID    string    `json:"target_id"`   // 接收者用户ID或群组ID
+		MessageType int       `json:"message_type"`
+		Content     string    `json:"content"`
+		MediaURL    string    `json:"media_url"`
+		AtUsers     string    `json:"at_users"`
+		SendAt      time.Time `json:"send_at"` // RFC3339格式
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.Error(w, 400, "请求参数错误")
+		return
+	}
+
+	userID, err := h.getCurrentUserID(r)
+	if err != nil {
+		pkg.Error(w, 4001, err.Error())
+		return
+	}
+
+	if req.MessageType <= 0 {
+		req.MessageType = 1 // 默认文本消息
+	}
+
+	message, err := h.controller.CreateScheduledMessage(userID, req.TargetType, req.TargetID, req.MessageType, req.Content, req.MediaURL, req.AtUsers, req.SendAt)
+	if err != nil {
+		pkg.Error(w, 500, err.Error())
+		return
+	}
+
+	pkg.Success(w, message)
+}
+
+// GetScheduledMessages 获取定时消息列表
+func (h *ScheduledMessageHandler) GetScheduledMessages(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getCurrentUserID(r)
+	if err != nil {
+		pkg.Error(w, 4001, err.Error())
+		return
+	}
+
+	status := -1
+	if statusStr := r.URL.Query().Get("status"); statusStr != "" {
+		if s, err := strconv.Atoi(statusStr); err == nil {
+			status = s
+		}
+	}
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page <= 0 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+
+	messages, err := h.controller.GetScheduledMessages(userID, status, page, pageSize)
+	if err != nil {
+		pkg.Error(w, 500, err.Error())
+		return
+	}
+
+	pkg.Success(w, messages)
+}
+
+// CancelScheduledMessage 取消定时消息
+func (h *ScheduledMessageHandler) CancelScheduledMessage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		pkg.Error(w, 400, "定时消息ID格式错误")
+		return
+	}
+
+	userID, err := h.getCurrentUserID(r)
+	if err != nil {
+		pkg.Error(w, 4001, err.Error())
+		return
+	}
+
+	if err := h.controller.CancelScheduledMessage(uint(id), userID); err != nil {
+		pkg.Error(w, 500, err.Error())
+		return
+	}
+
+	pkg.Success(w, "定时消息已取消")
+}
@@ -2,10 +2,15 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"im-backend/internal/controller"
 	"im-backend/internal/pkg"
+	"im-backend/internal/service"
 	"net/http"
+	"strconv"
 	"strings"
+
+	"github.com/gorilla/mux"
 )
 
 type UserHandler struct {
@@ -87,7 +92,7 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, err := h.controller.Login(req.Email, req.Code)
+	data, err := h.controller.Login(req.Email, req.Code, loginClient(r))
 	if err != nil {
 		pkg.Error(w, 4003, err.Error())
 		return
@@ -124,17 +129,37 @@ func (h *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	pkg.Success(w, "退出成功")
 }
 
+// Refresh 刷新 Token
+func (h *UserHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		pkg.Error(w, 4001, "参数错误")
+		return
+	}
+
+	tokens, err := h.controller.Refresh(req.RefreshToken)
+	if err != nil {
+		pkg.Error(w, 4003, err.Error())
+		return
+	}
+
+	pkg.Success(w, tokens)
+}
+
 // SendCode 发送邮件验证码
 func (h *UserHandler) SendCode(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Email string `json:"email"`
+		Email   string `json:"email"`
+		Purpose string `json:"purpose"` // register / login / reset_password / change_email / delete_account
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
 		pkg.Error(w, 4001, "参数错误")
 		return
 	}
 
-	if err := h.controller.SendCode(req.Email); err != nil {
+	if err := h.controller.SendCode(req.Email, req.Purpose); err != nil {
 		pkg.Error(w, 4002, err.Error())
 		return
 	}
@@ -145,15 +170,16 @@ func (h *UserHandler) SendCode(w http.ResponseWriter, r *http.Request) {
 // VerifyCode 验证邮件验证码
 func (h *UserHandler) VerifyCode(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Email string `json:"email"`
-		Code  string `json:"code"`
+		Email   string `json:"email"`
+		Purpose string `json:"purpose"`
+		Code    string `json:"code"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		pkg.Error(w, 4001, "参数错误")
 		return
 	}
 
-	ok, err := h.controller.VerifyCode(req.Email, req.Code)
+	ok, err := h.controller.VerifyCode(req.Email, req.Purpose, req.Code)
 	if err != nil {
 		pkg.Error(w, 4002, err.Error())
 		return
@@ -196,7 +222,10 @@ func (h *UserHandler) LoginWithPassword(w http.ResponseWriter, r *http.Request)
 		// 兼容旧的user_id字段
 		account = r.FormValue("user_id")
 	}
-	data, err := h.controller.LoginWithPassword(account, req.Password)
+	data, err := h.controller.LoginWithPassword(account, req.Password, loginClient(r))
+	if writeLoginLocked(w, err) {
+		return
+	}
 	if err != nil {
 		pkg.Error(w, 4003, err.Error())
 		return
@@ -205,8 +234,167 @@ func (h *UserHandler) LoginWithPassword(w http.ResponseWriter, r *http.Request)
 	pkg.Success(w, data)
 }
 
+// LoginHistory 查询自己的登录记录，cursor 为上一页最后一条记录的ID
+func (h *UserHandler) LoginHistory(w http.ResponseWriter, r *http.Request) {
+	pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 20
+	}
+	cursor, _ := strconv.ParseUint(r.URL.Query().Get("cursor"), 10, 64)
+
+	userID := pkg.GetUserIDFromContext(r.Context())
+	data, err := h.controller.LoginHistory(userID, uint(cursor), pageSize)
+	if err != nil {
+		pkg.Error(w, 4004, err.Error())
+		return
+	}
+
+	pkg.Success(w, data)
+}
+
+// RequestEmailChange 修改邮箱第一步，向当前邮箱和新邮箱发送验证码
+func (h *UserHandler) RequestEmailChange(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		NewEmail string `json:"new_email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.NewEmail == "" {
+		pkg.Error(w, 4001, "参数错误")
+		return
+	}
+
+	userID := pkg.GetUserIDFromContext(r.Context())
+	if err := h.controller.RequestEmailChange(userID, req.NewEmail); err != nil {
+		pkg.Error(w, 4002, err.Error())
+		return
+	}
+
+	pkg.Success(w, map[string]string{"message": "验证码已发送到当前邮箱和新邮箱"})
+}
+
+// ConfirmEmailChange 修改邮箱第二步，返回新的登录令牌
+func (h *UserHandler) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		OldCode string `json:"old_code"` // 当前邮箱收到的验证码
+		NewCode string `json:"new_code"` // 新邮箱收到的验证码
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.OldCode == "" || req.NewCode == "" {
+		pkg.Error(w, 4001, "参数错误")
+		return
+	}
+
+	userID := pkg.GetUserIDFromContext(r.Context())
+	data, err := h.controller.ConfirmEmailChange(userID, req.OldCode, req.NewCode)
+	if err != nil {
+		pkg.Error(w, 4002, err.Error())
+		return
+	}
+
+	pkg.Success(w, data)
+}
+
+// ExportData 导出个人数据：首次请求时创建后台任务，完成后返回下载地址
+func (h *UserHandler) ExportData(w http.ResponseWriter, r *http.Request) {
+	userID := pkg.GetUserIDFromContext(r.Context())
+	data, err := h.controller.ExportData(userID)
+	if err != nil {
+		pkg.Error(w, 4002, err.Error())
+		return
+	}
+
+	pkg.Success(w, data)
+}
+
+// DownloadExport 下载个人数据导出文件（ZIP）
+func (h *UserHandler) DownloadExport(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		pkg.Error(w, 4001, "无效的导出ID")
+		return
+	}
+
+	userID := pkg.GetUserIDFromContext(r.Context())
+	path, err := h.controller.ExportFile(userID, uint(id))
+	if err != nil {
+		pkg.Error(w, 4004, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="esyim-data-export.zip"`)
+	w.Header().Set("Cache-Control", "private, no-store")
+	http.ServeFile(w, r, path)
+}
+
+// RequestDeletion 申请注销账号
+func (h *UserHandler) RequestDeletion(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Password      string `json:"password"`        // 已设置密码时必填
+		Code          string `json:"code"`            // 未设置密码时填 delete_account 用途的验证码
+		TwoFactorCode string `json:"two_factor_code"` // 开启两步验证时必填，TOTP 验证码或恢复码
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.Error(w, 4001, "参数错误")
+		return
+	}
+
+	userID := pkg.GetUserIDFromContext(r.Context())
+	data, err := h.controller.RequestDeletion(userID, req.Password, req.Code, req.TwoFactorCode, loginClient(r))
+	if writeLoginLocked(w, err) {
+		return
+	}
+	if err != nil {
+		pkg.Error(w, 4002, err.Error())
+		return
+	}
+
+	pkg.Success(w, data)
+}
+
+// CancelDeletion 冷静期内撤销注销
+func (h *UserHandler) CancelDeletion(w http.ResponseWriter, r *http.Request) {
+	userID := pkg.GetUserIDFromContext(r.Context())
+	if err := h.controller.CancelDeletion(userID); err != nil {
+		pkg.Error(w, 4002, err.Error())
+		return
+	}
+
+	pkg.Success(w, map[string]string{"message": "已撤销注销"})
+}
+
+// GetPrivacy 获取隐私设置
+func (h *UserHandler) GetPrivacy(w http.ResponseWriter, r *http.Request) {
+	userID := pkg.GetUserIDFromContext(r.Context())
+	data, err := h.controller.GetPrivacy(userID)
+	if err != nil {
+		pkg.Error(w, 4004, err.Error())
+		return
+	}
+
+	pkg.Success(w, data)
+}
+
+// UpdatePrivacy 修改隐私设置，只修改请求中出现的字段
+func (h *UserHandler) UpdatePrivacy(w http.ResponseWriter, r *http.Request) {
+	var req service.PrivacyUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.Error(w, 4001, "参数错误")
+		return
+	}
+
+	userID := pkg.GetUserIDFromContext(r.Context())
+	data, err := h.controller.UpdatePrivacy(userID, req)
+	if err != nil {
+		pkg.Error(w, 4002, err.Error())
+		return
+	}
+
+	pkg.Success(w, data)
+}
+
 type setPasswordRequest struct {
-	Password string `json:"password"`
+	OldPassword string `json:"old_password"` // 当前密码，已设置密码时与 code 二选一
+	Code        string `json:"code"`         // reset_password 用途的验证码
+	Password    string `json:"password"`
 }
 
 // SetPassword 设置或修改密码
@@ -217,14 +405,18 @@ func (h *UserHandler) SetPassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 从上下文获取当前用户email
-	email := pkg.GetUserIDFromContext(r.Context())
-	if email == "" {
+	// 从上下文获取当前用户和登录会话
+	principal := pkg.GetPrincipalFromContext(r.Context())
+	if principal == nil {
 		pkg.Error(w, 4001, "未认证")
 		return
 	}
 
-	if err := h.controller.SetPassword(email, req.Password); err != nil {
+	err := h.controller.ChangePassword(principal.UserID, principal.SessionID, req.OldPassword, req.Code, req.Password, loginClient(r))
+	if writeLoginLocked(w, err) {
+		return
+	}
+	if err != nil {
 		pkg.Error(w, 4002, err.Error())
 		return
 	}
@@ -232,6 +424,45 @@ func (h *UserHandler) SetPassword(w http.ResponseWriter, r *http.Request) {
 	pkg.Success(w, "密码设置成功")
 }
 
+// ForgotPassword 忘记密码，发送重置验证码
+func (h *UserHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		pkg.Error(w, 4001, "参数错误")
+		return
+	}
+
+	if err := h.controller.ForgotPassword(req.Email); err != nil {
+		pkg.Error(w, 4002, err.Error())
+		return
+	}
+
+	// 无论邮箱是否注册都返回相同结果
+	pkg.Success(w, map[string]string{"message": "如果该邮箱已注册，验证码将发送到邮箱"})
+}
+
+// ResetPassword 通过验证码重置密码
+func (h *UserHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email    string `json:"email"`
+		Code     string `json:"code"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" || req.Code == "" {
+		pkg.Error(w, 4001, "参数错误")
+		return
+	}
+
+	if err := h.controller.ResetPassword(req.Email, req.Code, req.Password); err != nil {
+		pkg.Error(w, 4002, err.Error())
+		return
+	}
+
+	pkg.Success(w, "密码重置成功，请重新登录")
+}
+
 type updateProfileRequest struct {
 	Nickname *string `json:"nickname"`
 	Avatar   *string `json:"avatar"`
@@ -245,17 +476,186 @@ func (h *UserHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 从上下文获取当前用户email
-	email := pkg.GetUserIDFromContext(r.Context())
-	if email == "" {
+	// 从上下文获取当前用户ID
+	userID := pkg.GetUserIDFromContext(r.Context())
+	if userID == "" {
 		pkg.Error(w, 4001, "未认证")
 		return
 	}
 
-	if err := h.controller.UpdateProfile(email, req.Nickname, req.Avatar); err != nil {
+	if err := h.controller.UpdateProfile(userID, req.Nickname, req.Avatar); err != nil {
 		pkg.Error(w, 4002, err.Error())
 		return
 	}
 
 	pkg.Success(w, "资料更新成功")
 }
+
+// OIDCProviders 获取可用的单点登录提供方
+func (h *UserHandler) OIDCProviders(w http.ResponseWriter, r *http.Request) {
+	pkg.Success(w, h.controller.OIDCProviders())
+}
+
+// OIDCLogin 跳转到身份提供方登录，format=json 时返回授权地址（便于移动端和单页应用自行打开）
+func (h *UserHandler) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	authURL, err := h.controller.OIDCAuthorizationURL(mux.Vars(r)["provider"])
+	if err != nil {
+		pkg.Error(w, 4002, err.Error())
+		return
+	}
+
+	if r.URL.Query().Get("format") == "json" {
+		pkg.Success(w, map[string]string{"authorization_url": authURL})
+		return
+	}
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallback 身份提供方回调，返回与其他登录方式相同的结果
+func (h *UserHandler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if errCode := query.Get("error"); errCode != "" {
+		msg := "单点登录失败: " + errCode
+		if desc := query.Get("error_description"); desc != "" {
+			msg += " " + desc
+		}
+		pkg.Error(w, 4003, msg)
+		return
+	}
+
+	data, err := h.controller.OIDCCallback(mux.Vars(r)["provider"], query.Get("state"), query.Get("code"), loginClient(r))
+	if err != nil {
+		pkg.Error(w, 4003, err.Error())
+		return
+	}
+
+	pkg.Success(w, data)
+}
+
+// twoFactorCodeRequest 两步验证相关请求体，code 为 TOTP 验证码或恢复码
+type twoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// VerifyTwoFactorLogin 登录第二步
+func (h *UserHandler) VerifyTwoFactorLogin(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ChallengeToken == "" {
+		pkg.Error(w, 4001, "参数错误")
+		return
+	}
+
+	data, err := h.controller.VerifyTwoFactorLogin(req.ChallengeToken, req.Code, loginClient(r))
+	if writeLoginLocked(w, err) {
+		return
+	}
+	if err != nil {
+		pkg.Error(w, 4003, err.Error())
+		return
+	}
+
+	pkg.Success(w, data)
+}
+
+// TwoFactorStatus 查询两步验证状态
+func (h *UserHandler) TwoFactorStatus(w http.ResponseWriter, r *http.Request) {
+	userID := pkg.GetUserIDFromContext(r.Context())
+	data, err := h.controller.TwoFactorStatus(userID)
+	if err != nil {
+		pkg.Error(w, 4004, err.Error())
+		return
+	}
+
+	pkg.Success(w, data)
+}
+
+// SetupTwoFactor 获取两步验证密钥和 otpauth URI
+func (h *UserHandler) SetupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID := pkg.GetUserIDFromContext(r.Context())
+	data, err := h.controller.SetupTwoFactor(userID)
+	if err != nil {
+		pkg.Error(w, 4002, err.Error())
+		return
+	}
+
+	pkg.Success(w, data)
+}
+
+// EnableTwoFactor 确认密钥并开启两步验证，返回恢复码
+func (h *UserHandler) EnableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req twoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.Error(w, 4001, "参数错误")
+		return
+	}
+
+	userID := pkg.GetUserIDFromContext(r.Context())
+	data, err := h.controller.EnableTwoFactor(userID, req.Code)
+	if err != nil {
+		pkg.Error(w, 4002, err.Error())
+		return
+	}
+
+	pkg.Success(w, data)
+}
+
+// DisableTwoFactor 关闭两步验证
+func (h *UserHandler) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req twoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.Error(w, 4001, "参数错误")
+		return
+	}
+
+	userID := pkg.GetUserIDFromContext(r.Context())
+	err := h.controller.DisableTwoFactor(userID, req.Code, loginClient(r))
+	if writeLoginLocked(w, err) {
+		return
+	}
+	if err != nil {
+		pkg.Error(w, 4002, err.Error())
+		return
+	}
+
+	pkg.Success(w, "两步验证已关闭")
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码
+func (h *UserHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	var req twoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		pkg.Error(w, 4001, "参数错误")
+		return
+	}
+
+	userID := pkg.GetUserIDFromContext(r.Context())
+	data, err := h.controller.RegenerateRecoveryCodes(userID, req.Code, loginClient(r))
+	if writeLoginLocked(w, err) {
+		return
+	}
+	if err != nil {
+		pkg.Error(w, 4002, err.Error())
+		return
+	}
+
+	pkg.Success(w, data)
+}
+
+// writeLoginLocked 账号或IP因连续校验失败被锁定时返回 429 和 Retry-After
+func writeLoginLocked(w http.ResponseWriter, err error) bool {
+	var locked *service.LoginLockedError
+	if !errors.As(err, &locked) {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.FormatInt(int64(locked.RetryAfter.Seconds()), 10))
+	pkg.ErrorWithStatus(w, http.StatusTooManyRequests, pkg.NewAppError(pkg.CodeAccountLocked, err.Error()))
+	return true
+}
+
+// loginClient 登录请求的客户端IP和 User-Agent，用于登录防护和登录记录
+func loginClient(r *http.Request) service.LoginClient {
+	return service.LoginClient{IP: pkg.ClientIP(r), UserAgent: r.UserAgent()}
+}
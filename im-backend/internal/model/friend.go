@@ -36,3 +36,46 @@ type Friend struct {
 	User       *User `gorm:"foreignKey:UserID;references:UserID" json:"user,omitempty"`
 	FriendUser *User `gorm:"foreignKey:FriendID;references:UserID" json:"friend_user,omitempty"`
 }
+
+// UserBlock 黑名单表（单向：UserID 拉黑了 BlockedUserID）
+type UserBlock struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	UserID        string    `gorm:"not null;uniqueIndex:idx_user_blocked,priority:1" json:"user_id"`                                // 拉黑发起方用户ID
+	BlockedUserID string    `gorm:"not null;uniqueIndex:idx_user_blocked,priority:2;index:idx_blocked_user" json:"blocked_user_id"` // 被拉黑的用户ID
+	CreatedAt     time.Time `json:"created_at"`
+
+	// 关联查询
+	BlockedUser *User `gorm:"foreignKey:BlockedUserID;references:UserID" json:"blocked_user,omitempty"`
+}
+
+// FriendRecommendation 好友推荐结果（可能认识的人，非数据表）
+type FriendRecommendation struct {
+	UserID        string      `json:"user_id"`
+	MutualFriends int         `json:"mutual_friends"` // 共同好友数
+	SharedGroups  int         `json:"shared_groups"`  // 共同群组数
+	User          *PublicUser `json:"user,omitempty"` // 公开资料，推荐对象不是好友，不返回邮箱
+}
+
+// FriendTag 好友标签表（用户自定义分组）
+type FriendTag struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    string    `gorm:"not null;uniqueIndex:idx_tag_user_name,priority:1" json:"user_id"`      // 标签所属用户ID
+	Name      string    `gorm:"not null;size:30;uniqueIndex:idx_tag_user_name,priority:2" json:"name"` // 标签名称
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// 关联查询
+	Members []FriendTagMember `gorm:"foreignKey:TagID" json:"members,omitempty"`
+}
+
+// FriendTagMember 好友标签成员表（一个好友可属于多个标签）
+type FriendTagMember struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	TagID     uint      `gorm:"not null;uniqueIndex:idx_tag_friend,priority:1" json:"tag_id"`                                // 标签ID
+	UserID    string    `gorm:"not null;index:idx_tag_member_user" json:"user_id"`                                           // 标签所属用户ID
+	FriendID  string    `gorm:"not null;uniqueIndex:idx_tag_friend,priority:2;index:idx_tag_member_friend" json:"friend_id"` // 好友用户ID
+	CreatedAt time.Time `json:"created_at"`
+
+	// 关联查询
+	FriendUser *User `gorm:"foreignKey:FriendID;references:UserID" json:"friend_user,omitempty"`
+}
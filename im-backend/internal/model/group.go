@@ -8,19 +8,21 @@ import (
 
 // Group 群组表
 type Group struct {
-	ID           uint           `gorm:"primaryKey" json:"id"`
-	GroupID      string         `gorm:"uniqueIndex:idx_group_id;not null;size:50" json:"group_id"` // 群组ID
-	Name         string         `gorm:"not null;size:100" json:"name"`                             // 群组名称
-	Avatar       string         `gorm:"size:255" json:"avatar"`                                    // 群头像
-	Description  string         `gorm:"size:500" json:"description"`                               // 群描述
-	OwnerID      string         `gorm:"not null;index:idx_owner" json:"owner_id"`                  // 群主ID
-	MaxMembers   int            `gorm:"default:500" json:"max_members"`                            // 最大成员数
-	MemberCount  int            `gorm:"default:1" json:"member_count"`                             // 当前成员数
-	IsPublic     bool           `gorm:"default:true" json:"is_public"`                             // 是否公开群组
-	JoinApproval bool           `gorm:"default:false" json:"join_approval"`                        // 是否需要审批加入
-	CreatedAt    time.Time      `gorm:"index:idx_created_at" json:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at"`
-	DeletedAt    gorm.DeletedAt `gorm:"index:idx_deleted_at" json:"-"`
+	ID             uint           `gorm:"primaryKey" json:"id"`
+	GroupID        string         `gorm:"uniqueIndex:idx_group_id;not null;size:50" json:"group_id"` // 群组ID
+	Name           string         `gorm:"not null;size:100" json:"name"`                             // 群组名称
+	Avatar         string         `gorm:"size:255" json:"avatar"`                                    // 群头像
+	Description    string         `gorm:"size:500" json:"description"`                               // 群描述
+	OwnerID        string         `gorm:"not null;index:idx_owner" json:"owner_id"`                  // 群主ID
+	MaxMembers     int            `gorm:"default:500" json:"max_members"`                            // 最大成员数
+	MemberCount    int            `gorm:"default:1" json:"member_count"`                             // 当前成员数
+	IsPublic       bool           `gorm:"default:true" json:"is_public"`                             // 是否公开群组
+	JoinApproval   bool           `gorm:"default:false" json:"join_approval"`                        // 是否需要审批加入
+	MessageTTL     int            `gorm:"default:0" json:"message_ttl"`                              // 消息存活时间（秒），0表示不自动销毁
+	MessageTTLMode int            `gorm:"default:0" json:"message_ttl_mode"`                         // 计时方式：0-发送后计时，1-首次已读后计时
+	CreatedAt      time.Time      `gorm:"index:idx_created_at" json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"index:idx_deleted_at" json:"-"`
 
 	// 关联查询
 	Owner   *User         `gorm:"foreignKey:OwnerID;references:UserID" json:"owner,omitempty"`
@@ -57,6 +59,8 @@ type GroupMessage struct {
 	AtUsers     string         `gorm:"type:text" json:"at_users"`                              // @的用户ID列表（JSON格式）
 	IsRecalled  bool           `gorm:"default:false;index:idx_is_recalled" json:"is_recalled"` // 是否撤回
 	RecalledAt  *time.Time     `json:"recalled_at"`                                            // 撤回时间
+	TTL         int            `gorm:"default:0" json:"ttl"`                                   // 存活时间（秒），发送时从群设置继承
+	ExpireAt    *time.Time     `gorm:"index:idx_group_message_expire_at" json:"expire_at"`     // 过期时间（到期后被后台任务物理删除）
 	CreatedAt   time.Time      `gorm:"index:idx_created_at" json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `gorm:"index:idx_deleted_at" json:"-"`
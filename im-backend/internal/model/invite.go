@@ -0,0 +1,34 @@
+package model
+
+import (
+	"time"
+)
+
+// InviteLink 邀请链接表（个人名片或群邀请，可生成二维码）
+type InviteLink struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	Token        string     `gorm:"not null;size:64;uniqueIndex:idx_invite_token" json:"token"` // 带签名的邀请令牌
+	Type         int        `gorm:"not null" json:"type"`                                       // 类型：1-好友名片，2-群邀请
+	CreatorID    string     `gorm:"not null;index:idx_invite_creator" json:"creator_id"`        // 创建者用户ID
+	GroupID      string     `gorm:"index:idx_invite_group" json:"group_id,omitempty"`           // 群组ID（群邀请）
+	SkipApproval bool       `gorm:"default:false" json:"skip_approval"`                         // 通过该邀请入群是否跳过审批
+	MaxUses      int        `gorm:"default:0" json:"max_uses"`                                  // 最大使用次数，0表示不限
+	UsedCount    int        `gorm:"default:0" json:"used_count"`                                // 已使用次数
+	ExpireAt     *time.Time `json:"expire_at"`                                                  // 过期时间，为空表示永不过期
+	RevokedAt    *time.Time `json:"revoked_at"`                                                 // 撤销时间
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+
+	URL            string      `gorm:"-" json:"url"`               // 邀请链接（二维码内容）
+	CreatorProfile *PublicUser `gorm:"-" json:"creator,omitempty"` // 创建者公开资料（持有令牌的陌生人也能看到，不含邮箱）
+
+	// 关联查询
+	Creator *User  `gorm:"foreignKey:CreatorID;references:UserID" json:"-"`
+	Group   *Group `gorm:"foreignKey:GroupID;references:GroupID" json:"group,omitempty"`
+}
+
+// 邀请类型
+const (
+	InviteTypeFriend = 1 // 好友名片
+	InviteTypeGroup  = 2 // 群邀请
+)
@@ -15,6 +15,8 @@ type Conversation struct {
 	LastMessageTime *time.Time     `gorm:"index:idx_last_message_time" json:"last_message_time"`      // 最后消息时间
 	User1Unread     int            `gorm:"default:0" json:"user1_unread"`                             // 用户1未读数
 	User2Unread     int            `gorm:"default:0" json:"user2_unread"`                             // 用户2未读数
+	MessageTTL      int            `gorm:"default:0" json:"message_ttl"`                              // 消息存活时间（秒），0表示不自动销毁
+	MessageTTLMode  int            `gorm:"default:0" json:"message_ttl_mode"`                         // 计时方式：0-发送后计时，1-首次已读后计时
 	CreatedAt       time.Time      `gorm:"index:idx_created_at" json:"created_at"`
 	UpdatedAt       time.Time      `json:"updated_at"`
 	DeletedAt       gorm.DeletedAt `gorm:"index:idx_deleted_at" json:"-"`
@@ -27,20 +29,23 @@ type Conversation struct {
 
 // Message 消息表
 type Message struct {
-	ID             uint           `gorm:"primaryKey" json:"id"`
-	ConversationID uint           `gorm:"not null;index:idx_conversation" json:"conversation_id"` // 会话ID
-	FromUserID     string         `gorm:"not null;index:idx_from_user" json:"from_user_id"`       // 发送者用户ID
-	ToUserID       string         `gorm:"not null;index:idx_to_user" json:"to_user_id"`           // 接收者用户ID
-	MessageType    int            `gorm:"default:1;index:idx_message_type" json:"message_type"`   // 消息类型：1-文本，2-图片，3-语音，4-视频，5-文件
-	Content        string         `gorm:"type:text" json:"content"`                               // 消息内容
-	MediaURL       string         `gorm:"size:500" json:"media_url"`                              // 媒体文件URL（图片、语音、视频、文件）
-	IsRead         bool           `gorm:"default:false;index:idx_is_read" json:"is_read"`         // 是否已读
-	ReadAt         *time.Time     `json:"read_at"`                                                // 读取时间
-	IsRecalled     bool           `gorm:"default:false;index:idx_is_recalled" json:"is_recalled"` // 是否撤回
-	RecalledAt     *time.Time     `json:"recalled_at"`                                            // 撤回时间
-	CreatedAt      time.Time      `gorm:"index:idx_created_at" json:"created_at"`
-	UpdatedAt      time.Time      `json:"updated_at"`
-	DeletedAt      gorm.DeletedAt `gorm:"index:idx_deleted_at" json:"-"`
+	ID                 uint           `gorm:"primaryKey" json:"id"`
+	ConversationID     uint           `gorm:"not null;index:idx_conversation" json:"conversation_id"` // 会话ID
+	FromUserID         string         `gorm:"not null;index:idx_from_user" json:"from_user_id"`       // 发送者用户ID
+	ToUserID           string         `gorm:"not null;index:idx_to_user" json:"to_user_id"`           // 接收者用户ID
+	MessageType        int            `gorm:"default:1;index:idx_message_type" json:"message_type"`   // 消息类型：1-文本，2-图片，3-语音，4-视频，5-文件
+	Content            string         `gorm:"type:text" json:"content"`                               // 消息内容
+	MediaURL           string         `gorm:"size:500" json:"media_url"`                              // 媒体文件URL（图片、语音、视频、文件）
+	IsRead             bool           `gorm:"default:false;index:idx_is_read" json:"is_read"`         // 是否已读
+	ReadAt             *time.Time     `json:"read_at"`                                                // 读取时间
+	IsRecalled         bool           `gorm:"default:false;index:idx_is_recalled" json:"is_recalled"` // 是否撤回
+	RecalledAt         *time.Time     `json:"recalled_at"`                                            // 撤回时间
+	TTL                int            `gorm:"default:0" json:"ttl"`                                   // 存活时间（秒），发送时从会话设置继承
+	ExpireAt           *time.Time     `gorm:"index:idx_message_expire_at" json:"expire_at"`           // 过期时间（到期后被后台任务物理删除）
+	HiddenFromReceiver bool           `gorm:"not null;default:false" json:"-"`                        // 被接收方拉黑时发送的消息，只对发送方可见
+	CreatedAt          time.Time      `gorm:"index:idx_created_at" json:"created_at"`
+	UpdatedAt          time.Time      `json:"updated_at"`
+	DeletedAt          gorm.DeletedAt `gorm:"index:idx_deleted_at" json:"-"`
 
 	// 关联查询
 	FromUser     *User         `gorm:"foreignKey:FromUserID;references:UserID" json:"from_user,omitempty"`
@@ -56,3 +61,9 @@ const (
 	MessageTypeVideo = 4 // 视频消息
 	MessageTypeFile  = 5 // 文件消息
 )
+
+// 阅后即焚计时方式
+const (
+	MessageTTLModeSend = 0 // 发送后开始计时
+	MessageTTLModeRead = 1 // 首次已读后开始计时
+)
@@ -13,17 +13,79 @@ type Moment struct {
 	Content      string         `gorm:"type:text" json:"content"`                   // 动态内容
 	Images       string         `gorm:"type:text" json:"images"`                    // 图片列表（JSON数组字符串）
 	Location     string         `gorm:"size:100" json:"location"`                   // 位置信息
-	Visible      int            `gorm:"default:0;index:idx_visible" json:"visible"` // 可见范围：0-所有人，1-仅好友，2-私密
+	Visible      int            `gorm:"default:0;index:idx_visible" json:"visible"` // 可见范围：0-所有人，1-仅好友，2-私密，3-部分好友可见，4-不给谁看
 	LikeCount    int            `gorm:"default:0" json:"like_count"`                // 点赞数
 	CommentCount int            `gorm:"default:0" json:"comment_count"`             // 评论数
+	RepostOfID   *uint          `gorm:"index:idx_repost_of" json:"repost_of_id"`    // 转发的原动态ID（原创动态为空）
+	RepostCount  int            `gorm:"default:0" json:"repost_count"`              // 被转发次数
+	EditedAt     *time.Time     `json:"edited_at"`                                  // 最后编辑时间（未编辑过为空）
 	CreatedAt    time.Time      `gorm:"index:idx_created_at" json:"created_at"`
 	UpdatedAt    time.Time      `json:"updated_at"`
 	DeletedAt    gorm.DeletedAt `gorm:"index:idx_deleted_at" json:"-"`
 
+	AudienceUserIDs []string `gorm:"-" json:"audience_user_ids,omitempty"` // 可见/屏蔽名单（仅发布者可见）
+
 	// 关联查询
-	User     *User           `gorm:"foreignKey:UserID;references:UserID" json:"user,omitempty"`
+	User     *PublicUser     `gorm:"foreignKey:UserID;references:UserID" json:"user,omitempty"` // 发布者公开资料，动态可能对陌生人可见，不包含邮箱
+	RepostOf *Moment         `gorm:"foreignKey:RepostOfID" json:"repost_of,omitempty"`
 	Likes    []MomentLike    `gorm:"foreignKey:MomentID" json:"likes,omitempty"`
 	Comments []MomentComment `gorm:"foreignKey:MomentID" json:"comments,omitempty"`
+	Hashtags []MomentHashtag `gorm:"foreignKey:MomentID" json:"hashtags,omitempty"`
+	Mentions []MomentMention `gorm:"foreignKey:MomentID" json:"mentions,omitempty"`
+}
+
+// 动态可见范围
+const (
+	MomentVisibleAll     = 0 // 所有人
+	MomentVisibleFriends = 1 // 仅好友
+	MomentVisiblePrivate = 2 // 私密
+	MomentVisibleInclude = 3 // 部分好友可见（名单内的好友）
+	MomentVisibleExclude = 4 // 不给谁看（名单外的好友）
+)
+
+// MomentAudience 动态受众名单表
+// 动态可见范围为3时表示可见名单，为4时表示屏蔽名单
+type MomentAudience struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	MomentID  uint      `gorm:"not null;uniqueIndex:idx_moment_audience,priority:1" json:"moment_id"`                       // 动态ID
+	UserID    string    `gorm:"not null;uniqueIndex:idx_moment_audience,priority:2;index:idx_audience_user" json:"user_id"` // 名单中的好友ID
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MomentEdit 动态编辑历史表，每次编辑前保存一份旧版本
+type MomentEdit struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	MomentID  uint      `gorm:"not null;index:idx_moment_edit_moment" json:"moment_id"` // 动态ID
+	Content   string    `gorm:"type:text" json:"content"`                               // 编辑前的内容
+	Images    string    `gorm:"type:text" json:"images"`                                // 编辑前的图片列表
+	Location  string    `gorm:"size:100" json:"location"`                               // 编辑前的位置信息
+	Visible   int       `json:"visible"`                                                // 编辑前的可见范围
+	Audience  string    `gorm:"type:text" json:"-"`                                     // 编辑前的受众名单（JSON数组字符串）
+	CreatedAt time.Time `json:"created_at"`                                             // 编辑时间
+
+	AudienceUserIDs []string `gorm:"-" json:"audience_user_ids,omitempty"` // 编辑前的受众名单（仅发布者可见）
+}
+
+// MomentHashtag 动态话题表（从正文中的 #话题 解析）
+type MomentHashtag struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	MomentID  uint      `gorm:"not null;uniqueIndex:idx_moment_hashtag,priority:1" json:"-"`                                 // 动态ID
+	Tag       string    `gorm:"size:50;not null;uniqueIndex:idx_moment_hashtag,priority:2;index:idx_hashtag_tag" json:"tag"` // 话题（已规范化）
+	CreatedAt time.Time `gorm:"index:idx_hashtag_created_at" json:"-"`
+}
+
+// MomentMention 动态提及表（从正文中的 @用户ID 解析，只记录好友）
+type MomentMention struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	MomentID  uint      `gorm:"not null;uniqueIndex:idx_moment_mention,priority:1" json:"-"`                              // 动态ID
+	UserID    string    `gorm:"not null;uniqueIndex:idx_moment_mention,priority:2;index:idx_mention_user" json:"user_id"` // 被提及的用户ID
+	CreatedAt time.Time `json:"-"`
+}
+
+// HashtagTrend 热门话题统计（非数据表）
+type HashtagTrend struct {
+	Tag         string `json:"tag"`
+	MomentCount int64  `json:"moment_count"`
 }
 
 // MomentLike 朋友圈点赞表
@@ -35,23 +97,65 @@ type MomentLike struct {
 	DeletedAt gorm.DeletedAt `gorm:"index:idx_deleted_at" json:"-"`
 
 	// 关联查询
-	User   *User   `gorm:"foreignKey:UserID;references:UserID" json:"user,omitempty"`
-	Moment *Moment `gorm:"foreignKey:MomentID" json:"moment,omitempty"`
+	User   *PublicUser `gorm:"foreignKey:UserID;references:UserID" json:"user,omitempty"` // 点赞用户公开资料
+	Moment *Moment     `gorm:"foreignKey:MomentID" json:"moment,omitempty"`
 }
 
 // MomentComment 朋友圈评论表
+// 评论按楼层组织：直接评论动态的为顶层评论，楼中的回复通过 RootID 归属到顶层评论
 type MomentComment struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	MomentID  uint           `gorm:"not null;index:idx_moment" json:"moment_id"` // 动态ID
-	UserID    string         `gorm:"not null;index:idx_user" json:"user_id"`     // 评论用户ID
-	ReplyToID *uint          `gorm:"index:idx_reply_to" json:"reply_to_id"`      // 回复的评论aID（空表示直接评论动态）
-	Content   string         `gorm:"type:text;not null" json:"content"`          // 评论内容
-	CreatedAt time.Time      `gorm:"index:idx_created_at" json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index:idx_deleted_at" json:"-"`
+	ID         uint           `gorm:"primaryKey" json:"id"`
+	MomentID   uint           `gorm:"not null;index:idx_moment" json:"moment_id"` // 动态ID
+	UserID     string         `gorm:"not null;index:idx_user" json:"user_id"`     // 评论用户ID
+	ReplyToID  *uint          `gorm:"index:idx_reply_to" json:"reply_to_id"`      // 回复的评论aID（空表示直接评论动态）
+	RootID     *uint          `gorm:"index:idx_comment_root" json:"root_id"`      // 所属的顶层评论ID（顶层评论为空）
+	Content    string         `gorm:"type:text;not null" json:"content"`          // 评论内容
+	ReplyCount int            `gorm:"default:0" json:"reply_count"`               // 楼中回复数（仅顶层评论）
+	LikeCount  int            `gorm:"default:0" json:"like_count"`                // 点赞数
+	IsDeleted  bool           `gorm:"default:false" json:"is_deleted"`            // 已删除（保留占位以维持回复链）
+	CreatedAt  time.Time      `gorm:"index:idx_created_at" json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `gorm:"index:idx_deleted_at" json:"-"`
+
+	Liked   bool            `gorm:"-" json:"liked"`             // 当前用户是否已点赞
+	Replies []MomentComment `gorm:"-" json:"replies,omitempty"` // 楼中的前几条回复（仅评论列表返回）
 
 	// 关联查询
-	User    *User          `gorm:"foreignKey:UserID;references:UserID" json:"user,omitempty"`
+	User    *PublicUser    `gorm:"foreignKey:UserID;references:UserID" json:"user,omitempty"` // 评论用户公开资料
 	Moment  *Moment        `gorm:"foreignKey:MomentID" json:"moment,omitempty"`
 	ReplyTo *MomentComment `gorm:"foreignKey:ReplyToID" json:"reply_to,omitempty"`
 }
+
+// MomentCommentLike 评论点赞表
+type MomentCommentLike struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CommentID uint      `gorm:"not null;uniqueIndex:idx_comment_like,priority:1" json:"comment_id"`                          // 评论ID
+	UserID    string    `gorm:"not null;uniqueIndex:idx_comment_like,priority:2;index:idx_comment_like_user" json:"user_id"` // 点赞用户ID
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MomentNotification 朋友圈互动通知表
+type MomentNotification struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    string    `gorm:"not null;index:idx_moment_notify_user,priority:1" json:"user_id"`      // 接收通知的用户ID
+	ActorID   string    `gorm:"not null" json:"actor_id"`                                             // 触发通知的用户ID
+	Type      int       `gorm:"not null" json:"type"`                                                 // 类型：1-点赞，2-评论，3-回复，4-提及，5-转发
+	MomentID  uint      `gorm:"not null;index:idx_moment_notify_moment" json:"moment_id"`             // 动态ID
+	CommentID *uint     `json:"comment_id"`                                                           // 评论ID（点赞时为空）
+	Content   string    `gorm:"size:255" json:"content"`                                              // 评论内容摘要
+	IsRead    bool      `gorm:"default:false;index:idx_moment_notify_user,priority:2" json:"is_read"` // 是否已读
+	CreatedAt time.Time `json:"created_at"`
+
+	// 关联查询
+	Actor  *PublicUser `gorm:"foreignKey:ActorID;references:UserID" json:"actor,omitempty"` // 触发者公开资料，可能是陌生人
+	Moment *Moment     `gorm:"foreignKey:MomentID" json:"moment,omitempty"`
+}
+
+// 朋友圈通知类型
+const (
+	MomentNotifyLike    = 1 // 点赞
+	MomentNotifyComment = 2 // 评论
+	MomentNotifyReply   = 3 // 回复评论
+	MomentNotifyMention = 4 // 在动态中提及
+	MomentNotifyRepost  = 5 // 转发了动态
+)
@@ -0,0 +1,43 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ScheduledMessage 定时消息表
+type ScheduledMessage struct {
+	ID            uint           `gorm:"primaryKey" json:"id"`
+	UserID        string         `gorm:"not null;index:idx_scheduled_user" json:"user_id"`                      // 发送者用户ID
+	TargetType    int            `gorm:"not null" json:"target_type"`                                           // 目标类型：1-私聊，2-群聊
+	TargetID      string         `gorm:"not null" json:"target_id"`                                             // 目标ID（私聊为接收者用户ID，群聊为群组ID）
+	MessageType   int            `gorm:"default:1" json:"message_type"`                                         // 消息类型，同 Message.MessageType
+	Content       string         `gorm:"type:text" json:"content"`                                              // 消息内容
+	MediaURL      string         `gorm:"size:500" json:"media_url"`                                             // 媒体文件URL
+	AtUsers       string         `gorm:"type:text" json:"at_users"`                                             // @的用户ID列表（仅群聊）
+	SendAt        time.Time      `gorm:"not null;index:idx_scheduled_status_send_at,priority:2" json:"send_at"` // 计划发送时间
+	Status        int            `gorm:"default:0;index:idx_scheduled_status_send_at,priority:1" json:"status"` // 状态：0-待发送，1-发送中，2-已发送，3-已取消，4-发送失败
+	FailReason    string         `gorm:"size:255" json:"fail_reason"`                                           // 失败原因
+	SentMessageID *uint          `json:"sent_message_id"`                                                       // 发送成功后生成的消息ID
+	SentAt        *time.Time     `json:"sent_at"`                                                               // 实际发送时间
+	ClaimedAt     *time.Time     `json:"-"`                                                                     // 开始投递的时间（发送中状态的租约）
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `gorm:"index:idx_scheduled_deleted_at" json:"-"`
+}
+
+// 定时消息目标类型
+const (
+	ScheduledTargetUser  = 1 // 私聊
+	ScheduledTargetGroup = 2 // 群聊
+)
+
+// 定时消息状态
+const (
+	ScheduledStatusPending   = 0 // 待发送
+	ScheduledStatusSending   = 1 // 发送中
+	ScheduledStatusSent      = 2 // 已发送
+	ScheduledStatusCancelled = 3 // 已取消
+	ScheduledStatusFailed    = 4 // 发送失败
+)
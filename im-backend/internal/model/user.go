@@ -17,4 +17,139 @@ type User struct {
 	CreatedAt time.Time      `gorm:"index:idx_created_at" json:"created_at"`               // 创建时间
 	UpdatedAt time.Time      `json:"updated_at"`                                           // 更新时间
 	DeletedAt gorm.DeletedAt `gorm:"index:idx_deleted_at" json:"-"`                        // 软删除
+
+	// 两步验证
+	TwoFactorEnabled bool   `gorm:"default:false" json:"-"` // 是否开启（只通过 SelfUser 返回给本人）
+	TwoFactorSecret  string `gorm:"size:64" json:"-"`       // TOTP 密钥（base32）
+
+	// 注销账号
+	DeletionScheduledAt *time.Time `gorm:"index:idx_deletion_scheduled_at" json:"-"` // 申请注销后计划清除数据的时间，冷静期内可撤销（只通过 SelfUser 返回给本人）
+	AccountDeletedAt    *time.Time `json:"-"`                                        // 已注销（资料已匿名化），保留记录使历史消息仍能显示发送者
+	DeletionClaimedAt   *time.Time `json:"-"`                                        // 清除数据任务的抢占时间，租约过期未完成时由其他实例重试
+}
+
+// PublicUser 对外展示的公开资料（不含邮箱），用于向非好友展示用户
+type PublicUser struct {
+	UserID   string `json:"user_id"`
+	Nickname string `json:"nickname"`
+	Avatar   string `json:"avatar"`
+}
+
+// TableName 公开资料直接从用户表读取，可作为关联预加载的目标，只查询公开字段
+func (PublicUser) TableName() string {
+	return "users"
+}
+
+// Public 返回用户的公开资料
+func (u *User) Public() *PublicUser {
+	if u == nil {
+		return nil
+	}
+	return &PublicUser{
+		UserID:   u.UserID,
+		Nickname: u.Nickname,
+		Avatar:   u.Avatar,
+	}
 }
+
+// SelfUser 返回给用户本人的资料，包含不对联系人公开的账号状态
+// User 会嵌入好友列表、群成员等响应中，这些状态字段在 User 上不序列化
+type SelfUser struct {
+	*User
+	TwoFactorEnabled    bool       `json:"two_factor_enabled"`    // 是否开启两步验证
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at"` // 已申请注销时计划清除数据的时间
+}
+
+// Self 返回用户本人视角的资料
+func (u *User) Self() *SelfUser {
+	if u == nil {
+		return nil
+	}
+	return &SelfUser{
+		User:                u,
+		TwoFactorEnabled:    u.TwoFactorEnabled,
+		DeletionScheduledAt: u.DeletionScheduledAt,
+	}
+}
+
+// UserSearchResult 搜索用户的结果：公开资料和对方的好友验证问题
+type UserSearchResult struct {
+	PublicUser
+	FriendQuestion string `json:"friend_question,omitempty"`
+}
+
+// UserPrivacy 隐私设置，没有记录的用户按默认值处理（可通过用户ID搜索、允许同群陌生人添加、公开动态对非好友可见）
+type UserPrivacy struct {
+	ID                  uint      `gorm:"primaryKey" json:"-"`
+	UserID              string    `gorm:"uniqueIndex:idx_privacy_user;size:50;not null" json:"-"`
+	SearchByID          bool      `gorm:"not null" json:"search_by_id"`          // 允许通过用户ID搜索到我
+	SearchByEmail       bool      `gorm:"not null" json:"search_by_email"`       // 允许通过邮箱搜索到我
+	FriendQuestion      string    `gorm:"size:100" json:"friend_question"`       // 好友验证问题，为空表示添加时不需要回答
+	FriendAnswerHash    string    `gorm:"size:64" json:"-"`                      // 答案的 bcrypt 哈希（忽略大小写和首尾空格）
+	AllowGroupStrangers bool      `gorm:"not null" json:"allow_group_strangers"` // 允许同群的陌生人添加我
+	StrangerMoments     bool      `gorm:"not null" json:"stranger_moments"`      // 公开动态对非好友可见
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+// UserRecoveryCode 两步验证恢复码，只保存哈希，每个恢复码只能使用一次
+type UserRecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    string     `gorm:"index:idx_recovery_code_user;size:50;not null" json:"user_id"`
+	CodeHash  string     `gorm:"size:64;not null" json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// UserIdentity 外部身份（OIDC 单点登录），同一提供方的 sub 唯一对应一个用户
+type UserIdentity struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    string    `gorm:"index:idx_identity_user;size:50;not null" json:"user_id"`
+	Provider  string    `gorm:"uniqueIndex:idx_identity_subject;size:50;not null" json:"provider"`
+	Subject   string    `gorm:"uniqueIndex:idx_identity_subject;size:255;not null" json:"-"`
+	Email     string    `gorm:"size:100" json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// 登录方式
+const (
+	LoginMethodPassword = "password"
+	LoginMethodCode     = "code"
+	LoginMethodOIDC     = "oidc"
+)
+
+// LoginHistory 登录记录（成功和失败），用于用户查看和识别新设备
+type LoginHistory struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	UserID     string    `gorm:"index:idx_login_history_user;size:50;not null" json:"user_id"`
+	Method     string    `gorm:"size:20" json:"method"` // password / code / oidc
+	IP         string    `gorm:"size:64" json:"ip"`
+	UserAgent  string    `gorm:"size:255" json:"user_agent"`
+	DeviceHash string    `gorm:"index:idx_login_history_device;size:64" json:"-"` // User-Agent 的哈希，用于识别新设备
+	Success    bool      `json:"success"`
+	Reason     string    `gorm:"size:100" json:"reason,omitempty"` // 失败原因
+	CreatedAt  time.Time `gorm:"index:idx_login_history_created_at" json:"created_at"`
+}
+
+// DataExport 个人数据导出任务，后台生成 ZIP 文件，过期后删除
+type DataExport struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    string     `gorm:"index:idx_data_export_user;size:50;not null" json:"user_id"`
+	Status    int        `gorm:"default:0;index:idx_data_export_status" json:"status"` // 状态：0-排队中，1-生成中，2-已完成，3-失败
+	FileName  string     `gorm:"size:255" json:"-"`                                    // 导出目录中的文件名
+	FileSize  int64      `json:"file_size"`
+	Error     string     `gorm:"size:255" json:"error,omitempty"`
+	ExpireAt  *time.Time `gorm:"index:idx_data_export_expire_at" json:"expire_at"` // 完成后的下载截止时间
+	ClaimedAt *time.Time `json:"-"`                                                // 开始生成的时间，租约过期仍未完成时重新生成
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+
+	DownloadURL string `gorm:"-" json:"download_url,omitempty"`
+}
+
+// 数据导出状态
+const (
+	DataExportStatusPending    = 0 // 排队中
+	DataExportStatusProcessing = 1 // 生成中
+	DataExportStatusReady      = 2 // 已完成
+	DataExportStatusFailed     = 3 // 失败
+)
@@ -4,15 +4,40 @@ import "context"
 
 type ctxKey string
 
-const userIDKey ctxKey = "userID"
+const principalKey ctxKey = "principal"
 
-func SetUserIDToContext(ctx context.Context, userID string) context.Context {
-	return context.WithValue(ctx, userIDKey, userID)
+// Principal 当前请求的认证主体，由 AuthMiddleware 根据 Access Token 写入
+type Principal struct {
+	UserID    string // 不可变的用户ID
+	Email     string
+	SessionID string // 签发 Access Token 的登录会话
 }
 
-func GetUserIDFromContext(ctx context.Context) string {
-	if v, ok := ctx.Value(userIDKey).(string); ok {
+// SetPrincipalToContext 写入当前请求的认证主体
+func SetPrincipalToContext(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey, principal)
+}
+
+// GetPrincipalFromContext 获取当前请求的认证主体，未认证时返回 nil
+func GetPrincipalFromContext(ctx context.Context) *Principal {
+	if v, ok := ctx.Value(principalKey).(*Principal); ok {
 		return v
 	}
+	return nil
+}
+
+// GetUserIDFromContext 获取当前用户的用户ID，未认证时返回空串
+func GetUserIDFromContext(ctx context.Context) string {
+	if principal := GetPrincipalFromContext(ctx); principal != nil {
+		return principal.UserID
+	}
+	return ""
+}
+
+// GetSessionIDFromContext 获取当前请求所属的登录会话
+func GetSessionIDFromContext(ctx context.Context) string {
+	if principal := GetPrincipalFromContext(ctx); principal != nil {
+		return principal.SessionID
+	}
 	return ""
 }
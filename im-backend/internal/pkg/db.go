@@ -32,7 +32,7 @@ func InitPostgres() {
 
 	// 自动迁移数据表 - 分步迁移避免外键依赖问题
 	// 先创建基础表
-	if err := DB.AutoMigrate(&model.User{}); err != nil {
+	if err := DB.AutoMigrate(&model.User{}, &model.UserRecoveryCode{}, &model.UserIdentity{}, &model.LoginHistory{}, &model.DataExport{}, &model.UserPrivacy{}); err != nil {
 		log.Fatalf("❌ User表迁移失败: %v", err)
 	}
 
@@ -40,6 +40,10 @@ func InitPostgres() {
 	if err := DB.AutoMigrate(
 		&model.Friend{},
 		&model.FriendRequest{},
+		&model.UserBlock{},
+		&model.FriendTag{},
+		&model.FriendTagMember{},
+		&model.InviteLink{},
 	); err != nil {
 		log.Fatalf("❌ 好友表迁移失败: %v", err)
 	}
@@ -49,17 +53,112 @@ func InitPostgres() {
 		&model.Moment{},
 		&model.MomentLike{},
 		&model.MomentComment{},
+		&model.MomentCommentLike{},
+		&model.MomentAudience{},
+		&model.MomentEdit{},
+		&model.MomentHashtag{},
+		&model.MomentMention{},
+		&model.MomentNotification{},
 	); err != nil {
 		log.Fatalf("❌ 朋友圈表迁移失败: %v", err)
 	}
+	backfillMomentUserIDs()
+	backfillCommentThreads()
 
 	// 创建消息相关表
 	if err := DB.AutoMigrate(
 		&model.Conversation{},
 		&model.Message{},
+		&model.ScheduledMessage{},
 	); err != nil {
 		log.Fatalf("❌ 消息表迁移失败: %v", err)
 	}
 
+	// 创建群聊相关表
+	if err := DB.AutoMigrate(
+		&model.Group{},
+		&model.GroupMember{},
+		&model.GroupMessage{},
+		&model.GroupMessageRead{},
+	); err != nil {
+		log.Fatalf("❌ 群聊表迁移失败: %v", err)
+	}
+
 	log.Println("✅ Postgres 连接成功并完成迁移")
 }
+
+// backfillMomentUserIDs 动态、点赞和评论改为以用户ID关联发布者之前，user_id 列保存的是邮箱，
+// 这里改写为对应的用户ID；已经是某个用户ID的值不再改写，可重复执行
+func backfillMomentUserIDs() {
+	// 同一条动态在改写前后各有一次点赞时，先删掉旧的那条，避免违反唯一索引，并重新统计点赞数
+	dedup := DB.Exec(`DELETE FROM moment_likes l USING users u, moment_likes n
+		WHERE l.user_id = u.email AND n.moment_id = l.moment_id AND n.user_id = u.user_id
+		AND NOT EXISTS (SELECT 1 FROM users x WHERE x.user_id = l.user_id)`)
+	if dedup.Error != nil {
+		log.Fatalf("❌ 动态点赞去重失败: %v", dedup.Error)
+	}
+	if dedup.RowsAffected > 0 {
+		if err := DB.Exec(`UPDATE moments m SET like_count = (
+				SELECT COUNT(*) FROM moment_likes l WHERE l.moment_id = m.id AND l.deleted_at IS NULL
+			)`).Error; err != nil {
+			log.Fatalf("❌ 统计动态点赞数失败: %v", err)
+		}
+	}
+
+	statements := []struct {
+		name string
+		sql  string
+	}{
+		{"动态", `UPDATE moments m SET user_id = u.user_id FROM users u
+			WHERE m.user_id LIKE '%@%' AND m.user_id = u.email
+			AND NOT EXISTS (SELECT 1 FROM users x WHERE x.user_id = m.user_id)`},
+		{"动态点赞", `UPDATE moment_likes l SET user_id = u.user_id FROM users u
+			WHERE l.user_id LIKE '%@%' AND l.user_id = u.email
+			AND NOT EXISTS (SELECT 1 FROM users x WHERE x.user_id = l.user_id)`},
+		{"动态评论", `UPDATE moment_comments c SET user_id = u.user_id FROM users u
+			WHERE c.user_id LIKE '%@%' AND c.user_id = u.email
+			AND NOT EXISTS (SELECT 1 FROM users x WHERE x.user_id = c.user_id)`},
+	}
+
+	var updated int64
+	for _, stmt := range statements {
+		result := DB.Exec(stmt.sql)
+		if result.Error != nil {
+			log.Fatalf("❌ %s用户ID迁移失败: %v", stmt.name, result.Error)
+		}
+		updated += result.RowsAffected
+	}
+	if updated > 0 {
+		log.Printf("✅ 已将 %d 条朋友圈记录的邮箱改写为用户ID", updated)
+	}
+}
+
+// backfillCommentThreads 为楼层化之前的回复补全所属的顶层评论，并重新统计楼中回复数
+// 每轮只处理上级已归属的回复，直到没有需要补全的记录
+func backfillCommentThreads() {
+	var updated int64
+	for {
+		result := DB.Exec(`UPDATE moment_comments c SET root_id = COALESCE(p.root_id, p.id)
+			FROM moment_comments p
+			WHERE c.reply_to_id = p.id AND c.root_id IS NULL AND (p.reply_to_id IS NULL OR p.root_id IS NOT NULL)`)
+		if result.Error != nil {
+			log.Printf("⚠️ 补全评论楼层失败: %v", result.Error)
+			return
+		}
+		if result.RowsAffected == 0 {
+			break
+		}
+		updated += result.RowsAffected
+	}
+	if updated == 0 {
+		return
+	}
+
+	if err := DB.Exec(`UPDATE moment_comments p SET reply_count = (
+			SELECT COUNT(*) FROM moment_comments c WHERE c.root_id = p.id AND c.deleted_at IS NULL
+		) WHERE p.root_id IS NULL`).Error; err != nil {
+		log.Printf("⚠️ 统计楼中回复数失败: %v", err)
+		return
+	}
+	log.Printf("✅ 已为 %d 条历史回复补全评论楼层", updated)
+}
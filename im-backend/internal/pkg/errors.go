@@ -16,6 +16,7 @@ const (
 	CodeNotFound         ErrorCode = 4004 // 资源不存在
 	CodeConflict         ErrorCode = 4009 // 资源冲突
 	CodeValidationFailed ErrorCode = 4010 // 验证失败
+	CodeTooManyRequests  ErrorCode = 4029 // 请求过于频繁
 
 	// 业务错误 (4xxx)
 	CodeUserNotFound     ErrorCode = 4101 // 用户不存在
@@ -25,6 +26,7 @@ const (
 	CodeTokenExpired     ErrorCode = 4105 // Token过期
 	CodeCodeInvalid      ErrorCode = 4106 // 验证码无效
 	CodeCodeExpired      ErrorCode = 4107 // 验证码过期
+	CodeAccountLocked    ErrorCode = 4108 // 登录失败次数过多，暂时锁定
 	CodeFriendNotFound   ErrorCode = 4201 // 好友不存在
 	CodeFriendExists     ErrorCode = 4202 // 已经是好友
 	CodeRequestExists    ErrorCode = 4203 // 好友请求已存在
@@ -50,6 +52,7 @@ var errorMessages = map[ErrorCode]string{
 	CodeNotFound:         "资源不存在",
 	CodeConflict:         "资源冲突",
 	CodeValidationFailed: "验证失败",
+	CodeTooManyRequests:  "请求过于频繁，请稍后再试",
 
 	// 业务错误
 	CodeUserNotFound:     "用户不存在",
@@ -59,6 +62,7 @@ var errorMessages = map[ErrorCode]string{
 	CodeTokenExpired:     "Token已过期，请重新登录",
 	CodeCodeInvalid:      "验证码无效",
 	CodeCodeExpired:      "验证码已过期",
+	CodeAccountLocked:    "登录失败次数过多，请稍后再试",
 	CodeFriendNotFound:   "好友不存在",
 	CodeFriendExists:     "已经是好友关系",
 	CodeRequestExists:    "好友请求已存在",
@@ -0,0 +1,49 @@
+package pkg
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+)
+
+// 邀请令牌格式：base64url(类型 + 随机数) + "." + base64url(HMAC签名)
+// 签名用于在查询数据库前拒绝伪造的令牌，撤销、过期和次数限制以数据库记录为准
+
+const inviteSignatureSize = 16
+
+// GenerateInviteToken 生成带签名的邀请令牌，kind 为令牌类型前缀（如 "u"、"g"）
+func GenerateInviteToken(kind string) (string, error) {
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(append([]byte(kind), nonce...))
+	return payload + "." + signInvitePayload(payload), nil
+}
+
+// VerifyInviteToken 校验邀请令牌签名，返回令牌类型前缀
+func VerifyInviteToken(token string) (string, bool) {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok || payload == "" {
+		return "", false
+	}
+	if !hmac.Equal([]byte(signature), []byte(signInvitePayload(payload))) {
+		return "", false
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil || len(raw) < 2 {
+		return "", false
+	}
+	return string(raw[:1]), true
+}
+
+// signInvitePayload 使用JWT密钥计算邀请令牌签名
+func signInvitePayload(payload string) string {
+	mac := hmac.New(sha256.New, getJWTSecret())
+	mac.Write([]byte("invite:" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:inviteSignatureSize])
+}
@@ -2,8 +2,11 @@ package pkg
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
-	"fmt"
 	"im-backend/config"
 	"log"
 	"strings"
@@ -13,7 +16,7 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
-// getJWTSecret 获取JWT密钥
+// getJWTSecret 获取HMAC密钥（用于邀请令牌签名，Access Token 使用非对称密钥签名）
 func getJWTSecret() []byte {
 	if config.Cfg == nil || config.Cfg.JWTSecret == "" {
 		log.Fatal("⚠️ JWT_SECRET 未配置，请在.env文件中设置JWT_SECRET")
@@ -21,56 +24,178 @@ func getJWTSecret() []byte {
 	return []byte(config.Cfg.JWTSecret)
 }
 
-// getJWTExpiration 获取JWT过期时间
-func getJWTExpiration() time.Duration {
-	if config.Cfg == nil || config.Cfg.JWTExpiration == 0 {
-		return 8 * time.Hour // 默认8小时
+// getTokenTTL 解析令牌有效期配置，无效时使用默认值
+func getTokenTTL(value string, defaultTTL time.Duration) time.Duration {
+	ttl, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil || ttl <= 0 {
+		return defaultTTL
 	}
-	return time.Duration(config.Cfg.JWTExpiration) * time.Hour
+	return ttl
 }
 
+// getAccessTokenTTL 获取 Access Token 有效期
+func getAccessTokenTTL() time.Duration {
+	if config.Cfg == nil {
+		return 15 * time.Minute
+	}
+	return getTokenTTL(config.Cfg.JWTAccessTTL, 15*time.Minute) // 默认15分钟
+}
+
+// getRefreshTokenTTL 获取 Refresh Token 有效期
+func getRefreshTokenTTL() time.Duration {
+	if config.Cfg == nil {
+		return 30 * 24 * time.Hour
+	}
+	return getTokenTTL(config.Cfg.JWTRefreshTTL, 30*24*time.Hour) // 默认30天
+}
+
+// Claims Access Token 的声明：UserID 为不可变的认证主体，SessionID 关联签发它的登录会话
+// Email 仅供展示，修改邮箱时会注销全部会话，因此不会过期不一致
 type Claims struct {
-	Email string `json:"email"`
+	UserID    string `json:"uid"`
+	Email     string `json:"email"`
+	SessionID string `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-const tokenPrefix = "jwt:"
+// TokenPair 登录和刷新时返回的令牌对
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // Access Token 剩余有效期（秒）
+}
 
-// GenerateToken 生成 Token 并写入 Redis
-func GenerateToken(email string, rdb *redis.Client) (string, error) {
-	expiration := getJWTExpiration()
-	claims := Claims{
-		Email: email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiration)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
-	}
+// 登录会话在 Redis 中的存储
+// 每次登录创建一个会话（即一个 Refresh Token 家族），Access Token 只在会话存在时有效；
+// Refresh Token 为不透明随机串，格式为 会话ID.随机数，Redis 中只保存其哈希
+const (
+	tokenSessionPrefix     = "jwt_session:"       // 会话：user_id、email、当前 Refresh Token 哈希
+	tokenSessionUsedPrefix = "jwt_session_used:"  // 会话中已轮换掉的 Refresh Token 哈希，用于重用检测
+	userSessionsPrefix     = "jwt_user_sessions:" // 用户的全部会话ID，键为 前缀+用户ID
+)
 
-	// 生成 token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(getJWTSecret())
+// refreshRotateScript 轮换 Refresh Token
+// 返回 1-轮换成功，0-检测到重用（已注销整个会话），-1-无效或已过期
+var refreshRotateScript = redis.NewScript(`
+local current = redis.call('HGET', KEYS[1], 'refresh')
+if not current then
+	return -1
+end
+if current == ARGV[1] then
+	redis.call('HSET', KEYS[1], 'refresh', ARGV[2])
+	redis.call('SADD', KEYS[2], ARGV[1])
+	redis.call('PEXPIRE', KEYS[1], ARGV[3])
+	redis.call('PEXPIRE', KEYS[2], ARGV[3])
+	return 1
+end
+if redis.call('SISMEMBER', KEYS[2], ARGV[1]) == 1 then
+	redis.call('DEL', KEYS[1], KEYS[2])
+	return 0
+end
+return -1
+`)
+
+// GenerateToken 创建登录会话，签发 Access Token 和 Refresh Token
+func GenerateToken(userID, email string, rdb *redis.Client) (*TokenPair, error) {
+	sessionID, err := RandomToken(16)
 	if err != nil {
-		return "", WrapError(err, CodeInternalError, "JWT生成失败")
+		return nil, WrapError(err, CodeInternalError, "会话创建失败")
+	}
+	refreshToken, refreshHash, err := newRefreshToken(sessionID)
+	if err != nil {
+		return nil, WrapError(err, CodeInternalError, "Refresh Token生成失败")
 	}
 
-	// 存储规则：一个用户只保留一个有效 token
 	ctx := context.Background()
-	key := fmt.Sprintf("%s%s", tokenPrefix, email)
+	refreshTTL := getRefreshTokenTTL()
+	pipe := rdb.TxPipeline()
+	pipe.HSet(ctx, tokenSessionPrefix+sessionID, "user_id", userID, "email", email, "refresh", refreshHash)
+	pipe.Expire(ctx, tokenSessionPrefix+sessionID, refreshTTL)
+	pipe.SAdd(ctx, userSessionsPrefix+userID, sessionID)
+	pipe.Expire(ctx, userSessionsPrefix+userID, refreshTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, WrapError(err, CodeRedisError, "Token存储失败")
+	}
+
+	return issueTokenPair(userID, email, sessionID, refreshToken)
+}
 
-	// 保存 email -> token
-	err = rdb.Set(ctx, key, tokenString, expiration).Err()
+// RefreshToken 使用 Refresh Token 换取新的令牌对，旧的 Refresh Token 立即失效
+// 已轮换掉的 Refresh Token 再次使用时视为泄露，注销整个会话
+// resolveUserID 根据邮箱查询用户ID，用于升级旧会话
+func RefreshToken(refreshToken string, rdb *redis.Client, resolveUserID func(email string) (string, error)) (*TokenPair, error) {
+	sessionID, _, ok := strings.Cut(strings.TrimSpace(refreshToken), ".")
+	if !ok || sessionID == "" {
+		return nil, errors.New("无效的 Refresh Token")
+	}
+
+	ctx := context.Background()
+	session, err := rdb.HMGet(ctx, tokenSessionPrefix+sessionID, "user_id", "email").Result()
 	if err != nil {
-		return "", WrapError(err, CodeRedisError, "Token存储失败")
+		return nil, WrapError(err, CodeRedisError, "Token读取失败")
+	}
+	userID, _ := session[0].(string)
+	email, _ := session[1].(string)
+	if userID == "" && email != "" {
+		// 以用户ID为认证主体之前创建的会话只记录了邮箱，首次刷新时补写用户ID，用户无需重新登录
+		userID = upgradeLegacySession(ctx, rdb, sessionID, email, resolveUserID)
+	}
+	if userID == "" {
+		return nil, errors.New("Refresh Token 已过期，请重新登录")
 	}
 
-	return tokenString, nil
+	newToken, newHash, err := newRefreshToken(sessionID)
+	if err != nil {
+		return nil, WrapError(err, CodeInternalError, "Refresh Token生成失败")
+	}
+
+	refreshTTL := getRefreshTokenTTL()
+	result, err := refreshRotateScript.Run(ctx, rdb,
+		[]string{tokenSessionPrefix + sessionID, tokenSessionUsedPrefix + sessionID},
+		hashRefreshToken(refreshToken), newHash, refreshTTL.Milliseconds()).Int()
+	if err != nil {
+		return nil, WrapError(err, CodeRedisError, "Token存储失败")
+	}
+
+	switch result {
+	case 1:
+		rdb.Expire(ctx, userSessionsPrefix+userID, refreshTTL)
+		return issueTokenPair(userID, email, sessionID, newToken)
+	case 0:
+		log.Printf("⚠️ 检测到 Refresh Token 重用，已注销会话: user=%s", userID)
+		rdb.SRem(ctx, userSessionsPrefix+userID, sessionID)
+		return nil, errors.New("Refresh Token 已被使用，会话已注销，请重新登录")
+	default:
+		return nil, errors.New("无效的 Refresh Token")
+	}
 }
 
-// VerifyToken 验证 Token
-func VerifyToken(tokenString string, rdb *redis.Client) (*Claims, error) {
-	log.Printf("Raw token input: %q", tokenString)
+// upgradeLegacySession 为只记录了邮箱的旧会话补写用户ID，并把会话从按邮箱的索引移到按用户ID的索引
+// 查不到用户时返回空串
+func upgradeLegacySession(ctx context.Context, rdb *redis.Client, sessionID, email string, resolveUserID func(email string) (string, error)) string {
+	if resolveUserID == nil {
+		return ""
+	}
+	userID, err := resolveUserID(email)
+	if err != nil || userID == "" {
+		return ""
+	}
 
+	refreshTTL := getRefreshTokenTTL()
+	pipe := rdb.TxPipeline()
+	pipe.HSet(ctx, tokenSessionPrefix+sessionID, "user_id", userID)
+	pipe.SAdd(ctx, userSessionsPrefix+userID, sessionID)
+	pipe.Expire(ctx, userSessionsPrefix+userID, refreshTTL)
+	pipe.SRem(ctx, userSessionsPrefix+email, sessionID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("⚠️ 旧会话升级失败: session=%s, err=%v", sessionID, err)
+		return ""
+	}
+	return userID
+}
+
+// VerifyToken 验证 Access Token，所属会话已注销时视为无效
+func VerifyToken(tokenString string, rdb *redis.Client) (*Claims, error) {
 	// 去掉前后空格 & Bearer 前缀
 	tokenString = strings.TrimSpace(tokenString)
 	if strings.HasPrefix(tokenString, "Bearer ") {
@@ -80,56 +205,112 @@ func VerifyToken(tokenString string, rdb *redis.Client) (*Claims, error) {
 
 	// 检查是否是合法 JWT（三段）
 	if strings.Count(tokenString, ".") != 2 {
-		if strings.Contains(tokenString, "@") {
-			log.Printf("[VerifyToken] ⚠️ 收到的 token 实际是 email=%q", tokenString)
-			return nil, errors.New("收到的 token 是邮箱而不是 JWT，请检查调用方")
-		}
-		log.Printf("[VerifyToken] ⚠️ token 格式错误=%q", tokenString)
 		return nil, errors.New("token 格式不正确")
 	}
 
-	// 解析 JWT
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		// 限制必须是 HMAC
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return getJWTSecret(), nil
-	})
+	// 解析 JWT（按 kid 选择验证密钥，只接受非对称签名算法）
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, jwtKeys.keyFunc, jwt.WithValidMethods(jwtKeys.validMethods()))
 	if err != nil {
 		return nil, err
 	}
 
-	// 打印 token 的关键信息
-	log.Printf("token.Valid: %v\n", token.Valid)
-	log.Printf("token.Method: %v\n", token.Method)
-	log.Printf("token.Header: %+v\n", token.Header)
-
 	claims, ok := token.Claims.(*Claims)
-	if !ok || !token.Valid {
+	if !ok || !token.Valid || claims.UserID == "" || claims.SessionID == "" {
 		return nil, errors.New("无效的token")
 	}
 
-	// 校验 Redis 中是否匹配
+	// 校验会话是否仍然有效（登出或检测到重用后立即失效）
 	ctx := context.Background()
-	key := fmt.Sprintf("%s%s", tokenPrefix, claims.Email)
-	storedToken, err := rdb.Get(ctx, key).Result()
+	userID, err := rdb.HGet(ctx, tokenSessionPrefix+claims.SessionID, "user_id").Result()
 	if errors.Is(err, redis.Nil) {
-		return nil, errors.New("token 已过期，请重新登录")
+		return nil, errors.New("token 已失效，请重新登录")
 	} else if err != nil {
 		return nil, err
 	}
-
-	if storedToken != tokenString {
-		return nil, errors.New("token 已失效（可能在其他地方登录）")
+	if userID != claims.UserID {
+		return nil, errors.New("无效的token")
 	}
 
 	return claims, nil
 }
 
-// DeleteToken 删除 Token（登出）
-func DeleteToken(userID string, rdb *redis.Client) error {
+// DeleteToken 注销登录会话（登出），会话下的 Access Token 和 Refresh Token 全部失效
+func DeleteToken(userID, sessionID string, rdb *redis.Client) error {
 	ctx := context.Background()
-	key := fmt.Sprintf("%s%s", tokenPrefix, userID)
-	return rdb.Del(ctx, key).Err()
+	pipe := rdb.TxPipeline()
+	pipe.Del(ctx, tokenSessionPrefix+sessionID, tokenSessionUsedPrefix+sessionID)
+	pipe.SRem(ctx, userSessionsPrefix+userID, sessionID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// RevokeUserTokens 注销用户的全部登录会话（重置密码等），exceptSessionID 非空时保留该会话
+func RevokeUserTokens(userID, exceptSessionID string, rdb *redis.Client) error {
+	ctx := context.Background()
+	sessionIDs, err := rdb.SMembers(ctx, userSessionsPrefix+userID).Result()
+	if err != nil {
+		return err
+	}
+
+	pipe := rdb.TxPipeline()
+	for _, sessionID := range sessionIDs {
+		if sessionID == exceptSessionID {
+			continue
+		}
+		pipe.Del(ctx, tokenSessionPrefix+sessionID, tokenSessionUsedPrefix+sessionID)
+		pipe.SRem(ctx, userSessionsPrefix+userID, sessionID)
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// issueTokenPair 使用当前签名密钥为会话签发 Access Token
+func issueTokenPair(userID, email, sessionID, refreshToken string) (*TokenPair, error) {
+	now := time.Now()
+	expiration := getAccessTokenTTL()
+	claims := Claims{
+		UserID:    userID,
+		Email:     email,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiration)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	tokenString, err := jwtKeys.sign(claims)
+	if err != nil {
+		return nil, WrapError(err, CodeInternalError, "JWT生成失败")
+	}
+
+	return &TokenPair{
+		AccessToken:  tokenString,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(expiration.Seconds()),
+	}, nil
+}
+
+// newRefreshToken 生成会话的 Refresh Token 及其哈希
+func newRefreshToken(sessionID string) (string, string, error) {
+	secret, err := RandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	token := sessionID + "." + secret
+	return token, hashRefreshToken(token), nil
+}
+
+// hashRefreshToken Redis 中只保存 Refresh Token 的哈希
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RandomToken 生成 n 字节的密码学安全随机串（base64url 编码）
+func RandomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
 }
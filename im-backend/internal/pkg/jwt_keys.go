@@ -0,0 +1,244 @@
+package pkg
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"im-backend/config"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWT 签名密钥
+// 密钥目录下每个 PEM 文件是一个密钥，文件名（去掉 .pem 和 .pub）即 kid：
+//   - 私钥（PKCS#8 或 PKCS#1）可用于签名和验证
+//   - 公钥（PKIX）只用于验证，供轮换时保留旧密钥或接受其他服务签发的令牌
+//
+// 支持 RSA（RS256）和 Ed25519（EdDSA），签名使用 JWT_SIGNING_KEY_ID 指定的私钥
+
+// jwtKey 单个签名或验证密钥
+type jwtKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer // 只用于验证的密钥为 nil
+	Public  crypto.PublicKey
+}
+
+// JWTKeySet 当前加载的全部密钥
+type JWTKeySet struct {
+	signing *jwtKey
+	keys    map[string]*jwtKey
+}
+
+var jwtKeys *JWTKeySet
+
+// InitJWTKeys 加载 JWT 签名密钥
+// 未配置密钥目录时拒绝启动；本地开发可设置 JWT_EPHEMERAL_KEY=true 生成临时 Ed25519 密钥
+// （重启后 Access Token 失效，多实例之间无法互认）
+func InitJWTKeys() {
+	dir := config.Cfg.JWTKeysDir
+	if dir == "" {
+		if !config.Cfg.JWTEphemeralKey {
+			log.Fatalf("❌ JWT_KEYS_DIR 未配置，请配置签名密钥目录（本地开发可设置 JWT_EPHEMERAL_KEY=true 使用临时密钥）")
+		}
+		key, err := generateEphemeralJWTKey()
+		if err != nil {
+			log.Fatalf("❌ 生成临时JWT密钥失败: %v", err)
+		}
+		jwtKeys = &JWTKeySet{signing: key, keys: map[string]*jwtKey{key.ID: key}}
+		log.Printf("⚠️ JWT_KEYS_DIR 未配置，使用临时密钥 %s，仅限本地开发", key.ID)
+		return
+	}
+
+	keySet, err := LoadJWTKeySet(dir, config.Cfg.JWTSigningKeyID)
+	if err != nil {
+		log.Fatalf("❌ 加载JWT密钥失败: %v", err)
+	}
+	jwtKeys = keySet
+	log.Printf("✅ JWT密钥加载完成: 签名密钥 %s，共 %d 个验证密钥", keySet.signing.ID, len(keySet.keys))
+}
+
+// LoadJWTKeySet 从目录加载密钥，signingKeyID 为空且只有一个私钥时使用该私钥签名
+func LoadJWTKeySet(dir, signingKeyID string) (*JWTKeySet, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	keySet := &JWTKeySet{keys: make(map[string]*jwtKey)}
+	var privateIDs []string
+	for _, file := range files {
+		key, err := loadJWTKeyFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(file), err)
+		}
+		if existing, ok := keySet.keys[key.ID]; ok {
+			// 同一 kid 同时存在私钥和公钥文件时保留私钥
+			if existing.Private != nil || key.Private == nil {
+				continue
+			}
+		}
+		keySet.keys[key.ID] = key
+	}
+
+	for id, key := range keySet.keys {
+		if key.Private != nil {
+			privateIDs = append(privateIDs, id)
+		}
+	}
+	sort.Strings(privateIDs)
+
+	if signingKeyID == "" {
+		if len(privateIDs) != 1 {
+			return nil, fmt.Errorf("目录 %s 中有 %d 个私钥，请通过 JWT_SIGNING_KEY_ID 指定签名密钥", dir, len(privateIDs))
+		}
+		signingKeyID = privateIDs[0]
+	}
+	signing, ok := keySet.keys[signingKeyID]
+	if !ok || signing.Private == nil {
+		return nil, fmt.Errorf("签名密钥 %s 不存在或缺少私钥", signingKeyID)
+	}
+	keySet.signing = signing
+	return keySet, nil
+}
+
+// loadJWTKeyFile 解析单个 PEM 密钥文件
+func loadJWTKeyFile(file string) (*jwtKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("不是有效的PEM文件")
+	}
+
+	id := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(file), ".pem"), ".pub")
+	var parsed interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("不支持的PEM类型: %s", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newJWTKey(id, parsed)
+}
+
+// newJWTKey 根据密钥类型确定签名算法
+func newJWTKey(id string, parsed interface{}) (*jwtKey, error) {
+	key := &jwtKey{ID: id}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("不支持的密钥类型: %T", parsed)
+	}
+	if rsaKey, ok := key.Public.(*rsa.PublicKey); ok && rsaKey.N.BitLen() < 2048 {
+		return nil, errors.New("RSA密钥长度不能小于2048位")
+	}
+	return key, nil
+}
+
+// generateEphemeralJWTKey 生成临时 Ed25519 密钥
+func generateEphemeralJWTKey() (*jwtKey, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	suffix, err := RandomToken(6)
+	if err != nil {
+		return nil, err
+	}
+	return newJWTKey("ephemeral-"+suffix, private)
+}
+
+// sign 使用当前签名密钥签发令牌，header 中写入 kid
+func (ks *JWTKeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.Method, claims)
+	token.Header["kid"] = ks.signing.ID
+	return token.SignedString(ks.signing.Private)
+}
+
+// keyFunc 按 kid 选择验证密钥，并要求算法与密钥类型一致
+func (ks *JWTKeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id: %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.Public, nil
+}
+
+// validMethods 允许的签名算法
+func (ks *JWTKeySet) validMethods() []string {
+	return []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}
+}
+
+// JWKS 公开全部验证密钥（RFC 7517），供其他服务验证 Access Token
+func (ks *JWTKeySet) JWKS() map[string]interface{} {
+	ids := make([]string, 0, len(ks.keys))
+	for id := range ks.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	keys := make([]map[string]string, 0, len(ids))
+	for _, id := range ids {
+		key := ks.keys[id]
+		jwk := map[string]string{
+			"kid": key.ID,
+			"alg": key.Method.Alg(),
+			"use": "sig",
+		}
+		switch pub := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk["kty"] = "RSA"
+			jwk["n"] = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk["kty"] = "OKP"
+			jwk["crv"] = "Ed25519"
+			jwk["x"] = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		keys = append(keys, jwk)
+	}
+	return map[string]interface{}{"keys": keys}
+}
+
+// JWKSHandler GET /.well-known/jwks.json
+// 按 JWKS 标准格式返回，不使用统一响应结构
+func JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	_ = json.NewEncoder(w).Encode(jwtKeys.JWKS())
+}
@@ -0,0 +1,46 @@
+package pkg
+
+import (
+	"errors"
+	"im-backend/config"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// mediaURLPrefix 本地媒体文件对外访问的路径前缀
+const mediaURLPrefix = "/uploads/"
+
+// LocalMediaPath 将本地媒体文件URL解析为存储目录中的路径
+// 只处理以 /uploads/ 开头的相对URL，外部链接返回 false
+func LocalMediaPath(mediaURL string) (string, bool) {
+	if mediaURL == "" || config.Cfg == nil || config.Cfg.UploadDir == "" {
+		return "", false
+	}
+
+	u, err := url.Parse(mediaURL)
+	if err != nil {
+		return "", false
+	}
+	if u.Scheme != "" || u.Host != "" || !strings.HasPrefix(u.Path, mediaURLPrefix) {
+		return "", false
+	}
+
+	// 防止通过 ../ 访问存储目录之外的文件
+	name := filepath.Clean("/" + strings.TrimPrefix(u.Path, mediaURLPrefix))
+	return filepath.Join(config.Cfg.UploadDir, name), true
+}
+
+// RemoveMediaFile 删除本地存储的媒体文件，外部链接直接忽略
+func RemoveMediaFile(mediaURL string) error {
+	path, ok := LocalMediaPath(mediaURL)
+	if !ok {
+		return nil
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
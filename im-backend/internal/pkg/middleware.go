@@ -109,10 +109,12 @@ func AuthMiddleware(rdb *redis.Client, next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		// 把 Email 写入请求上下文
-		ctx := r.Context()
-		ctx = SetUserIDToContext(ctx, claims.Email)
-		r = r.WithContext(ctx)
+		// 把认证主体写入请求上下文
+		r = r.WithContext(SetPrincipalToContext(r.Context(), &Principal{
+			UserID:    claims.UserID,
+			Email:     claims.Email,
+			SessionID: claims.SessionID,
+		}))
 
 		next(w, r)
 	}
@@ -150,45 +152,3 @@ func CORSMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
-
-// RateLimitMiddleware 限流中间件（简单实现）
-type RateLimiter struct {
-	requests map[string][]time.Time
-}
-
-func NewRateLimiter() *RateLimiter {
-	return &RateLimiter{
-		requests: make(map[string][]time.Time),
-	}
-}
-
-func (rl *RateLimiter) Middleware(maxRequests int, window time.Duration) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ip := r.RemoteAddr
-			now := time.Now()
-
-			// 清理过期记录
-			if times, exists := rl.requests[ip]; exists {
-				var validTimes []time.Time
-				for _, t := range times {
-					if now.Sub(t) < window {
-						validTimes = append(validTimes, t)
-					}
-				}
-				rl.requests[ip] = validTimes
-			}
-
-			// 检查是否超过限制
-			if len(rl.requests[ip]) >= maxRequests {
-				appErr := NewAppError(CodeForbidden, "请求过于频繁，请稍后再试")
-				ErrorWithAppError(w, appErr, false)
-				return
-			}
-
-			// 记录请求
-			rl.requests[ip] = append(rl.requests[ip], now)
-			next.ServeHTTP(w, r)
-		})
-	}
-}
@@ -0,0 +1,63 @@
+package pkg
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// 动态正文中的话题和提及
+// 话题支持 #话题 和 #话题# 两种写法，提及格式为 @用户ID
+var (
+	hashtagPattern = regexp.MustCompile(`#([\p{L}\p{N}_]+)#?`)
+	mentionPattern = regexp.MustCompile(`(?:^|[^A-Za-z0-9_.])@([\p{L}\p{N}_\-]+)`) // 排除邮箱地址中的@
+)
+
+// MaxHashtagLength 话题的最大字符数
+const MaxHashtagLength = 30
+
+// NormalizeHashtag 规范化话题：去掉首尾的#和空白，英文统一小写
+// 返回空字符串表示不是有效的话题
+func NormalizeHashtag(tag string) string {
+	tag = strings.ToLower(strings.Trim(strings.TrimSpace(tag), "#"))
+	if tag == "" || utf8.RuneCountInString(tag) > MaxHashtagLength {
+		return ""
+	}
+	return tag
+}
+
+// ParseHashtags 提取正文中的话题（去重，保持出现顺序），最多 limit 个
+func ParseHashtags(content string, limit int) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, match := range hashtagPattern.FindAllStringSubmatch(content, -1) {
+		tag := NormalizeHashtag(match[1])
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+		if len(tags) >= limit {
+			break
+		}
+	}
+	return tags
+}
+
+// ParseMentions 提取正文中提及的用户ID（去重，保持出现顺序），最多 limit 个
+func ParseMentions(content string, limit int) []string {
+	var userIDs []string
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		userID := match[1]
+		if seen[userID] {
+			continue
+		}
+		seen[userID] = true
+		userIDs = append(userIDs, userID)
+		if len(userIDs) >= limit {
+			break
+		}
+	}
+	return userIDs
+}
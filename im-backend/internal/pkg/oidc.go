@@ -0,0 +1,390 @@
+package pkg
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"im-backend/config"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// OIDC 客户端：授权码模式 + PKCE（S256）
+// 提供方的元数据和签名公钥在首次使用时获取，身份提供方暂时不可用不影响服务启动
+const (
+	oidcHTTPTimeout     = 10 * time.Second
+	oidcKeyRefreshDelay = time.Minute // 遇到未知 kid 时重新获取公钥的最小间隔
+	oidcMaxResponseSize = 1 << 20
+)
+
+// OIDCClaims ID Token 中使用的声明
+type OIDCClaims struct {
+	Email             string   `json:"email"`
+	EmailVerified     oidcBool `json:"email_verified"`
+	Name              string   `json:"name"`
+	PreferredUsername string   `json:"preferred_username"`
+	Nonce             string   `json:"nonce"`
+	AuthorizedParty   string   `json:"azp"`
+	jwt.RegisteredClaims
+}
+
+// oidcBool 兼容部分提供方将 email_verified 返回为字符串 "true"
+type oidcBool bool
+
+func (b *oidcBool) UnmarshalJSON(data []byte) error {
+	value := strings.Trim(string(data), `"`)
+	*b = oidcBool(value == "true")
+	return nil
+}
+
+// oidcDiscovery 提供方元数据（/.well-known/openid-configuration）
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCProvider 单个 OIDC 身份提供方
+type OIDCProvider struct {
+	Name        string
+	Issuer      string
+	ClientID    string
+	RedirectURL string
+
+	clientSecret string
+	scopes       string
+	client       *http.Client
+
+	mu            sync.Mutex
+	discovery     *oidcDiscovery
+	keys          map[string]interface{}
+	keysFetchedAt time.Time
+	keysFetching  chan struct{} // 正在获取公钥集时不为空，获取结束后关闭
+}
+
+// NewOIDCProviders 按配置创建身份提供方，键为提供方名称
+func NewOIDCProviders() map[string]*OIDCProvider {
+	providers := make(map[string]*OIDCProvider)
+	for _, cfg := range config.Cfg.OIDCProviders {
+		providers[cfg.Name] = &OIDCProvider{
+			Name:         cfg.Name,
+			Issuer:       cfg.Issuer,
+			ClientID:     cfg.ClientID,
+			RedirectURL:  config.Cfg.OIDCRedirectURL + cfg.Name + "/callback",
+			clientSecret: cfg.ClientSecret,
+			scopes:       cfg.Scopes,
+			client:       &http.Client{Timeout: oidcHTTPTimeout},
+		}
+	}
+	return providers
+}
+
+// PKCEChallenge 根据 code_verifier 计算 S256 code_challenge
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL 生成跳转到身份提供方的授权地址
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	discovery, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.ClientID)
+	query.Set("redirect_uri", p.RedirectURL)
+	query.Set("scope", p.scopes)
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", PKCEChallenge(verifier))
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange 用授权码和 code_verifier 换取 ID Token
+func (p *OIDCProvider) Exchange(ctx context.Context, code, verifier string) (string, error) {
+	discovery, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("client_id", p.ClientID)
+	form.Set("code_verifier", verifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.clientSecret != "" {
+		// client_secret_basic：按 RFC 6749 先做表单编码
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.clientSecret))
+	}
+
+	var result struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := p.doJSON(req, &result); err != nil {
+		if result.Error != "" {
+			return "", fmt.Errorf("授权码兑换失败: %s %s", result.Error, result.ErrorDescription)
+		}
+		return "", err
+	}
+	if result.IDToken == "" {
+		return "", errors.New("身份提供方未返回 id_token")
+	}
+	return result.IDToken, nil
+}
+
+// VerifyIDToken 校验 ID Token 的签名、签发方、受众、有效期和 nonce
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, rawToken, nonce string) (*OIDCClaims, error) {
+	discovery, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &OIDCClaims{}
+	_, err = jwt.ParseWithClaims(rawToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.getKey(ctx, discovery.JWKSURI, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "ES256", "EdDSA"}),
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(30*time.Second),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ID Token 校验失败: %w", err)
+	}
+
+	if claims.Nonce == "" || claims.Nonce != nonce {
+		return nil, errors.New("ID Token 校验失败: nonce 不匹配")
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.ClientID {
+		return nil, errors.New("ID Token 校验失败: azp 不匹配")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("ID Token 校验失败: 缺少 sub")
+	}
+	return claims, nil
+}
+
+// getDiscovery 获取并缓存提供方元数据，要求 issuer 与配置完全一致
+// 网络请求在锁外进行，并发的首次请求可能各自获取一次，以先写入的为准
+func (p *OIDCProvider) getDiscovery(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	cached := p.discovery
+	p.mu.Unlock()
+	if cached != nil {
+		return cached, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		strings.TrimSuffix(p.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var discovery oidcDiscovery
+	if err := p.doJSON(req, &discovery); err != nil {
+		return nil, fmt.Errorf("获取 OIDC 元数据失败: %w", err)
+	}
+	if discovery.Issuer != p.Issuer {
+		return nil, fmt.Errorf("OIDC 元数据的 issuer %q 与配置 %q 不一致", discovery.Issuer, p.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("OIDC 元数据不完整")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery == nil {
+		p.discovery = &discovery
+	}
+	return p.discovery, nil
+}
+
+// getKey 按 kid 获取签名公钥，未知 kid 时重新获取公钥集（提供方轮换密钥）
+// 公钥集在锁外获取，同一时间只有一个请求访问提供方，其余请求等待其结果
+func (p *OIDCProvider) getKey(ctx context.Context, jwksURI, kid string) (interface{}, error) {
+	p.mu.Lock()
+	for p.keysFetching != nil {
+		if key, ok := p.lookupKey(kid); ok {
+			p.mu.Unlock()
+			return key, nil
+		}
+		fetching := p.keysFetching
+		p.mu.Unlock()
+		select {
+		case <-fetching:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		p.mu.Lock()
+	}
+	if key, ok := p.lookupKey(kid); ok {
+		p.mu.Unlock()
+		return key, nil
+	}
+	if time.Since(p.keysFetchedAt) < oidcKeyRefreshDelay {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("unknown key id: %q", kid)
+	}
+	done := make(chan struct{})
+	p.keysFetching = done
+	p.mu.Unlock()
+
+	keys, err := p.fetchKeys(ctx, jwksURI)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keysFetching = nil
+	close(done)
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key id: %q", kid)
+}
+
+// fetchKeys 获取提供方的公钥集，只保留用于签名的公钥
+func (p *OIDCProvider) fetchKeys(ctx context.Context, jwksURI string) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var jwks struct {
+		Keys []map[string]interface{} `json:"keys"`
+	}
+	if err := p.doJSON(req, &jwks); err != nil {
+		return nil, fmt.Errorf("获取 OIDC 公钥失败: %w", err)
+	}
+
+	keys := make(map[string]interface{})
+	for _, raw := range jwks.Keys {
+		// 只使用字符串字段（x5c 等数组字段忽略）
+		jwk := make(map[string]string, len(raw))
+		for field, value := range raw {
+			if str, ok := value.(string); ok {
+				jwk[field] = str
+			}
+		}
+		if use := jwk["use"]; use != "" && use != "sig" {
+			continue
+		}
+		if key, err := parseJWK(jwk); err == nil {
+			keys[jwk["kid"]] = key
+		}
+	}
+	return keys, nil
+}
+
+// lookupKey 查找公钥；令牌未带 kid 且只有一个公钥时使用该公钥，调用方需持有锁
+func (p *OIDCProvider) lookupKey(kid string) (interface{}, bool) {
+	if key, ok := p.keys[kid]; ok {
+		return key, true
+	}
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// doJSON 发送请求并解析 JSON 响应，非 2xx 时仍尝试解析错误信息
+func (p *OIDCProvider) doJSON(req *http.Request, out interface{}) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, oidcMaxResponseSize))
+	if err != nil {
+		return err
+	}
+	decodeErr := json.Unmarshal(body, out)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s 返回状态码 %d", req.URL.Host, resp.StatusCode)
+	}
+	return decodeErr
+}
+
+// parseJWK 解析 RSA、EC P-256 和 Ed25519 公钥
+func parseJWK(jwk map[string]string) (interface{}, error) {
+	decode := func(field string) ([]byte, error) {
+		return base64.RawURLEncoding.DecodeString(strings.TrimRight(jwk[field], "="))
+	}
+
+	switch jwk["kty"] {
+	case "RSA":
+		n, err := decode("n")
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode("e")
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if jwk["crv"] != "P-256" {
+			return nil, fmt.Errorf("不支持的曲线: %s", jwk["crv"])
+		}
+		x, err := decode("x")
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode("y")
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if jwk["crv"] != "Ed25519" {
+			return nil, fmt.Errorf("不支持的曲线: %s", jwk["crv"])
+		}
+		x, err := decode("x")
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("无效的 Ed25519 公钥")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("不支持的密钥类型: %s", jwk["kty"])
+}
@@ -0,0 +1,384 @@
+package pkg
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	mockOIDCClientID     = "im-backend"
+	mockOIDCClientSecret = "mock-secret"
+	mockOIDCRedirectURL  = "http://localhost:8080/api/v1/users/oidc/mock/callback"
+)
+
+// mockOIDCServer 模拟身份提供方：授权页面直接签发授权码，令牌端点校验 client_secret 和 PKCE 后返回 RS256 签名的 ID Token
+type mockOIDCServer struct {
+	*httptest.Server
+	issuer string // 元数据中的 issuer，为空时使用服务地址
+
+	mu    sync.Mutex
+	kid   string
+	key   *rsa.PrivateKey
+	codes map[string]url.Values // 授权码 -> 授权请求参数
+
+	discoveryHits atomic.Int32
+	jwksHits      atomic.Int32
+}
+
+func newMockOIDCServer(t *testing.T) *mockOIDCServer {
+	t.Helper()
+	m := &mockOIDCServer{kid: "key-1", key: newTestRSAKey(t), codes: make(map[string]url.Values)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		m.discoveryHits.Add(1)
+		issuer := m.issuer
+		if issuer == "" {
+			issuer = m.URL
+		}
+		writeTestJSON(w, http.StatusOK, map[string]string{
+			"issuer":                 issuer,
+			"authorization_endpoint": m.URL + "/authorize",
+			"token_endpoint":         m.URL + "/token",
+			"jwks_uri":               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		code := randomTestString()
+		m.mu.Lock()
+		m.codes[code] = r.URL.Query()
+		m.mu.Unlock()
+
+		callback, _ := url.Parse(r.URL.Query().Get("redirect_uri"))
+		query := callback.Query()
+		query.Set("code", code)
+		query.Set("state", r.URL.Query().Get("state"))
+		callback.RawQuery = query.Encode()
+		http.Redirect(w, r, callback.String(), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		clientID, secret, ok := r.BasicAuth()
+		if !ok || clientID != mockOIDCClientID || secret != mockOIDCClientSecret {
+			writeTestJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+			return
+		}
+		m.mu.Lock()
+		request, found := m.codes[r.PostForm.Get("code")]
+		delete(m.codes, r.PostForm.Get("code"))
+		m.mu.Unlock()
+		if !found || request.Get("redirect_uri") != r.PostForm.Get("redirect_uri") ||
+			PKCEChallenge(r.PostForm.Get("code_verifier")) != request.Get("code_challenge") {
+			writeTestJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+			return
+		}
+		writeTestJSON(w, http.StatusOK, map[string]string{
+			"id_token": m.sign(t, m.claims(request.Get("nonce"))),
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		m.jwksHits.Add(1)
+		m.mu.Lock()
+		pub, kid := m.key.PublicKey, m.kid
+		m.mu.Unlock()
+		writeTestJSON(w, http.StatusOK, map[string]interface{}{
+			"keys": []map[string]interface{}{
+				{"kty": "RSA", "kid": "enc-key", "use": "enc", "n": "AQAB", "e": "AQAB"},
+				{
+					"kty": "RSA",
+					"kid": kid,
+					"use": "sig",
+					"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+					"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+					"x5c": []string{"ignored"},
+				},
+			},
+		})
+	})
+
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+// provider 指向模拟服务的身份提供方
+func (m *mockOIDCServer) provider() *OIDCProvider {
+	return &OIDCProvider{
+		Name:         "mock",
+		Issuer:       m.URL,
+		ClientID:     mockOIDCClientID,
+		RedirectURL:  mockOIDCRedirectURL,
+		clientSecret: mockOIDCClientSecret,
+		scopes:       "openid email profile",
+		client:       m.Client(),
+	}
+}
+
+// rotateKey 轮换签名密钥
+func (m *mockOIDCServer) rotateKey(t *testing.T, kid string) {
+	key := newTestRSAKey(t)
+	m.mu.Lock()
+	m.kid, m.key = kid, key
+	m.mu.Unlock()
+}
+
+func (m *mockOIDCServer) claims(nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            m.URL,
+		"sub":            "mock|sso_user",
+		"aud":            mockOIDCClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          nonce,
+		"email":          "sso_user@example.com",
+		"email_verified": "true",
+		"name":           "SSO User",
+	}
+}
+
+func (m *mockOIDCServer) sign(t *testing.T, claims jwt.MapClaims) string {
+	m.mu.Lock()
+	key, kid := m.key, m.kid
+	m.mu.Unlock()
+	return signTestToken(t, claims, key, kid)
+}
+
+// authorize 模拟用户在授权页面同意：访问授权地址，从回调地址中取出 code 和 state
+func (m *mockOIDCServer) authorize(t *testing.T, authURL string) (code, state string) {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return callback.Query().Get("code"), callback.Query().Get("state")
+}
+
+func TestOIDCAuthorizationCodeFlow(t *testing.T) {
+	m := newMockOIDCServer(t)
+	p := m.provider()
+	ctx := context.Background()
+
+	authURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", "verifier-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, _ := url.ParseQuery(authURL[strings.Index(authURL, "?")+1:])
+	if !strings.HasPrefix(authURL, m.URL+"/authorize?") || query.Get("state") != "state-1" || query.Get("nonce") != "nonce-1" ||
+		query.Get("code_challenge") != PKCEChallenge("verifier-1") || query.Get("code_challenge_method") != "S256" ||
+		query.Get("redirect_uri") != mockOIDCRedirectURL || query.Get("client_id") != mockOIDCClientID {
+		t.Fatalf("授权地址参数不正确: %s", authURL)
+	}
+
+	code, state := m.authorize(t, authURL)
+	if state != "state-1" {
+		t.Fatalf("回调 state = %q, want state-1", state)
+	}
+
+	// code_verifier 不匹配时兑换失败，且授权码已被使用
+	if _, err := p.Exchange(ctx, code, "wrong-verifier"); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Fatalf("错误的 code_verifier 应兑换失败, got %v", err)
+	}
+
+	code, _ = m.authorize(t, authURL)
+	idToken, err := p.Exchange(ctx, code, "verifier-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := p.VerifyIDToken(ctx, idToken, "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "mock|sso_user" || claims.Email != "sso_user@example.com" || !bool(claims.EmailVerified) {
+		t.Fatalf("ID Token 声明不正确: %+v", claims)
+	}
+
+	if _, err := p.VerifyIDToken(ctx, idToken, "nonce-2"); err == nil || !strings.Contains(err.Error(), "nonce") {
+		t.Fatalf("nonce 不匹配时应校验失败, got %v", err)
+	}
+
+	// 元数据和公钥集只获取一次
+	if m.discoveryHits.Load() != 1 || m.jwksHits.Load() != 1 {
+		t.Fatalf("元数据获取 %d 次、公钥集获取 %d 次, want 1/1", m.discoveryHits.Load(), m.jwksHits.Load())
+	}
+}
+
+func TestOIDCDiscoveryIssuerMismatch(t *testing.T) {
+	m := newMockOIDCServer(t)
+	m.issuer = "https://evil.example.com"
+	if _, err := m.provider().AuthCodeURL(context.Background(), "s", "n", "v"); err == nil || !strings.Contains(err.Error(), "issuer") {
+		t.Fatalf("issuer 不一致时应拒绝, got %v", err)
+	}
+}
+
+func TestOIDCVerifyIDTokenClaims(t *testing.T) {
+	m := newMockOIDCServer(t)
+	p := m.provider()
+	ctx := context.Background()
+
+	otherKey := newTestRSAKey(t)
+	tests := []struct {
+		name  string
+		token func() string
+	}{
+		{"签发方不一致", func() string {
+			claims := m.claims("n")
+			claims["iss"] = "https://evil.example.com"
+			return m.sign(t, claims)
+		}},
+		{"受众不一致", func() string {
+			claims := m.claims("n")
+			claims["aud"] = "other-client"
+			return m.sign(t, claims)
+		}},
+		{"多个受众且 azp 不一致", func() string {
+			claims := m.claims("n")
+			claims["aud"] = []string{mockOIDCClientID, "other-client"}
+			claims["azp"] = "other-client"
+			return m.sign(t, claims)
+		}},
+		{"已过期", func() string {
+			claims := m.claims("n")
+			claims["exp"] = time.Now().Add(-time.Hour).Unix()
+			return m.sign(t, claims)
+		}},
+		{"缺少 exp", func() string {
+			claims := m.claims("n")
+			delete(claims, "exp")
+			return m.sign(t, claims)
+		}},
+		{"缺少 sub", func() string {
+			claims := m.claims("n")
+			delete(claims, "sub")
+			return m.sign(t, claims)
+		}},
+		{"签名密钥不匹配", func() string {
+			return signTestToken(t, m.claims("n"), otherKey, m.kid)
+		}},
+		{"不允许的算法", func() string {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, m.claims("n"))
+			signed, _ := token.SignedString([]byte(mockOIDCClientSecret))
+			return signed
+		}},
+	}
+	for _, tt := range tests {
+		if _, err := p.VerifyIDToken(ctx, tt.token(), "n"); err == nil {
+			t.Errorf("%s: 应校验失败", tt.name)
+		}
+	}
+
+	if _, err := p.VerifyIDToken(ctx, m.sign(t, m.claims("n")), "n"); err != nil {
+		t.Fatalf("有效的 ID Token 校验失败: %v", err)
+	}
+}
+
+func TestOIDCKeyRotation(t *testing.T) {
+	m := newMockOIDCServer(t)
+	p := m.provider()
+	ctx := context.Background()
+
+	if _, err := p.VerifyIDToken(ctx, m.sign(t, m.claims("n")), "n"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 刷新间隔内遇到未知 kid 不重新获取公钥集
+	m.rotateKey(t, "key-2")
+	if _, err := p.VerifyIDToken(ctx, m.sign(t, m.claims("n")), "n"); err == nil {
+		t.Fatal("刷新间隔内未知 kid 应校验失败")
+	}
+	if m.jwksHits.Load() != 1 {
+		t.Fatalf("刷新间隔内公钥集获取 %d 次, want 1", m.jwksHits.Load())
+	}
+
+	// 超过刷新间隔后重新获取，使用轮换后的公钥
+	p.mu.Lock()
+	p.keysFetchedAt = time.Now().Add(-oidcKeyRefreshDelay)
+	p.mu.Unlock()
+	if _, err := p.VerifyIDToken(ctx, m.sign(t, m.claims("n")), "n"); err != nil {
+		t.Fatalf("轮换后的公钥校验失败: %v", err)
+	}
+	if m.jwksHits.Load() != 2 {
+		t.Fatalf("公钥集获取 %d 次, want 2", m.jwksHits.Load())
+	}
+}
+
+// 并发校验时公钥集只获取一次，等待中的请求使用同一结果
+func TestOIDCConcurrentKeyFetch(t *testing.T) {
+	m := newMockOIDCServer(t)
+	p := m.provider()
+	ctx := context.Background()
+	token := m.sign(t, m.claims("n"))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := p.VerifyIDToken(ctx, token, "n")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if m.jwksHits.Load() != 1 {
+		t.Fatalf("公钥集获取 %d 次, want 1", m.jwksHits.Load())
+	}
+}
+
+func newTestRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func signTestToken(t *testing.T, claims jwt.MapClaims, key *rsa.PrivateKey, kid string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func writeTestJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func randomTestString() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
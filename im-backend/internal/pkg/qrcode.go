@@ -0,0 +1,530 @@
+package pkg
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// 二维码生成（ISO/IEC 18004）
+// 仅实现邀请链接需要的子集：字节模式、纠错等级M、版本1-10（最多213字节）
+
+// qrVersion 各版本在纠错等级M下的分块参数
+type qrVersion struct {
+	ecPerBlock int      // 每块纠错码字数
+	blocks     [][2]int // {块数, 每块数据码字数}
+	align      []int    // 校正图形中心坐标
+}
+
+var qrVersions = [...]qrVersion{
+	1:  {10, [][2]int{{1, 16}}, nil},
+	2:  {16, [][2]int{{1, 28}}, []int{6, 18}},
+	3:  {26, [][2]int{{1, 44}}, []int{6, 22}},
+	4:  {18, [][2]int{{2, 32}}, []int{6, 26}},
+	5:  {24, [][2]int{{2, 43}}, []int{6, 30}},
+	6:  {16, [][2]int{{4, 27}}, []int{6, 34}},
+	7:  {18, [][2]int{{4, 31}}, []int{6, 22, 38}},
+	8:  {22, [][2]int{{2, 38}, {2, 39}}, []int{6, 24, 42}},
+	9:  {22, [][2]int{{3, 36}, {2, 37}}, []int{6, 26, 46}},
+	10: {26, [][2]int{{4, 43}, {1, 44}}, []int{6, 28, 50}},
+}
+
+// dataCodewords 该版本的数据码字总数
+func (v qrVersion) dataCodewords() int {
+	total := 0
+	for _, group := range v.blocks {
+		total += group[0] * group[1]
+	}
+	return total
+}
+
+// qrCode 二维码模块矩阵
+type qrCode struct {
+	version    int
+	size       int
+	modules    [][]bool // [y][x]，true 为深色
+	isFunction [][]bool // 功能图形区域，不参与数据填充和掩码
+}
+
+// EncodeQRCodePNG 将内容编码为二维码PNG图片
+// scale 为每个模块的像素数，图片四周保留4个模块的静区
+func EncodeQRCodePNG(content string, scale int) ([]byte, error) {
+	if scale <= 0 {
+		scale = 8
+	}
+
+	qr, err := encodeQRCode([]byte(content))
+	if err != nil {
+		return nil, err
+	}
+
+	const quiet = 4
+	side := (qr.size + quiet*2) * scale
+	img := image.NewGray(image.Rect(0, 0, side, side))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+	for y := 0; y < qr.size; y++ {
+		for x := 0; x < qr.size; x++ {
+			if !qr.modules[y][x] {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetGray((x+quiet)*scale+dx, (y+quiet)*scale+dy, color.Gray{Y: 0})
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeQRCode 生成二维码矩阵
+func encodeQRCode(data []byte) (*qrCode, error) {
+	// 选择能容纳数据的最小版本
+	version := 0
+	for v := 1; v < len(qrVersions); v++ {
+		if qrDataBits(v, len(data)) <= qrVersions[v].dataCodewords()*8 {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, errors.New("二维码内容过长")
+	}
+
+	codewords := qrAddErrorCorrection(version, qrEncodeData(version, data))
+
+	qr := &qrCode{version: version, size: version*4 + 17}
+	qr.modules = make([][]bool, qr.size)
+	qr.isFunction = make([][]bool, qr.size)
+	for i := range qr.modules {
+		qr.modules[i] = make([]bool, qr.size)
+		qr.isFunction[i] = make([]bool, qr.size)
+	}
+
+	qr.drawFunctionPatterns()
+	qr.drawCodewords(codewords)
+
+	// 选择惩罚分最低的掩码
+	bestMask, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		qr.applyMask(mask)
+		qr.drawFormatBits(mask)
+		if penalty := qr.penaltyScore(); bestPenalty < 0 || penalty < bestPenalty {
+			bestMask, bestPenalty = mask, penalty
+		}
+		qr.applyMask(mask) // 掩码为异或操作，再次应用即可撤销
+	}
+	qr.applyMask(bestMask)
+	qr.drawFormatBits(bestMask)
+
+	return qr, nil
+}
+
+// qrDataBits 字节模式下编码数据所需的比特数
+func qrDataBits(version, length int) int {
+	countBits := 8
+	if version >= 10 {
+		countBits = 16
+	}
+	return 4 + countBits + length*8
+}
+
+// qrEncodeData 生成数据码字（模式指示符、字符计数、数据、终止符和填充）
+func qrEncodeData(version int, data []byte) []byte {
+	capacity := qrVersions[version].dataCodewords() * 8
+
+	var bits []bool
+	appendBits := func(value, length int) {
+		for i := length - 1; i >= 0; i-- {
+			bits = append(bits, (value>>uint(i))&1 == 1)
+		}
+	}
+
+	appendBits(0x4, 4) // 字节模式
+	if version >= 10 {
+		appendBits(len(data), 16)
+	} else {
+		appendBits(len(data), 8)
+	}
+	for _, b := range data {
+		appendBits(int(b), 8)
+	}
+
+	// 终止符与字节对齐
+	terminator := capacity - len(bits)
+	if terminator > 4 {
+		terminator = 4
+	}
+	appendBits(0, terminator)
+	appendBits(0, (8-len(bits)%8)%8)
+
+	// 交替填充 0xEC、0x11
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		appendBits(pad, 8)
+	}
+
+	result := make([]byte, len(bits)/8)
+	for i, bit := range bits {
+		if bit {
+			result[i>>3] |= 1 << uint(7-i&7)
+		}
+	}
+	return result
+}
+
+// qrAddErrorCorrection 分块计算纠错码并交错排列
+func qrAddErrorCorrection(version int, data []byte) []byte {
+	info := qrVersions[version]
+	divisor := qrReedSolomonDivisor(info.ecPerBlock)
+
+	var dataBlocks, ecBlocks [][]byte
+	offset := 0
+	for _, group := range info.blocks {
+		for i := 0; i < group[0]; i++ {
+			block := data[offset : offset+group[1]]
+			offset += group[1]
+			dataBlocks = append(dataBlocks, block)
+			ecBlocks = append(ecBlocks, qrReedSolomonRemainder(block, divisor))
+		}
+	}
+
+	var result []byte
+	maxData := info.blocks[len(info.blocks)-1][1]
+	for i := 0; i < maxData; i++ {
+		for _, block := range dataBlocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < info.ecPerBlock; i++ {
+		for _, block := range ecBlocks {
+			result = append(result, block[i])
+		}
+	}
+	return result
+}
+
+// qrReedSolomonDivisor 计算指定次数的生成多项式（最高次项系数省略）
+func qrReedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = qrGFMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = qrGFMultiply(root, 0x02)
+	}
+	return result
+}
+
+// qrReedSolomonRemainder 计算数据对生成多项式取余，即纠错码字
+func qrReedSolomonRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coef := range divisor {
+			result[i] ^= qrGFMultiply(coef, factor)
+		}
+	}
+	return result
+}
+
+// qrGFMultiply GF(2^8) 乘法，本原多项式 0x11D
+func qrGFMultiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>uint(i))&1) * int(x)
+	}
+	return byte(z)
+}
+
+// setFunctionModule 设置功能图形模块
+func (qr *qrCode) setFunctionModule(x, y int, dark bool) {
+	qr.modules[y][x] = dark
+	qr.isFunction[y][x] = true
+}
+
+// drawFunctionPatterns 绘制定位、分隔、时序、校正图形，并预留格式与版本信息区域
+func (qr *qrCode) drawFunctionPatterns() {
+	for i := 0; i < qr.size; i++ {
+		qr.setFunctionModule(6, i, i%2 == 0)
+		qr.setFunctionModule(i, 6, i%2 == 0)
+	}
+
+	qr.drawFinderPattern(3, 3)
+	qr.drawFinderPattern(qr.size-4, 3)
+	qr.drawFinderPattern(3, qr.size-4)
+
+	align := qrVersions[qr.version].align
+	last := len(align) - 1
+	for i := range align {
+		for j := range align {
+			// 与定位图形重叠的位置跳过
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			qr.drawAlignmentPattern(align[i], align[j])
+		}
+	}
+
+	qr.drawFormatBits(0) // 先占位，选定掩码后覆盖
+	qr.drawVersion()
+}
+
+// drawFinderPattern 以 (x, y) 为中心绘制定位图形及分隔符
+func (qr *qrCode) drawFinderPattern(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || xx >= qr.size || yy < 0 || yy >= qr.size {
+				continue
+			}
+			dist := qrMax(qrAbs(dx), qrAbs(dy))
+			qr.setFunctionModule(xx, yy, dist != 2 && dist != 4)
+		}
+	}
+}
+
+// drawAlignmentPattern 以 (x, y) 为中心绘制校正图形
+func (qr *qrCode) drawAlignmentPattern(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			qr.setFunctionModule(x+dx, y+dy, qrMax(qrAbs(dx), qrAbs(dy)) != 1)
+		}
+	}
+}
+
+// drawFormatBits 绘制两份格式信息（纠错等级M + 掩码）
+func (qr *qrCode) drawFormatBits(mask int) {
+	data := mask // 纠错等级M的指示位为 00
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>uint(i))&1 == 1 }
+
+	// 左上角
+	for i := 0; i <= 5; i++ {
+		qr.setFunctionModule(8, i, bit(i))
+	}
+	qr.setFunctionModule(8, 7, bit(6))
+	qr.setFunctionModule(8, 8, bit(7))
+	qr.setFunctionModule(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		qr.setFunctionModule(14-i, 8, bit(i))
+	}
+
+	// 右上角与左下角
+	for i := 0; i < 8; i++ {
+		qr.setFunctionModule(qr.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		qr.setFunctionModule(8, qr.size-15+i, bit(i))
+	}
+	qr.setFunctionModule(8, qr.size-8, true) // 固定深色模块
+}
+
+// drawVersion 绘制版本信息（版本7及以上）
+func (qr *qrCode) drawVersion() {
+	if qr.version < 7 {
+		return
+	}
+
+	rem := qr.version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	bits := qr.version<<12 | rem
+
+	for i := 0; i < 18; i++ {
+		dark := (bits>>uint(i))&1 == 1
+		a, b := qr.size-11+i%3, i/3
+		qr.setFunctionModule(a, b, dark)
+		qr.setFunctionModule(b, a, dark)
+	}
+}
+
+// drawCodewords 按之字形顺序填充数据码字
+func (qr *qrCode) drawCodewords(codewords []byte) {
+	i := 0
+	for right := qr.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // 跳过垂直时序图形
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < qr.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if upward {
+					y = qr.size - 1 - vert
+				}
+				if qr.isFunction[y][x] || i >= len(codewords)*8 {
+					continue
+				}
+				qr.modules[y][x] = (codewords[i>>3]>>uint(7-i&7))&1 == 1
+				i++
+			}
+		}
+	}
+}
+
+// applyMask 对数据区域应用掩码（异或）
+func (qr *qrCode) applyMask(mask int) {
+	for y := 0; y < qr.size; y++ {
+		for x := 0; x < qr.size; x++ {
+			if qr.isFunction[y][x] {
+				continue
+			}
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert {
+				qr.modules[y][x] = !qr.modules[y][x]
+			}
+		}
+	}
+}
+
+// penaltyScore 按标准的四条规则计算掩码惩罚分
+func (qr *qrCode) penaltyScore() int {
+	score := 0
+	size := qr.size
+
+	// 规则1、3：行列中的同色连续模块和类定位图形
+	line := make([]bool, size)
+	for pass := 0; pass < 2; pass++ {
+		for a := 0; a < size; a++ {
+			for b := 0; b < size; b++ {
+				if pass == 0 {
+					line[b] = qr.modules[a][b]
+				} else {
+					line[b] = qr.modules[b][a]
+				}
+			}
+			score += qrRunPenalty(line) + qrFinderLikePenalty(line)
+		}
+	}
+
+	// 规则2：2x2 同色块
+	for y := 0; y < size-1; y++ {
+		for x := 0; x < size-1; x++ {
+			c := qr.modules[y][x]
+			if c == qr.modules[y][x+1] && c == qr.modules[y+1][x] && c == qr.modules[y+1][x+1] {
+				score += 3
+			}
+		}
+	}
+
+	// 规则4：深色模块比例偏离50%
+	dark := 0
+	for _, row := range qr.modules {
+		for _, m := range row {
+			if m {
+				dark++
+			}
+		}
+	}
+	total := size * size
+	deviation := qrAbs(dark*20 - total*10)
+	score += deviation / total * 10
+	return score
+}
+
+// qrRunPenalty 连续5个及以上同色模块的惩罚分
+func qrRunPenalty(line []bool) int {
+	score := 0
+	run := 1
+	for i := 1; i <= len(line); i++ {
+		if i < len(line) && line[i] == line[i-1] {
+			run++
+			continue
+		}
+		if run >= 5 {
+			score += run - 2
+		}
+		run = 1
+	}
+	return score
+}
+
+// qrFinderLikePenalty 出现 1:1:3:1:1 且一侧有4个浅色模块的图形的惩罚分
+func qrFinderLikePenalty(line []bool) int {
+	pattern := []bool{true, false, true, true, true, false, true}
+	score := 0
+	for i := 0; i+len(pattern) <= len(line); i++ {
+		match := true
+		for j, p := range pattern {
+			if line[i+j] != p {
+				match = false
+				break
+			}
+		}
+		if !match {
+			continue
+		}
+		if qrLightRun(line, i-4, i) || qrLightRun(line, i+len(pattern), i+len(pattern)+4) {
+			score += 40
+		}
+	}
+	return score
+}
+
+// qrLightRun 判断 [from, to) 是否全为浅色（超出边界视为浅色静区）
+func qrLightRun(line []bool, from, to int) bool {
+	for i := from; i < to; i++ {
+		if i >= 0 && i < len(line) && line[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func qrAbs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func qrMax(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
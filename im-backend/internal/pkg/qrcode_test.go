@@ -0,0 +1,214 @@
+package pkg
+
+import (
+	"bytes"
+	"image/png"
+	"strconv"
+	"testing"
+)
+
+// 纠错码字：ISO/IEC 18004 附录中 "HELLO WORLD"（版本1-M）的数据码字及其纠错码字
+func TestQRReedSolomonKnownVector(t *testing.T) {
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	got := qrReedSolomonRemainder(data, qrReedSolomonDivisor(qrVersions[1].ecPerBlock))
+	if !bytes.Equal(got, want) {
+		t.Fatalf("纠错码字 = %v, want %v", got, want)
+	}
+}
+
+// 版本选择：纠错等级M下字节模式各版本的容量（ISO/IEC 18004 表7）
+func TestQRVersionSelection(t *testing.T) {
+	capacities := []int{1: 14, 2: 26, 3: 42, 4: 62, 5: 84, 6: 106, 7: 122, 8: 152, 9: 180, 10: 213}
+	for version := 1; version < len(capacities); version++ {
+		capacity := capacities[version]
+
+		qr, err := encodeQRCode(bytes.Repeat([]byte("a"), capacity))
+		if err != nil || qr.version != version {
+			t.Fatalf("%d 字节应使用版本 %d, got %v, err %v", capacity, version, qr, err)
+		}
+		if qr.size != version*4+17 {
+			t.Fatalf("版本 %d 边长 = %d, want %d", version, qr.size, version*4+17)
+		}
+
+		if version < len(capacities)-1 {
+			qr, err = encodeQRCode(bytes.Repeat([]byte("a"), capacity+1))
+			if err != nil || qr.version != version+1 {
+				t.Fatalf("%d 字节应使用版本 %d, got %v, err %v", capacity+1, version+1, qr, err)
+			}
+		}
+	}
+
+	if _, err := encodeQRCode(bytes.Repeat([]byte("a"), 214)); err == nil {
+		t.Fatal("超过版本10容量时应返回错误")
+	}
+}
+
+// 数据码字：模式指示符 0100、8位字符计数、数据、终止符，再交替填充 0xEC、0x11
+func TestQREncodeData(t *testing.T) {
+	got := qrEncodeData(1, []byte("hi"))
+	want := []byte{0x40, 0x26, 0x86, 0x90, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("数据码字 = % X, want % X", got, want)
+	}
+}
+
+// 格式信息：纠错等级M下8种掩码的15位格式串（ISO/IEC 18004 附录C）
+func TestQRFormatBits(t *testing.T) {
+	want := []string{
+		"101010000010010",
+		"101000100100101",
+		"101111001111100",
+		"101101101001011",
+		"100010111111001",
+		"100000011001110",
+		"100111110010111",
+		"100101010100000",
+	}
+	for mask, format := range want {
+		qr := newTestQRCode(1)
+		qr.drawFormatBits(mask)
+		if got := readFormatBits(qr); got != format {
+			t.Errorf("掩码 %d 格式信息 = %s, want %s", mask, got, format)
+		}
+	}
+}
+
+// 版本信息：版本7为 000111110010010100（ISO/IEC 18004 附录D）
+func TestQRVersionBits(t *testing.T) {
+	qr := newTestQRCode(7)
+	qr.drawVersion()
+
+	got := ""
+	for i := 17; i >= 0; i-- {
+		a, b := qr.size-11+i%3, i/3
+		if qr.modules[b][a] != qr.modules[a][b] {
+			t.Fatalf("两份版本信息不一致: 第 %d 位", i)
+		}
+		got += strconv.Itoa(boolToInt(qr.modules[b][a]))
+	}
+	if want := "000111110010010100"; got != want {
+		t.Fatalf("版本信息 = %s, want %s", got, want)
+	}
+}
+
+// 掩码选择：最终矩阵的格式信息指向惩罚分最低的掩码，去掉掩码后能按之字形读回全部码字
+func TestQRMaskSelection(t *testing.T) {
+	for _, content := range []string{"https://example.com/invite/abc", string(bytes.Repeat([]byte("x"), 150))} {
+		data := []byte(content)
+		qr, err := encodeQRCode(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		format, err := strconv.ParseInt(readFormatBits(qr), 2, 32)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mask := int((format^0x5412)>>10) & 0x7
+		if (format^0x5412)>>13 != 0 {
+			t.Fatalf("纠错等级不是M: %015b", format)
+		}
+
+		chosen := qr.penaltyScore()
+		for other := 0; other < 8; other++ {
+			qr.applyMask(mask)
+			qr.applyMask(other)
+			qr.drawFormatBits(other)
+			if penalty := qr.penaltyScore(); penalty < chosen {
+				t.Fatalf("掩码 %d 的惩罚分 %d 低于选中的掩码 %d（%d）", other, penalty, mask, chosen)
+			}
+			qr.applyMask(other)
+			qr.applyMask(mask)
+			qr.drawFormatBits(mask)
+		}
+
+		qr.applyMask(mask)
+		want := qrAddErrorCorrection(qr.version, qrEncodeData(qr.version, data))
+		if got := readCodewords(qr, len(want)); !bytes.Equal(got, want) {
+			t.Fatalf("读回的码字与编码结果不一致")
+		}
+	}
+}
+
+func TestEncodeQRCodePNG(t *testing.T) {
+	data, err := EncodeQRCodePNG("https://example.com/invite/abc", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 30字节超过版本2容量，使用版本3（29个模块），加两侧各4个模块的静区
+	if side := (29 + 8) * 4; img.Bounds().Dx() != side || img.Bounds().Dy() != side {
+		t.Fatalf("图片尺寸 = %v, want %dx%d", img.Bounds(), side, side)
+	}
+}
+
+func newTestQRCode(version int) *qrCode {
+	qr := &qrCode{version: version, size: version*4 + 17}
+	qr.modules = make([][]bool, qr.size)
+	qr.isFunction = make([][]bool, qr.size)
+	for i := range qr.modules {
+		qr.modules[i] = make([]bool, qr.size)
+		qr.isFunction[i] = make([]bool, qr.size)
+	}
+	return qr
+}
+
+// readFormatBits 从左上角读取格式信息，高位在前
+func readFormatBits(qr *qrCode) string {
+	positions := make([][2]int, 15)
+	for i := 0; i <= 5; i++ {
+		positions[i] = [2]int{8, i}
+	}
+	positions[6] = [2]int{8, 7}
+	positions[7] = [2]int{8, 8}
+	positions[8] = [2]int{7, 8}
+	for i := 9; i < 15; i++ {
+		positions[i] = [2]int{14 - i, 8}
+	}
+
+	result := ""
+	for i := 14; i >= 0; i-- {
+		result += strconv.Itoa(boolToInt(qr.modules[positions[i][1]][positions[i][0]]))
+	}
+	return result
+}
+
+// readCodewords 按之字形顺序读取数据区域的码字
+func readCodewords(qr *qrCode, count int) []byte {
+	result := make([]byte, count)
+	i := 0
+	for right := qr.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < qr.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if upward {
+					y = qr.size - 1 - vert
+				}
+				if qr.isFunction[y][x] || i >= count*8 {
+					continue
+				}
+				if qr.modules[y][x] {
+					result[i>>3] |= 1 << uint(7-i&7)
+				}
+				i++
+			}
+		}
+	}
+	return result
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,216 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"im-backend/config"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 限流分类，不同分类使用独立的令牌桶
+const (
+	RateLimitGlobal  = "global"  // 所有接口，按IP
+	RateLimitCode    = "code"    // 发送验证码，按IP
+	RateLimitAuth    = "auth"    // 登录注册，按IP
+	RateLimitMessage = "message" // 发送消息，按用户
+)
+
+// RateLimitPrefix 令牌桶在Redis中的键前缀
+const RateLimitPrefix = "rate_limit:"
+
+// rateLimitScript 令牌桶：按距上次请求的时间补充令牌，容量为 capacity，每毫秒补充 rate 个
+// 返回 {是否放行, 需要等待的毫秒数}；使用Redis服务器时间，避免多实例时钟不一致
+var rateLimitScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil or ts == nil then
+	tokens = capacity
+	ts = now
+end
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) / rate)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(capacity / rate) + 1000)
+return {allowed, wait}
+`)
+
+// RateLimitRule 限流规则：每个周期最多 Capacity 次请求，令牌在周期内匀速补充
+type RateLimitRule struct {
+	Capacity int
+	Period   time.Duration
+}
+
+// ParseRateLimitRule 解析 "次数/周期" 格式的限流规则，如 "5/1m"、"60/1m"
+func ParseRateLimitRule(value string) (RateLimitRule, error) {
+	count, period, ok := strings.Cut(strings.TrimSpace(value), "/")
+	if !ok {
+		return RateLimitRule{}, fmt.Errorf("限流规则格式错误: %q", value)
+	}
+	capacity, err := strconv.Atoi(count)
+	if err != nil || capacity <= 0 {
+		return RateLimitRule{}, fmt.Errorf("限流次数无效: %q", value)
+	}
+	duration, err := time.ParseDuration(period)
+	if err != nil || duration <= 0 {
+		return RateLimitRule{}, fmt.Errorf("限流周期无效: %q", value)
+	}
+	return RateLimitRule{Capacity: capacity, Period: duration}, nil
+}
+
+// RateLimiter 基于Redis令牌桶的限流器，多个服务实例共享限额
+type RateLimiter struct {
+	rdb            *redis.Client
+	enabled        bool
+	trustedProxies int
+	rules          map[string]RateLimitRule
+}
+
+// NewRateLimiter 按配置创建限流器，配置无效的分类使用默认规则
+func NewRateLimiter(rdb *redis.Client) *RateLimiter {
+	cfg := config.Cfg
+	rl := &RateLimiter{
+		rdb:            rdb,
+		enabled:        cfg.RateLimitEnabled,
+		trustedProxies: cfg.RateLimitTrustedProxies,
+		rules:          make(map[string]RateLimitRule),
+	}
+
+	for class, value := range map[string]string{
+		RateLimitGlobal:  cfg.RateLimitGlobal,
+		RateLimitCode:    cfg.RateLimitCode,
+		RateLimitAuth:    cfg.RateLimitAuth,
+		RateLimitMessage: cfg.RateLimitMessage,
+	} {
+		rule, err := ParseRateLimitRule(value)
+		if err != nil {
+			log.Printf("⚠️ %v，%s 分类使用默认规则", err, class)
+			rule = defaultRateLimitRules[class]
+		}
+		rl.rules[class] = rule
+	}
+	return rl
+}
+
+// defaultRateLimitRules 配置无效时的默认规则
+var defaultRateLimitRules = map[string]RateLimitRule{
+	RateLimitGlobal:  {Capacity: 600, Period: time.Minute},
+	RateLimitCode:    {Capacity: 5, Period: 10 * time.Minute},
+	RateLimitAuth:    {Capacity: 30, Period: time.Minute},
+	RateLimitMessage: {Capacity: 60, Period: time.Minute},
+}
+
+// Middleware 按IP限流的路由中间件，用于 Subrouter.Use
+func (rl *RateLimiter) Middleware(class string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(rl.ByIP(class, next.ServeHTTP))
+	}
+}
+
+// ByIP 按客户端IP限流
+func (rl *RateLimiter) ByIP(class string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if rl.allow(w, class, "ip:"+rl.clientIP(r)) {
+			next(w, r)
+		}
+	}
+}
+
+// ByUser 按当前用户限流，需放在 AuthMiddleware 之内；取不到用户时按IP限流
+func (rl *RateLimiter) ByUser(class string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := "ip:" + rl.clientIP(r)
+		if user := GetUserIDFromContext(r.Context()); user != "" {
+			key = "user:" + user
+		}
+		if rl.allow(w, class, key) {
+			next(w, r)
+		}
+	}
+}
+
+// allow 消耗一个令牌，超出限额时写入 429 响应和 Retry-After
+// Redis不可用时放行，避免限流器故障导致整个服务不可用
+func (rl *RateLimiter) allow(w http.ResponseWriter, class, key string) bool {
+	rule, ok := rl.rules[class]
+	if !rl.enabled || !ok {
+		return true
+	}
+
+	rate := float64(rule.Capacity) / float64(rule.Period.Milliseconds())
+	result, err := rateLimitScript.Run(context.Background(), rl.rdb,
+		[]string{RateLimitPrefix + class + ":" + key}, rule.Capacity, rate).Int64Slice()
+	if err != nil || len(result) != 2 {
+		log.Printf("⚠️ 限流检查失败，已放行: %v", err)
+		return true
+	}
+	if result[0] == 1 {
+		return true
+	}
+
+	retryAfter := (result[1] + 999) / 1000
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+	ErrorWithStatus(w, http.StatusTooManyRequests, NewAppError(CodeTooManyRequests, fmt.Sprintf("%s 限流，%d 秒后重试", class, retryAfter)))
+	return false
+}
+
+// clientIP 获取客户端IP
+func (rl *RateLimiter) clientIP(r *http.Request) string {
+	return clientIP(r, rl.trustedProxies)
+}
+
+// ClientIP 获取客户端IP（登录记录等），可信代理层数与限流配置一致
+func ClientIP(r *http.Request) string {
+	return clientIP(r, config.Cfg.RateLimitTrustedProxies)
+}
+
+// clientIP 部署在 trustedProxies 层反向代理之后时，从 X-Forwarded-For 右数第 trustedProxies 个地址取客户端IP
+// 每层代理把上一跳的地址追加到末尾，左侧的地址由客户端自己填写，不能信任
+func clientIP(r *http.Request, trustedProxies int) string {
+	if trustedProxies > 0 {
+		var hops []string
+		for _, value := range r.Header.Values("X-Forwarded-For") {
+			for _, hop := range strings.Split(value, ",") {
+				if hop = strings.TrimSpace(hop); hop != "" {
+					hops = append(hops, hop)
+				}
+			}
+		}
+		if len(hops) > 0 {
+			// 地址少于代理层数时全部由可信代理写入，取最左侧的地址
+			return hops[max(len(hops)-trustedProxies, 0)]
+		}
+		if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+			return strings.TrimSpace(realIP)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,40 @@
+package pkg
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustedProxies int
+		forwarded      []string
+		realIP         string
+		want           string
+	}{
+		{"不信任代理时忽略请求头", 0, []string{"1.1.1.1"}, "2.2.2.2", "10.0.0.1"},
+		{"一层代理取最右侧地址", 1, []string{"6.6.6.6, 1.1.1.1"}, "", "1.1.1.1"},
+		{"两层代理取右数第二个地址", 2, []string{"6.6.6.6, 1.1.1.1, 10.0.0.2"}, "", "1.1.1.1"},
+		{"多个请求头按顺序合并", 1, []string{"6.6.6.6", "1.1.1.1"}, "", "1.1.1.1"},
+		{"地址少于代理层数时取最左侧", 3, []string{"1.1.1.1, 10.0.0.2"}, "", "1.1.1.1"},
+		{"没有 X-Forwarded-For 时使用 X-Real-IP", 1, nil, "1.1.1.1", "1.1.1.1"},
+		{"没有代理头时使用连接地址", 1, nil, "", "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = "10.0.0.1:5678"
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if got := clientIP(r, tt.trustedProxies); got != tt.want {
+				t.Errorf("clientIP() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -36,8 +36,17 @@ func Error(w http.ResponseWriter, code int, msg string) {
 
 // ErrorWithAppError 使用AppError响应
 func ErrorWithAppError(w http.ResponseWriter, err *AppError, showDetail bool) {
+	writeAppError(w, http.StatusOK, err, showDetail)
+}
+
+// ErrorWithStatus 使用AppError响应并指定HTTP状态码（如限流时的429，便于网关和客户端识别）
+func ErrorWithStatus(w http.ResponseWriter, status int, err *AppError) {
+	writeAppError(w, status, err, false)
+}
+
+func writeAppError(w http.ResponseWriter, status int, err *AppError, showDetail bool) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(status)
 
 	msg := err.Message
 	// 开发环境显示详细错误信息
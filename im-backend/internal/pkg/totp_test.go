@@ -0,0 +1,59 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+)
+
+// RFC 6238 附录B的 SHA1 测试向量，密钥为 ASCII "12345678901234567890"
+// 附录给出的是8位验证码，6位验证码取其后6位
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},          // 94287082
+	{1111111109, "081804"},  // 07081804
+	{1111111111, "050471"},  // 14050471
+	{1234567890, "005924"},  // 89005924
+	{2000000000, "279037"},  // 69279037
+	{20000000000, "353130"}, // 65353130
+}
+
+var rfc6238Secret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	for _, v := range rfc6238Vectors {
+		if got := totpCode([]byte("12345678901234567890"), v.unix/TOTPPeriod); got != v.code {
+			t.Errorf("T=%d: 验证码 = %s, want %s", v.unix, got, v.code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	for _, v := range rfc6238Vectors {
+		now := time.Unix(v.unix, 0)
+		step, ok := ValidateTOTP(rfc6238Secret, v.code, now)
+		if !ok || step != v.unix/TOTPPeriod {
+			t.Errorf("T=%d: ValidateTOTP = (%d, %v), want (%d, true)", v.unix, step, ok, v.unix/TOTPPeriod)
+		}
+
+		// 允许前后各一个时间步的时钟误差，超出则拒绝
+		if _, ok := ValidateTOTP(rfc6238Secret, v.code, now.Add(TOTPPeriod*time.Second)); !ok {
+			t.Errorf("T=%d: 下一个时间步内应仍然有效", v.unix)
+		}
+		if _, ok := ValidateTOTP(rfc6238Secret, v.code, now.Add(2*TOTPPeriod*time.Second)); ok {
+			t.Errorf("T=%d: 两个时间步之后应失效", v.unix)
+		}
+	}
+
+	// 密钥大小写不敏感，位数不符或密钥无效时拒绝
+	if _, ok := ValidateTOTP("gezdgnbvgy3tqojqgezdgnbvgy3tqojq", "287082", time.Unix(59, 0)); !ok {
+		t.Error("小写密钥应能校验")
+	}
+	if _, ok := ValidateTOTP(rfc6238Secret, "94287082", time.Unix(59, 0)); ok {
+		t.Error("8位验证码应被拒绝")
+	}
+	if _, ok := ValidateTOTP("not-base32!", "287082", time.Unix(59, 0)); ok {
+		t.Error("无效密钥应被拒绝")
+	}
+}
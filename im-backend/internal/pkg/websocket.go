@@ -184,6 +184,37 @@ func (h *Hub) SendFriendAccepted(userID string, friend interface{}) error {
 	return nil
 }
 
+// SendMessagesExpired 发送消息过期通知（客户端需在本地清除对应消息）
+func (h *Hub) SendMessagesExpired(userID string, data interface{}) error {
+	return h.sendEvent(userID, "messages_expired", data)
+}
+
+// SendMomentNotification 发送朋友圈互动通知（点赞、评论、回复）
+func (h *Hub) SendMomentNotification(userID string, notification interface{}) error {
+	return h.sendEvent(userID, "moment_notification", notification)
+}
+
+// sendEvent 按事件类型推送消息给指定用户
+func (h *Hub) sendEvent(userID, eventType string, data interface{}) error {
+	wsMsg := WSMessage{
+		Type:      eventType,
+		Data:      data,
+		Timestamp: time.Now().Unix(),
+	}
+
+	payload, err := json.Marshal(wsMsg)
+	if err != nil {
+		return err
+	}
+
+	h.Broadcast <- &BroadcastMessage{
+		UserID:  userID,
+		Message: payload,
+	}
+
+	return nil
+}
+
 // IsUserOnline 检查用户是否在线
 func (h *Hub) IsUserOnline(userID string) bool {
 	h.mu.RLock()
@@ -192,6 +223,18 @@ func (h *Hub) IsUserOnline(userID string) bool {
 	return exists
 }
 
+// DisconnectUser 断开用户的WebSocket连接（账号注销时调用）
+func (h *Hub) DisconnectUser(userID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if client, exists := h.Clients[userID]; exists {
+		delete(h.Clients, userID)
+		client.closeClientSend()
+		client.Conn.Close()
+		log.Printf("❌ 用户 %s 的 WebSocket 已被服务端断开", userID)
+	}
+}
+
 // GetOnlineUsers 获取所有在线用户
 func (h *Hub) GetOnlineUsers() []string {
 	h.mu.RLock()
@@ -0,0 +1,282 @@
+package repository
+
+import (
+	"fmt"
+	"im-backend/internal/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// exportBatchSize 导出消息时每批读取的数量
+const exportBatchSize = 500
+
+// AccountRepository 个人数据导出和账号注销涉及的跨表操作
+type AccountRepository struct {
+	db *gorm.DB
+}
+
+func NewAccountRepository(db *gorm.DB) *AccountRepository {
+	return &AccountRepository{db: db}
+}
+
+// ==================== 数据导出任务 ====================
+
+// CreateExport 创建导出任务
+func (r *AccountRepository) CreateExport(export *model.DataExport) error {
+	return r.db.Create(export).Error
+}
+
+// FindExportByID 根据ID查询导出任务
+func (r *AccountRepository) FindExportByID(id uint) (*model.DataExport, error) {
+	var export model.DataExport
+	if err := r.db.First(&export, id).Error; err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// FindLatestExport 查询用户最近一次导出任务
+func (r *AccountRepository) FindLatestExport(userID string) (*model.DataExport, error) {
+	var export model.DataExport
+	if err := r.db.Where("user_id = ?", userID).
+		Order("id DESC").
+		First(&export).Error; err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// GetUserExports 查询用户的全部导出任务
+func (r *AccountRepository) GetUserExports(userID string) ([]model.DataExport, error) {
+	var exports []model.DataExport
+	err := r.db.Where("user_id = ?", userID).Find(&exports).Error
+	return exports, err
+}
+
+// exportClaimable 排队中，或生成中但租约已过期（处理的实例异常退出）的导出任务
+func exportClaimable(db *gorm.DB, leaseExpiredAt time.Time) *gorm.DB {
+	return db.Where("status = ? OR (status = ? AND (claimed_at IS NULL OR claimed_at <= ?))",
+		model.DataExportStatusPending, model.DataExportStatusProcessing, leaseExpiredAt)
+}
+
+// FindPendingExports 查询待生成的导出任务，包括租约过期的生成中任务
+func (r *AccountRepository) FindPendingExports(leaseExpiredAt time.Time, limit int) ([]model.DataExport, error) {
+	var exports []model.DataExport
+	err := exportClaimable(r.db, leaseExpiredAt).
+		Order("id ASC").
+		Limit(limit).
+		Find(&exports).Error
+	return exports, err
+}
+
+// ClaimExport 抢占一个待生成的导出任务（置为生成中并记录抢占时间），多实例部署时同一租约内只有一个实例生成
+func (r *AccountRepository) ClaimExport(id uint, now, leaseExpiredAt time.Time) (bool, error) {
+	result := exportClaimable(r.db.Model(&model.DataExport{}).Where("id = ?", id), leaseExpiredAt).
+		Updates(map[string]interface{}{
+			"status":     model.DataExportStatusProcessing,
+			"claimed_at": now,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// MarkExportReady 标记导出完成
+func (r *AccountRepository) MarkExportReady(id uint, fileName string, fileSize int64, expireAt time.Time) error {
+	return r.db.Model(&model.DataExport{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":    model.DataExportStatusReady,
+			"file_name": fileName,
+			"file_size": fileSize,
+			"expire_at": expireAt,
+		}).Error
+}
+
+// MarkExportFailed 标记导出失败
+func (r *AccountRepository) MarkExportFailed(id uint, reason string) error {
+	return r.db.Model(&model.DataExport{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status": model.DataExportStatusFailed,
+			"error":  reason,
+		}).Error
+}
+
+// FindExpiredExports 查询已过下载期限的导出任务
+func (r *AccountRepository) FindExpiredExports(now time.Time, limit int) ([]model.DataExport, error) {
+	var exports []model.DataExport
+	err := r.db.Where("status = ? AND expire_at <= ?", model.DataExportStatusReady, now).
+		Limit(limit).
+		Find(&exports).Error
+	return exports, err
+}
+
+// DeleteExports 删除导出任务记录
+func (r *AccountRepository) DeleteExports(ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.db.Where("id IN ?", ids).Delete(&model.DataExport{}).Error
+}
+
+// ==================== 导出数据查询 ====================
+
+// GetFriendRequests 获取用户发出和收到的全部好友请求
+func (r *AccountRepository) GetFriendRequests(userID string) ([]model.FriendRequest, error) {
+	var requests []model.FriendRequest
+	err := r.db.Where("from_user_id = ? OR to_user_id = ?", userID, userID).
+		Order("created_at ASC").
+		Find(&requests).Error
+	return requests, err
+}
+
+// EachSentMessage 分批遍历用户发送的私聊消息
+func (r *AccountRepository) EachSentMessage(userID string, fn func([]model.Message) error) error {
+	var batch []model.Message
+	return r.db.Where("from_user_id = ?", userID).
+		Order("id ASC").
+		FindInBatches(&batch, exportBatchSize, func(tx *gorm.DB, _ int) error {
+			return fn(batch)
+		}).Error
+}
+
+// EachSentGroupMessage 分批遍历用户发送的群消息
+func (r *AccountRepository) EachSentGroupMessage(userID string, fn func([]model.GroupMessage) error) error {
+	var batch []model.GroupMessage
+	return r.db.Where("from_user_id = ?", userID).
+		Order("id ASC").
+		FindInBatches(&batch, exportBatchSize, func(tx *gorm.DB, _ int) error {
+			return fn(batch)
+		}).Error
+}
+
+// GetMoments 获取用户发布的全部动态
+func (r *AccountRepository) GetMoments(userID string) ([]model.Moment, error) {
+	var moments []model.Moment
+	err := r.db.Where("user_id = ?", userID).
+		Order("id ASC").
+		Find(&moments).Error
+	return moments, err
+}
+
+// GetMomentLikes 获取用户的全部动态点赞
+func (r *AccountRepository) GetMomentLikes(userID string) ([]model.MomentLike, error) {
+	var likes []model.MomentLike
+	err := r.db.Where("user_id = ?", userID).
+		Order("id ASC").
+		Find(&likes).Error
+	return likes, err
+}
+
+// GetMomentComments 获取用户发表的全部评论（不含已删除的占位评论）
+func (r *AccountRepository) GetMomentComments(userID string) ([]model.MomentComment, error) {
+	var comments []model.MomentComment
+	err := r.db.Where("user_id = ? AND is_deleted = ?", userID, false).
+		Order("id ASC").
+		Find(&comments).Error
+	return comments, err
+}
+
+// GetLikedCommentIDs 获取用户点赞过的全部评论ID
+func (r *AccountRepository) GetLikedCommentIDs(userID string) ([]uint, error) {
+	var ids []uint
+	err := r.db.Model(&model.MomentCommentLike{}).
+		Where("user_id = ?", userID).
+		Pluck("comment_id", &ids).Error
+	return ids, err
+}
+
+// ==================== 账号注销 ====================
+
+// ScheduleDeletion 设置计划清除数据的时间，传 nil 表示撤销注销
+func (r *AccountRepository) ScheduleDeletion(userID string, at *time.Time) error {
+	return r.db.Model(&model.User{}).
+		Where("user_id = ? AND account_deleted_at IS NULL", userID).
+		Update("deletion_scheduled_at", at).Error
+}
+
+// deletionClaimable 冷静期已结束且未开始清除，或已开始清除但租约过期仍未完成（失败或处理的实例异常退出）的账号
+// 清除完成时 deletion_scheduled_at 置空，不再匹配
+func deletionClaimable(db *gorm.DB, now, leaseExpiredAt time.Time) *gorm.DB {
+	return db.Where("deletion_scheduled_at <= ? AND (account_deleted_at IS NULL OR deletion_claimed_at IS NULL OR deletion_claimed_at <= ?)",
+		now, leaseExpiredAt)
+}
+
+// FindDueDeletions 查询等待清除的账号，包括租约过期的未完成清除
+func (r *AccountRepository) FindDueDeletions(now, leaseExpiredAt time.Time, limit int) ([]model.User, error) {
+	var users []model.User
+	err := deletionClaimable(r.db, now, leaseExpiredAt).
+		Order("deletion_scheduled_at ASC").
+		Limit(limit).
+		Find(&users).Error
+	return users, err
+}
+
+// ClaimDeletion 抢占一个待清除的账号并标记为已注销（之后该账号不能再登录），记录抢占时间
+// 多实例部署时同一租约内只有一个实例清除，失败的清除在租约过期后重试
+func (r *AccountRepository) ClaimDeletion(userID string, now, leaseExpiredAt time.Time) (bool, error) {
+	result := deletionClaimable(r.db.Model(&model.User{}).Where("user_id = ?", userID), now, leaseExpiredAt).
+		Updates(map[string]interface{}{
+			"account_deleted_at":  gorm.Expr("COALESCE(account_deleted_at, ?)", now),
+			"deletion_claimed_at": now,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// PurgeUserData 删除用户的社交关系、登录凭据等个人数据
+// 好友、动态、点赞、评论和群成员需要同步计数和缓存，由各自的服务处理
+func (r *AccountRepository) PurgeUserData(userID string, now time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		deletes := []struct {
+			model interface{}
+			query string
+		}{
+			{&model.Friend{}, "user_id = ? OR friend_id = ?"},
+			{&model.FriendRequest{}, "from_user_id = ? OR to_user_id = ?"},
+			{&model.UserBlock{}, "user_id = ? OR blocked_user_id = ?"},
+			{&model.FriendTagMember{}, "user_id = ? OR friend_id = ?"},
+			{&model.MomentNotification{}, "user_id = ? OR actor_id = ?"},
+		}
+		for _, d := range deletes {
+			if err := tx.Where(d.query, userID, userID).Delete(d.model).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, m := range []interface{}{&model.FriendTag{}, &model.UserRecoveryCode{}, &model.UserIdentity{}, &model.LoginHistory{}, &model.UserPrivacy{}} {
+			if err := tx.Where("user_id = ?", userID).Delete(m).Error; err != nil {
+				return err
+			}
+		}
+
+		// 未发送的定时消息取消，邀请链接撤销
+		if err := tx.Model(&model.ScheduledMessage{}).
+			Where("user_id = ? AND status = ?", userID, model.ScheduledStatusPending).
+			Update("status", model.ScheduledStatusCancelled).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.InviteLink{}).
+			Where("creator_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", now).Error
+	})
+}
+
+// AnonymizeUser 匿名化用户资料，完成注销
+// 发送过的私聊和群消息（含内容和媒体）只与账号脱离而不删除也不改写发送者：
+// 消息同时属于对方或群成员的聊天记录，删除会破坏他们的会话；消息仍关联原用户ID，
+// 该ID对应的记录已清空邮箱、密码、昵称和头像，只显示为“已注销用户”，且保留记录使该ID不能再次注册，
+// 避免他人注册同一ID冒充原用户出现在历史会话中
+func (r *AccountRepository) AnonymizeUser(user *model.User) error {
+	return r.db.Model(&model.User{}).
+		Where("id = ?", user.ID).
+		Updates(map[string]interface{}{
+			"email":                 fmt.Sprintf("deleted_%d@deleted.invalid", user.ID),
+			"password":              "",
+			"nickname":              "已注销用户",
+			"avatar":                "",
+			"two_factor_enabled":    false,
+			"two_factor_secret":     "",
+			"deletion_scheduled_at": nil,
+			"deletion_claimed_at":   nil,
+		}).Error
+}
@@ -2,6 +2,8 @@ package repository
 
 import (
 	"im-backend/internal/model"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -45,7 +47,10 @@ func (r *FriendRepository) UpdateFriendRequestStatus(id uint, status int) error
 // GetReceivedRequests 获取收到的好友请求列表
 func (r *FriendRepository) GetReceivedRequests(userID string, status int) ([]model.FriendRequest, error) {
 	var requests []model.FriendRequest
-	query := r.db.Where("to_user_id = ?", userID).Preload("FromUser")
+	// 被自己拉黑的用户发来的请求不展示
+	query := r.db.Where("to_user_id = ?", userID).
+		Where("from_user_id NOT IN (?)", r.db.Model(&model.UserBlock{}).Select("blocked_user_id").Where("user_id = ?", userID)).
+		Preload("FromUser")
 	if status >= 0 {
 		query = query.Where("status = ?", status)
 	}
@@ -99,6 +104,31 @@ func (r *FriendRepository) GetFriendList(userID string) ([]model.Friend, error)
 	return friends, nil
 }
 
+// GetFriendListByTag 获取某个标签下的好友列表
+func (r *FriendRepository) GetFriendListByTag(userID string, tagID uint) ([]model.Friend, error) {
+	var friends []model.Friend
+	if err := r.db.Where("user_id = ?", userID).
+		Where("friend_id IN (?)", r.db.Model(&model.FriendTagMember{}).Select("friend_id").Where("tag_id = ? AND user_id = ?", tagID, userID)).
+		Preload("FriendUser").
+		Order("created_at DESC").
+		Find(&friends).Error; err != nil {
+		return nil, err
+	}
+	return friends, nil
+}
+
+// FilterFriendIDs 从给定用户ID中筛选出是当前用户好友的ID
+func (r *FriendRepository) FilterFriendIDs(userID string, ids []string) ([]string, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var friendIDs []string
+	err := r.db.Model(&model.Friend{}).
+		Where("user_id = ? AND friend_id IN ?", userID, ids).
+		Pluck("friend_id", &friendIDs).Error
+	return friendIDs, err
+}
+
 // UpdateFriendRemark 更新好友备注
 func (r *FriendRepository) UpdateFriendRemark(userID, friendID, remark string) error {
 	return r.db.Model(&model.Friend{}).
@@ -116,3 +146,208 @@ func (r *FriendRepository) IsFriend(userID, friendID string) (bool, error) {
 	}
 	return count > 0, nil
 }
+
+// CreateBlock 拉黑用户
+func (r *FriendRepository) CreateBlock(block *model.UserBlock) error {
+	return r.db.Create(block).Error
+}
+
+// DeleteBlock 取消拉黑
+func (r *FriendRepository) DeleteBlock(userID, blockedUserID string) error {
+	return r.db.Where("user_id = ? AND blocked_user_id = ?", userID, blockedUserID).
+		Delete(&model.UserBlock{}).Error
+}
+
+// IsBlocked 判断 userID 是否拉黑了 targetID
+func (r *FriendRepository) IsBlocked(userID, targetID string) (bool, error) {
+	var count int64
+	if err := r.db.Model(&model.UserBlock{}).
+		Where("user_id = ? AND blocked_user_id = ?", userID, targetID).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// GetBlockList 获取黑名单列表
+func (r *FriendRepository) GetBlockList(userID string) ([]model.UserBlock, error) {
+	var blocks []model.UserBlock
+	if err := r.db.Where("user_id = ?", userID).
+		Preload("BlockedUser").
+		Order("created_at DESC").
+		Find(&blocks).Error; err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+// GetBlockRelatedUserIDs 获取与用户存在拉黑关系的用户ID（包括拉黑对方和被对方拉黑）
+func (r *FriendRepository) GetBlockRelatedUserIDs(userID string) ([]string, error) {
+	var blockedIDs []string
+	if err := r.db.Model(&model.UserBlock{}).
+		Where("user_id = ?", userID).
+		Pluck("blocked_user_id", &blockedIDs).Error; err != nil {
+		return nil, err
+	}
+
+	var blockerIDs []string
+	if err := r.db.Model(&model.UserBlock{}).
+		Where("blocked_user_id = ?", userID).
+		Pluck("user_id", &blockerIDs).Error; err != nil {
+		return nil, err
+	}
+
+	return append(blockedIDs, blockerIDs...), nil
+}
+
+// GetFriendIDs 获取用户全部好友的ID
+func (r *FriendRepository) GetFriendIDs(userID string) ([]string, error) {
+	var friendIDs []string
+	err := r.db.Model(&model.Friend{}).
+		Where("user_id = ?", userID).
+		Pluck("friend_id", &friendIDs).Error
+	return friendIDs, err
+}
+
+// recommendExcludedCondition 候选人 {c} 不应推荐给用户 @user 的情况：已是好友、任一方拉黑、存在待处理的好友请求
+const recommendExcludedCondition = `NOT EXISTS (
+		SELECT 1 FROM friends f WHERE f.user_id = @user AND f.friend_id = {c} AND f.deleted_at IS NULL
+	) AND NOT EXISTS (
+		SELECT 1 FROM user_blocks ub
+		WHERE (ub.user_id = @user AND ub.blocked_user_id = {c}) OR (ub.user_id = {c} AND ub.blocked_user_id = @user)
+	) AND NOT EXISTS (
+		SELECT 1 FROM friend_requests fr
+		WHERE fr.status = 0 AND fr.deleted_at IS NULL
+		  AND ((fr.from_user_id = @user AND fr.to_user_id = {c}) OR (fr.from_user_id = {c} AND fr.to_user_id = @user))
+	)`
+
+// recommendableTo 推荐候选人的排除条件，candidate 为候选人ID列
+// 需要在排序和截断之前排除，否则候选名额会被好友等不推荐的用户占满
+func recommendableTo(userID, candidate string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(strings.ReplaceAll(recommendExcludedCondition, "{c}", candidate), map[string]interface{}{
+			"user": userID,
+		})
+	}
+}
+
+// GetMutualFriendCounts 统计好友的好友（二度好友）与当前用户的共同好友数，已排除不应推荐的用户
+func (r *FriendRepository) GetMutualFriendCounts(userID string, limit int) (map[string]int, error) {
+	var rows []struct {
+		UserID string
+		Count  int
+	}
+	err := r.db.Table("friends AS f1").
+		Select("f2.friend_id AS user_id, COUNT(*) AS count").
+		Joins("JOIN friends AS f2 ON f2.user_id = f1.friend_id AND f2.deleted_at IS NULL").
+		Where("f1.user_id = ? AND f1.deleted_at IS NULL AND f2.friend_id <> ?", userID, userID).
+		Scopes(recommendableTo(userID, "f2.friend_id")).
+		Group("f2.friend_id").
+		Order("count DESC").
+		Limit(limit).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[row.UserID] = row.Count
+	}
+	return counts, nil
+}
+
+// ==================== 好友标签 相关方法 ====================
+
+// CreateTag 创建标签
+func (r *FriendRepository) CreateTag(tag *model.FriendTag) error {
+	return r.db.Create(tag).Error
+}
+
+// FindTagByID 根据ID查询标签
+func (r *FriendRepository) FindTagByID(id uint) (*model.FriendTag, error) {
+	var tag model.FriendTag
+	if err := r.db.Preload("Members.FriendUser").First(&tag, id).Error; err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+// FindTagByName 根据名称查询用户的标签
+func (r *FriendRepository) FindTagByName(userID, name string) (*model.FriendTag, error) {
+	var tag model.FriendTag
+	if err := r.db.Where("user_id = ? AND name = ?", userID, name).First(&tag).Error; err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+// GetTags 获取用户的全部标签（包含成员）
+func (r *FriendRepository) GetTags(userID string) ([]model.FriendTag, error) {
+	var tags []model.FriendTag
+	if err := r.db.Where("user_id = ?", userID).
+		Preload("Members.FriendUser").
+		Order("created_at ASC").
+		Find(&tags).Error; err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// UpdateTagName 修改标签名称
+func (r *FriendRepository) UpdateTagName(id uint, name string) error {
+	return r.db.Model(&model.FriendTag{}).Where("id = ?", id).Update("name", name).Error
+}
+
+// DeleteTag 删除标签及其成员
+func (r *FriendRepository) DeleteTag(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("tag_id = ?", id).Delete(&model.FriendTagMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&model.FriendTag{}, id).Error
+	})
+}
+
+// SetTagMembers 覆盖设置标签成员
+func (r *FriendRepository) SetTagMembers(tagID uint, userID string, friendIDs []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("tag_id = ?", tagID).Delete(&model.FriendTagMember{}).Error; err != nil {
+			return err
+		}
+		if len(friendIDs) == 0 {
+			return nil
+		}
+
+		now := time.Now()
+		members := make([]model.FriendTagMember, 0, len(friendIDs))
+		for _, friendID := range friendIDs {
+			members = append(members, model.FriendTagMember{
+				TagID:     tagID,
+				UserID:    userID,
+				FriendID:  friendID,
+				CreatedAt: now,
+			})
+		}
+		return tx.CreateInBatches(members, 100).Error
+	})
+}
+
+// GetTagFriendIDs 获取用户若干标签下的好友ID（去重）
+func (r *FriendRepository) GetTagFriendIDs(userID string, tagIDs []uint) ([]string, error) {
+	if len(tagIDs) == 0 {
+		return nil, nil
+	}
+	var friendIDs []string
+	err := r.db.Model(&model.FriendTagMember{}).
+		Distinct("friend_id").
+		Where("user_id = ? AND tag_id IN ?", userID, tagIDs).
+		Pluck("friend_id", &friendIDs).Error
+	return friendIDs, err
+}
+
+// RemoveFriendFromTags 将好友从用户的所有标签中移除
+func (r *FriendRepository) RemoveFriendFromTags(userID, friendID string) error {
+	return r.db.Where("user_id = ? AND friend_id = ?", userID, friendID).
+		Delete(&model.FriendTagMember{}).Error
+}
@@ -77,6 +77,15 @@ func (r *GroupRepository) GetUserGroups(userID string, page, pageSize int) ([]mo
 	return groups, err
 }
 
+// GetUserGroupIDs 获取用户加入的全部群组ID
+func (r *GroupRepository) GetUserGroupIDs(userID string) ([]string, error) {
+	var groupIDs []string
+	err := r.db.Model(&model.GroupMember{}).
+		Where("user_id = ?", userID).
+		Pluck("group_id", &groupIDs).Error
+	return groupIDs, err
+}
+
 // SearchGroups 搜索公开群组
 func (r *GroupRepository) SearchGroups(keyword string, page, pageSize int) ([]model.Group, error) {
 	var groups []model.Group
@@ -150,6 +159,39 @@ func (r *GroupRepository) RemoveGroupMember(groupID, userID string) error {
 		Delete(&model.GroupMember{}).Error
 }
 
+// FindOwnerSuccessor 查找群主的继任者：最早加入的管理员，没有管理员时为最早加入的成员
+// 群内没有其他成员时返回 nil
+func (r *GroupRepository) FindOwnerSuccessor(groupID, ownerID string) (*model.GroupMember, error) {
+	var members []model.GroupMember
+	err := r.db.Where("group_id = ? AND user_id <> ?", groupID, ownerID).
+		Order("role DESC, joined_at ASC").
+		Limit(1).
+		Find(&members).Error
+	if err != nil || len(members) == 0 {
+		return nil, err
+	}
+	return &members[0], nil
+}
+
+// TransferOwner 转让群主：原群主降为普通成员，新群主角色和群组的 owner_id 同时更新
+func (r *GroupRepository) TransferOwner(groupID, fromUserID, toUserID string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.GroupMember{}).
+			Where("group_id = ? AND user_id = ?", groupID, fromUserID).
+			Update("role", model.GroupRoleMember).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.GroupMember{}).
+			Where("group_id = ? AND user_id = ?", groupID, toUserID).
+			Update("role", model.GroupRoleOwner).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.Group{}).
+			Where("group_id = ?", groupID).
+			Update("owner_id", toUserID).Error
+	})
+}
+
 // IsGroupMember 检查用户是否为群成员
 func (r *GroupRepository) IsGroupMember(groupID, userID string) (bool, error) {
 	var count int64
@@ -333,3 +375,82 @@ func (r *GroupRepository) BatchMarkGroupMessagesAsRead(groupID, userID string, b
 
 	return r.db.CreateInBatches(reads, 100).Error
 }
+
+// ==================== 阅后即焚 相关方法 ====================
+
+// StartGroupReadExpiry 为用户刚读到的、已读后计时的群消息设置过期时间
+func (r *GroupRepository) StartGroupReadExpiry(groupID, userID string, readAt time.Time) error {
+	return r.db.Model(&model.GroupMessage{}).
+		Where("group_id = ? AND from_user_id != ? AND created_at <= ? AND ttl > 0 AND expire_at IS NULL", groupID, userID, readAt).
+		UpdateColumn("expire_at", gorm.Expr("CAST(? AS timestamptz) + ttl * INTERVAL '1 second'", readAt)).Error
+}
+
+// FindExpiredGroupMessages 查询已过期的群消息（包含已被软删除的消息）
+func (r *GroupRepository) FindExpiredGroupMessages(now time.Time, limit int) ([]model.GroupMessage, error) {
+	var messages []model.GroupMessage
+	err := r.db.Unscoped().
+		Where("expire_at IS NOT NULL AND expire_at <= ?", now).
+		Order("expire_at ASC").
+		Limit(limit).
+		Find(&messages).Error
+	return messages, err
+}
+
+// HardDeleteGroupMessages 物理删除群消息及其已读记录
+func (r *GroupRepository) HardDeleteGroupMessages(messageIDs []uint) error {
+	if len(messageIDs) == 0 {
+		return nil
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("message_id IN ?", messageIDs).Delete(&model.GroupMessageRead{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("id IN ?", messageIDs).Delete(&model.GroupMessage{}).Error
+	})
+}
+
+// GetGroupMemberIDs 获取群组全部成员的用户ID
+func (r *GroupRepository) GetGroupMemberIDs(groupID string) ([]string, error) {
+	var userIDs []string
+	err := r.db.Model(&model.GroupMember{}).
+		Where("group_id = ?", groupID).
+		Pluck("user_id", &userIDs).Error
+	return userIDs, err
+}
+
+// HasSharedGroup 两个用户是否同在至少一个群
+func (r *GroupRepository) HasSharedGroup(userID, otherID string) (bool, error) {
+	var count int64
+	err := r.db.Table("group_members AS gm1").
+		Joins("JOIN group_members AS gm2 ON gm2.group_id = gm1.group_id AND gm2.deleted_at IS NULL").
+		Where("gm1.user_id = ? AND gm1.deleted_at IS NULL AND gm2.user_id = ?", userID, otherID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// GetSharedGroupCounts 统计与用户同在一个群的其他用户及共同群组数，已排除不应推荐的用户
+func (r *GroupRepository) GetSharedGroupCounts(userID string, limit int) (map[string]int, error) {
+	var rows []struct {
+		UserID string
+		Count  int
+	}
+	err := r.db.Table("group_members AS gm1").
+		Select("gm2.user_id AS user_id, COUNT(*) AS count").
+		Joins("JOIN group_members AS gm2 ON gm2.group_id = gm1.group_id AND gm2.deleted_at IS NULL").
+		Where("gm1.user_id = ? AND gm1.deleted_at IS NULL AND gm2.user_id <> ?", userID, userID).
+		Scopes(recommendableTo(userID, "gm2.user_id")).
+		Group("gm2.user_id").
+		Order("count DESC").
+		Limit(limit).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[row.UserID] = row.Count
+	}
+	return counts, nil
+}
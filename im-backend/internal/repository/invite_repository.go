@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"im-backend/internal/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type InviteRepository struct {
+	db *gorm.DB
+}
+
+func NewInviteRepository(db *gorm.DB) *InviteRepository {
+	return &InviteRepository{db: db}
+}
+
+// Create 创建邀请链接
+func (r *InviteRepository) Create(invite *model.InviteLink) error {
+	return r.db.Create(invite).Error
+}
+
+// FindByID 根据ID查询邀请链接
+func (r *InviteRepository) FindByID(id uint) (*model.InviteLink, error) {
+	var invite model.InviteLink
+	if err := r.db.First(&invite, id).Error; err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+// FindByToken 根据令牌查询邀请链接（包含创建者和群组信息）
+func (r *InviteRepository) FindByToken(token string) (*model.InviteLink, error) {
+	var invite model.InviteLink
+	if err := r.db.Where("token = ?", token).
+		Preload("Creator").
+		Preload("Group").
+		First(&invite).Error; err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+// GetUserInvites 获取用户创建的未撤销邀请链接
+func (r *InviteRepository) GetUserInvites(userID string) ([]model.InviteLink, error) {
+	var invites []model.InviteLink
+	if err := r.db.Where("creator_id = ? AND revoked_at IS NULL", userID).
+		Preload("Group").
+		Order("created_at DESC").
+		Find(&invites).Error; err != nil {
+		return nil, err
+	}
+	return invites, nil
+}
+
+// GetGroupInvites 获取群组的全部未撤销邀请链接
+func (r *InviteRepository) GetGroupInvites(groupID string) ([]model.InviteLink, error) {
+	var invites []model.InviteLink
+	if err := r.db.Where("group_id = ? AND type = ? AND revoked_at IS NULL", groupID, model.InviteTypeGroup).
+		Preload("Creator").
+		Order("created_at DESC").
+		Find(&invites).Error; err != nil {
+		return nil, err
+	}
+	return invites, nil
+}
+
+// Revoke 撤销邀请链接
+func (r *InviteRepository) Revoke(id uint, revokedAt time.Time) error {
+	return r.db.Model(&model.InviteLink{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", revokedAt).Error
+}
+
+// ClaimUse 原子地占用一次使用次数，邀请已撤销、过期或次数用尽时返回false
+func (r *InviteRepository) ClaimUse(id uint, now time.Time) (bool, error) {
+	result := r.db.Model(&model.InviteLink{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Where("expire_at IS NULL OR expire_at > ?", now).
+		Where("max_uses = 0 OR used_count < max_uses").
+		Update("used_count", gorm.Expr("used_count + 1"))
+	return result.RowsAffected > 0, result.Error
+}
+
+// ReleaseUse 兑换失败时归还占用的使用次数
+func (r *InviteRepository) ReleaseUse(id uint) error {
+	return r.db.Model(&model.InviteLink{}).
+		Where("id = ? AND used_count > 0", id).
+		Update("used_count", gorm.Expr("used_count - 1")).Error
+}
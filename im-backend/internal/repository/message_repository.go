@@ -123,6 +123,16 @@ func (r *MessageRepository) ClearUnreadCount(conversationID uint, userID string)
 	}
 }
 
+// UpdateConversationTTL 更新会话的消息存活时间设置
+func (r *MessageRepository) UpdateConversationTTL(conversationID uint, ttl, mode int) error {
+	return r.db.Model(&model.Conversation{}).
+		Where("id = ?", conversationID).
+		Updates(map[string]interface{}{
+			"message_ttl":      ttl,
+			"message_ttl_mode": mode,
+		}).Error
+}
+
 // ==================== Message 相关方法 ====================
 
 // CreateMessage 创建消息
@@ -139,12 +149,20 @@ func (r *MessageRepository) GetMessageByID(id uint) (*model.Message, error) {
 	return &message, nil
 }
 
-// GetConversationMessages 获取会话的消息列表（分页）
-func (r *MessageRepository) GetConversationMessages(conversationID uint, page, pageSize int) ([]model.Message, error) {
+// visibleToUser 排除被接收方拉黑时发送、只对发送方可见的消息
+func visibleToUser(userID string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("hidden_from_receiver = ? OR from_user_id = ?", false, userID)
+	}
+}
+
+// GetConversationMessages 获取会话中用户可见的消息列表（分页）
+func (r *MessageRepository) GetConversationMessages(conversationID uint, userID string, page, pageSize int) ([]model.Message, error) {
 	var messages []model.Message
 	offset := (page - 1) * pageSize
 
 	err := r.db.Where("conversation_id = ?", conversationID).
+		Scopes(visibleToUser(userID)).
 		Preload("FromUser").
 		Preload("ToUser").
 		Order("created_at ASC").
@@ -155,11 +173,12 @@ func (r *MessageRepository) GetConversationMessages(conversationID uint, page, p
 	return messages, err
 }
 
-// GetLatestMessages 获取会话的最新N条消息
-func (r *MessageRepository) GetLatestMessages(conversationID uint, limit int) ([]model.Message, error) {
+// GetLatestMessages 获取会话中用户可见的最新N条消息
+func (r *MessageRepository) GetLatestMessages(conversationID uint, userID string, limit int) ([]model.Message, error) {
 	var messages []model.Message
 
 	err := r.db.Where("conversation_id = ?", conversationID).
+		Scopes(visibleToUser(userID)).
 		Preload("FromUser").
 		Preload("ToUser").
 		Order("created_at DESC").
@@ -189,7 +208,7 @@ func (r *MessageRepository) MarkMessageAsRead(messageID uint) error {
 func (r *MessageRepository) MarkConversationMessagesAsRead(conversationID uint, userID string) error {
 	now := time.Now()
 	return r.db.Model(&model.Message{}).
-		Where("conversation_id = ? AND to_user_id = ? AND is_read = ?", conversationID, userID, false).
+		Where("conversation_id = ? AND to_user_id = ? AND is_read = ? AND hidden_from_receiver = ?", conversationID, userID, false, false).
 		Updates(map[string]interface{}{
 			"is_read": true,
 			"read_at": now,
@@ -216,7 +235,7 @@ func (r *MessageRepository) DeleteMessage(messageID uint) error {
 func (r *MessageRepository) GetUnreadMessageCount(userID string) (int64, error) {
 	var count int64
 	err := r.db.Model(&model.Message{}).
-		Where("to_user_id = ? AND is_read = ?", userID, false).
+		Where("to_user_id = ? AND is_read = ? AND hidden_from_receiver = ?", userID, false, false).
 		Count(&count).Error
 	return count, err
 }
@@ -225,7 +244,71 @@ func (r *MessageRepository) GetUnreadMessageCount(userID string) (int64, error)
 func (r *MessageRepository) GetConversationUnreadCount(conversationID uint, userID string) (int64, error) {
 	var count int64
 	err := r.db.Model(&model.Message{}).
-		Where("conversation_id = ? AND to_user_id = ? AND is_read = ?", conversationID, userID, false).
+		Where("conversation_id = ? AND to_user_id = ? AND is_read = ? AND hidden_from_receiver = ?", conversationID, userID, false, false).
 		Count(&count).Error
 	return count, err
 }
+
+// ==================== 阅后即焚 相关方法 ====================
+
+// StartReadExpiry 为用户刚读到的、已读后计时的消息设置过期时间
+func (r *MessageRepository) StartReadExpiry(conversationID uint, userID string, readAt time.Time) error {
+	return r.db.Model(&model.Message{}).
+		Where("conversation_id = ? AND to_user_id = ? AND ttl > 0 AND expire_at IS NULL AND hidden_from_receiver = ?", conversationID, userID, false).
+		UpdateColumn("expire_at", gorm.Expr("CAST(? AS timestamptz) + ttl * INTERVAL '1 second'", readAt)).Error
+}
+
+// StartMessageReadExpiry 为单条已读后计时的消息设置过期时间
+func (r *MessageRepository) StartMessageReadExpiry(messageID uint, readAt time.Time) error {
+	return r.db.Model(&model.Message{}).
+		Where("id = ? AND ttl > 0 AND expire_at IS NULL", messageID).
+		UpdateColumn("expire_at", gorm.Expr("CAST(? AS timestamptz) + ttl * INTERVAL '1 second'", readAt)).Error
+}
+
+// FindExpiredMessages 查询已过期的消息（包含已被软删除的消息）
+func (r *MessageRepository) FindExpiredMessages(now time.Time, limit int) ([]model.Message, error) {
+	var messages []model.Message
+	err := r.db.Unscoped().
+		Where("expire_at IS NOT NULL AND expire_at <= ?", now).
+		Order("expire_at ASC").
+		Limit(limit).
+		Find(&messages).Error
+	return messages, err
+}
+
+// HardDeleteMessages 物理删除消息，并清理会话中对这些消息的引用
+func (r *MessageRepository) HardDeleteMessages(messageIDs []uint) error {
+	if len(messageIDs) == 0 {
+		return nil
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.Conversation{}).
+			Where("last_message_id IN ?", messageIDs).
+			Update("last_message_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("id IN ?", messageIDs).Delete(&model.Message{}).Error
+	})
+}
+
+// IsMediaReferenced 媒体文件是否仍被消息、定时消息、头像或动态图片引用
+func (r *MessageRepository) IsMediaReferenced(mediaURL string) (bool, error) {
+	checks := []*gorm.DB{
+		r.db.Model(&model.Message{}).Where("media_url = ?", mediaURL),
+		r.db.Model(&model.GroupMessage{}).Where("media_url = ?", mediaURL),
+		r.db.Model(&model.ScheduledMessage{}).Where("media_url = ? AND status IN ?", mediaURL, []int{model.ScheduledStatusPending, model.ScheduledStatusSending}),
+		r.db.Model(&model.User{}).Where("avatar = ?", mediaURL),
+		r.db.Model(&model.Moment{}).Where("images LIKE ?", "%\""+mediaURL+"\"%"),
+	}
+	for _, query := range checks {
+		var count int64
+		if err := query.Limit(1).Count(&count).Error; err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
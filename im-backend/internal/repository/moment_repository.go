@@ -2,6 +2,8 @@ package repository
 
 import (
 	"im-backend/internal/model"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -19,13 +21,122 @@ func (r *MomentRepository) CreateMoment(moment *model.Moment) error {
 	return r.db.Create(moment).Error
 }
 
+// CreateMomentWithAudience 创建动态及其受众名单
+func (r *MomentRepository) CreateMomentWithAudience(moment *model.Moment, audienceUserIDs []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(moment).Error; err != nil {
+			return err
+		}
+		if len(audienceUserIDs) == 0 {
+			return nil
+		}
+
+		audience := make([]model.MomentAudience, 0, len(audienceUserIDs))
+		for _, userID := range audienceUserIDs {
+			audience = append(audience, model.MomentAudience{
+				MomentID:  moment.ID,
+				UserID:    userID,
+				CreatedAt: moment.CreatedAt,
+			})
+		}
+		return tx.CreateInBatches(audience, 100).Error
+	})
+}
+
+// GetAudienceUserIDs 获取动态的受众名单
+func (r *MomentRepository) GetAudienceUserIDs(momentID uint) ([]string, error) {
+	var userIDs []string
+	err := r.db.Model(&model.MomentAudience{}).
+		Where("moment_id = ?", momentID).
+		Pluck("user_id", &userIDs).Error
+	return userIDs, err
+}
+
+// momentVisibleCondition 单条动态对查看者 @viewer 可见的条件，{m} 为动态表的别名
+//   - 发布者本人始终可见
+//   - 双方存在拉黑关系（任一方向）时不可见
+//   - 0-所有人可见；1-好友可见；2-私密；3-仅名单内的好友可见；4-名单内的好友不可见
+//   - 发布者在隐私设置中关闭“公开动态对非好友可见”时，所有人可见的动态也只对好友可见
+const momentVisibleCondition = `({m}.user_id = @viewer OR (
+	NOT EXISTS (
+		SELECT 1 FROM user_blocks ub
+		WHERE (ub.user_id = {m}.user_id AND ub.blocked_user_id = @viewer)
+		   OR (ub.user_id = @viewer AND ub.blocked_user_id = {m}.user_id)
+	)
+	AND (
+		(
+			{m}.visible = @all
+			AND (
+				NOT EXISTS (
+					SELECT 1 FROM user_privacies up
+					WHERE up.user_id = {m}.user_id AND up.stranger_moments = FALSE
+				)
+				OR EXISTS (
+					SELECT 1 FROM friends f
+					WHERE f.user_id = {m}.user_id AND f.friend_id = @viewer AND f.deleted_at IS NULL
+				)
+			)
+		)
+		OR (
+			{m}.visible IN @friendScopes
+			AND EXISTS (
+				SELECT 1 FROM friends f
+				WHERE f.user_id = {m}.user_id AND f.friend_id = @viewer AND f.deleted_at IS NULL
+			)
+			AND ({m}.visible <> @include OR EXISTS (
+				SELECT 1 FROM moment_audiences ma WHERE ma.moment_id = {m}.id AND ma.user_id = @viewer
+			))
+			AND ({m}.visible <> @exclude OR NOT EXISTS (
+				SELECT 1 FROM moment_audiences ma WHERE ma.moment_id = {m}.id AND ma.user_id = @viewer
+			))
+		)
+	)
+))`
+
+// momentVisibleSQL 动态本身可见，且转发的原动态未删除并同样对查看者可见
+// 这样好友可见的原动态不会通过转发泄露给转发者的其他好友
+var momentVisibleSQL = strings.ReplaceAll(momentVisibleCondition, "{m}", "moments") + `
+AND (moments.repost_of_id IS NULL OR EXISTS (
+	SELECT 1 FROM moments orig
+	WHERE orig.id = moments.repost_of_id AND orig.deleted_at IS NULL
+	AND ` + strings.ReplaceAll(momentVisibleCondition, "{m}", "orig") + `
+))`
+
+// momentVisibleTo 动态可见性策略，所有按查看者过滤动态的查询都通过该条件
+//
+// viewer 为查看者用户ID，也可以是 gorm.Expr 列表达式（用于批量计算某条动态的可见用户）
+func momentVisibleTo(viewer interface{}) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("("+momentVisibleSQL+")", map[string]interface{}{
+			"viewer":       viewer,
+			"all":          model.MomentVisibleAll,
+			"friendScopes": []int{model.MomentVisibleFriends, model.MomentVisibleInclude, model.MomentVisibleExclude},
+			"include":      model.MomentVisibleInclude,
+			"exclude":      model.MomentVisibleExclude,
+		})
+	}
+}
+
+// IsMomentVisible 判断动态对查看者是否可见
+func (r *MomentRepository) IsMomentVisible(momentID uint, viewerID string) (bool, error) {
+	var count int64
+	err := r.db.Model(&model.Moment{}).
+		Where("moments.id = ?", momentID).
+		Scopes(momentVisibleTo(viewerID)).
+		Count(&count).Error
+	return count > 0, err
+}
+
 // FindMomentByID 根据ID查询动态
 func (r *MomentRepository) FindMomentByID(id uint) (*model.Moment, error) {
 	var moment model.Moment
 	if err := r.db.Preload("User").
+		Preload("RepostOf.User").
 		Preload("Likes.User").
 		Preload("Comments.User").
 		Preload("Comments.ReplyTo").
+		Preload("Hashtags").
+		Preload("Mentions").
 		First(&moment, id).Error; err != nil {
 		return nil, err
 	}
@@ -33,12 +144,17 @@ func (r *MomentRepository) FindMomentByID(id uint) (*model.Moment, error) {
 }
 
 // GetMomentList 获取朋友圈动态列表（支持分页）
+// 列表本身不按可见性过滤，转发的原动态对发布者不再可见时（被移出受众或解除好友）不返回原动态
 func (r *MomentRepository) GetMomentList(userID string, offset, limit int) ([]model.Moment, error) {
 	var moments []model.Moment
 	if err := r.db.Where("user_id = ?", userID).
 		Preload("User").
+		Preload("RepostOf", momentVisibleTo(userID)).
+		Preload("RepostOf.User").
 		Preload("Likes.User").
 		Preload("Comments.User").
+		Preload("Hashtags").
+		Preload("Mentions").
 		Order("created_at DESC").
 		Offset(offset).
 		Limit(limit).
@@ -48,13 +164,17 @@ func (r *MomentRepository) GetMomentList(userID string, offset, limit int) ([]mo
 	return moments, nil
 }
 
-// GetFriendMomentList 获取好友的朋友圈动态列表
-func (r *MomentRepository) GetFriendMomentList(friendIDs []string, offset, limit int) ([]model.Moment, error) {
+// GetFriendMomentList 获取好友的朋友圈动态列表（按查看者的可见性过滤）
+func (r *MomentRepository) GetFriendMomentList(friendIDs []string, viewerID string, offset, limit int) ([]model.Moment, error) {
 	var moments []model.Moment
-	if err := r.db.Where("user_id IN ? AND (visible = 0 OR visible = 1)", friendIDs).
+	if err := r.db.Where("moments.user_id IN ?", friendIDs).
+		Scopes(momentVisibleTo(viewerID)).
 		Preload("User").
+		Preload("RepostOf.User").
 		Preload("Likes.User").
 		Preload("Comments.User").
+		Preload("Hashtags").
+		Preload("Mentions").
 		Order("created_at DESC").
 		Offset(offset).
 		Limit(limit).
@@ -64,14 +184,212 @@ func (r *MomentRepository) GetFriendMomentList(friendIDs []string, offset, limit
 	return moments, nil
 }
 
+// GetTimelineMoments 按游标获取时间线动态（ID小于 beforeID，beforeID 为0时从最新开始）
+func (r *MomentRepository) GetTimelineMoments(authorIDs []string, viewerID string, beforeID uint, limit int) ([]model.Moment, error) {
+	query := r.db.Where("moments.user_id IN ?", authorIDs)
+	if beforeID > 0 {
+		query = query.Where("moments.id < ?", beforeID)
+	}
+
+	var moments []model.Moment
+	if err := query.Scopes(momentVisibleTo(viewerID)).
+		Preload("User").
+		Preload("RepostOf.User").
+		Preload("Likes.User").
+		Preload("Comments.User").
+		Preload("Hashtags").
+		Preload("Mentions").
+		Order("moments.id DESC").
+		Limit(limit).
+		Find(&moments).Error; err != nil {
+		return nil, err
+	}
+	return moments, nil
+}
+
+// GetTimelineMomentIDs 获取时间线中最新的动态ID（用于重建缓存）
+func (r *MomentRepository) GetTimelineMomentIDs(authorIDs []string, viewerID string, limit int) ([]uint, error) {
+	var ids []uint
+	err := r.db.Model(&model.Moment{}).
+		Where("moments.user_id IN ?", authorIDs).
+		Scopes(momentVisibleTo(viewerID)).
+		Order("moments.id DESC").
+		Limit(limit).
+		Pluck("moments.id", &ids).Error
+	return ids, err
+}
+
+// FindVisibleMomentsByIDs 按ID批量查询对查看者可见的动态（按ID倒序）
+func (r *MomentRepository) FindVisibleMomentsByIDs(ids []uint, viewerID string) ([]model.Moment, error) {
+	var moments []model.Moment
+	if len(ids) == 0 {
+		return moments, nil
+	}
+	if err := r.db.Where("moments.id IN ?", ids).
+		Scopes(momentVisibleTo(viewerID)).
+		Preload("User").
+		Preload("RepostOf.User").
+		Preload("Likes.User").
+		Preload("Comments.User").
+		Preload("Hashtags").
+		Preload("Mentions").
+		Order("moments.id DESC").
+		Find(&moments).Error; err != nil {
+		return nil, err
+	}
+	return moments, nil
+}
+
+// GetMomentViewerIDs 获取能在时间线中看到某条动态的好友ID（不含作者本人）
+func (r *MomentRepository) GetMomentViewerIDs(momentID uint) ([]string, error) {
+	var viewerIDs []string
+	err := r.db.Table("friends AS fr").
+		Joins("JOIN moments ON moments.id = ? AND moments.deleted_at IS NULL", momentID).
+		Where("fr.user_id = moments.user_id AND fr.deleted_at IS NULL").
+		Scopes(momentVisibleTo(gorm.Expr("fr.friend_id"))).
+		Pluck("fr.friend_id", &viewerIDs).Error
+	return viewerIDs, err
+}
+
+// GetMomentIDsByUser 获取用户发布的全部动态ID
+func (r *MomentRepository) GetMomentIDsByUser(userID string) ([]uint, error) {
+	var ids []uint
+	err := r.db.Model(&model.Moment{}).
+		Where("user_id = ?", userID).
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
+// GetHashtagMoments 按游标获取某个话题下对查看者可见的动态（ID小于 beforeID，beforeID 为0时从最新开始）
+func (r *MomentRepository) GetHashtagMoments(tag, viewerID string, beforeID uint, limit int) ([]model.Moment, error) {
+	query := r.db.Where("moments.id IN (?)", r.db.Model(&model.MomentHashtag{}).Select("moment_id").Where("tag = ?", tag))
+	if beforeID > 0 {
+		query = query.Where("moments.id < ?", beforeID)
+	}
+
+	var moments []model.Moment
+	if err := query.Scopes(momentVisibleTo(viewerID)).
+		Preload("User").
+		Preload("RepostOf.User").
+		Preload("Likes.User").
+		Preload("Comments.User").
+		Preload("Hashtags").
+		Preload("Mentions").
+		Order("moments.id DESC").
+		Limit(limit).
+		Find(&moments).Error; err != nil {
+		return nil, err
+	}
+	return moments, nil
+}
+
+// GetTrendingHashtags 统计某时间之后发布的、对查看者可见的动态中出现最多的话题
+func (r *MomentRepository) GetTrendingHashtags(viewerID string, since time.Time, limit int) ([]model.HashtagTrend, error) {
+	var trends []model.HashtagTrend
+	err := r.db.Table("moment_hashtags").
+		Select("moment_hashtags.tag, COUNT(*) AS moment_count").
+		Joins("JOIN moments ON moments.id = moment_hashtags.moment_id AND moments.deleted_at IS NULL").
+		Where("moments.created_at >= ?", since).
+		Scopes(momentVisibleTo(viewerID)).
+		Group("moment_hashtags.tag").
+		Order("moment_count DESC, moment_hashtags.tag").
+		Limit(limit).
+		Scan(&trends).Error
+	return trends, err
+}
+
+// CountFriendMomentsSince 统计某时间之后好友发布的、对查看者可见的动态数
+func (r *MomentRepository) CountFriendMomentsSince(friendIDs []string, viewerID string, since time.Time) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.Moment{}).
+		Where("moments.user_id IN ? AND moments.created_at > ?", friendIDs, since).
+		Scopes(momentVisibleTo(viewerID)).
+		Count(&count).Error
+	return count, err
+}
+
 // DeleteMoment 删除动态
 func (r *MomentRepository) DeleteMoment(id uint, userID string) error {
 	return r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&model.Moment{}).Error
 }
 
-// UpdateMoment 更新动态
-func (r *MomentRepository) UpdateMoment(moment *model.Moment) error {
-	return r.db.Save(moment).Error
+// UpdateMoment 编辑动态：保存旧版本到编辑历史，更新内容并替换受众名单
+// 只更新可编辑的列，避免覆盖并发变化的点赞数和评论数
+func (r *MomentRepository) UpdateMoment(moment *model.Moment, audienceUserIDs []string, edit *model.MomentEdit) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(edit).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.Moment{}).Where("id = ?", moment.ID).Updates(map[string]interface{}{
+			"content":   moment.Content,
+			"images":    moment.Images,
+			"location":  moment.Location,
+			"visible":   moment.Visible,
+			"edited_at": moment.EditedAt,
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := r.replaceMomentTags(tx, moment); err != nil {
+			return err
+		}
+
+		if err := tx.Where("moment_id = ?", moment.ID).Delete(&model.MomentAudience{}).Error; err != nil {
+			return err
+		}
+		if len(audienceUserIDs) == 0 {
+			return nil
+		}
+
+		audience := make([]model.MomentAudience, 0, len(audienceUserIDs))
+		for _, userID := range audienceUserIDs {
+			audience = append(audience, model.MomentAudience{
+				MomentID:  moment.ID,
+				UserID:    userID,
+				CreatedAt: *moment.EditedAt,
+			})
+		}
+		return tx.CreateInBatches(audience, 100).Error
+	})
+}
+
+// replaceMomentTags 用动态上的话题和提及替换已保存的记录
+func (r *MomentRepository) replaceMomentTags(tx *gorm.DB, moment *model.Moment) error {
+	if err := tx.Where("moment_id = ?", moment.ID).Delete(&model.MomentHashtag{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("moment_id = ?", moment.ID).Delete(&model.MomentMention{}).Error; err != nil {
+		return err
+	}
+
+	for i := range moment.Hashtags {
+		moment.Hashtags[i].ID = 0
+		moment.Hashtags[i].MomentID = moment.ID
+	}
+	for i := range moment.Mentions {
+		moment.Mentions[i].ID = 0
+		moment.Mentions[i].MomentID = moment.ID
+	}
+	if len(moment.Hashtags) > 0 {
+		if err := tx.Create(&moment.Hashtags).Error; err != nil {
+			return err
+		}
+	}
+	if len(moment.Mentions) > 0 {
+		if err := tx.Create(&moment.Mentions).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetMomentEdits 获取动态的编辑历史（最近的在前）
+func (r *MomentRepository) GetMomentEdits(momentID uint) ([]model.MomentEdit, error) {
+	var edits []model.MomentEdit
+	err := r.db.Where("moment_id = ?", momentID).
+		Order("id DESC").
+		Find(&edits).Error
+	return edits, err
 }
 
 // IncreaseLikeCount 增加点赞数
@@ -102,6 +420,20 @@ func (r *MomentRepository) DecreaseCommentCount(momentID uint) error {
 		UpdateColumn("comment_count", gorm.Expr("comment_count - ?", 1)).Error
 }
 
+// IncreaseRepostCount 增加转发数
+func (r *MomentRepository) IncreaseRepostCount(momentID uint) error {
+	return r.db.Model(&model.Moment{}).
+		Where("id = ?", momentID).
+		UpdateColumn("repost_count", gorm.Expr("repost_count + ?", 1)).Error
+}
+
+// DecreaseRepostCount 减少转发数
+func (r *MomentRepository) DecreaseRepostCount(momentID uint) error {
+	return r.db.Model(&model.Moment{}).
+		Where("id = ?", momentID).
+		UpdateColumn("repost_count", gorm.Expr("repost_count - ?", 1)).Error
+}
+
 // CreateLike 创建点赞
 func (r *MomentRepository) CreateLike(like *model.MomentLike) error {
 	return r.db.Create(like).Error
@@ -155,15 +487,190 @@ func (r *MomentRepository) DeleteComment(id uint, userID string) error {
 		Delete(&model.MomentComment{}).Error
 }
 
-// GetCommentList 获取动态的评论列表
-func (r *MomentRepository) GetCommentList(momentID uint) ([]model.MomentComment, error) {
+// GetTopComments 按游标获取动态的顶层评论（ID大于 afterID，按时间正序）
+func (r *MomentRepository) GetTopComments(momentID, afterID uint, limit int) ([]model.MomentComment, error) {
 	var comments []model.MomentComment
-	if err := r.db.Where("moment_id = ?", momentID).
+	if err := r.db.Where("moment_id = ? AND root_id IS NULL AND id > ?", momentID, afterID).
 		Preload("User").
-		Preload("ReplyTo.User").
-		Order("created_at ASC").
+		Order("id ASC").
+		Limit(limit).
 		Find(&comments).Error; err != nil {
 		return nil, err
 	}
 	return comments, nil
 }
+
+// GetReplies 按游标获取某条顶层评论楼中的回复（ID大于 afterID，按时间正序）
+func (r *MomentRepository) GetReplies(rootID, afterID uint, limit int) ([]model.MomentComment, error) {
+	var replies []model.MomentComment
+	if err := r.db.Where("root_id = ? AND id > ?", rootID, afterID).
+		Preload("User").
+		Preload("ReplyTo.User").
+		Order("id ASC").
+		Limit(limit).
+		Find(&replies).Error; err != nil {
+		return nil, err
+	}
+	return replies, nil
+}
+
+// GetReplyPreviews 批量获取多条顶层评论楼中最早的 perRoot 条回复
+func (r *MomentRepository) GetReplyPreviews(rootIDs []uint, perRoot int) ([]model.MomentComment, error) {
+	var replies []model.MomentComment
+	if len(rootIDs) == 0 {
+		return replies, nil
+	}
+
+	ranked := r.db.Model(&model.MomentComment{}).
+		Select("id, ROW_NUMBER() OVER (PARTITION BY root_id ORDER BY id) AS rn").
+		Where("root_id IN ?", rootIDs)
+	if err := r.db.Where("id IN (?)", r.db.Table("(?) AS ranked", ranked).Select("id").Where("rn <= ?", perRoot)).
+		Preload("User").
+		Preload("ReplyTo.User").
+		Order("id ASC").
+		Find(&replies).Error; err != nil {
+		return nil, err
+	}
+	return replies, nil
+}
+
+// HasReplies 检查评论是否还有未删除的回复
+func (r *MomentRepository) HasReplies(commentID uint) (bool, error) {
+	var count int64
+	err := r.db.Model(&model.MomentComment{}).
+		Where("reply_to_id = ? OR root_id = ?", commentID, commentID).
+		Limit(1).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// MarkCommentDeleted 将评论标记为已删除并清空内容，保留记录作为回复链的占位
+func (r *MomentRepository) MarkCommentDeleted(id uint) error {
+	return r.db.Model(&model.MomentComment{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"is_deleted": true, "content": ""}).Error
+}
+
+// IncreaseReplyCount 增加楼中回复数
+func (r *MomentRepository) IncreaseReplyCount(rootID uint) error {
+	return r.db.Model(&model.MomentComment{}).
+		Where("id = ?", rootID).
+		UpdateColumn("reply_count", gorm.Expr("reply_count + ?", 1)).Error
+}
+
+// DecreaseReplyCount 减少楼中回复数
+func (r *MomentRepository) DecreaseReplyCount(rootID uint) error {
+	return r.db.Model(&model.MomentComment{}).
+		Where("id = ?", rootID).
+		UpdateColumn("reply_count", gorm.Expr("reply_count - ?", 1)).Error
+}
+
+// CreateCommentLike 创建评论点赞并增加点赞数
+func (r *MomentRepository) CreateCommentLike(like *model.MomentCommentLike) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(like).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.MomentComment{}).
+			Where("id = ?", like.CommentID).
+			UpdateColumn("like_count", gorm.Expr("like_count + ?", 1)).Error
+	})
+}
+
+// DeleteCommentLike 取消评论点赞并减少点赞数，返回是否存在点赞记录
+func (r *MomentRepository) DeleteCommentLike(commentID uint, userID string) (bool, error) {
+	var deleted bool
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("comment_id = ? AND user_id = ?", commentID, userID).Delete(&model.MomentCommentLike{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		deleted = true
+		return tx.Model(&model.MomentComment{}).
+			Where("id = ?", commentID).
+			UpdateColumn("like_count", gorm.Expr("like_count - ?", 1)).Error
+	})
+	return deleted, err
+}
+
+// IsCommentLiked 检查用户是否已点赞评论
+func (r *MomentRepository) IsCommentLiked(commentID uint, userID string) (bool, error) {
+	var count int64
+	err := r.db.Model(&model.MomentCommentLike{}).
+		Where("comment_id = ? AND user_id = ?", commentID, userID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// GetLikedCommentIDs 获取用户在指定评论中点过赞的评论ID
+func (r *MomentRepository) GetLikedCommentIDs(userID string, commentIDs []uint) ([]uint, error) {
+	var ids []uint
+	if len(commentIDs) == 0 {
+		return ids, nil
+	}
+	err := r.db.Model(&model.MomentCommentLike{}).
+		Where("user_id = ? AND comment_id IN ?", userID, commentIDs).
+		Pluck("comment_id", &ids).Error
+	return ids, err
+}
+
+// ==================== 朋友圈通知 相关方法 ====================
+
+// CreateNotification 创建互动通知
+func (r *MomentRepository) CreateNotification(notification *model.MomentNotification) error {
+	return r.db.Create(notification).Error
+}
+
+// DeleteLikeNotification 删除未读的点赞通知（取消点赞时）
+func (r *MomentRepository) DeleteLikeNotification(momentID uint, actorID string) error {
+	return r.db.Where("moment_id = ? AND actor_id = ? AND type = ? AND is_read = ?", momentID, actorID, model.MomentNotifyLike, false).
+		Delete(&model.MomentNotification{}).Error
+}
+
+// notificationVisibleTo 只保留动态仍对接收者可见的通知
+// 动态被删除、改为私密、接收者被移出受众名单或存在拉黑关系后，相关通知不再返回
+func (r *MomentRepository) notificationVisibleTo(userID string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		visibleMoments := r.db.Model(&model.Moment{}).Select("moments.id").Scopes(momentVisibleTo(userID))
+		return db.Where("moment_id IN (?)", visibleMoments)
+	}
+}
+
+// GetNotifications 获取用户的互动通知列表（支持分页），只返回动态仍可见的通知
+func (r *MomentRepository) GetNotifications(userID string, offset, limit int) ([]model.MomentNotification, error) {
+	var notifications []model.MomentNotification
+	if err := r.db.Where("user_id = ?", userID).
+		Scopes(r.notificationVisibleTo(userID)).
+		Preload("Actor").
+		Preload("Moment", momentVisibleTo(userID)).
+		Order("created_at DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&notifications).Error; err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+// CountUnreadNotifications 统计未读互动通知数，与通知列表一样只统计动态仍可见的通知
+func (r *MomentRepository) CountUnreadNotifications(userID string) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.MomentNotification{}).
+		Where("user_id = ? AND is_read = ?", userID, false).
+		Scopes(r.notificationVisibleTo(userID)).
+		Count(&count).Error
+	return count, err
+}
+
+// MarkNotificationsRead 将用户的互动通知标记为已读（ids 为空时标记全部）
+func (r *MomentRepository) MarkNotificationsRead(userID string, ids []uint) error {
+	query := r.db.Model(&model.MomentNotification{}).
+		Where("user_id = ? AND is_read = ?", userID, false)
+	if len(ids) > 0 {
+		query = query.Where("id IN ?", ids)
+	}
+	return query.Update("is_read", true).Error
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"im-backend/internal/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ScheduledMessageRepository struct {
+	db *gorm.DB
+}
+
+func NewScheduledMessageRepository(db *gorm.DB) *ScheduledMessageRepository {
+	return &ScheduledMessageRepository{db: db}
+}
+
+// Create 创建定时消息
+func (r *ScheduledMessageRepository) Create(message *model.ScheduledMessage) error {
+	return r.db.Create(message).Error
+}
+
+// FindByID 根据ID查询定时消息
+func (r *ScheduledMessageRepository) FindByID(id uint) (*model.ScheduledMessage, error) {
+	var message model.ScheduledMessage
+	if err := r.db.First(&message, id).Error; err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// GetUserScheduledMessages 获取用户创建的定时消息列表（status < 0 表示全部）
+func (r *ScheduledMessageRepository) GetUserScheduledMessages(userID string, status, page, pageSize int) ([]model.ScheduledMessage, error) {
+	var messages []model.ScheduledMessage
+	offset := (page - 1) * pageSize
+
+	query := r.db.Where("user_id = ?", userID)
+	if status >= 0 {
+		query = query.Where("status = ?", status)
+	}
+
+	err := query.Order("send_at ASC").
+		Offset(offset).
+		Limit(pageSize).
+		Find(&messages).Error
+
+	return messages, err
+}
+
+// Cancel 取消待发送的定时消息，返回是否取消成功
+func (r *ScheduledMessageRepository) Cancel(id uint, userID string) (bool, error) {
+	result := r.db.Model(&model.ScheduledMessage{}).
+		Where("id = ? AND user_id = ? AND status = ?", id, userID, model.ScheduledStatusPending).
+		Update("status", model.ScheduledStatusCancelled)
+	return result.RowsAffected > 0, result.Error
+}
+
+// FindDue 查询已到发送时间的待发送消息
+func (r *ScheduledMessageRepository) FindDue(now time.Time, limit int) ([]model.ScheduledMessage, error) {
+	var messages []model.ScheduledMessage
+	err := r.db.Where("status = ? AND send_at <= ?", model.ScheduledStatusPending, now).
+		Order("send_at ASC").
+		Limit(limit).
+		Find(&messages).Error
+	return messages, err
+}
+
+// Claim 抢占一条待发送消息（置为发送中并记录租约开始时间），多实例部署时保证只发送一次
+func (r *ScheduledMessageRepository) Claim(id uint, now time.Time) (bool, error) {
+	result := r.db.Model(&model.ScheduledMessage{}).
+		Where("id = ? AND status = ?", id, model.ScheduledStatusPending).
+		Updates(map[string]interface{}{
+			"status":     model.ScheduledStatusSending,
+			"claimed_at": now,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// MarkSent 标记为已发送
+func (r *ScheduledMessageRepository) MarkSent(id, sentMessageID uint, sentAt time.Time) error {
+	return r.db.Model(&model.ScheduledMessage{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":          model.ScheduledStatusSent,
+			"sent_message_id": sentMessageID,
+			"sent_at":         sentAt,
+		}).Error
+}
+
+// MarkFailed 标记为发送失败
+func (r *ScheduledMessageRepository) MarkFailed(id uint, reason string) error {
+	return r.db.Model(&model.ScheduledMessage{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":      model.ScheduledStatusFailed,
+			"fail_reason": reason,
+		}).Error
+}
+
+// FailStaleSending 将租约已过期的发送中消息标记为失败（投递实例异常退出遗留的记录）
+// 无法确认这类消息是否已经发出，重新投递可能重复发送，因此不再自动重试
+func (r *ScheduledMessageRepository) FailStaleSending(before time.Time, reason string) (int64, error) {
+	result := r.db.Model(&model.ScheduledMessage{}).
+		Where("status = ? AND (claimed_at IS NULL OR claimed_at < ?)", model.ScheduledStatusSending, before).
+		Updates(map[string]interface{}{
+			"status":      model.ScheduledStatusFailed,
+			"fail_reason": reason,
+		})
+	return result.RowsAffected, result.Error
+}
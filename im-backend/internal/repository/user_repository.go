@@ -2,8 +2,10 @@ package repository
 
 import (
 	"im-backend/internal/model"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type UserRepository struct {
@@ -19,10 +21,15 @@ func (r *UserRepository) Create(user *model.User) error {
 	return r.db.Create(user).Error
 }
 
+// active 排除已注销的账号
+func active(db *gorm.DB) *gorm.DB {
+	return db.Where("account_deleted_at IS NULL")
+}
+
 // FindByEmail 根据邮箱查询
 func (r *UserRepository) FindByEmail(email string) (*model.User, error) {
 	var user model.User
-	if err := r.db.Where("email = ?", email).First(&user).Error; err != nil {
+	if err := r.db.Scopes(active).Where("email = ?", email).First(&user).Error; err != nil {
 		return nil, err
 	}
 	return &user, nil
@@ -31,12 +38,31 @@ func (r *UserRepository) FindByEmail(email string) (*model.User, error) {
 // FindByUserID 根据用户ID查询
 func (r *UserRepository) FindByUserID(userID string) (*model.User, error) {
 	var user model.User
-	if err := r.db.Where("user_id = ?", userID).First(&user).Error; err != nil {
+	if err := r.db.Scopes(active).Where("user_id = ?", userID).First(&user).Error; err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
+// UserIDExists 用户ID是否已被占用（包括已注销的账号，用户ID不能再次注册）
+func (r *UserRepository) UserIDExists(userID string) (bool, error) {
+	var count int64
+	err := r.db.Unscoped().Model(&model.User{}).Where("user_id = ?", userID).Count(&count).Error
+	return count > 0, err
+}
+
+// FindByUserIDs 根据用户ID批量查询
+func (r *UserRepository) FindByUserIDs(userIDs []string) ([]model.User, error) {
+	var users []model.User
+	if len(userIDs) == 0 {
+		return users, nil
+	}
+	if err := r.db.Scopes(active).Where("user_id IN ?", userIDs).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
 // Update 更新用户（用于修改密码/昵称等）
 func (r *UserRepository) Update(user *model.User) error {
 	return r.db.Save(user).Error
@@ -48,3 +74,170 @@ func (r *UserRepository) UpdateField(userID string, field string, value interfac
 		Where("user_id = ?", userID).
 		Update(field, value).Error
 }
+
+// EnableTwoFactor 开启两步验证并写入新的恢复码
+func (r *UserRepository) EnableTwoFactor(userID, secret string, codeHashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.User{}).Where("user_id = ?", userID).
+			Updates(map[string]interface{}{"two_factor_enabled": true, "two_factor_secret": secret}).Error; err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+}
+
+// DisableTwoFactor 关闭两步验证并删除恢复码
+func (r *UserRepository) DisableTwoFactor(userID string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.User{}).Where("user_id = ?", userID).
+			Updates(map[string]interface{}{"two_factor_enabled": false, "two_factor_secret": ""}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&model.UserRecoveryCode{}).Error
+	})
+}
+
+// ReplaceRecoveryCodes 重新生成恢复码，旧的恢复码全部作废
+func (r *UserRepository) ReplaceRecoveryCodes(userID string, codeHashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+}
+
+// UseRecoveryCode 使用恢复码，返回是否存在且未使用过
+func (r *UserRepository) UseRecoveryCode(userID, codeHash string) (bool, error) {
+	result := r.db.Model(&model.UserRecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+// CountUnusedRecoveryCodes 统计剩余可用的恢复码
+func (r *UserRepository) CountUnusedRecoveryCodes(userID string) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.UserRecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error
+	return count, err
+}
+
+// replaceRecoveryCodes 在事务中替换用户的恢复码
+func replaceRecoveryCodes(tx *gorm.DB, userID string, codeHashes []string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&model.UserRecoveryCode{}).Error; err != nil {
+		return err
+	}
+	now := time.Now()
+	codes := make([]model.UserRecoveryCode, 0, len(codeHashes))
+	for _, hash := range codeHashes {
+		codes = append(codes, model.UserRecoveryCode{UserID: userID, CodeHash: hash, CreatedAt: now})
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	return tx.Create(&codes).Error
+}
+
+// FindIdentity 根据提供方和 sub 查询外部身份
+func (r *UserRepository) FindIdentity(provider, subject string) (*model.UserIdentity, error) {
+	var identity model.UserIdentity
+	if err := r.db.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error; err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// CreateIdentity 关联外部身份到已有用户
+func (r *UserRepository) CreateIdentity(identity *model.UserIdentity) error {
+	return r.db.Create(identity).Error
+}
+
+// CreateWithIdentity 首次单点登录时创建用户并关联外部身份
+func (r *UserRepository) CreateWithIdentity(user *model.User, identity *model.UserIdentity) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		identity.UserID = user.UserID
+		return tx.Create(identity).Error
+	})
+}
+
+// CreateLoginHistory 写入登录记录
+func (r *UserRepository) CreateLoginHistory(history *model.LoginHistory) error {
+	return r.db.Create(history).Error
+}
+
+// HasSuccessfulLogin 用户是否有过成功登录，deviceHash 非空时只统计该设备
+func (r *UserRepository) HasSuccessfulLogin(userID, deviceHash string) (bool, error) {
+	query := r.db.Model(&model.LoginHistory{}).Where("user_id = ? AND success = ?", userID, true)
+	if deviceHash != "" {
+		query = query.Where("device_hash = ?", deviceHash)
+	}
+	var count int64
+	err := query.Count(&count).Error
+	return count > 0, err
+}
+
+// GetLoginHistory 按游标查询登录记录（从新到旧），beforeID 为0表示从最新开始
+func (r *UserRepository) GetLoginHistory(userID string, beforeID uint, limit int) ([]model.LoginHistory, error) {
+	var histories []model.LoginHistory
+	query := r.db.Where("user_id = ?", userID)
+	if beforeID > 0 {
+		query = query.Where("id < ?", beforeID)
+	}
+	err := query.Order("id DESC").Limit(limit).Find(&histories).Error
+	return histories, err
+}
+
+// ==================== 隐私设置 ====================
+
+// defaultPrivacy 未设置过隐私的用户使用的默认值
+func defaultPrivacy(userID string) model.UserPrivacy {
+	return model.UserPrivacy{
+		UserID:              userID,
+		SearchByID:          true,
+		AllowGroupStrangers: true,
+		StrangerMoments:     true,
+	}
+}
+
+// GetPrivacy 获取隐私设置，没有记录时返回默认值
+func (r *UserRepository) GetPrivacy(userID string) (*model.UserPrivacy, error) {
+	var privacies []model.UserPrivacy
+	if err := r.db.Where("user_id = ?", userID).Limit(1).Find(&privacies).Error; err != nil {
+		return nil, err
+	}
+	if len(privacies) == 0 {
+		privacy := defaultPrivacy(userID)
+		return &privacy, nil
+	}
+	return &privacies[0], nil
+}
+
+// GetPrivacies 批量获取隐私设置，没有记录的用户使用默认值
+func (r *UserRepository) GetPrivacies(userIDs []string) (map[string]model.UserPrivacy, error) {
+	result := make(map[string]model.UserPrivacy, len(userIDs))
+	if len(userIDs) == 0 {
+		return result, nil
+	}
+	var privacies []model.UserPrivacy
+	if err := r.db.Where("user_id IN ?", userIDs).Find(&privacies).Error; err != nil {
+		return nil, err
+	}
+	for _, userID := range userIDs {
+		result[userID] = defaultPrivacy(userID)
+	}
+	for _, privacy := range privacies {
+		result[privacy.UserID] = privacy
+	}
+	return result, nil
+}
+
+// SavePrivacy 保存隐私设置（按用户ID插入或更新全部字段）
+func (r *UserRepository) SavePrivacy(privacy *model.UserPrivacy) error {
+	privacy.UpdatedAt = time.Now()
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"search_by_id", "search_by_email", "friend_question", "friend_answer_hash", "allow_group_strangers", "stranger_moments", "updated_at"}),
+	}).Create(privacy).Error
+}
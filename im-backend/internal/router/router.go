@@ -7,6 +7,7 @@ import (
 	"im-backend/internal/repository"
 	"im-backend/internal/service"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -14,45 +15,77 @@ import (
 func InitRouter() *mux.Router {
 	r := mux.NewRouter()
 
+	// JWT 公钥（JWKS），供其他服务验证 Access Token
+	r.HandleFunc("/.well-known/jwks.json", pkg.JWKSHandler).Methods("GET")
+
 	// API 统一前缀
 	api := r.PathPrefix("/api/v1").Subrouter()
 
+	// 限流：所有接口按IP的全局限额，敏感接口再按分类单独限额
+	rateLimiter := pkg.NewRateLimiter(pkg.RDB)
+	api.Use(rateLimiter.Middleware(pkg.RateLimitGlobal))
+
 	// 初始化依赖
 	userRepo := repository.NewUserRepository(pkg.DB)
 	codeService := service.NewCodeService()
-	userService := service.NewUserService(userRepo, pkg.RDB, codeService)
+	loginGuard := service.NewLoginGuard(userRepo)
+	userService := service.NewUserService(userRepo, pkg.RDB, codeService, loginGuard)
+	twoFactorService := service.NewTwoFactorService(userRepo, loginGuard)
+	oidcService := service.NewOIDCService(userRepo, pkg.NewOIDCProviders())
 
-	// 好友系统
+	// 好友系统（好友推荐需要统计共同群组，好友关系变化需要同步朋友圈时间线）
 	friendRepo := repository.NewFriendRepository(pkg.DB)
-	friendService := service.NewFriendService(friendRepo, userRepo)
+	groupRepo := repository.NewGroupRepository(pkg.DB)
+	momentRepo := repository.NewMomentRepository(pkg.DB)
+	momentTimeline := service.NewMomentTimeline(momentRepo, friendRepo)
+	friendService := service.NewFriendService(friendRepo, groupRepo, userRepo, momentTimeline)
 
 	// 朋友圈
-	momentRepo := repository.NewMomentRepository(pkg.DB)
-	momentService := service.NewMomentService(momentRepo, friendRepo)
+	momentService := service.NewMomentService(momentRepo, friendRepo, userRepo, momentTimeline)
 
 	// 消息系统
 	messageRepo := repository.NewMessageRepository(pkg.DB)
 	messageService := service.NewMessageService(messageRepo, friendRepo)
 
 	// 群聊系统
-	groupRepo := repository.NewGroupRepository(pkg.DB)
 	groupService := service.NewGroupService(groupRepo, friendRepo, userRepo)
 
-	userController := controller.NewUserController(userService, codeService)
+	// 后台任务：清理过期的阅后即焚消息
+	messageSweeper := service.NewMessageSweeper(messageRepo, groupRepo)
+	go messageSweeper.Run(time.Minute)
+
+	// 定时消息（发送时再经过消息/群聊服务的校验）
+	scheduledMessageRepo := repository.NewScheduledMessageRepository(pkg.DB)
+	scheduledMessageService := service.NewScheduledMessageService(scheduledMessageRepo, messageService, groupService)
+	go scheduledMessageService.Run(10 * time.Second)
+
+	// 邀请链接与二维码
+	inviteRepo := repository.NewInviteRepository(pkg.DB)
+	inviteService := service.NewInviteService(inviteRepo, groupRepo, friendService, groupService)
+
+	// 个人数据导出与账号注销（后台生成导出文件、清除冷静期已结束的账号）
+	accountRepo := repository.NewAccountRepository(pkg.DB)
+	accountService := service.NewAccountService(accountRepo, userRepo, friendRepo, friendService, momentService, groupService, twoFactorService, codeService, loginGuard, pkg.RDB)
+	go accountService.Run(time.Minute)
+
+	userController := controller.NewUserController(userService, codeService, twoFactorService, oidcService, loginGuard, accountService)
 	friendController := controller.NewFriendController(friendService)
 	momentController := controller.NewMomentController(momentService)
 	messageController := controller.NewMessageController(messageService)
 	groupController := controller.NewGroupController(groupService)
+	scheduledMessageController := controller.NewScheduledMessageController(scheduledMessageService)
+	inviteController := controller.NewInviteController(inviteService)
 	//friendController := controller.NewFriendController()
 	//messageController := controller.NewMessageController()
 	//momentController := controller.NewMomentController()
 
 	userHandler := handler.NewUserHandler(userController)
-	friendHandler := handler.NewFriendHandler(friendController, userRepo)
+	friendHandler := handler.NewFriendHandler(friendController)
 	momentHandler := handler.NewMomentHandler(momentController)
-	// 替换这里：为MessageHandler注入userRepo
-	messageHandler := handler.NewMessageHandler(messageController, userRepo)
-	groupHandler := handler.NewGroupHandler(groupController, userRepo)
+	messageHandler := handler.NewMessageHandler(messageController)
+	groupHandler := handler.NewGroupHandler(groupController)
+	scheduledMessageHandler := handler.NewScheduledMessageHandler(scheduledMessageController)
+	inviteHandler := handler.NewInviteHandler(inviteController)
 
 	// 健康检查
 	api.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
@@ -60,21 +93,44 @@ func InitRouter() *mux.Router {
 	}).Methods("GET")
 
 	// user 用户
-	api.HandleFunc("/users/register", userHandler.Register).Methods("POST")
-	api.HandleFunc("/users/login", userHandler.Login).Methods("POST")
-	api.HandleFunc("/users/register-pwd", userHandler.RegisterWithPassword).Methods("POST")
-	api.HandleFunc("/users/login-pwd", userHandler.LoginWithPassword).Methods("POST")
-	api.HandleFunc("/users/send-code", userHandler.SendCode).Methods("POST")
-	api.HandleFunc("/users/verify-code", userHandler.VerifyCode).Methods("POST")
+	api.HandleFunc("/users/register", rateLimiter.ByIP(pkg.RateLimitAuth, userHandler.Register)).Methods("POST")
+	api.HandleFunc("/users/login", rateLimiter.ByIP(pkg.RateLimitAuth, userHandler.Login)).Methods("POST")
+	api.HandleFunc("/users/register-pwd", rateLimiter.ByIP(pkg.RateLimitAuth, userHandler.RegisterWithPassword)).Methods("POST")
+	api.HandleFunc("/users/login-pwd", rateLimiter.ByIP(pkg.RateLimitAuth, userHandler.LoginWithPassword)).Methods("POST")
+	api.HandleFunc("/users/2fa/verify", rateLimiter.ByIP(pkg.RateLimitAuth, userHandler.VerifyTwoFactorLogin)).Methods("POST")
+	api.HandleFunc("/users/oidc/providers", userHandler.OIDCProviders).Methods("GET")
+	api.HandleFunc("/users/oidc/{provider}/login", rateLimiter.ByIP(pkg.RateLimitAuth, userHandler.OIDCLogin)).Methods("GET")
+	api.HandleFunc("/users/oidc/{provider}/callback", rateLimiter.ByIP(pkg.RateLimitAuth, userHandler.OIDCCallback)).Methods("GET")
+	api.HandleFunc("/users/refresh", rateLimiter.ByIP(pkg.RateLimitAuth, userHandler.Refresh)).Methods("POST")
+	api.HandleFunc("/users/forgot-password", rateLimiter.ByIP(pkg.RateLimitCode, userHandler.ForgotPassword)).Methods("POST")
+	api.HandleFunc("/users/reset-password", rateLimiter.ByIP(pkg.RateLimitAuth, userHandler.ResetPassword)).Methods("POST")
+	api.HandleFunc("/users/send-code", rateLimiter.ByIP(pkg.RateLimitCode, userHandler.SendCode)).Methods("POST")
+	api.HandleFunc("/users/verify-code", rateLimiter.ByIP(pkg.RateLimitAuth, userHandler.VerifyCode)).Methods("POST")
 
 	// 带鉴权的接口
 	api.HandleFunc("/users/me", pkg.AuthMiddleware(pkg.RDB, userHandler.Me)).Methods("GET")
 	api.HandleFunc("/users/me", pkg.AuthMiddleware(pkg.RDB, userHandler.UpdateProfile)).Methods("PUT")
 	api.HandleFunc("/users/logout", pkg.AuthMiddleware(pkg.RDB, userHandler.Logout)).Methods("POST")
 	api.HandleFunc("/users/set-password", pkg.AuthMiddleware(pkg.RDB, userHandler.SetPassword)).Methods("POST")
+	api.HandleFunc("/users/change-email", pkg.AuthMiddleware(pkg.RDB, rateLimiter.ByUser(pkg.RateLimitCode, userHandler.RequestEmailChange))).Methods("POST")
+	api.HandleFunc("/users/change-email/confirm", pkg.AuthMiddleware(pkg.RDB, rateLimiter.ByUser(pkg.RateLimitAuth, userHandler.ConfirmEmailChange))).Methods("POST")
+	api.HandleFunc("/users/login-history", pkg.AuthMiddleware(pkg.RDB, userHandler.LoginHistory)).Methods("GET")
+	api.HandleFunc("/users/privacy", pkg.AuthMiddleware(pkg.RDB, userHandler.GetPrivacy)).Methods("GET")
+	api.HandleFunc("/users/privacy", pkg.AuthMiddleware(pkg.RDB, userHandler.UpdatePrivacy)).Methods("PUT")
+	api.HandleFunc("/users/me/export", pkg.AuthMiddleware(pkg.RDB, userHandler.ExportData)).Methods("GET")
+	api.HandleFunc("/users/me/export/{id}/download", pkg.AuthMiddleware(pkg.RDB, userHandler.DownloadExport)).Methods("GET")
+	api.HandleFunc("/users/me/deletion", pkg.AuthMiddleware(pkg.RDB, rateLimiter.ByUser(pkg.RateLimitAuth, userHandler.RequestDeletion))).Methods("POST")
+	api.HandleFunc("/users/me/deletion", pkg.AuthMiddleware(pkg.RDB, userHandler.CancelDeletion)).Methods("DELETE")
+
+	// 两步验证（TOTP）
+	api.HandleFunc("/users/2fa", pkg.AuthMiddleware(pkg.RDB, userHandler.TwoFactorStatus)).Methods("GET")
+	api.HandleFunc("/users/2fa/setup", pkg.AuthMiddleware(pkg.RDB, userHandler.SetupTwoFactor)).Methods("POST")
+	api.HandleFunc("/users/2fa/enable", pkg.AuthMiddleware(pkg.RDB, userHandler.EnableTwoFactor)).Methods("POST")
+	api.HandleFunc("/users/2fa/disable", pkg.AuthMiddleware(pkg.RDB, userHandler.DisableTwoFactor)).Methods("POST")
+	api.HandleFunc("/users/2fa/recovery-codes", pkg.AuthMiddleware(pkg.RDB, userHandler.RegenerateRecoveryCodes)).Methods("POST")
 
 	// friends 好友系统
-	api.HandleFunc("/friends/send-request", pkg.AuthMiddleware(pkg.RDB, friendHandler.SendRequest)).Methods("POST")
+	api.HandleFunc("/friends/send-request", pkg.AuthMiddleware(pkg.RDB, rateLimiter.ByUser(pkg.RateLimitAuth, friendHandler.SendRequest))).Methods("POST")
 	api.HandleFunc("/friends/accept-request", pkg.AuthMiddleware(pkg.RDB, friendHandler.AcceptRequest)).Methods("POST")
 	api.HandleFunc("/friends/reject-request", pkg.AuthMiddleware(pkg.RDB, friendHandler.RejectRequest)).Methods("POST")
 	api.HandleFunc("/friends/list", pkg.AuthMiddleware(pkg.RDB, friendHandler.GetFriendList)).Methods("GET")
@@ -83,6 +139,22 @@ func InitRouter() *mux.Router {
 	api.HandleFunc("/friends/received-requests", pkg.AuthMiddleware(pkg.RDB, friendHandler.GetReceivedRequests)).Methods("GET")
 	api.HandleFunc("/friends/sent-requests", pkg.AuthMiddleware(pkg.RDB, friendHandler.GetSentRequests)).Methods("GET")
 	api.HandleFunc("/friends/search", pkg.AuthMiddleware(pkg.RDB, friendHandler.SearchFriend)).Methods("GET")
+	api.HandleFunc("/friends/recommendations", pkg.AuthMiddleware(pkg.RDB, friendHandler.GetRecommendations)).Methods("GET")
+	api.HandleFunc("/friends/block", pkg.AuthMiddleware(pkg.RDB, friendHandler.BlockUser)).Methods("POST")
+	api.HandleFunc("/friends/block/{user_id}", pkg.AuthMiddleware(pkg.RDB, friendHandler.UnblockUser)).Methods("DELETE")
+	api.HandleFunc("/friends/blocklist", pkg.AuthMiddleware(pkg.RDB, friendHandler.GetBlockList)).Methods("GET")
+	api.HandleFunc("/friends/tags", pkg.AuthMiddleware(pkg.RDB, friendHandler.CreateTag)).Methods("POST")
+	api.HandleFunc("/friends/tags", pkg.AuthMiddleware(pkg.RDB, friendHandler.GetTags)).Methods("GET")
+	api.HandleFunc("/friends/tags/{tag_id}", pkg.AuthMiddleware(pkg.RDB, friendHandler.UpdateTag)).Methods("PUT")
+	api.HandleFunc("/friends/tags/{tag_id}", pkg.AuthMiddleware(pkg.RDB, friendHandler.DeleteTag)).Methods("DELETE")
+
+	// invites 邀请链接（好友名片 / 群邀请）
+	api.HandleFunc("/invites", pkg.AuthMiddleware(pkg.RDB, inviteHandler.CreateInvite)).Methods("POST")
+	api.HandleFunc("/invites", pkg.AuthMiddleware(pkg.RDB, inviteHandler.GetInvites)).Methods("GET")
+	api.HandleFunc("/invites/{id}", pkg.AuthMiddleware(pkg.RDB, inviteHandler.RevokeInvite)).Methods("DELETE")
+	api.HandleFunc("/invites/{id}/qrcode", pkg.AuthMiddleware(pkg.RDB, inviteHandler.GetInviteQRCode)).Methods("GET")
+	api.HandleFunc("/invites/token/{token}", pkg.AuthMiddleware(pkg.RDB, inviteHandler.GetInviteByToken)).Methods("GET")
+	api.HandleFunc("/invites/token/{token}/redeem", pkg.AuthMiddleware(pkg.RDB, inviteHandler.RedeemInvite)).Methods("POST")
 
 	// messages 消息管理
 	//api.HandleFunc("/messages/send", messageHandler.Send).Methods("POST")
@@ -93,9 +165,21 @@ func InitRouter() *mux.Router {
 	api.HandleFunc("/moments/create", pkg.AuthMiddleware(pkg.RDB, momentHandler.CreateMoment)).Methods("POST")
 	api.HandleFunc("/moments/my-list", pkg.AuthMiddleware(pkg.RDB, momentHandler.GetMyMoments)).Methods("GET")
 	api.HandleFunc("/moments/timeline", pkg.AuthMiddleware(pkg.RDB, momentHandler.GetFriendMoments)).Methods("GET")
+	api.HandleFunc("/moments/timeline/new-count", pkg.AuthMiddleware(pkg.RDB, momentHandler.GetNewTimelineCount)).Methods("GET")
+	api.HandleFunc("/moments/notifications", pkg.AuthMiddleware(pkg.RDB, momentHandler.GetNotifications)).Methods("GET")
+	api.HandleFunc("/moments/notifications/unread-count", pkg.AuthMiddleware(pkg.RDB, momentHandler.GetUnreadNotificationCount)).Methods("GET")
+	api.HandleFunc("/moments/notifications/read", pkg.AuthMiddleware(pkg.RDB, momentHandler.MarkNotificationsRead)).Methods("PUT")
+	api.HandleFunc("/moments/hashtags/trending", pkg.AuthMiddleware(pkg.RDB, momentHandler.GetTrendingHashtags)).Methods("GET")
+	api.HandleFunc("/moments/hashtags/{tag}", pkg.AuthMiddleware(pkg.RDB, momentHandler.GetHashtagMoments)).Methods("GET")
 	api.HandleFunc("/moments/comments/{comment_id}", pkg.AuthMiddleware(pkg.RDB, momentHandler.DeleteComment)).Methods("DELETE")
+	api.HandleFunc("/moments/comments/{comment_id}/replies", pkg.AuthMiddleware(pkg.RDB, momentHandler.GetCommentReplies)).Methods("GET")
+	api.HandleFunc("/moments/comments/{comment_id}/like", pkg.AuthMiddleware(pkg.RDB, momentHandler.LikeComment)).Methods("POST")
+	api.HandleFunc("/moments/comments/{comment_id}/unlike", pkg.AuthMiddleware(pkg.RDB, momentHandler.UnlikeComment)).Methods("DELETE")
 	api.HandleFunc("/moments/{id}", pkg.AuthMiddleware(pkg.RDB, momentHandler.GetMomentByID)).Methods("GET")
 	api.HandleFunc("/moments/{id}", pkg.AuthMiddleware(pkg.RDB, momentHandler.DeleteMoment)).Methods("DELETE")
+	api.HandleFunc("/moments/{id}", pkg.AuthMiddleware(pkg.RDB, momentHandler.UpdateMoment)).Methods("PUT")
+	api.HandleFunc("/moments/{id}/repost", pkg.AuthMiddleware(pkg.RDB, momentHandler.RepostMoment)).Methods("POST")
+	api.HandleFunc("/moments/{id}/edits", pkg.AuthMiddleware(pkg.RDB, momentHandler.GetMomentEdits)).Methods("GET")
 	api.HandleFunc("/moments/{id}/like", pkg.AuthMiddleware(pkg.RDB, momentHandler.LikeMoment)).Methods("POST")
 	api.HandleFunc("/moments/{id}/unlike", pkg.AuthMiddleware(pkg.RDB, momentHandler.UnlikeMoment)).Methods("DELETE")
 	api.HandleFunc("/moments/{id}/likes", pkg.AuthMiddleware(pkg.RDB, momentHandler.GetLikeList)).Methods("GET")
@@ -105,15 +189,21 @@ func InitRouter() *mux.Router {
 	// messages 消息系统
 	// WebSocket不使用中间件，在handler内部验证token（从URL参数）
 	api.HandleFunc("/messages/ws", messageHandler.WebSocketHandler).Methods("GET")
-	api.HandleFunc("/messages/send", pkg.AuthMiddleware(pkg.RDB, messageHandler.SendMessage)).Methods("POST")
+	api.HandleFunc("/messages/send", pkg.AuthMiddleware(pkg.RDB, rateLimiter.ByUser(pkg.RateLimitMessage, messageHandler.SendMessage))).Methods("POST")
 	api.HandleFunc("/messages/conversations", pkg.AuthMiddleware(pkg.RDB, messageHandler.GetConversationList)).Methods("GET")
 	api.HandleFunc("/messages/conversations/create", pkg.AuthMiddleware(pkg.RDB, messageHandler.GetOrCreateConversation)).Methods("POST")
 	api.HandleFunc("/messages/conversations/{conversation_id}/messages", pkg.AuthMiddleware(pkg.RDB, messageHandler.GetConversationMessages)).Methods("GET")
 	api.HandleFunc("/messages/conversations/{conversation_id}/read", pkg.AuthMiddleware(pkg.RDB, messageHandler.MarkConversationAsRead)).Methods("PUT")
+	api.HandleFunc("/messages/conversations/{conversation_id}/ttl", pkg.AuthMiddleware(pkg.RDB, messageHandler.SetConversationTTL)).Methods("PUT")
 	api.HandleFunc("/messages/{message_id}/recall", pkg.AuthMiddleware(pkg.RDB, messageHandler.RecallMessage)).Methods("PUT")
 	api.HandleFunc("/messages/{message_id}", pkg.AuthMiddleware(pkg.RDB, messageHandler.DeleteMessage)).Methods("DELETE")
 	api.HandleFunc("/messages/unread-count", pkg.AuthMiddleware(pkg.RDB, messageHandler.GetUnreadMessageCount)).Methods("GET")
 
+	// 定时消息
+	api.HandleFunc("/messages/scheduled", pkg.AuthMiddleware(pkg.RDB, rateLimiter.ByUser(pkg.RateLimitMessage, scheduledMessageHandler.CreateScheduledMessage))).Methods("POST")
+	api.HandleFunc("/messages/scheduled", pkg.AuthMiddleware(pkg.RDB, scheduledMessageHandler.GetScheduledMessages)).Methods("GET")
+	api.HandleFunc("/messages/scheduled/{id}", pkg.AuthMiddleware(pkg.RDB, scheduledMessageHandler.CancelScheduledMessage)).Methods("DELETE")
+
 	// groups 群聊系统
 	api.HandleFunc("/groups/create", pkg.AuthMiddleware(pkg.RDB, groupHandler.CreateGroup)).Methods("POST")
 	api.HandleFunc("/groups/{group_id}", pkg.AuthMiddleware(pkg.RDB, groupHandler.GetGroupInfo)).Methods("GET")
@@ -121,16 +211,18 @@ func InitRouter() *mux.Router {
 	api.HandleFunc("/groups/{group_id}", pkg.AuthMiddleware(pkg.RDB, groupHandler.DeleteGroup)).Methods("DELETE")
 	api.HandleFunc("/groups/my-list", pkg.AuthMiddleware(pkg.RDB, groupHandler.GetUserGroups)).Methods("GET")
 	api.HandleFunc("/groups/search", pkg.AuthMiddleware(pkg.RDB, groupHandler.SearchGroups)).Methods("GET")
+	api.HandleFunc("/groups/{group_id}/ttl", pkg.AuthMiddleware(pkg.RDB, groupHandler.SetMessageTTL)).Methods("PUT")
 
 	// 群成员管理
 	api.HandleFunc("/groups/join", pkg.AuthMiddleware(pkg.RDB, groupHandler.JoinGroup)).Methods("POST")
+	api.HandleFunc("/groups/{group_id}/invite", pkg.AuthMiddleware(pkg.RDB, groupHandler.InviteMembers)).Methods("POST")
 	api.HandleFunc("/groups/{group_id}/leave", pkg.AuthMiddleware(pkg.RDB, groupHandler.LeaveGroup)).Methods("POST")
 	api.HandleFunc("/groups/{group_id}/kick", pkg.AuthMiddleware(pkg.RDB, groupHandler.KickMember)).Methods("POST")
 	api.HandleFunc("/groups/{group_id}/set-role", pkg.AuthMiddleware(pkg.RDB, groupHandler.SetMemberRole)).Methods("POST")
 	api.HandleFunc("/groups/{group_id}/members", pkg.AuthMiddleware(pkg.RDB, groupHandler.GetGroupMembers)).Methods("GET")
 
 	// 群消息管理
-	api.HandleFunc("/groups/messages/send", pkg.AuthMiddleware(pkg.RDB, groupHandler.SendGroupMessage)).Methods("POST")
+	api.HandleFunc("/groups/messages/send", pkg.AuthMiddleware(pkg.RDB, rateLimiter.ByUser(pkg.RateLimitMessage, groupHandler.SendGroupMessage))).Methods("POST")
 	api.HandleFunc("/groups/{group_id}/messages", pkg.AuthMiddleware(pkg.RDB, groupHandler.GetGroupMessages)).Methods("GET")
 	api.HandleFunc("/groups/messages/{message_id}/recall", pkg.AuthMiddleware(pkg.RDB, groupHandler.RecallGroupMessage)).Methods("PUT")
 	api.HandleFunc("/groups/{group_id}/messages/read", pkg.AuthMiddleware(pkg.RDB, groupHandler.MarkGroupMessagesAsRead)).Methods("PUT")
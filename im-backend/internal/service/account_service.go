@@ -0,0 +1,668 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"im-backend/config"
+	"im-backend/internal/model"
+	"im-backend/internal/pkg"
+	"im-backend/internal/repository"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 个人数据导出和账号注销
+const (
+	dataExportTTL         = 72 * time.Hour     // 导出文件的下载期限
+	defaultDeletionGrace  = 7 * 24 * time.Hour // 默认注销冷静期
+	accountTaskBatchSize  = 20                 // 每轮处理的导出任务/注销账号数量
+	accountTaskLease      = 30 * time.Minute   // 导出和清除任务的租约，超时未完成视为处理的实例已退出，由下一轮重试
+	dataExportDownloadURL = "/api/v1/users/me/export/%d/download"
+)
+
+// AccountService 个人数据导出和账号注销
+// 导出任务和到期的注销由 Run 在后台处理
+type AccountService struct {
+	accountRepo      *repository.AccountRepository
+	userRepo         *repository.UserRepository
+	friendRepo       *repository.FriendRepository
+	friendService    *FriendService
+	momentService    *MomentService
+	groupService     *GroupService
+	twoFactorService *TwoFactorService
+	codeService      *CodeService
+	loginGuard       *LoginGuard
+	rdb              *redis.Client
+}
+
+func NewAccountService(accountRepo *repository.AccountRepository, userRepo *repository.UserRepository, friendRepo *repository.FriendRepository,
+	friendService *FriendService, momentService *MomentService, groupService *GroupService,
+	twoFactorService *TwoFactorService, codeService *CodeService, loginGuard *LoginGuard, rdb *redis.Client) *AccountService {
+	return &AccountService{
+		accountRepo:      accountRepo,
+		userRepo:         userRepo,
+		friendRepo:       friendRepo,
+		friendService:    friendService,
+		momentService:    momentService,
+		groupService:     groupService,
+		twoFactorService: twoFactorService,
+		codeService:      codeService,
+		loginGuard:       loginGuard,
+		rdb:              rdb,
+	}
+}
+
+// ==================== 数据导出 ====================
+
+// RequestExport 获取个人数据导出任务：已有排队中、生成中或未过期的导出时直接返回，否则创建新任务
+func (s *AccountService) RequestExport(userID string) (*model.DataExport, error) {
+	export, err := s.accountRepo.FindLatestExport(userID)
+	if err == nil {
+		switch export.Status {
+		case model.DataExportStatusPending, model.DataExportStatusProcessing:
+			return export, nil
+		case model.DataExportStatusReady:
+			if export.ExpireAt != nil && export.ExpireAt.After(time.Now()) {
+				export.DownloadURL = fmt.Sprintf(dataExportDownloadURL, export.ID)
+				return export, nil
+			}
+		}
+	}
+
+	export = &model.DataExport{
+		UserID: userID,
+		Status: model.DataExportStatusPending,
+	}
+	if err := s.accountRepo.CreateExport(export); err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+// GetExportFile 获取已完成的导出文件路径，只能下载自己的导出
+func (s *AccountService) GetExportFile(userID string, exportID uint) (string, *model.DataExport, error) {
+	export, err := s.accountRepo.FindExportByID(exportID)
+	if err != nil || export.UserID != userID {
+		return "", nil, errors.New("导出不存在")
+	}
+	if export.Status != model.DataExportStatusReady {
+		return "", nil, errors.New("导出尚未完成")
+	}
+	if export.ExpireAt == nil || !export.ExpireAt.After(time.Now()) {
+		return "", nil, errors.New("导出已过期，请重新导出")
+	}
+	return filepath.Join(exportDir(), export.FileName), export, nil
+}
+
+// exportDir 导出文件存储目录
+func exportDir() string {
+	if config.Cfg == nil || config.Cfg.ExportDir == "" {
+		return "exports"
+	}
+	return config.Cfg.ExportDir
+}
+
+// processExports 生成排队中的导出任务，租约过期的生成中任务重新生成
+func (s *AccountService) processExports(now time.Time) {
+	exports, err := s.accountRepo.FindPendingExports(now.Add(-accountTaskLease), accountTaskBatchSize)
+	if err != nil {
+		log.Printf("❌ 查询数据导出任务失败: %v", err)
+		return
+	}
+
+	for _, export := range exports {
+		ok, err := s.accountRepo.ClaimExport(export.ID, now, now.Add(-accountTaskLease))
+		if err != nil {
+			log.Printf("❌ 抢占数据导出任务 %d 失败: %v", export.ID, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		fileName := fmt.Sprintf("data_export_%d.zip", export.ID)
+		size, err := s.buildExport(export.UserID, filepath.Join(exportDir(), fileName))
+		if err != nil {
+			log.Printf("⚠️ 用户 %s 的数据导出 %d 失败: %v", export.UserID, export.ID, err)
+			if markErr := s.accountRepo.MarkExportFailed(export.ID, truncateRunes(err.Error(), 255)); markErr != nil {
+				log.Printf("❌ 更新数据导出任务 %d 状态失败: %v", export.ID, markErr)
+			}
+			continue
+		}
+		if err := s.accountRepo.MarkExportReady(export.ID, fileName, size, time.Now().Add(dataExportTTL)); err != nil {
+			log.Printf("❌ 更新数据导出任务 %d 状态失败: %v", export.ID, err)
+			continue
+		}
+		log.Printf("✅ 用户 %s 的数据导出 %d 已完成", export.UserID, export.ID)
+	}
+}
+
+// buildExport 生成导出的 ZIP 文件：每类数据一个 JSON 文件，本地上传的媒体文件放在 media/ 目录
+// 先写临时文件，完成后再重命名，避免下载到不完整的文件
+func (s *AccountService) buildExport(userID, path string) (int64, error) {
+	user, err := s.userRepo.FindByUserID(userID)
+	if err != nil {
+		return 0, errors.New("用户不存在")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, err
+	}
+
+	tmpPath := path + ".part"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmpPath)
+
+	zw := zip.NewWriter(file)
+	if err := s.writeExportArchive(zw, user); err != nil {
+		zw.Close()
+		file.Close()
+		return 0, err
+	}
+	if err := zw.Close(); err != nil {
+		file.Close()
+		return 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return 0, err
+	}
+	if err := file.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// writeExportArchive 写入导出内容
+func (s *AccountService) writeExportArchive(zw *zip.Writer, user *model.User) error {
+	media := []string{user.Avatar}
+
+	if err := writeJSONFile(zw, "profile.json", user.Self()); err != nil {
+		return err
+	}
+
+	friends, err := s.friendRepo.GetFriendList(user.UserID)
+	if err != nil {
+		return err
+	}
+	if err := writeJSONFile(zw, "friends.json", friends); err != nil {
+		return err
+	}
+
+	requests, err := s.accountRepo.GetFriendRequests(user.UserID)
+	if err != nil {
+		return err
+	}
+	if err := writeJSONFile(zw, "friend_requests.json", requests); err != nil {
+		return err
+	}
+
+	// 消息可能很多，分批读取并逐条写入
+	messages, err := newJSONArrayFile(zw, "messages.json")
+	if err != nil {
+		return err
+	}
+	if err := s.accountRepo.EachSentMessage(user.UserID, func(batch []model.Message) error {
+		for _, message := range batch {
+			media = append(media, message.MediaURL)
+			if err := messages.Add(message); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := messages.Close(); err != nil {
+		return err
+	}
+
+	groupMessages, err := newJSONArrayFile(zw, "group_messages.json")
+	if err != nil {
+		return err
+	}
+	if err := s.accountRepo.EachSentGroupMessage(user.UserID, func(batch []model.GroupMessage) error {
+		for _, message := range batch {
+			media = append(media, message.MediaURL)
+			if err := groupMessages.Add(message); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := groupMessages.Close(); err != nil {
+		return err
+	}
+
+	moments, err := s.accountRepo.GetMoments(user.UserID)
+	if err != nil {
+		return err
+	}
+	for _, moment := range moments {
+		media = append(media, momentImages(moment.Images)...)
+	}
+	if err := writeJSONFile(zw, "moments.json", moments); err != nil {
+		return err
+	}
+
+	likes, err := s.accountRepo.GetMomentLikes(user.UserID)
+	if err != nil {
+		return err
+	}
+	if err := writeJSONFile(zw, "moment_likes.json", likes); err != nil {
+		return err
+	}
+
+	comments, err := s.accountRepo.GetMomentComments(user.UserID)
+	if err != nil {
+		return err
+	}
+	if err := writeJSONFile(zw, "moment_comments.json", comments); err != nil {
+		return err
+	}
+
+	return writeMediaFiles(zw, media)
+}
+
+// writeJSONFile 以 JSON 格式写入一个文件
+func writeJSONFile(zw *zip.Writer, name string, v interface{}) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// jsonArrayFile 逐条写入的 JSON 数组文件
+type jsonArrayFile struct {
+	w     io.Writer
+	count int
+}
+
+func newJSONArrayFile(zw *zip.Writer, name string) (*jsonArrayFile, error) {
+	w, err := zw.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(w, "["); err != nil {
+		return nil, err
+	}
+	return &jsonArrayFile{w: w}, nil
+}
+
+// Add 写入一个元素
+func (f *jsonArrayFile) Add(v interface{}) error {
+	data, err := json.MarshalIndent(v, "  ", "  ")
+	if err != nil {
+		return err
+	}
+	sep := ",\n  "
+	if f.count == 0 {
+		sep = "\n  "
+	}
+	f.count++
+	if _, err := io.WriteString(f.w, sep); err != nil {
+		return err
+	}
+	_, err = f.w.Write(data)
+	return err
+}
+
+// Close 结束数组
+func (f *jsonArrayFile) Close() error {
+	end := "\n]\n"
+	if f.count == 0 {
+		end = "]\n"
+	}
+	_, err := io.WriteString(f.w, end)
+	return err
+}
+
+// momentImages 解析动态的图片列表（JSON 数组字符串），格式不正确时忽略
+func momentImages(images string) []string {
+	var urls []string
+	if images == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(images), &urls); err != nil {
+		return nil
+	}
+	return urls
+}
+
+// writeMediaFiles 将本地上传的媒体文件写入 media/ 目录，外部链接和已不存在的文件跳过
+func writeMediaFiles(zw *zip.Writer, mediaURLs []string) error {
+	written := make(map[string]bool)
+	for _, mediaURL := range mediaURLs {
+		path, ok := pkg.LocalMediaPath(mediaURL)
+		if !ok || written[path] {
+			continue
+		}
+		written[path] = true
+
+		name, err := filepath.Rel(config.Cfg.UploadDir, path)
+		if err != nil {
+			continue
+		}
+		if err := copyFileToZip(zw, "media/"+filepath.ToSlash(name), path); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// copyFileToZip 复制单个文件到 ZIP
+func copyFileToZip(zw *zip.Writer, name, path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, src)
+	return err
+}
+
+// cleanExpiredExports 删除已过下载期限的导出文件和记录
+func (s *AccountService) cleanExpiredExports(now time.Time) {
+	exports, err := s.accountRepo.FindExpiredExports(now, accountTaskBatchSize)
+	if err != nil {
+		log.Printf("❌ 查询过期数据导出失败: %v", err)
+		return
+	}
+	s.removeExports(exports)
+}
+
+// removeExports 删除导出文件和记录
+func (s *AccountService) removeExports(exports []model.DataExport) {
+	ids := make([]uint, 0, len(exports))
+	for _, export := range exports {
+		if export.FileName != "" {
+			if err := os.Remove(filepath.Join(exportDir(), export.FileName)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				log.Printf("⚠️ 删除导出文件 %s 失败: %v", export.FileName, err)
+				continue
+			}
+		}
+		ids = append(ids, export.ID)
+	}
+	if err := s.accountRepo.DeleteExports(ids); err != nil {
+		log.Printf("❌ 删除数据导出记录失败: %v", err)
+	}
+}
+
+// ==================== 账号注销 ====================
+
+// deletionGrace 注销冷静期，配置无效时使用默认值
+func deletionGrace() time.Duration {
+	if config.Cfg == nil {
+		return defaultDeletionGrace
+	}
+	grace, err := time.ParseDuration(strings.TrimSpace(config.Cfg.AccountDeletionGrace))
+	if err != nil || grace < 0 {
+		return defaultDeletionGrace
+	}
+	return grace
+}
+
+// RequestDeletion 申请注销账号：已设置密码时校验密码，否则校验 delete_account 用途的验证码；
+// 开启两步验证时还需要 TOTP 验证码或恢复码。密码和第二因素错误与登录共用失败计数和锁定。
+// 冷静期结束后清除数据，期间可以撤销
+func (s *AccountService) RequestDeletion(ctx context.Context, userID, password, code, twoFactorCode string, client LoginClient) (*time.Time, error) {
+	user, err := s.userRepo.FindByUserID(userID)
+	if err != nil {
+		return nil, errors.New("用户不存在")
+	}
+	if user.DeletionScheduledAt != nil {
+		return nil, errors.New("已申请注销，请勿重复提交")
+	}
+
+	if user.Password != "" {
+		if password == "" {
+			return nil, errors.New("请输入密码")
+		}
+		ok, err := s.loginGuard.CheckPassword(user, password, client)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errors.New("密码错误")
+		}
+	} else {
+		if code == "" {
+			return nil, errors.New("请输入验证码")
+		}
+		ok, err := s.codeService.ConsumeCode(user.Email, CodePurposeDelete, code)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errors.New("验证码错误或已过期")
+		}
+	}
+	if user.TwoFactorEnabled {
+		if err := s.twoFactorService.guardedVerify(user, twoFactorCode, "", client); err != nil {
+			return nil, err
+		}
+	}
+
+	at := time.Now().Add(deletionGrace())
+	if err := s.accountRepo.ScheduleDeletion(user.UserID, &at); err != nil {
+		return nil, err
+	}
+
+	go s.notifyDeletion(user.Email, at)
+	log.Printf("🗓️ 用户 %s 申请注销，计划于 %s 清除数据", user.UserID, at.Format(time.RFC3339))
+	return &at, nil
+}
+
+// CancelDeletion 冷静期内撤销注销
+func (s *AccountService) CancelDeletion(ctx context.Context, userID string) error {
+	user, err := s.userRepo.FindByUserID(userID)
+	if err != nil {
+		return errors.New("用户不存在")
+	}
+	if user.DeletionScheduledAt == nil {
+		return errors.New("未申请注销")
+	}
+	if err := s.accountRepo.ScheduleDeletion(user.UserID, nil); err != nil {
+		return err
+	}
+	log.Printf("↩️ 用户 %s 已撤销注销", user.UserID)
+	return nil
+}
+
+// notifyDeletion 邮件通知用户已申请注销
+func (s *AccountService) notifyDeletion(email string, at time.Time) {
+	subject := "IM 系统账号注销申请"
+	body := fmt.Sprintf("您的账号已申请注销，将于 %s 清除全部数据，之后无法恢复。在此之前登录后可以撤销注销。如非本人操作，请立即登录撤销并修改密码。",
+		at.Format("2006-01-02 15:04:05"))
+	if err := pkg.SendEmail(email, subject, body); err != nil {
+		log.Printf("⚠️ 发送注销通知失败: %v", err)
+	}
+}
+
+// purgeDueAccounts 清除冷静期已结束的账号，租约过期仍未完成的清除重新执行（各步骤可重复执行）
+func (s *AccountService) purgeDueAccounts(now time.Time) {
+	users, err := s.accountRepo.FindDueDeletions(now, now.Add(-accountTaskLease), accountTaskBatchSize)
+	if err != nil {
+		log.Printf("❌ 查询待注销账号失败: %v", err)
+		return
+	}
+
+	for i := range users {
+		ok, err := s.accountRepo.ClaimDeletion(users[i].UserID, now, now.Add(-accountTaskLease))
+		if err != nil {
+			log.Printf("❌ 抢占待注销账号 %s 失败: %v", users[i].UserID, err)
+			continue
+		}
+		if !ok {
+			// 已撤销或被其他实例处理
+			continue
+		}
+		s.purgeAccount(&users[i])
+	}
+}
+
+// purgeAccount 清除账号数据：注销全部会话并断开连接，退出群组，删除好友、动态、点赞和评论，
+// 删除其他个人数据后匿名化用户资料。发送过的消息保留给对方，发送者显示为已注销用户（原因见 AnonymizeUser）
+// 失败时保留计划清除时间，租约过期后由后台任务重试
+func (s *AccountService) purgeAccount(user *model.User) {
+	userID := user.UserID
+
+	if err := pkg.RevokeUserTokens(userID, "", s.rdb); err != nil {
+		log.Printf("⚠️ 注销用户 %s 的会话失败: %v", userID, err)
+	}
+	if pkg.GlobalHub != nil {
+		pkg.GlobalHub.DisconnectUser(userID)
+	}
+
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"退出群组", func() error { return s.groupService.LeaveAllGroups(userID) }},
+		{"删除好友", func() error { return s.removeFriends(userID) }},
+		{"删除动态", func() error { return s.removeMoments(userID) }},
+		{"删除点赞和评论", func() error { return s.removeInteractions(userID) }},
+		{"删除个人数据", func() error { return s.accountRepo.PurgeUserData(userID, time.Now()) }},
+		{"删除数据导出", func() error { return s.removeUserExports(userID) }},
+		{"匿名化资料", func() error { return s.accountRepo.AnonymizeUser(user) }},
+	}
+	for _, step := range steps {
+		if err := step.run(); err != nil {
+			log.Printf("❌ 注销用户 %s 时%s失败: %v", userID, step.name, err)
+			return
+		}
+	}
+
+	if err := pkg.RemoveMediaFile(user.Avatar); err != nil {
+		log.Printf("⚠️ 删除头像文件失败 %s: %v", user.Avatar, err)
+	}
+	ctx := context.Background()
+	s.rdb.Del(ctx, TimelinePrefix+userID, RecommendPrefix+userID, EmailChangePrefix+userID, TwoFactorSetupPrefix+userID)
+
+	log.Printf("🗑️ 用户 %s 的账号已注销", userID)
+}
+
+// removeFriends 解除全部好友关系
+func (s *AccountService) removeFriends(userID string) error {
+	friendIDs, err := s.friendRepo.GetFriendIDs(userID)
+	if err != nil {
+		return err
+	}
+	for _, friendID := range friendIDs {
+		if err := s.friendService.DeleteFriend(userID, friendID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeMoments 删除发布的全部动态及图片
+func (s *AccountService) removeMoments(userID string) error {
+	moments, err := s.accountRepo.GetMoments(userID)
+	if err != nil {
+		return err
+	}
+	for _, moment := range moments {
+		if err := s.momentService.DeleteMoment(moment.ID, userID); err != nil {
+			return err
+		}
+		for _, image := range momentImages(moment.Images) {
+			if err := pkg.RemoveMediaFile(image); err != nil {
+				log.Printf("⚠️ 删除动态图片失败 %s: %v", image, err)
+			}
+		}
+	}
+	return nil
+}
+
+// removeInteractions 取消全部点赞，删除全部评论
+func (s *AccountService) removeInteractions(userID string) error {
+	likes, err := s.accountRepo.GetMomentLikes(userID)
+	if err != nil {
+		return err
+	}
+	for _, like := range likes {
+		if err := s.momentService.UnlikeMoment(like.MomentID, userID); err != nil {
+			return err
+		}
+	}
+
+	commentIDs, err := s.accountRepo.GetLikedCommentIDs(userID)
+	if err != nil {
+		return err
+	}
+	for _, commentID := range commentIDs {
+		if err := s.momentService.UnlikeComment(commentID, userID); err != nil {
+			return err
+		}
+	}
+
+	comments, err := s.accountRepo.GetMomentComments(userID)
+	if err != nil {
+		return err
+	}
+	for _, comment := range comments {
+		if err := s.momentService.DeleteComment(comment.ID, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeUserExports 删除用户的全部导出文件
+func (s *AccountService) removeUserExports(userID string) error {
+	exports, err := s.accountRepo.GetUserExports(userID)
+	if err != nil {
+		return err
+	}
+	s.removeExports(exports)
+	return nil
+}
+
+// ==================== 后台任务 ====================
+
+// Run 定时生成数据导出、清理过期导出文件、清除到期的注销账号（阻塞运行，需在goroutine中调用）
+// 任务按租约抢占，异常退出或失败遗留的任务在租约过期后由任一实例的下一轮重试
+func (s *AccountService) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.RunOnce(time.Now())
+	}
+}
+
+// RunOnce 执行一轮后台任务
+func (s *AccountService) RunOnce(now time.Time) {
+	s.processExports(now)
+	s.cleanExpiredExports(now)
+	s.purgeDueAccounts(now)
+}
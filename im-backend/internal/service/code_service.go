@@ -2,15 +2,55 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"errors"
 	"fmt"
 	"im-backend/internal/pkg"
-	"math/rand"
+	"math/big"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
-const CodePrefix = "verify_code:"
+const (
+	CodePrefix         = "verify_code:"          // 验证码，键为 前缀+用途+":"+邮箱
+	CodeCooldownPrefix = "verify_code_cooldown:" // 同一邮箱的重发冷却
+)
+
+// 验证码用途，不同用途的验证码互相独立，不能混用
+const (
+	CodePurposeRegister    = "register"
+	CodePurposeLogin       = "login"
+	CodePurposeReset       = "reset_password"
+	CodePurposeChangeEmail = "change_email"
+	CodePurposeDelete      = "delete_account"
+)
+
+// 验证码限制
+const (
+	codeTTL         = 5 * time.Minute // 有效期
+	codeCooldown    = time.Minute     // 同一邮箱两次发送的最小间隔
+	codeMaxAttempts = 5               // 允许的错误次数，达到后验证码作废
+)
+
+// codeCheckScript 校验验证码：正确时按需删除（一次性使用），错误时累计次数，达到上限后作废
+// 返回 1-正确，0-错误，-1-不存在或已作废
+var codeCheckScript = redis.NewScript(`
+local stored = redis.call('HGET', KEYS[1], 'code')
+if not stored then
+	return -1
+end
+if stored == ARGV[1] then
+	if ARGV[2] == '1' then
+		redis.call('DEL', KEYS[1])
+	end
+	return 1
+end
+if redis.call('HINCRBY', KEYS[1], 'attempts', 1) >= tonumber(ARGV[3]) then
+	redis.call('DEL', KEYS[1])
+end
+return 0
+`)
 
 type CodeService struct{}
 
@@ -18,31 +58,95 @@ func NewCodeService() *CodeService {
 	return &CodeService{}
 }
 
-// SendCode 生成验证码并发送邮件
-func (s *CodeService) SendCode(email string) error {
-	code := fmt.Sprintf("%06d", rand.Intn(1000000))
+// ValidCodePurpose 判断验证码用途是否有效
+func ValidCodePurpose(purpose string) bool {
+	switch purpose {
+	case CodePurposeRegister, CodePurposeLogin, CodePurposeReset, CodePurposeChangeEmail, CodePurposeDelete:
+		return true
+	}
+	return false
+}
 
-	// 保存到 Redis，过期 5 分钟
+// SendCode 生成指定用途的验证码并发送邮件
+func (s *CodeService) SendCode(email, purpose string) error {
+	if !ValidCodePurpose(purpose) {
+		return errors.New("无效的验证码用途")
+	}
+
+	// 同一邮箱在冷却时间内不能重复发送
 	ctx := context.Background()
-	if err := pkg.RDB.Set(ctx, CodePrefix+email, code, 5*time.Minute).Err(); err != nil {
+	ok, err := pkg.RDB.SetNX(ctx, CodeCooldownPrefix+email, 1, codeCooldown).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		ttl, _ := pkg.RDB.TTL(ctx, CodeCooldownPrefix+email).Result()
+		if ttl < time.Second {
+			ttl = time.Second
+		}
+		return fmt.Errorf("发送过于频繁，请在%d秒后重试", int(ttl.Seconds()))
+	}
+
+	code, err := generateCode()
+	if err != nil {
+		pkg.RDB.Del(ctx, CodeCooldownPrefix+email)
+		return err
+	}
+
+	// 保存到 Redis，重新发送会覆盖旧验证码并重置错误次数
+	key := CodePrefix + purpose + ":" + email
+	pipe := pkg.RDB.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.HSet(ctx, key, "code", code, "attempts", 0)
+	pipe.Expire(ctx, key, codeTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		pkg.RDB.Del(ctx, CodeCooldownPrefix+email)
 		return err
 	}
 
-	// 发送邮件
+	// 发送邮件，失败时作废验证码并解除冷却，用户可以立即重试
 	subject := "IM 系统验证码"
-	body := fmt.Sprintf("您的验证码是：%s，5分钟内有效。", code)
-	return pkg.SendEmail(email, subject, body)
+	body := fmt.Sprintf("您的验证码是：%s，%d分钟内有效。", code, int(codeTTL.Minutes()))
+	if err := pkg.SendEmail(email, subject, body); err != nil {
+		pkg.RDB.Del(ctx, key, CodeCooldownPrefix+email)
+		return err
+	}
+	return nil
 }
 
-// VerifyCode 校验验证码
-func (s *CodeService) VerifyCode(email, code string) (bool, error) {
-	ctx := context.Background()
-	val, err := pkg.RDB.Get(ctx, CodePrefix+email).Result()
-	if err == redis.Nil {
-		// Redis 没有值（过期或者没发送过）
+// VerifyCode 校验验证码但不消耗（用于提交前的预校验）
+func (s *CodeService) VerifyCode(email, purpose, code string) (bool, error) {
+	return s.checkCode(email, purpose, code, false)
+}
+
+// ConsumeCode 校验验证码，正确时立即作废，保证一次性使用
+func (s *CodeService) ConsumeCode(email, purpose, code string) (bool, error) {
+	return s.checkCode(email, purpose, code, true)
+}
+
+// checkCode 校验验证码，错误次数达到上限后验证码作废
+func (s *CodeService) checkCode(email, purpose, code string, consume bool) (bool, error) {
+	if !ValidCodePurpose(purpose) || code == "" {
 		return false, nil
-	} else if err != nil {
+	}
+
+	consumeFlag := "0"
+	if consume {
+		consumeFlag = "1"
+	}
+	result, err := codeCheckScript.Run(context.Background(), pkg.RDB,
+		[]string{CodePrefix + purpose + ":" + email}, code, consumeFlag, codeMaxAttempts).Int()
+	if err != nil {
 		return false, err
 	}
-	return val == code, nil
+	return result == 1, nil
+}
+
+// generateCode 使用密码学安全的随机数生成6位验证码
+func generateCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
 }
@@ -1,27 +1,52 @@
 package service
 
 import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"im-backend/internal/model"
 	"im-backend/internal/pkg"
 	"im-backend/internal/repository"
+	"log"
+	"sort"
+	"strings"
 	"time"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 type FriendService struct {
 	friendRepo *repository.FriendRepository
+	groupRepo  *repository.GroupRepository
 	userRepo   *repository.UserRepository
+	timeline   *MomentTimeline
 }
 
-func NewFriendService(friendRepo *repository.FriendRepository, userRepo *repository.UserRepository) *FriendService {
+func NewFriendService(friendRepo *repository.FriendRepository, groupRepo *repository.GroupRepository, userRepo *repository.UserRepository, timeline *MomentTimeline) *FriendService {
 	return &FriendService{
 		friendRepo: friendRepo,
+		groupRepo:  groupRepo,
 		userRepo:   userRepo,
+		timeline:   timeline,
 	}
 }
 
-// SendFriendRequest 发送好友请求
-func (s *FriendService) SendFriendRequest(fromUserID, toUserID, message string) error {
+// SendFriendRequest 发送好友请求，按对方的隐私设置校验能否添加，设置了验证问题时需要回答
+func (s *FriendService) SendFriendRequest(fromUserID, toUserID, message, answer string) error {
+	return s.sendFriendRequest(fromUserID, toUserID, message, answer, false)
+}
+
+// SendFriendRequestByInvite 通过好友名片发送好友请求
+// 名片由对方主动分享，不受搜索、同群添加和验证问题的隐私限制
+func (s *FriendService) SendFriendRequestByInvite(fromUserID, toUserID, message string) error {
+	return s.sendFriendRequest(fromUserID, toUserID, message, "", true)
+}
+
+func (s *FriendService) sendFriendRequest(fromUserID, toUserID, message, answer string, byInvite bool) error {
 	// 不能添加自己为好友
 	if fromUserID == toUserID {
 		return errors.New("不能添加自己为好友")
@@ -33,6 +58,21 @@ func (s *FriendService) SendFriendRequest(fromUserID, toUserID, message string)
 		return errors.New("目标用户不存在")
 	}
 
+	// 自己拉黑了对方，需先移出黑名单
+	blocking, err := s.friendRepo.IsBlocked(fromUserID, toUserID)
+	if err != nil {
+		return err
+	}
+	if blocking {
+		return errors.New("对方在您的黑名单中，请先移出黑名单")
+	}
+
+	// 被对方拉黑时照常返回成功，但请求不会出现在对方的列表中，也不会推送通知
+	blockedBy, err := s.friendRepo.IsBlocked(toUserID, fromUserID)
+	if err != nil {
+		return err
+	}
+
 	// 检查是否已经是好友
 	isFriend, err := s.friendRepo.IsFriend(fromUserID, toUserID)
 	if err != nil {
@@ -50,7 +90,7 @@ func (s *FriendService) SendFriendRequest(fromUserID, toUserID, message string)
 
 	// 检查是否存在反向待处理请求：若存在则直接建立关系并更新该请求为已同意
 	reverseReq, _ := s.friendRepo.FindPendingRequest(toUserID, fromUserID)
-	if reverseReq != nil {
+	if reverseReq != nil && !blockedBy {
 		// 将反向请求置为已同意
 		if err := s.friendRepo.UpdateFriendRequestStatus(reverseReq.ID, 1); err != nil {
 			return err
@@ -76,7 +116,11 @@ func (s *FriendService) SendFriendRequest(fromUserID, toUserID, message string)
 			}
 		}
 
-		// 通过WebSocket通知双方（按Email标识）
+		s.invalidateRecommendations(fromUserID, toUserID)
+		// 新好友的历史动态需要补入时间线，下次读取时重建
+		s.timeline.Invalidate(fromUserID, toUserID)
+
+		// 通过WebSocket通知双方（按用户ID标识）
 		if pkg.GlobalHub != nil {
 			fromUser, _ := s.userRepo.FindByUserID(fromUserID)
 			toUserFull, _ := s.userRepo.FindByUserID(toUserID)
@@ -91,7 +135,7 @@ func (s *FriendService) SendFriendRequest(fromUserID, toUserID, message string)
 						"email":    fromUser.Email,
 					},
 				}
-				pkg.GlobalHub.SendFriendAccepted(toUserFull.Email, acceptNotification)
+				pkg.GlobalHub.SendFriendAccepted(toUserFull.UserID, acceptNotification)
 
 				// 通知当前发起者（fromUserID）：双方已成为好友
 				mutualNotification := map[string]interface{}{
@@ -102,12 +146,19 @@ func (s *FriendService) SendFriendRequest(fromUserID, toUserID, message string)
 						"email":    toUserFull.Email,
 					},
 				}
-				pkg.GlobalHub.SendFriendAccepted(fromUser.Email, mutualNotification)
+				pkg.GlobalHub.SendFriendAccepted(fromUser.UserID, mutualNotification)
 			}
 		}
 		return nil
 	}
 
+	// 对方已向自己发出请求时上面直接成为好友，这里只校验新发起的请求
+	if !byInvite {
+		if err := s.checkRequestPrivacy(fromUserID, toUserID, answer); err != nil {
+			return err
+		}
+	}
+
 	// 创建好友请求（无反向待处理时）
 	req := &model.FriendRequest{
 		FromUserID: fromUserID,
@@ -120,9 +171,10 @@ func (s *FriendService) SendFriendRequest(fromUserID, toUserID, message string)
 	if err := s.friendRepo.CreateFriendRequest(req); err != nil {
 		return err
 	}
+	s.invalidateRecommendations(fromUserID, toUserID)
 
-	// 通过WebSocket推送通知给接收方（按Email标识）
-	if pkg.GlobalHub != nil {
+	// 通过WebSocket推送通知给接收方（按用户ID标识）
+	if pkg.GlobalHub != nil && !blockedBy {
 		fromUser, _ := s.userRepo.FindByUserID(fromUserID)
 		toUserFull, _ := s.userRepo.FindByUserID(toUserID)
 		if fromUser != nil && toUserFull != nil {
@@ -140,13 +192,104 @@ func (s *FriendService) SendFriendRequest(fromUserID, toUserID, message string)
 					"email":    fromUser.Email,
 				},
 			}
-			pkg.GlobalHub.SendFriendRequest(toUserFull.Email, notificationData)
+			pkg.GlobalHub.SendFriendRequest(toUserFull.UserID, notificationData)
+		}
+	}
+
+	return nil
+}
+
+// 好友验证问题答错次数限制：同一请求方对同一用户24小时内最多答错5次
+const (
+	FriendAnswerFailPrefix  = "friend_answer_fail:" // 答错次数，键为 前缀+请求方+":"+对方
+	friendAnswerMaxFailures = 5
+	friendAnswerFailWindow  = 24 * time.Hour
+)
+
+// checkRequestPrivacy 按对方的隐私设置校验陌生人能否发起好友请求，各项设置分别生效：
+// 与对方同群时需要对方允许同群陌生人添加；不同群时需要对方允许被搜索到（用户ID或邮箱）。
+// 对方设置了验证问题时答案必须正确
+func (s *FriendService) checkRequestPrivacy(fromUserID, toUserID, answer string) error {
+	privacy, err := s.userRepo.GetPrivacy(toUserID)
+	if err != nil {
+		return err
+	}
+
+	sharedGroup, err := s.groupRepo.HasSharedGroup(fromUserID, toUserID)
+	if err != nil {
+		return err
+	}
+	if !canAddStranger(*privacy, sharedGroup) {
+		return errors.New("对方设置了隐私，无法添加好友")
+	}
+
+	if privacy.FriendQuestion != "" {
+		if strings.TrimSpace(answer) == "" {
+			return fmt.Errorf("请回答对方设置的问题：%s", privacy.FriendQuestion)
 		}
+		return checkFriendAnswerLimited(fromUserID, toUserID, answer, privacy.FriendAnswerHash)
+	}
+	return nil
+}
+
+// canAddStranger 陌生人能否按隐私设置添加该用户：同群时看是否允许同群陌生人添加，否则看是否允许被搜索到
+func canAddStranger(privacy model.UserPrivacy, sharedGroup bool) bool {
+	if sharedGroup {
+		return privacy.AllowGroupStrangers
+	}
+	return privacy.SearchByID || privacy.SearchByEmail
+}
+
+// checkFriendAnswerLimited 校验验证问题答案并限制答错次数，防止穷举答案
+// 先计数再比对，并发请求也不会超过上限；答对后清零
+func checkFriendAnswerLimited(fromUserID, toUserID, answer, hash string) error {
+	ctx := context.Background()
+	key := FriendAnswerFailPrefix + fromUserID + ":" + toUserID
+
+	pipe := pkg.RDB.TxPipeline()
+	attempts := pipe.Incr(ctx, key)
+	pipe.ExpireNX(ctx, key, friendAnswerFailWindow)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	if attempts.Val() > friendAnswerMaxFailures {
+		return errors.New("答错次数过多，请明天再试")
 	}
 
+	if !checkFriendAnswer(answer, hash) {
+		return errors.New("问题答案不正确")
+	}
+	if err := pkg.RDB.Del(ctx, key).Err(); err != nil {
+		log.Printf("⚠️ 清除验证问题答错次数失败: %v", err)
+	}
 	return nil
 }
 
+// normalizeFriendAnswer 忽略大小写和首尾空格后取 SHA-256
+// bcrypt 只使用前72字节，中文答案可能超出，所以先摘要成固定长度再交给 bcrypt
+func normalizeFriendAnswer(answer string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(answer))))
+	return hex.EncodeToString(sum[:])
+}
+
+// hashFriendAnswer 好友验证问题答案的 bcrypt 哈希
+func hashFriendAnswer(answer string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(normalizeFriendAnswer(answer)), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// checkFriendAnswer 比对答案，兼容旧版本保存的未加盐 SHA-256 哈希（答案重新设置后即换成 bcrypt）
+func checkFriendAnswer(answer, hash string) bool {
+	digest := normalizeFriendAnswer(answer)
+	if strings.HasPrefix(hash, "$2") {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(digest)) == nil
+	}
+	return subtle.ConstantTimeCompare([]byte(digest), []byte(hash)) == 1
+}
+
 // AcceptFriendRequest 接受好友请求
 func (s *FriendService) AcceptFriendRequest(requestID uint, userID string) error {
 	// 查询好友请求
@@ -202,7 +345,11 @@ func (s *FriendService) AcceptFriendRequest(requestID uint, userID string) error
 		}
 	}
 
-	// 通过WebSocket通知发送方请求已被接受（按Email标识）
+	s.invalidateRecommendations(req.FromUserID, req.ToUserID)
+	// 新好友的历史动态需要补入时间线，下次读取时重建
+	s.timeline.Invalidate(req.FromUserID, req.ToUserID)
+
+	// 通过WebSocket通知发送方请求已被接受（按用户ID标识）
 	if pkg.GlobalHub != nil {
 		acceptUser, _ := s.userRepo.FindByUserID(userID)
 		fromUser, _ := s.userRepo.FindByUserID(req.FromUserID)
@@ -216,7 +363,7 @@ func (s *FriendService) AcceptFriendRequest(requestID uint, userID string) error
 					"email":    acceptUser.Email,
 				},
 			}
-			pkg.GlobalHub.SendFriendAccepted(fromUser.Email, notificationData)
+			pkg.GlobalHub.SendFriendAccepted(fromUser.UserID, notificationData)
 		}
 	}
 
@@ -245,9 +392,16 @@ func (s *FriendService) RejectFriendRequest(requestID uint, userID string) error
 	return s.friendRepo.UpdateFriendRequestStatus(requestID, 2)
 }
 
-// GetFriendList 获取好友列表
-func (s *FriendService) GetFriendList(userID string) ([]model.Friend, error) {
-	return s.friendRepo.GetFriendList(userID)
+// GetFriendList 获取好友列表（tagID 不为0时只返回该标签下的好友）
+func (s *FriendService) GetFriendList(userID string, tagID uint) ([]model.Friend, error) {
+	if tagID == 0 {
+		return s.friendRepo.GetFriendList(userID)
+	}
+
+	if _, err := s.getOwnTag(tagID, userID); err != nil {
+		return nil, err
+	}
+	return s.friendRepo.GetFriendListByTag(userID, tagID)
 }
 
 // DeleteFriend 删除好友
@@ -269,6 +423,18 @@ func (s *FriendService) DeleteFriend(userID, friendID string) error {
 		return err
 	}
 
+	// 从双方的标签中移除
+	if err := s.friendRepo.RemoveFriendFromTags(userID, friendID); err != nil {
+		return err
+	}
+	if err := s.friendRepo.RemoveFriendFromTags(friendID, userID); err != nil {
+		return err
+	}
+
+	s.invalidateRecommendations(userID, friendID)
+	s.timeline.RemoveAuthor(userID, friendID)
+	s.timeline.RemoveAuthor(friendID, userID)
+
 	return nil
 }
 
@@ -296,11 +462,400 @@ func (s *FriendService) GetSentRequests(userID string, status int) ([]model.Frie
 	return s.friendRepo.GetSentRequests(userID, status)
 }
 
-// SearchFriend 搜索好友（根据用户ID或昵称）
-func (s *FriendService) SearchFriend(userID string) (*model.User, error) {
-	user, err := s.userRepo.FindByUserID(userID)
+// SearchFriend 按用户ID或邮箱搜索用户（二选一），对方在隐私设置中关闭对应的搜索方式时视为不存在
+// 好友之间始终可以搜索到；结果只包含公开资料和对方的好友验证问题
+func (s *FriendService) SearchFriend(viewerID, userID, email string) (*model.UserSearchResult, error) {
+	var user *model.User
+	var err error
+	if email != "" {
+		user, err = s.userRepo.FindByEmail(email)
+	} else {
+		user, err = s.userRepo.FindByUserID(userID)
+	}
 	if err != nil {
 		return nil, errors.New("用户不存在")
 	}
-	return user, nil
+	if user.UserID == viewerID {
+		return &model.UserSearchResult{PublicUser: *user.Public()}, nil
+	}
+
+	privacy, err := s.userRepo.GetPrivacy(user.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if (email != "" && !privacy.SearchByEmail) || (email == "" && !privacy.SearchByID) {
+		isFriend, err := s.friendRepo.IsFriend(viewerID, user.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if !isFriend {
+			return nil, errors.New("用户不存在")
+		}
+	}
+
+	return &model.UserSearchResult{
+		PublicUser:     *user.Public(),
+		FriendQuestion: privacy.FriendQuestion,
+	}, nil
+}
+
+// ==================== 好友推荐 ====================
+
+const (
+	RecommendPrefix     = "friend_recommend:"
+	recommendCacheTTL   = 30 * time.Minute
+	recommendCandidates = 200 // 每类关系最多统计的候选人数
+	maxRecommendations  = 50  // 缓存的推荐结果数量上限
+)
+
+// GetRecommendations 获取可能认识的人
+// 按共同好友数、共同群组数排序，排除好友、自己、拉黑关系和待处理请求的用户，结果按用户缓存
+func (s *FriendService) GetRecommendations(userID string, limit int) ([]model.FriendRecommendation, error) {
+	if limit <= 0 || limit > maxRecommendations {
+		limit = 20
+	}
+
+	recommendations, err := s.loadCachedRecommendations(userID)
+	if err != nil {
+		recommendations, err = s.buildRecommendations(userID)
+		if err != nil {
+			return nil, err
+		}
+		s.cacheRecommendations(userID, recommendations)
+	}
+
+	if len(recommendations) > limit {
+		recommendations = recommendations[:limit]
+	}
+	return recommendations, nil
+}
+
+// buildRecommendations 从数据库计算推荐结果
+func (s *FriendService) buildRecommendations(userID string) ([]model.FriendRecommendation, error) {
+	mutualCounts, err := s.friendRepo.GetMutualFriendCounts(userID, recommendCandidates)
+	if err != nil {
+		return nil, err
+	}
+	groupCounts, err := s.groupRepo.GetSharedGroupCounts(userID, recommendCandidates)
+	if err != nil {
+		return nil, err
+	}
+
+	// 好友、拉黑关系和待处理请求的用户已在查询中排除
+	candidates := make(map[string]*model.FriendRecommendation)
+	for id, count := range mutualCounts {
+		candidates[id] = &model.FriendRecommendation{UserID: id, MutualFriends: count}
+	}
+	for id, count := range groupCounts {
+		if candidate, ok := candidates[id]; ok {
+			candidate.SharedGroups = count
+		} else {
+			candidates[id] = &model.FriendRecommendation{UserID: id, SharedGroups: count}
+		}
+	}
+
+	// 不推荐按隐私设置无法添加的用户，规则与发起好友请求时一致
+	candidateIDs := make([]string, 0, len(candidates))
+	for id := range candidates {
+		candidateIDs = append(candidateIDs, id)
+	}
+	privacies, err := s.userRepo.GetPrivacies(candidateIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	recommendations := make([]model.FriendRecommendation, 0, len(candidates))
+	for id, candidate := range candidates {
+		if !canAddStranger(privacies[id], candidate.SharedGroups > 0) {
+			continue
+		}
+		recommendations = append(recommendations, *candidate)
+	}
+	sort.Slice(recommendations, func(i, j int) bool {
+		a, b := recommendations[i], recommendations[j]
+		if a.MutualFriends != b.MutualFriends {
+			return a.MutualFriends > b.MutualFriends
+		}
+		if a.SharedGroups != b.SharedGroups {
+			return a.SharedGroups > b.SharedGroups
+		}
+		return a.UserID < b.UserID
+	})
+	if len(recommendations) > maxRecommendations {
+		recommendations = recommendations[:maxRecommendations]
+	}
+
+	// 补充用户资料
+	ids := make([]string, 0, len(recommendations))
+	for _, recommendation := range recommendations {
+		ids = append(ids, recommendation.UserID)
+	}
+	users, err := s.userRepo.FindByUserIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	userMap := make(map[string]*model.User, len(users))
+	for i := range users {
+		userMap[users[i].UserID] = &users[i]
+	}
+
+	result := recommendations[:0]
+	for _, recommendation := range recommendations {
+		if user, ok := userMap[recommendation.UserID]; ok {
+			recommendation.User = user.Public()
+			result = append(result, recommendation)
+		}
+	}
+	return result, nil
+}
+
+// loadCachedRecommendations 读取缓存的推荐结果
+func (s *FriendService) loadCachedRecommendations(userID string) ([]model.FriendRecommendation, error) {
+	data, err := pkg.RDB.Get(context.Background(), RecommendPrefix+userID).Bytes()
+	if err != nil {
+		return nil, err
+	}
+	var recommendations []model.FriendRecommendation
+	if err := json.Unmarshal(data, &recommendations); err != nil {
+		return nil, err
+	}
+	return recommendations, nil
+}
+
+// cacheRecommendations 缓存推荐结果，失败只记录日志
+func (s *FriendService) cacheRecommendations(userID string, recommendations []model.FriendRecommendation) {
+	data, err := json.Marshal(recommendations)
+	if err != nil {
+		return
+	}
+	if err := pkg.RDB.Set(context.Background(), RecommendPrefix+userID, data, recommendCacheTTL).Err(); err != nil {
+		log.Printf("⚠️ 缓存好友推荐失败: %v", err)
+	}
+}
+
+// invalidateRecommendations 好友关系变化后清除相关用户的推荐缓存
+func (s *FriendService) invalidateRecommendations(userIDs ...string) {
+	keys := make([]string, 0, len(userIDs))
+	for _, userID := range userIDs {
+		keys = append(keys, RecommendPrefix+userID)
+	}
+	if err := pkg.RDB.Del(context.Background(), keys...).Err(); err != nil {
+		log.Printf("⚠️ 清除好友推荐缓存失败: %v", err)
+	}
+}
+
+// BlockUser 拉黑用户
+func (s *FriendService) BlockUser(userID, targetID string) error {
+	if userID == targetID {
+		return errors.New("不能拉黑自己")
+	}
+
+	// 检查目标用户是否存在
+	target, err := s.userRepo.FindByUserID(targetID)
+	if err != nil || target == nil {
+		return errors.New("目标用户不存在")
+	}
+
+	blocked, err := s.friendRepo.IsBlocked(userID, targetID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return errors.New("该用户已在黑名单中")
+	}
+
+	block := &model.UserBlock{
+		UserID:        userID,
+		BlockedUserID: targetID,
+		CreatedAt:     time.Now(),
+	}
+	if err := s.friendRepo.CreateBlock(block); err != nil {
+		return err
+	}
+	s.invalidateRecommendations(userID, targetID)
+	s.timeline.RemoveAuthor(userID, targetID)
+	s.timeline.RemoveAuthor(targetID, userID)
+	return nil
+}
+
+// UnblockUser 取消拉黑
+func (s *FriendService) UnblockUser(userID, targetID string) error {
+	blocked, err := s.friendRepo.IsBlocked(userID, targetID)
+	if err != nil {
+		return err
+	}
+	if !blocked {
+		return errors.New("该用户不在黑名单中")
+	}
+
+	if err := s.friendRepo.DeleteBlock(userID, targetID); err != nil {
+		return err
+	}
+	s.invalidateRecommendations(userID, targetID)
+	s.timeline.Invalidate(userID, targetID)
+	return nil
+}
+
+// GetBlockList 获取黑名单列表
+func (s *FriendService) GetBlockList(userID string) ([]model.UserBlock, error) {
+	return s.friendRepo.GetBlockList(userID)
+}
+
+// ==================== 好友标签 ====================
+
+// maxTagNameLength 标签名称最大长度（字符数）
+const maxTagNameLength = 30
+
+// CreateTag 创建好友标签，可同时指定标签成员
+func (s *FriendService) CreateTag(userID, name string, friendIDs []string) (*model.FriendTag, error) {
+	name, err := s.validateTagName(userID, name, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := s.filterTagMembers(userID, friendIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	tag := &model.FriendTag{
+		UserID:    userID,
+		Name:      name,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.friendRepo.CreateTag(tag); err != nil {
+		return nil, err
+	}
+	if err := s.friendRepo.SetTagMembers(tag.ID, userID, members); err != nil {
+		return nil, err
+	}
+
+	return s.friendRepo.FindTagByID(tag.ID)
+}
+
+// GetTags 获取用户的全部好友标签
+func (s *FriendService) GetTags(userID string) ([]model.FriendTag, error) {
+	return s.friendRepo.GetTags(userID)
+}
+
+// UpdateTag 修改标签名称和成员
+// name 为空表示不修改名称，friendIDs 为 nil 表示不修改成员
+func (s *FriendService) UpdateTag(tagID uint, userID, name string, friendIDs []string) (*model.FriendTag, error) {
+	if _, err := s.getOwnTag(tagID, userID); err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(name) != "" {
+		validName, err := s.validateTagName(userID, name, tagID)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.friendRepo.UpdateTagName(tagID, validName); err != nil {
+			return nil, err
+		}
+	}
+
+	if friendIDs != nil {
+		members, err := s.filterTagMembers(userID, friendIDs)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.friendRepo.SetTagMembers(tagID, userID, members); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.friendRepo.FindTagByID(tagID)
+}
+
+// DeleteTag 删除标签（不影响好友关系）
+func (s *FriendService) DeleteTag(tagID uint, userID string) error {
+	if _, err := s.getOwnTag(tagID, userID); err != nil {
+		return err
+	}
+	return s.friendRepo.DeleteTag(tagID)
+}
+
+// ResolveAudience 将显式指定的用户ID与标签展开为去重后的好友ID列表
+// 标签必须属于当前用户，结果只包含当前用户的好友
+func (s *FriendService) ResolveAudience(userID string, userIDs []string, tagIDs []uint) ([]string, error) {
+	return resolveAudience(s.friendRepo, userID, userIDs, tagIDs)
+}
+
+// resolveAudience 按标签选择受众的通用实现，供好友、群组、动态等服务复用
+func resolveAudience(friendRepo *repository.FriendRepository, userID string, userIDs []string, tagIDs []uint) ([]string, error) {
+	for _, tagID := range tagIDs {
+		tag, err := friendRepo.FindTagByID(tagID)
+		if err != nil || tag.UserID != userID {
+			return nil, errors.New("标签不存在")
+		}
+	}
+
+	tagFriendIDs, err := friendRepo.GetTagFriendIDs(userID, tagIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	candidates := make([]string, 0, len(userIDs)+len(tagFriendIDs))
+	for _, id := range append(append([]string{}, userIDs...), tagFriendIDs...) {
+		if id == "" || id == userID || seen[id] {
+			continue
+		}
+		seen[id] = true
+		candidates = append(candidates, id)
+	}
+
+	return friendRepo.FilterFriendIDs(userID, candidates)
+}
+
+// getOwnTag 获取属于当前用户的标签
+func (s *FriendService) getOwnTag(tagID uint, userID string) (*model.FriendTag, error) {
+	tag, err := s.friendRepo.FindTagByID(tagID)
+	if err != nil || tag.UserID != userID {
+		return nil, errors.New("标签不存在")
+	}
+	return tag, nil
+}
+
+// validateTagName 校验标签名称（同一用户下不可重名）
+func (s *FriendService) validateTagName(userID, name string, excludeID uint) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("标签名称不能为空")
+	}
+	if len([]rune(name)) > maxTagNameLength {
+		return "", errors.New("标签名称不能超过30个字符")
+	}
+	if existing, err := s.friendRepo.FindTagByName(userID, name); err == nil && existing.ID != excludeID {
+		return "", errors.New("标签名称已存在")
+	}
+	return name, nil
+}
+
+// filterTagMembers 校验标签成员必须都是好友
+func (s *FriendService) filterTagMembers(userID string, friendIDs []string) ([]string, error) {
+	if len(friendIDs) == 0 {
+		return nil, nil
+	}
+
+	unique := make([]string, 0, len(friendIDs))
+	seen := make(map[string]bool)
+	for _, id := range friendIDs {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	members, err := s.friendRepo.FilterFriendIDs(userID, unique)
+	if err != nil {
+		return nil, err
+	}
+	if len(members) != len(unique) {
+		return nil, errors.New("标签成员必须是好友")
+	}
+	return members, nil
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"im-backend/internal/model"
 	"im-backend/internal/repository"
+	"log"
 	"math/rand"
 	"time"
 )
@@ -153,8 +154,36 @@ func (s *GroupService) JoinGroup(groupID, userID string) error {
 		return errors.New("群组不存在")
 	}
 
+	return s.addMember(group, userID, func() error {
+		// 如果是私有群组且需要审批，这里应该创建加入申请而不是直接加入
+		if !group.IsPublic || group.JoinApproval {
+			return errors.New("该群组需要审批才能加入")
+		}
+		return nil
+	})
+}
+
+// JoinGroupByInvite 通过邀请链接加入群组
+// 私有群组可以通过邀请加入；需要审批的群组只有在邀请设置了跳过审批时才能直接加入
+func (s *GroupService) JoinGroupByInvite(groupID, userID string, skipApproval bool) error {
+	group, err := s.groupRepo.GetGroupByID(groupID)
+	if err != nil {
+		return errors.New("群组不存在")
+	}
+
+	return s.addMember(group, userID, func() error {
+		if group.JoinApproval && !skipApproval {
+			return errors.New("该群组需要审批才能加入")
+		}
+		return nil
+	})
+}
+
+// addMember 校验成员身份和人数后以普通成员身份加入群组
+// checkApproval 在人数校验之后执行，用于不同入群方式的审批规则
+func (s *GroupService) addMember(group *model.Group, userID string, checkApproval func() error) error {
 	// 检查是否已经是成员
-	isMember, err := s.groupRepo.IsGroupMember(groupID, userID)
+	isMember, err := s.groupRepo.IsGroupMember(group.GroupID, userID)
 	if err != nil {
 		return err
 	}
@@ -167,14 +196,13 @@ func (s *GroupService) JoinGroup(groupID, userID string) error {
 		return errors.New("群组人数已满")
 	}
 
-	// 如果是私有群组且需要审批，这里应该创建加入申请而不是直接加入
-	if !group.IsPublic || group.JoinApproval {
-		return errors.New("该群组需要审批才能加入")
+	if err := checkApproval(); err != nil {
+		return err
 	}
 
 	// 添加成员
 	member := &model.GroupMember{
-		GroupID:   groupID,
+		GroupID:   group.GroupID,
 		UserID:    userID,
 		Role:      model.GroupRoleMember,
 		JoinedAt:  time.Now(),
@@ -186,7 +214,83 @@ func (s *GroupService) JoinGroup(groupID, userID string) error {
 	}
 
 	// 更新群成员数量
-	return s.groupRepo.UpdateMemberCount(groupID, 1)
+	return s.groupRepo.UpdateMemberCount(group.GroupID, 1)
+}
+
+// InviteMembers 邀请好友入群，可按好友标签批量选择，返回实际加入的人数
+// 需要审批的群组只有管理员和群主可以直接拉人
+func (s *GroupService) InviteMembers(groupID, operatorID string, userIDs []string, tagIDs []uint) (int, error) {
+	role, err := s.groupRepo.GetMemberRole(groupID, operatorID)
+	if err != nil {
+		return 0, errors.New("您不是该群组的成员")
+	}
+
+	group, err := s.groupRepo.GetGroupByID(groupID)
+	if err != nil {
+		return 0, errors.New("群组不存在")
+	}
+	if group.JoinApproval && role < model.GroupRoleAdmin {
+		return 0, errors.New("该群组需要审批，只有管理员和群主可以邀请成员")
+	}
+
+	// 展开标签，只能邀请自己的好友
+	candidates, err := resolveAudience(s.friendRepo, operatorID, userIDs, tagIDs)
+	if err != nil {
+		return 0, err
+	}
+	if len(candidates) == 0 {
+		return 0, errors.New("请选择要邀请的好友")
+	}
+
+	// 排除存在拉黑关系的用户
+	blockedIDs, err := s.friendRepo.GetBlockRelatedUserIDs(operatorID)
+	if err != nil {
+		return 0, err
+	}
+	blocked := make(map[string]bool, len(blockedIDs))
+	for _, id := range blockedIDs {
+		blocked[id] = true
+	}
+
+	invitees := make([]string, 0, len(candidates))
+	for _, userID := range candidates {
+		if blocked[userID] {
+			continue
+		}
+		isMember, err := s.groupRepo.IsGroupMember(groupID, userID)
+		if err != nil {
+			return 0, err
+		}
+		if !isMember {
+			invitees = append(invitees, userID)
+		}
+	}
+	if len(invitees) == 0 {
+		return 0, nil
+	}
+
+	if group.MemberCount+len(invitees) > group.MaxMembers {
+		return 0, errors.New("群组人数已满")
+	}
+
+	now := time.Now()
+	for _, userID := range invitees {
+		member := &model.GroupMember{
+			GroupID:   groupID,
+			UserID:    userID,
+			Role:      model.GroupRoleMember,
+			JoinedAt:  now,
+			CreatedAt: now,
+		}
+		if err := s.groupRepo.AddGroupMember(member); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := s.groupRepo.UpdateMemberCount(groupID, len(invitees)); err != nil {
+		return 0, err
+	}
+	return len(invitees), nil
 }
 
 // LeaveGroup 退出群组
@@ -211,6 +315,47 @@ func (s *GroupService) LeaveGroup(groupID, userID string) error {
 	return s.groupRepo.UpdateMemberCount(groupID, -1)
 }
 
+// LeaveAllGroups 退出用户加入的全部群组（注销账号时调用）
+// 群主身份转让给最早加入的管理员，没有管理员时转让给最早加入的成员；群内没有其他成员时解散群组
+func (s *GroupService) LeaveAllGroups(userID string) error {
+	groupIDs, err := s.groupRepo.GetUserGroupIDs(userID)
+	if err != nil {
+		return err
+	}
+
+	for _, groupID := range groupIDs {
+		role, err := s.groupRepo.GetMemberRole(groupID, userID)
+		if err != nil {
+			continue
+		}
+		if role == model.GroupRoleOwner {
+			successor, err := s.groupRepo.FindOwnerSuccessor(groupID, userID)
+			if err != nil {
+				return err
+			}
+			if successor == nil {
+				if err := s.groupRepo.DeleteGroup(groupID); err != nil {
+					return err
+				}
+				if err := s.groupRepo.RemoveGroupMember(groupID, userID); err != nil {
+					return err
+				}
+				log.Printf("🗑️ 群组 %s 没有其他成员，已随群主注销解散", groupID)
+				continue
+			}
+			if err := s.groupRepo.TransferOwner(groupID, userID, successor.UserID); err != nil {
+				return err
+			}
+			log.Printf("👑 群组 %s 的群主已由 %s 转让给 %s", groupID, userID, successor.UserID)
+		}
+
+		if err := s.LeaveGroup(groupID, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // KickMember 踢出成员
 func (s *GroupService) KickMember(groupID, operatorID, targetUserID string) error {
 	// 检查操作者权限
@@ -320,7 +465,13 @@ func (s *GroupService) SendGroupMessage(groupID, fromUserID string, messageType
 		}
 	}
 
+	group, err := s.groupRepo.GetGroupByID(groupID)
+	if err != nil {
+		return nil, errors.New("群组不存在")
+	}
+
 	// 创建消息
+	now := time.Now()
 	message := &model.GroupMessage{
 		GroupID:     groupID,
 		FromUserID:  fromUserID,
@@ -328,7 +479,9 @@ func (s *GroupService) SendGroupMessage(groupID, fromUserID string, messageType
 		Content:     content,
 		MediaURL:    mediaURL,
 		AtUsers:     atUsers,
-		CreatedAt:   time.Now(),
+		TTL:         group.MessageTTL,
+		ExpireAt:    messageExpireAt(now, group.MessageTTL, group.MessageTTLMode),
+		CreatedAt:   now,
 	}
 
 	if err := s.groupRepo.CreateGroupMessage(message); err != nil {
@@ -397,7 +550,36 @@ func (s *GroupService) MarkGroupMessagesAsRead(groupID, userID string) error {
 	}
 
 	// 批量标记消息为已读（标记当前时间之前的所有未读消息）
-	return s.groupRepo.BatchMarkGroupMessagesAsRead(groupID, userID, time.Now())
+	now := time.Now()
+	if err := s.groupRepo.BatchMarkGroupMessagesAsRead(groupID, userID, now); err != nil {
+		return err
+	}
+
+	// 已读后计时的消息从首次被读到时开始倒计时
+	return s.groupRepo.StartGroupReadExpiry(groupID, userID, now)
+}
+
+// SetMessageTTL 设置群消息存活时间（阅后即焚）
+func (s *GroupService) SetMessageTTL(groupID, userID string, ttl, mode int) error {
+	if err := validateMessageTTL(ttl, mode); err != nil {
+		return err
+	}
+
+	// 检查权限（只有群主和管理员可以修改）
+	role, err := s.groupRepo.GetMemberRole(groupID, userID)
+	if err != nil {
+		return errors.New("您不是该群组的成员")
+	}
+	if role < model.GroupRoleAdmin {
+		return errors.New("只有管理员和群主可以设置消息存活时间")
+	}
+
+	updates := map[string]interface{}{
+		"message_ttl":      ttl,
+		"message_ttl_mode": mode,
+	}
+
+	return s.groupRepo.UpdateGroup(groupID, updates)
 }
 
 // GetUserUnreadGroupMessages 获取用户在群组中的未读消息数
@@ -0,0 +1,249 @@
+package service
+
+import (
+	"errors"
+	"im-backend/config"
+	"im-backend/internal/model"
+	"im-backend/internal/pkg"
+	"im-backend/internal/repository"
+	"time"
+)
+
+// 邀请链接限制
+const (
+	maxInviteTTL         = 365 * 24 * 3600 // 最长有效期（秒）
+	defaultInviteMessage = "我通过你的名片添加了你"
+	inviteQRCodeScale    = 8
+)
+
+// 邀请令牌类型前缀
+const (
+	inviteTokenKindFriend = "u"
+	inviteTokenKindGroup  = "g"
+)
+
+type InviteService struct {
+	inviteRepo    *repository.InviteRepository
+	groupRepo     *repository.GroupRepository
+	friendService *FriendService
+	groupService  *GroupService
+}
+
+func NewInviteService(inviteRepo *repository.InviteRepository, groupRepo *repository.GroupRepository, friendService *FriendService, groupService *GroupService) *InviteService {
+	return &InviteService{
+		inviteRepo:    inviteRepo,
+		groupRepo:     groupRepo,
+		friendService: friendService,
+		groupService:  groupService,
+	}
+}
+
+// CreateInvite 创建邀请链接
+// expireIn 为有效期（秒），0表示永不过期；maxUses 为0表示不限次数
+func (s *InviteService) CreateInvite(creatorID string, inviteType int, groupID string, expireIn, maxUses int, skipApproval bool) (*model.InviteLink, error) {
+	if expireIn < 0 || expireIn > maxInviteTTL {
+		return nil, errors.New("有效期不能超过一年")
+	}
+	if maxUses < 0 {
+		return nil, errors.New("无效的使用次数")
+	}
+
+	kind := inviteTokenKindFriend
+	switch inviteType {
+	case model.InviteTypeFriend:
+		groupID = ""
+		skipApproval = false
+	case model.InviteTypeGroup:
+		kind = inviteTokenKindGroup
+		role, err := s.groupRepo.GetMemberRole(groupID, creatorID)
+		if err != nil {
+			return nil, errors.New("您不是该群组的成员")
+		}
+		group, err := s.groupRepo.GetGroupByID(groupID)
+		if err != nil {
+			return nil, errors.New("群组不存在")
+		}
+		if (skipApproval || group.JoinApproval) && role < model.GroupRoleAdmin {
+			return nil, errors.New("只有管理员和群主可以创建免审批的群邀请")
+		}
+	default:
+		return nil, errors.New("无效的邀请类型")
+	}
+
+	token, err := pkg.GenerateInviteToken(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	invite := &model.InviteLink{
+		Token:        token,
+		Type:         inviteType,
+		CreatorID:    creatorID,
+		GroupID:      groupID,
+		SkipApproval: skipApproval,
+		MaxUses:      maxUses,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if expireIn > 0 {
+		expireAt := now.Add(time.Duration(expireIn) * time.Second)
+		invite.ExpireAt = &expireAt
+	}
+
+	if err := s.inviteRepo.Create(invite); err != nil {
+		return nil, err
+	}
+	invite.URL = inviteURL(invite.Token)
+	return invite, nil
+}
+
+// GetInvites 获取邀请链接列表
+// 指定群组时返回该群的全部邀请（仅管理员和群主），否则返回自己创建的邀请
+func (s *InviteService) GetInvites(userID, groupID string) ([]model.InviteLink, error) {
+	var invites []model.InviteLink
+	var err error
+	if groupID != "" {
+		role, roleErr := s.groupRepo.GetMemberRole(groupID, userID)
+		if roleErr != nil {
+			return nil, errors.New("您不是该群组的成员")
+		}
+		if role < model.GroupRoleAdmin {
+			return nil, errors.New("只有管理员和群主可以查看群邀请")
+		}
+		invites, err = s.inviteRepo.GetGroupInvites(groupID)
+	} else {
+		invites, err = s.inviteRepo.GetUserInvites(userID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range invites {
+		presentInvite(&invites[i])
+	}
+	return invites, nil
+}
+
+// RevokeInvite 撤销邀请链接（创建者或群管理员）
+func (s *InviteService) RevokeInvite(id uint, userID string) error {
+	invite, err := s.getManageableInvite(id, userID)
+	if err != nil {
+		return err
+	}
+	if invite.RevokedAt != nil {
+		return errors.New("邀请已撤销")
+	}
+	return s.inviteRepo.Revoke(id, time.Now())
+}
+
+// GetInviteQRCode 生成邀请链接的二维码PNG
+func (s *InviteService) GetInviteQRCode(id uint, userID string) ([]byte, error) {
+	invite, err := s.getManageableInvite(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	return pkg.EncodeQRCodePNG(inviteURL(invite.Token), inviteQRCodeScale)
+}
+
+// GetInviteByToken 预览邀请（扫码后展示名片或群信息）
+func (s *InviteService) GetInviteByToken(token string) (*model.InviteLink, error) {
+	invite, err := s.findValidInvite(token, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	presentInvite(invite)
+	return invite, nil
+}
+
+// RedeemInvite 兑换邀请
+// 好友名片发起预填验证信息的好友请求；群邀请直接入群（按邀请设置决定是否跳过审批）
+func (s *InviteService) RedeemInvite(token, userID, message string) (*model.InviteLink, error) {
+	now := time.Now()
+	invite, err := s.findValidInvite(token, now)
+	if err != nil {
+		return nil, err
+	}
+	if invite.Type == model.InviteTypeFriend && invite.CreatorID == userID {
+		return nil, errors.New("不能添加自己为好友")
+	}
+
+	ok, err := s.inviteRepo.ClaimUse(invite.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("邀请已失效")
+	}
+
+	switch invite.Type {
+	case model.InviteTypeFriend:
+		if message == "" {
+			message = defaultInviteMessage
+		}
+		err = s.friendService.SendFriendRequestByInvite(userID, invite.CreatorID, message)
+	case model.InviteTypeGroup:
+		err = s.groupService.JoinGroupByInvite(invite.GroupID, userID, invite.SkipApproval)
+	default:
+		err = errors.New("无效的邀请类型")
+	}
+
+	if err != nil {
+		_ = s.inviteRepo.ReleaseUse(invite.ID)
+		return nil, err
+	}
+
+	invite.UsedCount++
+	presentInvite(invite)
+	return invite, nil
+}
+
+// findValidInvite 校验令牌签名并返回仍然有效的邀请
+func (s *InviteService) findValidInvite(token string, now time.Time) (*model.InviteLink, error) {
+	if _, ok := pkg.VerifyInviteToken(token); !ok {
+		return nil, errors.New("无效的邀请")
+	}
+
+	invite, err := s.inviteRepo.FindByToken(token)
+	if err != nil {
+		return nil, errors.New("无效的邀请")
+	}
+	if invite.RevokedAt != nil {
+		return nil, errors.New("邀请已撤销")
+	}
+	if invite.ExpireAt != nil && !now.Before(*invite.ExpireAt) {
+		return nil, errors.New("邀请已过期")
+	}
+	if invite.MaxUses > 0 && invite.UsedCount >= invite.MaxUses {
+		return nil, errors.New("邀请使用次数已达上限")
+	}
+	return invite, nil
+}
+
+// getManageableInvite 获取当前用户可管理的邀请（创建者，或群邀请所在群的管理员和群主）
+func (s *InviteService) getManageableInvite(id uint, userID string) (*model.InviteLink, error) {
+	invite, err := s.inviteRepo.FindByID(id)
+	if err != nil {
+		return nil, errors.New("邀请不存在")
+	}
+	if invite.CreatorID == userID {
+		return invite, nil
+	}
+	if invite.Type == model.InviteTypeGroup {
+		if role, err := s.groupRepo.GetMemberRole(invite.GroupID, userID); err == nil && role >= model.GroupRoleAdmin {
+			return invite, nil
+		}
+	}
+	return nil, errors.New("邀请不存在")
+}
+
+// presentInvite 填充邀请链接，并只对外返回创建者的公开资料
+func presentInvite(invite *model.InviteLink) {
+	invite.URL = inviteURL(invite.Token)
+	invite.CreatorProfile = invite.Creator.Public()
+}
+
+// inviteURL 拼接邀请链接
+func inviteURL(token string) string {
+	return config.Cfg.InviteBaseURL + token
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"im-backend/internal/model"
+	"im-backend/internal/pkg"
+	"im-backend/internal/repository"
+	"log"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	LoginFailPrefix = "login_fail:" // 失败次数，键为 前缀+"account:"+账号+":"+IP 或 前缀+"ip:"+IP
+	LoginLockPrefix = "login_lock:" // 锁定标记，过期即解锁
+)
+
+// 登录防护策略
+// 账号：按账号和IP计数，密码和两步验证码共用，24小时固定窗口内连续失败3次后每次失败需等待 2、4 秒，
+// 5次起锁定15分钟并逐次翻倍（最长24小时），登录成功后清零。
+// 只锁定失败来源的IP，知道邮箱的人无法让账号在其他网络下也无法登录
+// IP：15分钟内失败20次锁定该IP 15分钟，防止撞库
+const (
+	loginAccountWindow        = 24 * time.Hour
+	loginDelayThreshold       = 3
+	loginLockThreshold        = 5
+	loginLockDuration         = 15 * time.Minute
+	loginMaxLockDuration      = 24 * time.Hour
+	loginIPWindow             = 15 * time.Minute
+	loginIPLockThreshold      = 20
+	loginIPLockDuration       = 15 * time.Minute
+	loginHistoryUserAgentSize = 255
+)
+
+// LoginClient 发起登录的客户端信息
+type LoginClient struct {
+	IP        string
+	UserAgent string
+}
+
+// LoginLockedError 登录被临时锁定
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return fmt.Sprintf("登录失败次数过多，请在%d秒后重试", int(e.RetryAfter.Seconds()))
+}
+
+// LoginGuard 密码（登录及修改密码、注销等敏感操作）和两步验证码的失败计数、渐进延迟和临时锁定，以及登录记录和新设备提醒
+type LoginGuard struct {
+	userRepo *repository.UserRepository
+}
+
+func NewLoginGuard(userRepo *repository.UserRepository) *LoginGuard {
+	return &LoginGuard{userRepo: userRepo}
+}
+
+// Check 登录前检查账号和IP是否处于锁定中
+func (g *LoginGuard) Check(account, ip string) error {
+	ctx := context.Background()
+	var retryAfter time.Duration
+	for _, key := range []string{
+		LoginLockPrefix + "account:" + accountIPKey(accountKey(g.findUser(account), account), ip),
+		LoginLockPrefix + "ip:" + ip,
+	} {
+		ttl, err := pkg.RDB.PTTL(ctx, key).Result()
+		if err != nil {
+			log.Printf("⚠️ 登录锁定检查失败，已放行: %v", err)
+			return nil
+		}
+		if ttl > retryAfter {
+			retryAfter = ttl
+		}
+	}
+	if retryAfter > 0 {
+		return &LoginLockedError{RetryAfter: retryAfter.Round(time.Second) + time.Second}
+	}
+	return nil
+}
+
+// RecordFailure 记录一次密码错误：累计账号和IP的失败次数，按策略锁定，并写入登录记录
+func (g *LoginGuard) RecordFailure(account string, client LoginClient, reason string) {
+	user := g.findUser(account)
+	g.recordFailure(accountKey(user, account), client)
+
+	// 账号存在时写入登录记录
+	if user != nil {
+		g.saveHistory(user.UserID, model.LoginMethodPassword, client, false, reason)
+	}
+}
+
+// RecordUserFailure 记录已知账号的一次凭证校验失败（如两步验证码错误），与密码错误共用计数和锁定
+// method 不为空时表示发生在登录流程中，同时写入登录记录
+func (g *LoginGuard) RecordUserFailure(user *model.User, method string, client LoginClient, reason string) {
+	g.recordFailure(user.UserID, client)
+	if method != "" {
+		g.saveHistory(user.UserID, method, client, false, reason)
+	}
+}
+
+// recordFailure 累计账号和IP的失败次数，按策略锁定
+// 计数窗口从第一次失败开始固定，之后的失败不会延长窗口
+func (g *LoginGuard) recordFailure(key string, client LoginClient) {
+	ctx := context.Background()
+	key = accountIPKey(key, client.IP)
+	pipe := pkg.RDB.TxPipeline()
+	accountFails := pipe.Incr(ctx, LoginFailPrefix+"account:"+key)
+	pipe.ExpireNX(ctx, LoginFailPrefix+"account:"+key, loginAccountWindow)
+	ipFails := pipe.Incr(ctx, LoginFailPrefix+"ip:"+client.IP)
+	pipe.ExpireNX(ctx, LoginFailPrefix+"ip:"+client.IP, loginIPWindow)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("⚠️ 记录登录失败次数失败: %v", err)
+		return
+	}
+	if lock := accountLockDuration(accountFails.Val()); lock > 0 {
+		pkg.RDB.Set(ctx, LoginLockPrefix+"account:"+key, 1, lock)
+	}
+	if ipFails.Val() >= loginIPLockThreshold {
+		pkg.RDB.Set(ctx, LoginLockPrefix+"ip:"+client.IP, 1, loginIPLockDuration)
+	}
+}
+
+// CheckPassword 校验已登录用户再次输入的密码（修改密码、注销账号等），与登录共用失败计数和锁定
+// 账号或IP锁定中返回 LoginLockedError；密码错误时记录失败并返回 false
+func (g *LoginGuard) CheckPassword(user *model.User, password string, client LoginClient) (bool, error) {
+	if err := g.Check(user.UserID, client.IP); err != nil {
+		return false, err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		g.RecordUserFailure(user, "", client, "密码错误")
+		return false, nil
+	}
+	return true, nil
+}
+
+// RecordSuccess 登录成功：清零账号在该IP的失败次数，写入登录记录，新设备登录时邮件提醒
+func (g *LoginGuard) RecordSuccess(user *model.User, method string, client LoginClient) {
+	key := accountIPKey(user.UserID, client.IP)
+	pkg.RDB.Del(context.Background(),
+		LoginFailPrefix+"account:"+key,
+		LoginLockPrefix+"account:"+key)
+
+	deviceHash := hashUserAgent(client.UserAgent)
+	hasLogin, err := g.userRepo.HasSuccessfulLogin(user.UserID, "")
+	if err != nil {
+		log.Printf("⚠️ 查询登录记录失败: %v", err)
+	}
+	knownDevice, err := g.userRepo.HasSuccessfulLogin(user.UserID, deviceHash)
+	if err != nil {
+		log.Printf("⚠️ 查询登录记录失败: %v", err)
+	}
+
+	g.saveHistory(user.UserID, method, client, true, "")
+
+	// 首次登录不提醒
+	if hasLogin && !knownDevice {
+		go g.notifyNewDevice(user.Email, method, client)
+	}
+}
+
+// GetHistory 查询自己的登录记录
+func (g *LoginGuard) GetHistory(userID string, cursor uint, pageSize int) ([]model.LoginHistory, error) {
+	return g.userRepo.GetLoginHistory(userID, cursor, pageSize)
+}
+
+// findUser 按用户ID或邮箱查找用户（与密码登录的查找顺序一致）
+func (g *LoginGuard) findUser(account string) *model.User {
+	if user, err := g.userRepo.FindByUserID(account); err == nil {
+		return user
+	}
+	if user, err := g.userRepo.FindByEmail(account); err == nil {
+		return user
+	}
+	return nil
+}
+
+// saveHistory 写入登录记录
+func (g *LoginGuard) saveHistory(userID, method string, client LoginClient, success bool, reason string) {
+	history := &model.LoginHistory{
+		UserID:     userID,
+		Method:     method,
+		IP:         client.IP,
+		UserAgent:  truncateRunes(client.UserAgent, loginHistoryUserAgentSize),
+		DeviceHash: hashUserAgent(client.UserAgent),
+		Success:    success,
+		Reason:     reason,
+		CreatedAt:  time.Now(),
+	}
+	if err := g.userRepo.CreateLoginHistory(history); err != nil {
+		log.Printf("⚠️ 写入登录记录失败: %v", err)
+	}
+}
+
+// notifyNewDevice 邮件提醒用户新设备登录
+func (g *LoginGuard) notifyNewDevice(email, method string, client LoginClient) {
+	subject := "IM 系统新设备登录提醒"
+	body := fmt.Sprintf("您的账号于 %s 在新设备上登录。\n\n登录方式：%s\nIP：%s\n设备：%s\n\n如非本人操作，请立即修改密码。",
+		time.Now().Format("2006-01-02 15:04:05"), method, client.IP, client.UserAgent)
+	if err := pkg.SendEmail(email, subject, body); err != nil {
+		log.Printf("⚠️ 发送新设备登录提醒失败: %v", err)
+	}
+}
+
+// accountLockDuration 根据连续失败次数计算需要等待的时间
+func accountLockDuration(failures int64) time.Duration {
+	switch {
+	case failures < loginDelayThreshold:
+		return 0
+	case failures < loginLockThreshold:
+		return time.Duration(1<<(failures-loginDelayThreshold+1)) * time.Second
+	}
+	lock := loginLockDuration
+	for i := int64(loginLockThreshold); i < failures && lock < loginMaxLockDuration; i++ {
+		lock *= 2
+	}
+	if lock > loginMaxLockDuration {
+		lock = loginMaxLockDuration
+	}
+	return lock
+}
+
+// accountKey 账号统一为用户ID，避免交替使用邮箱和用户ID绕过计数；不存在的账号按输入计数
+func accountKey(user *model.User, account string) string {
+	if user != nil {
+		return user.UserID
+	}
+	return "unknown:" + strings.ToLower(strings.TrimSpace(account))
+}
+
+// accountIPKey 账号失败计数和锁定按账号和IP区分
+func accountIPKey(key, ip string) string {
+	return key + ":" + ip
+}
+
+// hashUserAgent 设备标识：User-Agent 的哈希
+func hashUserAgent(userAgent string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(userAgent)))
+	return hex.EncodeToString(sum[:])
+}
@@ -7,6 +7,12 @@ import (
 	"time"
 )
 
+// 阅后即焚时长限制（秒）
+const (
+	minMessageTTL = 60                // 最短1分钟
+	maxMessageTTL = 30 * 24 * 60 * 60 // 最长30天
+)
+
 type MessageService struct {
 	messageRepo *repository.MessageRepository
 	friendRepo  *repository.FriendRepository
@@ -30,6 +36,12 @@ func (s *MessageService) SendMessage(fromUserID, toUserID string, messageType in
 		return nil, errors.New("只能给好友发送消息")
 	}
 
+	// 检查拉黑关系：被对方拉黑时照常发送成功，消息只对发送方可见，不暴露拉黑状态
+	blockedBy, err := s.checkBlocked(fromUserID, toUserID)
+	if err != nil {
+		return nil, err
+	}
+
 	// 查找或创建会话
 	conversation, err := s.messageRepo.FindOrCreateConversation(fromUserID, toUserID)
 	if err != nil {
@@ -37,6 +49,7 @@ func (s *MessageService) SendMessage(fromUserID, toUserID string, messageType in
 	}
 
 	// 创建消息
+	now := time.Now()
 	message := &model.Message{
 		ConversationID: conversation.ID,
 		FromUserID:     fromUserID,
@@ -45,13 +58,22 @@ func (s *MessageService) SendMessage(fromUserID, toUserID string, messageType in
 		Content:        content,
 		MediaURL:       mediaURL,
 		IsRead:         false,
-		CreatedAt:      time.Now(),
+		TTL:            conversation.MessageTTL,
+		ExpireAt:       messageExpireAt(now, conversation.MessageTTL, conversation.MessageTTLMode),
+		CreatedAt:      now,
+
+		HiddenFromReceiver: blockedBy,
 	}
 
 	if err := s.messageRepo.CreateMessage(message); err != nil {
 		return nil, err
 	}
 
+	// 对方看不到的消息不更新会话的最后一条消息和未读数，避免出现在对方的会话列表中
+	if blockedBy {
+		return s.messageRepo.GetMessageByID(message.ID)
+	}
+
 	// 更新会话的最后一条消息
 	if err := s.messageRepo.UpdateConversationLastMessage(conversation.ID, message.ID, message.CreatedAt); err != nil {
 		return nil, err
@@ -83,7 +105,7 @@ func (s *MessageService) GetConversationMessages(conversationID uint, userID str
 		return nil, errors.New("无权访问该会话")
 	}
 
-	return s.messageRepo.GetConversationMessages(conversationID, page, pageSize)
+	return s.messageRepo.GetConversationMessages(conversationID, userID, page, pageSize)
 }
 
 // GetLatestMessages 获取会话的最新消息
@@ -98,7 +120,7 @@ func (s *MessageService) GetLatestMessages(conversationID uint, userID string, l
 		return nil, errors.New("无权访问该会话")
 	}
 
-	return s.messageRepo.GetLatestMessages(conversationID, limit)
+	return s.messageRepo.GetLatestMessages(conversationID, userID, limit)
 }
 
 // MarkMessageAsRead 标记消息为已读
@@ -109,6 +131,11 @@ func (s *MessageService) MarkMessageAsRead(messageID uint, userID string) error
 		return errors.New("消息不存在")
 	}
 
+	// 只对发送方可见的消息对接收方视为不存在
+	if message.HiddenFromReceiver && message.ToUserID == userID {
+		return errors.New("消息不存在")
+	}
+
 	// 验证是否为接收方
 	if message.ToUserID != userID {
 		return errors.New("无权操作该消息")
@@ -119,7 +146,12 @@ func (s *MessageService) MarkMessageAsRead(messageID uint, userID string) error
 		return nil
 	}
 
-	return s.messageRepo.MarkMessageAsRead(messageID)
+	if err := s.messageRepo.MarkMessageAsRead(messageID); err != nil {
+		return err
+	}
+
+	// 已读后计时的消息从此刻开始倒计时
+	return s.messageRepo.StartMessageReadExpiry(messageID, time.Now())
 }
 
 // MarkConversationAsRead 标记会话中所有消息为已读
@@ -139,6 +171,11 @@ func (s *MessageService) MarkConversationAsRead(conversationID uint, userID stri
 		return err
 	}
 
+	// 已读后计时的消息从此刻开始倒计时
+	if err := s.messageRepo.StartReadExpiry(conversationID, userID, time.Now()); err != nil {
+		return err
+	}
+
 	// 清空会话的未读计数
 	return s.messageRepo.ClearUnreadCount(conversationID, userID)
 }
@@ -177,6 +214,10 @@ func (s *MessageService) DeleteMessage(messageID uint, userID string) error {
 		return errors.New("消息不存在")
 	}
 
+	if message.HiddenFromReceiver && message.ToUserID == userID {
+		return errors.New("消息不存在")
+	}
+
 	// 验证是否为发送方或接收方
 	if message.FromUserID != userID && message.ToUserID != userID {
 		return errors.New("无权删除该消息")
@@ -216,5 +257,63 @@ func (s *MessageService) GetOrCreateConversation(user1ID, user2ID string) (*mode
 		return nil, errors.New("只能与好友创建会话")
 	}
 
+	// 检查拉黑关系（被对方拉黑时照常返回会话，之后发送的消息只对自己可见）
+	if _, err := s.checkBlocked(user1ID, user2ID); err != nil {
+		return nil, err
+	}
+
 	return s.messageRepo.FindOrCreateConversation(user1ID, user2ID)
 }
+
+// SetConversationTTL 设置会话的消息存活时间（阅后即焚）
+func (s *MessageService) SetConversationTTL(conversationID uint, userID string, ttl, mode int) error {
+	if err := validateMessageTTL(ttl, mode); err != nil {
+		return err
+	}
+
+	// 验证用户是否属于该会话
+	conversation, err := s.messageRepo.GetConversationByID(conversationID)
+	if err != nil {
+		return errors.New("会话不存在")
+	}
+
+	if conversation.User1ID != userID && conversation.User2ID != userID {
+		return errors.New("无权访问该会话")
+	}
+
+	return s.messageRepo.UpdateConversationTTL(conversationID, ttl, mode)
+}
+
+// checkBlocked 检查双方的拉黑关系
+// 自己拉黑了对方时返回错误；被对方拉黑时不报错，返回 blockedBy 由调用方静默处理，与好友请求一致
+func (s *MessageService) checkBlocked(userID, targetID string) (blockedBy bool, err error) {
+	blocking, err := s.friendRepo.IsBlocked(userID, targetID)
+	if err != nil {
+		return false, err
+	}
+	if blocking {
+		return false, errors.New("对方在您的黑名单中，请先移出黑名单")
+	}
+
+	return s.friendRepo.IsBlocked(targetID, userID)
+}
+
+// validateMessageTTL 校验消息存活时间设置
+func validateMessageTTL(ttl, mode int) error {
+	if ttl != 0 && (ttl < minMessageTTL || ttl > maxMessageTTL) {
+		return errors.New("消息存活时间需在1分钟到30天之间，0表示关闭")
+	}
+	if mode != model.MessageTTLModeSend && mode != model.MessageTTLModeRead {
+		return errors.New("无效的计时方式")
+	}
+	return nil
+}
+
+// messageExpireAt 计算发送后计时的消息过期时间，已读后计时或未开启时返回nil
+func messageExpireAt(sentAt time.Time, ttl, mode int) *time.Time {
+	if ttl <= 0 || mode != model.MessageTTLModeSend {
+		return nil
+	}
+	expireAt := sentAt.Add(time.Duration(ttl) * time.Second)
+	return &expireAt
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"im-backend/internal/pkg"
+	"im-backend/internal/repository"
+	"log"
+	"time"
+)
+
+// sweepBatchSize 每批清理的消息数量
+const sweepBatchSize = 500
+
+// MessageSweeper 阅后即焚过期消息清理器
+type MessageSweeper struct {
+	messageRepo *repository.MessageRepository
+	groupRepo   *repository.GroupRepository
+}
+
+func NewMessageSweeper(messageRepo *repository.MessageRepository, groupRepo *repository.GroupRepository) *MessageSweeper {
+	return &MessageSweeper{
+		messageRepo: messageRepo,
+		groupRepo:   groupRepo,
+	}
+}
+
+// Run 按固定间隔清理过期消息（阻塞运行，需在goroutine中调用）
+func (s *MessageSweeper) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.SweepOnce(time.Now())
+	}
+}
+
+// SweepOnce 执行一次清理
+func (s *MessageSweeper) SweepOnce(now time.Time) {
+	if err := s.sweepMessages(now); err != nil {
+		log.Printf("❌ 清理过期私聊消息失败: %v", err)
+	}
+	if err := s.sweepGroupMessages(now); err != nil {
+		log.Printf("❌ 清理过期群消息失败: %v", err)
+	}
+}
+
+// sweepMessages 清理过期的私聊消息并通知会话双方
+func (s *MessageSweeper) sweepMessages(now time.Time) error {
+	for {
+		messages, err := s.messageRepo.FindExpiredMessages(now, sweepBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(messages) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, 0, len(messages))
+		mediaURLs := make([]string, 0, len(messages))
+		expired := make(map[uint][]uint)         // 会话ID -> 过期消息ID
+		participants := make(map[uint][2]string) // 会话ID -> 双方用户ID
+		for _, message := range messages {
+			ids = append(ids, message.ID)
+			expired[message.ConversationID] = append(expired[message.ConversationID], message.ID)
+			participants[message.ConversationID] = [2]string{message.FromUserID, message.ToUserID}
+			mediaURLs = append(mediaURLs, message.MediaURL)
+		}
+
+		if err := s.messageRepo.HardDeleteMessages(ids); err != nil {
+			return err
+		}
+		s.removeMedia(mediaURLs)
+
+		for conversationID, messageIDs := range expired {
+			data := map[string]interface{}{
+				"conversation_id": conversationID,
+				"message_ids":     messageIDs,
+			}
+			for _, userID := range participants[conversationID] {
+				s.notify(userID, data)
+			}
+		}
+
+		if len(messages) < sweepBatchSize {
+			return nil
+		}
+	}
+}
+
+// sweepGroupMessages 清理过期的群消息并通知全体群成员
+func (s *MessageSweeper) sweepGroupMessages(now time.Time) error {
+	for {
+		messages, err := s.groupRepo.FindExpiredGroupMessages(now, sweepBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(messages) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, 0, len(messages))
+		mediaURLs := make([]string, 0, len(messages))
+		expired := make(map[string][]uint) // 群组ID -> 过期消息ID
+		for _, message := range messages {
+			ids = append(ids, message.ID)
+			expired[message.GroupID] = append(expired[message.GroupID], message.ID)
+			mediaURLs = append(mediaURLs, message.MediaURL)
+		}
+
+		if err := s.groupRepo.HardDeleteGroupMessages(ids); err != nil {
+			return err
+		}
+		s.removeMedia(mediaURLs)
+
+		for groupID, messageIDs := range expired {
+			memberIDs, err := s.groupRepo.GetGroupMemberIDs(groupID)
+			if err != nil {
+				log.Printf("⚠️ 获取群 %s 成员失败，跳过过期通知: %v", groupID, err)
+				continue
+			}
+			data := map[string]interface{}{
+				"group_id":    groupID,
+				"message_ids": messageIDs,
+			}
+			for _, userID := range memberIDs {
+				s.notify(userID, data)
+			}
+		}
+
+		if len(messages) < sweepBatchSize {
+			return nil
+		}
+	}
+}
+
+// removeMedia 在消息删除后清理其媒体文件，仍被其他消息、头像或动态引用的文件保留（如转发过的图片），失败只记录日志
+func (s *MessageSweeper) removeMedia(mediaURLs []string) {
+	removed := make(map[string]bool)
+	for _, mediaURL := range mediaURLs {
+		if _, ok := pkg.LocalMediaPath(mediaURL); !ok || removed[mediaURL] {
+			continue
+		}
+		removed[mediaURL] = true
+
+		referenced, err := s.messageRepo.IsMediaReferenced(mediaURL)
+		if err != nil {
+			log.Printf("⚠️ 检查媒体文件引用失败 %s: %v", mediaURL, err)
+			continue
+		}
+		if referenced {
+			continue
+		}
+		if err := pkg.RemoveMediaFile(mediaURL); err != nil {
+			log.Printf("⚠️ 删除媒体文件失败 %s: %v", mediaURL, err)
+		}
+	}
+}
+
+// notify 通过WebSocket通知在线用户清除本地消息
+func (s *MessageSweeper) notify(userID string, data interface{}) {
+	if pkg.GlobalHub != nil && pkg.GlobalHub.IsUserOnline(userID) {
+		_ = pkg.GlobalHub.SendMessagesExpired(userID, data)
+	}
+}
@@ -1,61 +1,232 @@
 package service
 
 import (
+	"encoding/json"
 	"errors"
 	"im-backend/internal/model"
+	"im-backend/internal/pkg"
 	"im-backend/internal/repository"
+	"log"
 	"strings"
 	"time"
 )
 
+// notificationSnippetLength 通知中评论摘要的最大字符数
+const notificationSnippetLength = 100
+
+// commentReplyPreviewSize 评论列表中每条顶层评论附带的回复数
+const commentReplyPreviewSize = 3
+
+// 话题和提及限制
+const (
+	maxMomentHashtags  = 10 // 每条动态最多解析的话题数
+	maxMomentMentions  = 20 // 每条动态最多提及的好友数
+	maxTrendingDays    = 30 // 热门话题最长统计天数
+	maxTrendingHashtag = 50 // 热门话题最多返回数量
+)
+
 type MomentService struct {
 	momentRepo *repository.MomentRepository
 	friendRepo *repository.FriendRepository
+	userRepo   *repository.UserRepository
+	timeline   *MomentTimeline
 }
 
-func NewMomentService(momentRepo *repository.MomentRepository, friendRepo *repository.FriendRepository) *MomentService {
+func NewMomentService(momentRepo *repository.MomentRepository, friendRepo *repository.FriendRepository, userRepo *repository.UserRepository, timeline *MomentTimeline) *MomentService {
 	return &MomentService{
 		momentRepo: momentRepo,
 		friendRepo: friendRepo,
+		userRepo:   userRepo,
+		timeline:   timeline,
 	}
 }
 
 // CreateMoment 发布朋友圈动态
-func (s *MomentService) CreateMoment(userID, content, images, location string, visible int) error {
+// 可见范围为部分可见或不给谁看时，通过 audienceUserIDs / audienceTagIDs 指定名单
+func (s *MomentService) CreateMoment(userID, content, images, location string, visible int, audienceUserIDs []string, audienceTagIDs []uint) error {
 	// 校验内容不能为空
 	if len(strings.TrimSpace(content)) == 0 {
 		return errors.New("动态内容不能为空")
 	}
 
+	audience, err := s.resolveMomentAudience(userID, visible, audienceUserIDs, audienceTagIDs)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	hashtags, mentions, err := s.parseMomentTags(userID, content, now)
+	if err != nil {
+		return err
+	}
+
 	moment := &model.Moment{
 		UserID:    userID,
 		Content:   content,
 		Images:    images,
 		Location:  location,
 		Visible:   visible,
-		CreatedAt: time.Now(),
+		CreatedAt: now,
+		Hashtags:  hashtags,
+		Mentions:  mentions,
 	}
 
-	return s.momentRepo.CreateMoment(moment)
+	if err := s.momentRepo.CreateMomentWithAudience(moment, audience); err != nil {
+		return err
+	}
+
+	// 写入作者及可见好友的时间线
+	s.timeline.FanOut(moment)
+	s.notifyMentions(moment, nil)
+	return nil
 }
 
-// GetMomentByID 获取动态详情
-func (s *MomentService) GetMomentByID(momentID uint, userID string) (*model.Moment, error) {
+// RepostMoment 转发动态到自己的朋友圈，content 为可选的转发评论
+// 转发动态只引用原动态，查看者需要同时能看到原动态；转发的转发统一指向最初的原动态
+func (s *MomentService) RepostMoment(momentID uint, userID, content string, visible int, audienceUserIDs []string, audienceTagIDs []uint) error {
+	original, err := s.getVisibleMoment(momentID, userID, "无权转发该动态")
+	if err != nil {
+		return err
+	}
+	if original.RepostOfID != nil {
+		if original, err = s.getVisibleMoment(*original.RepostOfID, userID, "无权转发该动态"); err != nil {
+			return err
+		}
+	}
+	if original.UserID == userID {
+		return errors.New("不能转发自己的动态")
+	}
+
+	audience, err := s.resolveMomentAudience(userID, visible, audienceUserIDs, audienceTagIDs)
+	if err != nil {
+		return err
+	}
+
+	content = strings.TrimSpace(content)
+	now := time.Now()
+	hashtags, mentions, err := s.parseMomentTags(userID, content, now)
+	if err != nil {
+		return err
+	}
+
+	moment := &model.Moment{
+		UserID:     userID,
+		Content:    content,
+		Visible:    visible,
+		RepostOfID: &original.ID,
+		CreatedAt:  now,
+		Hashtags:   hashtags,
+		Mentions:   mentions,
+	}
+	if err := s.momentRepo.CreateMomentWithAudience(moment, audience); err != nil {
+		return err
+	}
+
+	// 增加原动态的转发数
+	if err := s.momentRepo.IncreaseRepostCount(original.ID); err != nil {
+		return err
+	}
+
+	s.timeline.FanOut(moment)
+	s.notifyMentions(moment, nil)
+	s.notify(&model.MomentNotification{
+		UserID:    original.UserID,
+		ActorID:   userID,
+		Type:      model.MomentNotifyRepost,
+		MomentID:  original.ID,
+		Content:   truncateRunes(content, notificationSnippetLength),
+		CreatedAt: now,
+	})
+	return nil
+}
+
+// parseMomentTags 解析正文中的话题和提及，提及只保留自己的好友
+func (s *MomentService) parseMomentTags(userID, content string, now time.Time) ([]model.MomentHashtag, []model.MomentMention, error) {
+	var hashtags []model.MomentHashtag
+	for _, tag := range pkg.ParseHashtags(content, maxMomentHashtags) {
+		hashtags = append(hashtags, model.MomentHashtag{Tag: tag, CreatedAt: now})
+	}
+
+	friendIDs, err := s.friendRepo.FilterFriendIDs(userID, pkg.ParseMentions(content, maxMomentMentions))
+	if err != nil {
+		return nil, nil, err
+	}
+	var mentions []model.MomentMention
+	for _, friendID := range friendIDs {
+		mentions = append(mentions, model.MomentMention{UserID: friendID, CreatedAt: now})
+	}
+	return hashtags, mentions, nil
+}
+
+// notifyMentions 通知动态中新提及且能看到该动态的好友，previous 为编辑前已提及的用户
+func (s *MomentService) notifyMentions(moment *model.Moment, previous []model.MomentMention) {
+	notified := make(map[string]bool, len(previous))
+	for _, mention := range previous {
+		notified[mention.UserID] = true
+	}
+
+	for _, mention := range moment.Mentions {
+		if notified[mention.UserID] {
+			continue
+		}
+		if visible, err := s.momentRepo.IsMomentVisible(moment.ID, mention.UserID); err != nil || !visible {
+			continue
+		}
+		s.notify(&model.MomentNotification{
+			UserID:    mention.UserID,
+			ActorID:   moment.UserID,
+			Type:      model.MomentNotifyMention,
+			MomentID:  moment.ID,
+			Content:   truncateRunes(moment.Content, notificationSnippetLength),
+			CreatedAt: mention.CreatedAt,
+		})
+	}
+}
+
+// resolveMomentAudience 校验可见范围并展开受众名单（支持按好友标签选择）
+func (s *MomentService) resolveMomentAudience(userID string, visible int, userIDs []string, tagIDs []uint) ([]string, error) {
+	if visible < model.MomentVisibleAll || visible > model.MomentVisibleExclude {
+		return nil, errors.New("无效的可见范围")
+	}
+	if visible != model.MomentVisibleInclude && visible != model.MomentVisibleExclude {
+		return nil, nil
+	}
+
+	audience, err := resolveAudience(s.friendRepo, userID, userIDs, tagIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(audience) == 0 {
+		return nil, errors.New("请选择可见或屏蔽的好友")
+	}
+	return audience, nil
+}
+
+// getVisibleMoment 获取动态并按统一的可见性策略校验查看权限
+func (s *MomentService) getVisibleMoment(momentID uint, userID, deniedMsg string) (*model.Moment, error) {
 	moment, err := s.momentRepo.FindMomentByID(momentID)
 	if err != nil {
 		return nil, errors.New("动态不存在")
 	}
 
-	// 检查可见权限
-	if moment.Visible == 2 && moment.UserID != userID {
-		return nil, errors.New("无权查看该动态")
+	visible, err := s.momentRepo.IsMomentVisible(momentID, userID)
+	if err != nil || !visible {
+		return nil, errors.New(deniedMsg)
 	}
+	return moment, nil
+}
 
-	if moment.Visible == 1 && moment.UserID != userID {
-		// 检查是否为好友
-		isFriend, err := s.friendRepo.IsFriend(userID, moment.UserID)
-		if err != nil || !isFriend {
-			return nil, errors.New("无权查看该动态")
+// GetMomentByID 获取动态详情
+func (s *MomentService) GetMomentByID(momentID uint, userID string) (*model.Moment, error) {
+	moment, err := s.getVisibleMoment(momentID, userID, "无权查看该动态")
+	if err != nil {
+		return nil, err
+	}
+
+	// 受众名单只对发布者展示
+	if moment.UserID == userID && (moment.Visible == model.MomentVisibleInclude || moment.Visible == model.MomentVisibleExclude) {
+		if moment.AudienceUserIDs, err = s.momentRepo.GetAudienceUserIDs(momentID); err != nil {
+			return nil, err
 		}
 	}
 
@@ -68,22 +239,153 @@ func (s *MomentService) GetMyMoments(userID string, page, pageSize int) ([]model
 	return s.momentRepo.GetMomentList(userID, offset, pageSize)
 }
 
-// GetFriendMoments 获取好友的朋友圈列表（时间线）
+// GetTimeline 按游标读取朋友圈时间线，cursor 为上一页最后一条动态的ID
+func (s *MomentService) GetTimeline(userID string, cursor uint, pageSize int) ([]model.Moment, error) {
+	return s.timeline.Read(userID, cursor, pageSize)
+}
+
+// GetFriendMoments 获取好友的朋友圈列表（按页码分页，兼容旧客户端）
 func (s *MomentService) GetFriendMoments(userID string, page, pageSize int) ([]model.Moment, error) {
-	// 获取好友列表
-	friends, err := s.friendRepo.GetFriendList(userID)
+	// 获取好友ID列表，并包含自己
+	friendIDs, err := s.friendRepo.GetFriendIDs(userID)
 	if err != nil {
 		return nil, err
 	}
+	friendIDs = append(friendIDs, userID)
 
-	// 提取好友ID列表，并包含自己
-	friendIDs := []string{userID}
-	for _, friend := range friends {
-		friendIDs = append(friendIDs, friend.FriendID)
+	// 可见范围、受众名单和拉黑关系由统一的可见性策略过滤
+	offset := (page - 1) * pageSize
+	return s.momentRepo.GetFriendMomentList(friendIDs, userID, offset, pageSize)
+}
+
+// UpdateMoment 编辑动态（仅发布者）
+// 旧版本保存到编辑历史，点赞和评论保留；可见范围或受众名单变化时重新分发时间线
+func (s *MomentService) UpdateMoment(momentID uint, userID, content, images, location string, visible int, audienceUserIDs []string, audienceTagIDs []uint) (*model.Moment, error) {
+	moment, err := s.momentRepo.FindMomentByID(momentID)
+	if err != nil {
+		return nil, errors.New("动态不存在")
+	}
+	if moment.UserID != userID {
+		return nil, errors.New("无权编辑该动态")
 	}
 
-	offset := (page - 1) * pageSize
-	return s.momentRepo.GetFriendMomentList(friendIDs, offset, pageSize)
+	// 转发动态的评论可以为空
+	if moment.RepostOfID == nil && len(strings.TrimSpace(content)) == 0 {
+		return nil, errors.New("动态内容不能为空")
+	}
+
+	audience, err := s.resolveMomentAudience(userID, visible, audienceUserIDs, audienceTagIDs)
+	if err != nil {
+		return nil, err
+	}
+	oldAudience, err := s.momentRepo.GetAudienceUserIDs(momentID)
+	if err != nil {
+		return nil, err
+	}
+
+	audienceChanged := visible != moment.Visible || !sameUserIDs(audience, oldAudience)
+	if !audienceChanged && content == moment.Content && images == moment.Images && location == moment.Location {
+		return nil, errors.New("动态内容未修改")
+	}
+
+	oldAudienceJSON, err := json.Marshal(oldAudience)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	hashtags, mentions, err := s.parseMomentTags(userID, content, now)
+	if err != nil {
+		return nil, err
+	}
+	previousMentions := moment.Mentions
+	edit := &model.MomentEdit{
+		MomentID:  momentID,
+		Content:   moment.Content,
+		Images:    moment.Images,
+		Location:  moment.Location,
+		Visible:   moment.Visible,
+		Audience:  string(oldAudienceJSON),
+		CreatedAt: now,
+	}
+
+	moment.Content = content
+	moment.Images = images
+	moment.Location = location
+	moment.Visible = visible
+	moment.EditedAt = &now
+	moment.Hashtags = hashtags
+	moment.Mentions = mentions
+	if err := s.momentRepo.UpdateMoment(moment, audience, edit); err != nil {
+		return nil, err
+	}
+
+	if audienceChanged {
+		s.timeline.Refresh(moment)
+	}
+	s.notifyMentions(moment, previousMentions)
+
+	return s.GetMomentByID(momentID, userID)
+}
+
+// GetMomentEdits 获取动态的编辑历史
+// 只有发布者可以查看：旧版本的可见范围可能比现在更窄，其他人只能通过 edited_at 知道动态被编辑过
+func (s *MomentService) GetMomentEdits(momentID uint, userID string) ([]model.MomentEdit, error) {
+	moment, err := s.momentRepo.FindMomentByID(momentID)
+	if err != nil {
+		return nil, errors.New("动态不存在")
+	}
+	if moment.UserID != userID {
+		return nil, errors.New("只有发布者可以查看编辑历史")
+	}
+
+	edits, err := s.momentRepo.GetMomentEdits(momentID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range edits {
+		if edits[i].Audience != "" {
+			_ = json.Unmarshal([]byte(edits[i].Audience), &edits[i].AudienceUserIDs)
+		}
+	}
+	return edits, nil
+}
+
+// sameUserIDs 判断两个用户ID名单是否相同（忽略顺序）
+func sameUserIDs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	set := make(map[string]bool, len(a))
+	for _, id := range a {
+		set[id] = true
+	}
+	for _, id := range b {
+		if !set[id] {
+			return false
+		}
+	}
+	return true
+}
+
+// GetHashtagMoments 按游标获取话题下对自己可见的动态，cursor 为上一页最后一条动态的ID
+func (s *MomentService) GetHashtagMoments(tag, userID string, cursor uint, pageSize int) ([]model.Moment, error) {
+	tag = pkg.NormalizeHashtag(tag)
+	if tag == "" {
+		return nil, errors.New("无效的话题")
+	}
+	return s.momentRepo.GetHashtagMoments(tag, userID, cursor, pageSize)
+}
+
+// GetTrendingHashtags 统计最近 days 天内自己能看到的动态中的热门话题
+func (s *MomentService) GetTrendingHashtags(userID string, days, limit int) ([]model.HashtagTrend, error) {
+	if days <= 0 || days > maxTrendingDays {
+		return nil, errors.New("统计天数必须在1到30之间")
+	}
+	if limit <= 0 || limit > maxTrendingHashtag {
+		limit = maxTrendingHashtag
+	}
+	since := time.Now().AddDate(0, 0, -days)
+	return s.momentRepo.GetTrendingHashtags(userID, since, limit)
 }
 
 // DeleteMoment 删除动态
@@ -98,27 +400,26 @@ func (s *MomentService) DeleteMoment(momentID uint, userID string) error {
 		return errors.New("无权删除该动态")
 	}
 
-	return s.momentRepo.DeleteMoment(momentID, userID)
+	if err := s.momentRepo.DeleteMoment(momentID, userID); err != nil {
+		return err
+	}
+	if moment.RepostOfID != nil {
+		if err := s.momentRepo.DecreaseRepostCount(*moment.RepostOfID); err != nil {
+			return err
+		}
+	}
+
+	// 原动态删除后，引用它的转发由可见性策略隐藏，时间线读取时清理
+	s.timeline.Remove(moment)
+	return nil
 }
 
 // LikeMoment 点赞动态
 func (s *MomentService) LikeMoment(momentID uint, userID string) error {
-	// 检查动态是否存在
-	moment, err := s.momentRepo.FindMomentByID(momentID)
+	// 检查动态是否存在及可见权限
+	moment, err := s.getVisibleMoment(momentID, userID, "无权访问该动态")
 	if err != nil {
-		return errors.New("动态不存在")
-	}
-
-	// 检查可见权限
-	if moment.Visible == 2 && moment.UserID != userID {
-		return errors.New("无权访问该动态")
-	}
-
-	if moment.Visible == 1 && moment.UserID != userID {
-		isFriend, err := s.friendRepo.IsFriend(userID, moment.UserID)
-		if err != nil || !isFriend {
-			return errors.New("无权访问该动态")
-		}
+		return err
 	}
 
 	// 检查是否已点赞
@@ -139,7 +440,21 @@ func (s *MomentService) LikeMoment(momentID uint, userID string) error {
 	}
 
 	// 增加点赞数
-	return s.momentRepo.IncreaseLikeCount(momentID)
+	if err := s.momentRepo.IncreaseLikeCount(momentID); err != nil {
+		return err
+	}
+
+	// 通知动态作者
+	if moment.UserID != userID {
+		s.notify(&model.MomentNotification{
+			UserID:    moment.UserID,
+			ActorID:   userID,
+			Type:      model.MomentNotifyLike,
+			MomentID:  momentID,
+			CreatedAt: like.CreatedAt,
+		})
+	}
+	return nil
 }
 
 // UnlikeMoment 取消点赞
@@ -155,6 +470,11 @@ func (s *MomentService) UnlikeMoment(momentID uint, userID string) error {
 		return err
 	}
 
+	// 撤回尚未读取的点赞通知
+	if err := s.momentRepo.DeleteLikeNotification(momentID, userID); err != nil {
+		log.Printf("⚠️ 删除点赞通知失败: %v", err)
+	}
+
 	// 减少点赞数
 	return s.momentRepo.DecreaseLikeCount(momentID)
 }
@@ -172,30 +492,24 @@ func (s *MomentService) GetLikeList(momentID uint, userID string) ([]model.Momen
 
 // CommentMoment 评论动态
 func (s *MomentService) CommentMoment(momentID uint, userID, content string, replyToID *uint) error {
-	// 检查动态是否存在
-	moment, err := s.momentRepo.FindMomentByID(momentID)
+	// 检查动态是否存在及可见权限
+	moment, err := s.getVisibleMoment(momentID, userID, "无权访问该动态")
 	if err != nil {
-		return errors.New("动态不存在")
-	}
-
-	// 检查可见权限
-	if moment.Visible == 2 && moment.UserID != userID {
-		return errors.New("无权访问该动态")
-	}
-
-	if moment.Visible == 1 && moment.UserID != userID {
-		isFriend, err := s.friendRepo.IsFriend(userID, moment.UserID)
-		if err != nil || !isFriend {
-			return errors.New("无权访问该动态")
-		}
+		return err
 	}
 
-	// 如果是回复评论，检查被回复的评论是否存在
+	// 如果是回复评论，检查被回复的评论是否存在，回复归属到被回复评论所在的楼层
+	var replyTo *model.MomentComment
+	var rootID *uint
 	if replyToID != nil {
-		_, err := s.momentRepo.FindCommentByID(*replyToID)
-		if err != nil {
+		replyTo, err = s.momentRepo.FindCommentByID(*replyToID)
+		if err != nil || replyTo.MomentID != momentID || replyTo.IsDeleted {
 			return errors.New("被回复的评论不存在")
 		}
+		rootID = replyTo.RootID
+		if rootID == nil {
+			rootID = &replyTo.ID
+		}
 	}
 
 	// 创建评论
@@ -204,6 +518,7 @@ func (s *MomentService) CommentMoment(momentID uint, userID, content string, rep
 		UserID:    userID,
 		Content:   content,
 		ReplyToID: replyToID,
+		RootID:    rootID,
 		CreatedAt: time.Now(),
 	}
 
@@ -211,15 +526,48 @@ func (s *MomentService) CommentMoment(momentID uint, userID, content string, rep
 		return err
 	}
 
-	// 增加评论数
-	return s.momentRepo.IncreaseCommentCount(momentID)
+	// 增加评论数和楼中回复数
+	if err := s.momentRepo.IncreaseCommentCount(momentID); err != nil {
+		return err
+	}
+	if rootID != nil {
+		if err := s.momentRepo.IncreaseReplyCount(*rootID); err != nil {
+			return err
+		}
+	}
+
+	// 通知动态作者和被回复的评论者（同一人只通知一次，以回复为准）
+	recipients := make(map[string]int)
+	if moment.UserID != userID {
+		recipients[moment.UserID] = model.MomentNotifyComment
+	}
+	if replyTo != nil && replyTo.UserID != userID {
+		recipients[replyTo.UserID] = model.MomentNotifyReply
+	}
+	for recipientID, notifyType := range recipients {
+		// 被回复者可能已看不到该动态（受众名单变化或被拉黑），不再通知
+		if visible, err := s.momentRepo.IsMomentVisible(momentID, recipientID); err != nil || !visible {
+			continue
+		}
+		s.notify(&model.MomentNotification{
+			UserID:    recipientID,
+			ActorID:   userID,
+			Type:      notifyType,
+			MomentID:  momentID,
+			CommentID: &comment.ID,
+			Content:   truncateRunes(content, notificationSnippetLength),
+			CreatedAt: comment.CreatedAt,
+		})
+	}
+	return nil
 }
 
 // DeleteComment 删除评论
+// 仍有回复的评论保留为"已删除"占位，保证回复链完整；没有回复的评论直接删除
 func (s *MomentService) DeleteComment(commentID uint, userID string) error {
 	// 检查评论是否存在且是否为本人发布
 	comment, err := s.momentRepo.FindCommentByID(commentID)
-	if err != nil {
+	if err != nil || comment.IsDeleted {
 		return errors.New("评论不存在")
 	}
 
@@ -227,22 +575,211 @@ func (s *MomentService) DeleteComment(commentID uint, userID string) error {
 		return errors.New("无权删除该评论")
 	}
 
-	// 删除评论
-	if err := s.momentRepo.DeleteComment(commentID, userID); err != nil {
+	hasReplies, err := s.momentRepo.HasReplies(commentID)
+	if err != nil {
+		return err
+	}
+	if hasReplies {
+		err = s.momentRepo.MarkCommentDeleted(commentID)
+	} else {
+		err = s.momentRepo.DeleteComment(commentID, userID)
+	}
+	if err != nil {
 		return err
 	}
 
-	// 减少评论数
+	// 减少评论数；彻底删除的回复同时减少楼中回复数
+	if comment.RootID != nil && !hasReplies {
+		if err := s.momentRepo.DecreaseReplyCount(*comment.RootID); err != nil {
+			return err
+		}
+	}
 	return s.momentRepo.DecreaseCommentCount(comment.MomentID)
 }
 
-// GetCommentList 获取评论列表
-func (s *MomentService) GetCommentList(momentID uint, userID string) ([]model.MomentComment, error) {
+// GetCommentList 按游标获取顶层评论，每条附带楼中回复数和最早的几条回复
+// cursor 为上一页最后一条评论的ID，0表示从第一条开始
+func (s *MomentService) GetCommentList(momentID uint, userID string, cursor uint, pageSize int) ([]model.MomentComment, error) {
 	// 检查动态是否存在及权限
-	_, err := s.GetMomentByID(momentID, userID)
+	if _, err := s.getVisibleMoment(momentID, userID, "无权查看该动态"); err != nil {
+		return nil, err
+	}
+
+	comments, err := s.momentRepo.GetTopComments(momentID, cursor, pageSize)
 	if err != nil {
 		return nil, err
 	}
 
-	return s.momentRepo.GetCommentList(momentID)
+	rootIDs := make([]uint, 0, len(comments))
+	for _, comment := range comments {
+		if comment.ReplyCount > 0 {
+			rootIDs = append(rootIDs, comment.ID)
+		}
+	}
+	replies, err := s.momentRepo.GetReplyPreviews(rootIDs, commentReplyPreviewSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.fillCommentLiked(userID, comments, replies); err != nil {
+		return nil, err
+	}
+
+	index := make(map[uint]int, len(comments))
+	for i := range comments {
+		index[comments[i].ID] = i
+	}
+	for _, reply := range replies {
+		if i, ok := index[*reply.RootID]; ok {
+			comments[i].Replies = append(comments[i].Replies, reply)
+		}
+	}
+	return comments, nil
+}
+
+// GetCommentReplies 按游标获取某条顶层评论楼中的回复，cursor 为上一页最后一条回复的ID
+func (s *MomentService) GetCommentReplies(commentID uint, userID string, cursor uint, pageSize int) ([]model.MomentComment, error) {
+	comment, err := s.momentRepo.FindCommentByID(commentID)
+	if err != nil {
+		return nil, errors.New("评论不存在")
+	}
+	if comment.RootID != nil {
+		return nil, errors.New("只能查看顶层评论的回复")
+	}
+	if _, err := s.getVisibleMoment(comment.MomentID, userID, "无权查看该动态"); err != nil {
+		return nil, err
+	}
+
+	replies, err := s.momentRepo.GetReplies(commentID, cursor, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.fillCommentLiked(userID, replies); err != nil {
+		return nil, err
+	}
+	return replies, nil
+}
+
+// LikeComment 点赞评论
+func (s *MomentService) LikeComment(commentID uint, userID string) error {
+	comment, err := s.momentRepo.FindCommentByID(commentID)
+	if err != nil || comment.IsDeleted {
+		return errors.New("评论不存在")
+	}
+	if _, err := s.getVisibleMoment(comment.MomentID, userID, "无权点赞该评论"); err != nil {
+		return err
+	}
+
+	liked, err := s.momentRepo.IsCommentLiked(commentID, userID)
+	if err != nil {
+		return err
+	}
+	if liked {
+		return errors.New("已经点赞过了")
+	}
+
+	return s.momentRepo.CreateCommentLike(&model.MomentCommentLike{
+		CommentID: commentID,
+		UserID:    userID,
+		CreatedAt: time.Now(),
+	})
+}
+
+// UnlikeComment 取消评论点赞
+func (s *MomentService) UnlikeComment(commentID uint, userID string) error {
+	deleted, err := s.momentRepo.DeleteCommentLike(commentID, userID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return errors.New("还未点赞")
+	}
+	return nil
+}
+
+// fillCommentLiked 标记当前用户点赞过的评论
+func (s *MomentService) fillCommentLiked(userID string, groups ...[]model.MomentComment) error {
+	var ids []uint
+	for _, comments := range groups {
+		for _, comment := range comments {
+			ids = append(ids, comment.ID)
+		}
+	}
+	likedIDs, err := s.momentRepo.GetLikedCommentIDs(userID, ids)
+	if err != nil {
+		return err
+	}
+
+	liked := make(map[uint]bool, len(likedIDs))
+	for _, id := range likedIDs {
+		liked[id] = true
+	}
+	for _, comments := range groups {
+		for i := range comments {
+			comments[i].Liked = liked[comments[i].ID]
+		}
+	}
+	return nil
+}
+
+// ==================== 朋友圈通知 ====================
+
+// GetNotifications 获取互动通知列表
+func (s *MomentService) GetNotifications(userID string, page, pageSize int) ([]model.MomentNotification, error) {
+	offset := (page - 1) * pageSize
+	return s.momentRepo.GetNotifications(userID, offset, pageSize)
+}
+
+// GetUnreadNotificationCount 获取未读互动通知数
+func (s *MomentService) GetUnreadNotificationCount(userID string) (int64, error) {
+	return s.momentRepo.CountUnreadNotifications(userID)
+}
+
+// MarkNotificationsRead 标记互动通知为已读（ids 为空时全部标记）
+func (s *MomentService) MarkNotificationsRead(userID string, ids []uint) error {
+	return s.momentRepo.MarkNotificationsRead(userID, ids)
+}
+
+// GetNewTimelineCount 统计某时间之后时间线中好友发布的新动态数（不含自己）
+func (s *MomentService) GetNewTimelineCount(userID string, since time.Time) (int64, error) {
+	friendIDs, err := s.friendRepo.GetFriendIDs(userID)
+	if err != nil {
+		return 0, err
+	}
+	if len(friendIDs) == 0 {
+		return 0, nil
+	}
+	return s.momentRepo.CountFriendMomentsSince(friendIDs, userID, since)
+}
+
+// notify 保存互动通知并推送给在线的接收者，失败只记录日志
+func (s *MomentService) notify(notification *model.MomentNotification) {
+	if err := s.momentRepo.CreateNotification(notification); err != nil {
+		log.Printf("❌ 保存朋友圈通知失败: %v", err)
+		return
+	}
+
+	if pkg.GlobalHub == nil {
+		return
+	}
+	if !pkg.GlobalHub.IsUserOnline(notification.UserID) {
+		return
+	}
+
+	data := map[string]interface{}{
+		"id":         notification.ID,
+		"type":       notification.Type,
+		"moment_id":  notification.MomentID,
+		"comment_id": notification.CommentID,
+		"content":    notification.Content,
+		"created_at": notification.CreatedAt,
+	}
+	if actor, err := s.userRepo.FindByUserID(notification.ActorID); err == nil && actor != nil {
+		data["actor"] = map[string]interface{}{
+			"user_id":  actor.UserID,
+			"nickname": actor.Nickname,
+			"avatar":   actor.Avatar,
+		}
+	}
+	_ = pkg.GlobalHub.SendMomentNotification(notification.UserID, data)
 }
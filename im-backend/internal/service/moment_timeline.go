@@ -0,0 +1,291 @@
+package service
+
+import (
+	"context"
+	"im-backend/internal/model"
+	"im-backend/internal/pkg"
+	"im-backend/internal/repository"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 时间线缓存：每个用户一个有序集合，成员和分数都是动态ID（ID单调递增，可直接作为游标）
+const (
+	TimelinePrefix      = "timeline:"
+	timelineCacheSize   = 500                // 每个用户缓存的动态数量上限
+	timelineTTL         = 7 * 24 * time.Hour // 不活跃用户的缓存过期时间
+	timelineSentinel    = "0"                // 占位成员，存在时表示缓存包含完整历史（未被裁剪），也保证空时间线能命中缓存
+	timelineFanOutBatch = 500                // 每次脚本调用写入的时间线数量
+)
+
+// timelineAddScript 只向已存在的时间线写入并裁剪长度
+// 不存在的时间线在下次读取时从数据库重建，避免生成不完整的缓存；
+// 占位成员分数最低，超出长度时最先被裁掉，此后缓存之外还有更早的动态
+var timelineAddScript = redis.NewScript(`
+for _, key in ipairs(KEYS) do
+	if redis.call('EXISTS', key) == 1 then
+		redis.call('ZADD', key, ARGV[1], ARGV[1])
+		redis.call('ZREMRANGEBYRANK', key, 0, -(tonumber(ARGV[2]) + 2))
+	end
+end
+return 0
+`)
+
+// MomentTimeline 写扩散的朋友圈时间线
+// 发布时写入作者及可见好友的时间线，删除、解除好友、拉黑和可见范围变化时裁剪；
+// Redis不可用或翻页超出已裁剪的缓存范围时回退到数据库查询
+type MomentTimeline struct {
+	momentRepo *repository.MomentRepository
+	friendRepo *repository.FriendRepository
+}
+
+func NewMomentTimeline(momentRepo *repository.MomentRepository, friendRepo *repository.FriendRepository) *MomentTimeline {
+	return &MomentTimeline{
+		momentRepo: momentRepo,
+		friendRepo: friendRepo,
+	}
+}
+
+// Read 按游标读取时间线，cursor 为上一页最后一条动态的ID，0表示从最新开始
+func (t *MomentTimeline) Read(userID string, cursor uint, limit int) ([]model.Moment, error) {
+	ids, complete, err := t.readCachedIDs(userID, cursor, limit)
+	if err != nil {
+		log.Printf("⚠️ 读取时间线缓存失败，回退数据库: %v", err)
+		return t.readFromDB(userID, cursor, limit)
+	}
+
+	// 缓存已被裁剪且不足一页时，游标已超出缓存范围，更早的动态只能查询数据库
+	if len(ids) < limit && !complete {
+		return t.readFromDB(userID, cursor, limit)
+	}
+
+	moments, err := t.momentRepo.FindVisibleMomentsByIDs(ids, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 存在已失效的条目（被删除或不再可见）时清理缓存并以数据库结果为准
+	if len(moments) < len(ids) {
+		visible := make(map[uint]bool, len(moments))
+		for _, moment := range moments {
+			visible[moment.ID] = true
+		}
+		var stale []uint
+		for _, id := range ids {
+			if !visible[id] {
+				stale = append(stale, id)
+			}
+		}
+		t.removeFromTimelines([]string{userID}, stale)
+		return t.readFromDB(userID, cursor, limit)
+	}
+
+	return moments, nil
+}
+
+// FanOut 将新发布的动态写入作者和可见好友的时间线
+func (t *MomentTimeline) FanOut(moment *model.Moment) {
+	viewerIDs, err := t.momentRepo.GetMomentViewerIDs(moment.ID)
+	if err != nil {
+		log.Printf("❌ 计算动态 %d 的可见用户失败: %v", moment.ID, err)
+		return
+	}
+	t.addToTimelines(append(viewerIDs, moment.UserID), moment.ID)
+}
+
+// Refresh 动态可见范围变化后重新分发：移出不再可见的好友时间线，写入新增可见的好友时间线
+func (t *MomentTimeline) Refresh(moment *model.Moment) {
+	friendIDs, err := t.friendRepo.GetFriendIDs(moment.UserID)
+	if err != nil {
+		log.Printf("❌ 获取好友列表失败: %v", err)
+		return
+	}
+	viewerIDs, err := t.momentRepo.GetMomentViewerIDs(moment.ID)
+	if err != nil {
+		log.Printf("❌ 计算动态 %d 的可见用户失败: %v", moment.ID, err)
+		return
+	}
+
+	visible := make(map[string]bool, len(viewerIDs))
+	for _, id := range viewerIDs {
+		visible[id] = true
+	}
+	var hidden []string
+	for _, id := range friendIDs {
+		if !visible[id] {
+			hidden = append(hidden, id)
+		}
+	}
+
+	t.removeFromTimelines(hidden, []uint{moment.ID})
+	t.addToTimelines(append(viewerIDs, moment.UserID), moment.ID)
+}
+
+// Remove 从作者及其好友的时间线中移除已删除的动态
+func (t *MomentTimeline) Remove(moment *model.Moment) {
+	friendIDs, err := t.friendRepo.GetFriendIDs(moment.UserID)
+	if err != nil {
+		log.Printf("❌ 获取好友列表失败: %v", err)
+	}
+	t.removeFromTimelines(append(friendIDs, moment.UserID), []uint{moment.ID})
+}
+
+// RemoveAuthor 从 userID 的时间线中移除 authorID 发布的全部动态（解除好友或拉黑时）
+func (t *MomentTimeline) RemoveAuthor(userID, authorID string) {
+	ids, err := t.momentRepo.GetMomentIDsByUser(authorID)
+	if err != nil {
+		log.Printf("❌ 获取用户动态失败: %v", err)
+		return
+	}
+	t.removeFromTimelines([]string{userID}, ids)
+}
+
+// Invalidate 清除用户的时间线缓存，下次读取时从数据库重建（新增好友等需要补充历史动态时）
+func (t *MomentTimeline) Invalidate(userIDs ...string) {
+	keys := make([]string, 0, len(userIDs))
+	for _, userID := range userIDs {
+		keys = append(keys, TimelinePrefix+userID)
+	}
+	if err := pkg.RDB.Del(context.Background(), keys...).Err(); err != nil {
+		log.Printf("⚠️ 清除时间线缓存失败: %v", err)
+	}
+}
+
+// readCachedIDs 从缓存读取一页动态ID，缓存不存在时先从数据库重建
+// complete 表示缓存包含完整历史，此时不足一页说明已经没有更早的动态
+func (t *MomentTimeline) readCachedIDs(userID string, cursor uint, limit int) (ids []uint, complete bool, err error) {
+	ctx := context.Background()
+	key := TimelinePrefix + userID
+
+	exists, err := pkg.RDB.Exists(ctx, key).Result()
+	if err != nil {
+		return nil, false, err
+	}
+	if exists == 0 {
+		if err := t.rebuild(userID); err != nil {
+			return nil, false, err
+		}
+	}
+
+	max := "+inf"
+	if cursor > 0 {
+		max = "(" + strconv.FormatUint(uint64(cursor), 10)
+	}
+	pipe := pkg.RDB.Pipeline()
+	rangeCmd := pipe.ZRevRangeByScore(ctx, key, &redis.ZRangeBy{
+		Max:   max,
+		Min:   "(" + timelineSentinel,
+		Count: int64(limit),
+	})
+	sentinelCmd := pipe.ZScore(ctx, key, timelineSentinel)
+	pipe.Expire(ctx, key, timelineTTL)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, false, err
+	}
+	members, err := rangeCmd.Result()
+	if err != nil {
+		return nil, false, err
+	}
+	complete = sentinelCmd.Err() == nil
+
+	ids = make([]uint, 0, len(members))
+	for _, member := range members {
+		id, err := strconv.ParseUint(member, 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, complete, nil
+}
+
+// rebuild 从数据库加载最新的动态ID重建时间线缓存
+func (t *MomentTimeline) rebuild(userID string) error {
+	authorIDs, err := t.authorIDs(userID)
+	if err != nil {
+		return err
+	}
+	ids, err := t.momentRepo.GetTimelineMomentIDs(authorIDs, userID, timelineCacheSize)
+	if err != nil {
+		return err
+	}
+
+	// 不足缓存上限说明已加载全部历史，加入占位成员；否则更早的动态只在数据库中
+	members := make([]redis.Z, 0, len(ids)+1)
+	if len(ids) < timelineCacheSize {
+		members = append(members, redis.Z{Score: 0, Member: timelineSentinel})
+	}
+	for _, id := range ids {
+		members = append(members, redis.Z{Score: float64(id), Member: strconv.FormatUint(uint64(id), 10)})
+	}
+
+	ctx := context.Background()
+	key := TimelinePrefix + userID
+	pipe := pkg.RDB.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.ZAdd(ctx, key, members...)
+	pipe.Expire(ctx, key, timelineTTL)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// readFromDB 直接从数据库按游标读取时间线
+func (t *MomentTimeline) readFromDB(userID string, cursor uint, limit int) ([]model.Moment, error) {
+	authorIDs, err := t.authorIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	return t.momentRepo.GetTimelineMoments(authorIDs, userID, cursor, limit)
+}
+
+// authorIDs 时间线包含的作者：自己和全部好友（可见性由统一策略过滤）
+func (t *MomentTimeline) authorIDs(userID string) ([]string, error) {
+	friendIDs, err := t.friendRepo.GetFriendIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	return append(friendIDs, userID), nil
+}
+
+// addToTimelines 将动态写入一批用户已存在的时间线
+func (t *MomentTimeline) addToTimelines(userIDs []string, momentID uint) {
+	ctx := context.Background()
+	for start := 0; start < len(userIDs); start += timelineFanOutBatch {
+		end := start + timelineFanOutBatch
+		if end > len(userIDs) {
+			end = len(userIDs)
+		}
+		keys := make([]string, 0, end-start)
+		for _, userID := range userIDs[start:end] {
+			keys = append(keys, TimelinePrefix+userID)
+		}
+		if err := timelineAddScript.Run(ctx, pkg.RDB, keys, momentID, timelineCacheSize).Err(); err != nil {
+			log.Printf("⚠️ 写入时间线失败: %v", err)
+			return
+		}
+	}
+}
+
+// removeFromTimelines 从一批用户的时间线中移除指定动态
+func (t *MomentTimeline) removeFromTimelines(userIDs []string, momentIDs []uint) {
+	if len(userIDs) == 0 || len(momentIDs) == 0 {
+		return
+	}
+
+	members := make([]interface{}, 0, len(momentIDs))
+	for _, id := range momentIDs {
+		members = append(members, strconv.FormatUint(uint64(id), 10))
+	}
+
+	ctx := context.Background()
+	pipe := pkg.RDB.Pipeline()
+	for _, userID := range userIDs {
+		pipe.ZRem(ctx, TimelinePrefix+userID, members...)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("⚠️ 裁剪时间线失败: %v", err)
+	}
+}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"im-backend/internal/model"
+	"im-backend/internal/pkg"
+	"im-backend/internal/repository"
+	"log"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// OIDCStatePrefix 授权请求的 state，保存 nonce 和 PKCE code_verifier，回调时一次性取出
+const OIDCStatePrefix = "oidc_state:"
+
+// 单点登录限制
+const (
+	oidcStateTTL          = 10 * time.Minute
+	oidcUserIDMaxLength   = 20
+	oidcNicknameMaxLength = 50
+	oidcUserIDAttempts    = 5 // 生成的用户ID冲突时追加随机后缀的重试次数
+)
+
+// OIDCService OpenID Connect 单点登录
+// 已关联的外部身份直接登录；未关联时按已验证的邮箱关联已有用户，否则自动创建用户
+type OIDCService struct {
+	userRepo  *repository.UserRepository
+	providers map[string]*pkg.OIDCProvider
+}
+
+func NewOIDCService(userRepo *repository.UserRepository, providers map[string]*pkg.OIDCProvider) *OIDCService {
+	return &OIDCService{userRepo: userRepo, providers: providers}
+}
+
+// Providers 已配置的身份提供方名称
+func (s *OIDCService) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AuthorizationURL 生成授权地址，state、nonce 和 code_verifier 保存在 Redis 中等待回调
+func (s *OIDCService) AuthorizationURL(providerName string) (string, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return "", errors.New("不支持的登录方式")
+	}
+
+	var values [3]string
+	for i := range values {
+		value, err := pkg.RandomToken(32)
+		if err != nil {
+			return "", err
+		}
+		values[i] = value
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	ctx := context.Background()
+	key := OIDCStatePrefix + state
+	pipe := pkg.RDB.TxPipeline()
+	pipe.HSet(ctx, key, "provider", providerName, "nonce", nonce, "verifier", verifier)
+	pipe.Expire(ctx, key, oidcStateTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+
+	return provider.AuthCodeURL(ctx, state, nonce, verifier)
+}
+
+// Callback 处理授权回调：校验 state，用授权码换取并校验 ID Token，返回对应的用户
+func (s *OIDCService) Callback(providerName, state, code string) (*model.User, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return nil, errors.New("不支持的登录方式")
+	}
+	if state == "" || code == "" {
+		return nil, errors.New("参数错误")
+	}
+
+	// state 只能使用一次
+	ctx := context.Background()
+	key := OIDCStatePrefix + state
+	pipe := pkg.RDB.TxPipeline()
+	stateCmd := pipe.HGetAll(ctx, key)
+	pipe.Del(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	saved := stateCmd.Val()
+	if len(saved) == 0 || saved["provider"] != providerName {
+		return nil, errors.New("登录请求已过期，请重新登录")
+	}
+
+	rawToken, err := provider.Exchange(ctx, code, saved["verifier"])
+	if err != nil {
+		log.Printf("❌ OIDC 授权码兑换失败 provider=%s: %v", providerName, err)
+		return nil, errors.New("单点登录失败，请重试")
+	}
+	claims, err := provider.VerifyIDToken(ctx, rawToken, saved["nonce"])
+	if err != nil {
+		log.Printf("❌ OIDC ID Token 校验失败 provider=%s: %v", providerName, err)
+		return nil, errors.New("单点登录失败，请重试")
+	}
+
+	return s.resolveUser(providerName, claims)
+}
+
+// resolveUser 查找或创建外部身份对应的用户
+func (s *OIDCService) resolveUser(providerName string, claims *pkg.OIDCClaims) (*model.User, error) {
+	if identity, err := s.userRepo.FindIdentity(providerName, claims.Subject); err == nil {
+		user, err := s.userRepo.FindByUserID(identity.UserID)
+		if err != nil {
+			return nil, errors.New("关联的用户不存在")
+		}
+		return user, nil
+	}
+
+	// 只有身份提供方验证过的邮箱才能关联或创建用户，避免通过未验证邮箱接管已有账号
+	email := strings.TrimSpace(claims.Email)
+	if email == "" || !bool(claims.EmailVerified) {
+		return nil, errors.New("身份提供方未提供已验证的邮箱，无法登录")
+	}
+
+	identity := &model.UserIdentity{
+		Provider:  providerName,
+		Subject:   claims.Subject,
+		Email:     email,
+		CreatedAt: time.Now(),
+	}
+
+	if user, err := s.userRepo.FindByEmail(email); err == nil {
+		identity.UserID = user.UserID
+		if err := s.userRepo.CreateIdentity(identity); err != nil {
+			return nil, err
+		}
+		log.Printf("✅ OIDC 身份已关联已有用户 provider=%s user=%s", providerName, user.UserID)
+		return user, nil
+	}
+
+	return s.provisionUser(claims, email, identity)
+}
+
+// provisionUser 首次单点登录时创建用户，用户ID取自 preferred_username 或邮箱前缀
+func (s *OIDCService) provisionUser(claims *pkg.OIDCClaims, email string, identity *model.UserIdentity) (*model.User, error) {
+	localPart, _, _ := strings.Cut(email, "@")
+	base := sanitizeUserID(claims.PreferredUsername)
+	if base == "" {
+		base = sanitizeUserID(localPart)
+	}
+	if base == "" {
+		base = "user"
+	}
+
+	nickname := strings.TrimSpace(claims.Name)
+	if nickname == "" {
+		nickname = strings.TrimSpace(claims.PreferredUsername)
+	}
+	if nickname == "" {
+		nickname = localPart
+	}
+	nickname = truncateRunes(nickname, oidcNicknameMaxLength)
+
+	userID := base
+	for attempt := 0; attempt < oidcUserIDAttempts; attempt++ {
+		if exists, err := s.userRepo.UserIDExists(userID); err == nil && !exists {
+			user := &model.User{
+				UserID:    userID,
+				Email:     email,
+				Nickname:  nickname,
+				CreatedAt: time.Now(),
+			}
+			if err := s.userRepo.CreateWithIdentity(user, identity); err != nil {
+				return nil, err
+			}
+			log.Printf("✅ OIDC 首次登录已创建用户 provider=%s user=%s", identity.Provider, user.UserID)
+			return user, nil
+		}
+
+		suffix, err := rand.Int(rand.Reader, big.NewInt(10000))
+		if err != nil {
+			return nil, err
+		}
+		tail := fmt.Sprintf("_%04d", suffix.Int64())
+		userID = truncateRunes(base, oidcUserIDMaxLength-len(tail)) + tail
+	}
+	return nil, errors.New("无法生成可用的用户ID，请重试")
+}
+
+// sanitizeUserID 只保留字母、数字和下划线，英文转小写
+func sanitizeUserID(value string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(value)) {
+		switch {
+		case r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)) || r == '_':
+			b.WriteRune(r)
+		case r == '.' || r == '-':
+			b.WriteRune('_')
+		}
+	}
+	return truncateRunes(strings.Trim(b.String(), "_"), oidcUserIDMaxLength)
+}
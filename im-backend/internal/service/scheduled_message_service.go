@@ -0,0 +1,198 @@
+package service
+
+import (
+	"errors"
+	"im-backend/internal/model"
+	"im-backend/internal/pkg"
+	"im-backend/internal/repository"
+	"log"
+	"strings"
+	"time"
+)
+
+// 定时消息限制
+const (
+	maxScheduleAhead      = 365 * 24 * time.Hour // 最多提前一年
+	scheduledDispatchSize = 100                  // 每轮最多投递的消息数
+	scheduledSendLease    = 5 * time.Minute      // 发送中状态的租约，超过后视为投递实例已退出
+)
+
+type ScheduledMessageService struct {
+	scheduledRepo  *repository.ScheduledMessageRepository
+	messageService *MessageService
+	groupService   *GroupService
+}
+
+func NewScheduledMessageService(scheduledRepo *repository.ScheduledMessageRepository, messageService *MessageService, groupService *GroupService) *ScheduledMessageService {
+	return &ScheduledMessageService{
+		scheduledRepo:  scheduledRepo,
+		messageService: messageService,
+		groupService:   groupService,
+	}
+}
+
+// CreateScheduledMessage 创建定时消息
+// 好友关系、群成员身份和禁言状态在实际发送时校验
+func (s *ScheduledMessageService) CreateScheduledMessage(userID string, targetType int, targetID string, messageType int, content, mediaURL, atUsers string, sendAt time.Time) (*model.ScheduledMessage, error) {
+	if targetType != model.ScheduledTargetUser && targetType != model.ScheduledTargetGroup {
+		return nil, errors.New("无效的目标类型")
+	}
+	if targetID == "" {
+		return nil, errors.New("目标ID不能为空")
+	}
+	if targetType == model.ScheduledTargetUser && targetID == userID {
+		return nil, errors.New("不能给自己发送消息")
+	}
+	if messageType < model.MessageTypeText || messageType > model.MessageTypeFile {
+		return nil, errors.New("无效的消息类型")
+	}
+	if messageType == model.MessageTypeText && strings.TrimSpace(content) == "" {
+		return nil, errors.New("文本消息内容不能为空")
+	}
+
+	now := time.Now()
+	if !sendAt.After(now) {
+		return nil, errors.New("发送时间必须晚于当前时间")
+	}
+	if sendAt.After(now.Add(maxScheduleAhead)) {
+		return nil, errors.New("发送时间不能超过一年")
+	}
+
+	message := &model.ScheduledMessage{
+		UserID:      userID,
+		TargetType:  targetType,
+		TargetID:    targetID,
+		MessageType: messageType,
+		Content:     content,
+		MediaURL:    mediaURL,
+		AtUsers:     atUsers,
+		SendAt:      sendAt,
+		Status:      model.ScheduledStatusPending,
+		CreatedAt:   now,
+	}
+
+	if err := s.scheduledRepo.Create(message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// GetScheduledMessages 获取用户的定时消息列表
+func (s *ScheduledMessageService) GetScheduledMessages(userID string, status, page, pageSize int) ([]model.ScheduledMessage, error) {
+	return s.scheduledRepo.GetUserScheduledMessages(userID, status, page, pageSize)
+}
+
+// CancelScheduledMessage 取消定时消息
+func (s *ScheduledMessageService) CancelScheduledMessage(id uint, userID string) error {
+	message, err := s.scheduledRepo.FindByID(id)
+	if err != nil || message.UserID != userID {
+		return errors.New("定时消息不存在")
+	}
+
+	ok, err := s.scheduledRepo.Cancel(id, userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("该定时消息已发送或已取消")
+	}
+	return nil
+}
+
+// Run 定时投递到期消息（阻塞运行，需在goroutine中调用）
+func (s *ScheduledMessageService) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.DispatchDue(time.Now())
+	}
+}
+
+// DispatchDue 投递所有已到时间的定时消息
+func (s *ScheduledMessageService) DispatchDue(now time.Time) {
+	// 租约过期的发送中消息可能已经发出，标记为失败由用户确认，避免重复发送
+	if n, err := s.scheduledRepo.FailStaleSending(now.Add(-scheduledSendLease), "投递中断，请确认对方是否已收到"); err != nil {
+		log.Printf("❌ 处理中断的定时消息失败: %v", err)
+	} else if n > 0 {
+		log.Printf("⚠️ %d 条定时消息投递中断，已标记为发送失败", n)
+	}
+
+	for {
+		messages, err := s.scheduledRepo.FindDue(now, scheduledDispatchSize)
+		if err != nil {
+			log.Printf("❌ 查询到期定时消息失败: %v", err)
+			return
+		}
+
+		for i := range messages {
+			s.dispatch(&messages[i])
+		}
+
+		if len(messages) < scheduledDispatchSize {
+			return
+		}
+	}
+}
+
+// dispatch 投递单条定时消息
+func (s *ScheduledMessageService) dispatch(scheduled *model.ScheduledMessage) {
+	ok, err := s.scheduledRepo.Claim(scheduled.ID, time.Now())
+	if err != nil {
+		log.Printf("❌ 抢占定时消息 %d 失败: %v", scheduled.ID, err)
+		return
+	}
+	if !ok {
+		// 已被取消或被其他实例处理
+		return
+	}
+
+	var sentID uint
+	switch scheduled.TargetType {
+	case model.ScheduledTargetUser:
+		message, sendErr := s.messageService.SendMessage(scheduled.UserID, scheduled.TargetID, scheduled.MessageType, scheduled.Content, scheduled.MediaURL)
+		if sendErr == nil {
+			sentID = message.ID
+			if !message.HiddenFromReceiver {
+				s.pushToUser(scheduled.TargetID, message)
+			}
+		}
+		err = sendErr
+	case model.ScheduledTargetGroup:
+		message, sendErr := s.groupService.SendGroupMessage(scheduled.TargetID, scheduled.UserID, scheduled.MessageType, scheduled.Content, scheduled.MediaURL, scheduled.AtUsers)
+		if sendErr == nil {
+			sentID = message.ID
+		}
+		err = sendErr
+	default:
+		err = errors.New("无效的目标类型")
+	}
+
+	if err != nil {
+		log.Printf("⚠️ 定时消息 %d 发送失败: %v", scheduled.ID, err)
+		if markErr := s.scheduledRepo.MarkFailed(scheduled.ID, truncateRunes(err.Error(), 255)); markErr != nil {
+			log.Printf("❌ 更新定时消息 %d 状态失败: %v", scheduled.ID, markErr)
+		}
+		return
+	}
+
+	if err := s.scheduledRepo.MarkSent(scheduled.ID, sentID, time.Now()); err != nil {
+		log.Printf("❌ 更新定时消息 %d 状态失败: %v", scheduled.ID, err)
+	}
+}
+
+// pushToUser 通过WebSocket推送新消息给在线的接收方
+func (s *ScheduledMessageService) pushToUser(userID string, message interface{}) {
+	if pkg.GlobalHub != nil && pkg.GlobalHub.IsUserOnline(userID) {
+		_ = pkg.GlobalHub.SendToUser(userID, message)
+	}
+}
+
+// truncateRunes 按字符截断字符串
+func truncateRunes(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max])
+}
@@ -0,0 +1,324 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"im-backend/internal/model"
+	"im-backend/internal/pkg"
+	"im-backend/internal/repository"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	TwoFactorSetupPrefix     = "2fa_setup:"     // 待确认的 TOTP 密钥，键为 前缀+用户ID
+	TwoFactorChallengePrefix = "2fa_challenge:" // 登录第二步的挑战令牌
+	TwoFactorUsedPrefix      = "2fa_used:"      // 已使用的 TOTP 时间步，防止验证码重放
+)
+
+// 两步验证限制
+const (
+	twoFactorIssuer          = "Esy-IM"
+	twoFactorSetupTTL        = 10 * time.Minute // 开启流程中待确认密钥的有效期
+	twoFactorChallengeTTL    = 5 * time.Minute  // 登录挑战令牌的有效期
+	twoFactorMaxAttempts     = 5                // 挑战令牌允许的错误次数，达到后作废
+	recoveryCodeCount        = 10
+	recoveryCodeLength       = 10
+	recoveryCodeAlphabet     = "abcdefghjkmnpqrstuvwxyz23456789" // 去掉易混淆的 i l o 0 1
+	twoFactorChallengeLength = 24
+)
+
+// twoFactorChallengeScript 记录一次失败的第二步验证，达到上限后挑战令牌作废
+var twoFactorChallengeScript = redis.NewScript(`
+if redis.call('HINCRBY', KEYS[1], 'attempts', 1) >= tonumber(ARGV[1]) then
+	redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// TwoFactorSetup 开启两步验证时返回给客户端的密钥
+type TwoFactorSetup struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+// TwoFactorChallenge 开启两步验证的用户登录第一步返回的挑战
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+	ExpiresIn         int64  `json:"expires_in"`
+}
+
+// TwoFactorService TOTP 两步验证（RFC 6238）和一次性恢复码
+// 验证码错误与密码错误一样经过 LoginGuard 按账号计数和锁定，挑战令牌本身的错误上限只是额外限制
+type TwoFactorService struct {
+	userRepo   *repository.UserRepository
+	loginGuard *LoginGuard
+}
+
+func NewTwoFactorService(userRepo *repository.UserRepository, loginGuard *LoginGuard) *TwoFactorService {
+	return &TwoFactorService{userRepo: userRepo, loginGuard: loginGuard}
+}
+
+// Setup 生成待确认的 TOTP 密钥，用户在验证器App中添加后调用 Enable 确认
+func (s *TwoFactorService) Setup(userID string) (*TwoFactorSetup, error) {
+	user, err := s.userRepo.FindByUserID(userID)
+	if err != nil {
+		return nil, errors.New("用户不存在")
+	}
+	if user.TwoFactorEnabled {
+		return nil, errors.New("两步验证已开启")
+	}
+
+	secret, err := pkg.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := pkg.RDB.Set(context.Background(), TwoFactorSetupPrefix+user.UserID, secret, twoFactorSetupTTL).Err(); err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorSetup{
+		Secret:     secret,
+		OTPAuthURI: pkg.TOTPURI(twoFactorIssuer, user.Email, secret),
+	}, nil
+}
+
+// Enable 用验证器App生成的验证码确认密钥并开启两步验证，返回一次性恢复码（只展示这一次）
+func (s *TwoFactorService) Enable(userID, code string) ([]string, error) {
+	user, err := s.userRepo.FindByUserID(userID)
+	if err != nil {
+		return nil, errors.New("用户不存在")
+	}
+	if user.TwoFactorEnabled {
+		return nil, errors.New("两步验证已开启")
+	}
+
+	ctx := context.Background()
+	secret, err := pkg.RDB.Get(ctx, TwoFactorSetupPrefix+user.UserID).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, errors.New("请先获取两步验证密钥")
+	} else if err != nil {
+		return nil, err
+	}
+	if !s.checkTOTP(user.UserID, secret, code) {
+		return nil, errors.New("验证码错误")
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.EnableTwoFactor(user.UserID, secret, hashes); err != nil {
+		return nil, err
+	}
+	pkg.RDB.Del(ctx, TwoFactorSetupPrefix+user.UserID)
+	return codes, nil
+}
+
+// Disable 关闭两步验证，需要当前的 TOTP 验证码或恢复码
+func (s *TwoFactorService) Disable(userID, code string, client LoginClient) error {
+	user, err := s.enabledUser(userID)
+	if err != nil {
+		return err
+	}
+	if err := s.guardedVerify(user, code, "", client); err != nil {
+		return err
+	}
+	return s.userRepo.DisableTwoFactor(user.UserID)
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，旧的恢复码全部作废
+func (s *TwoFactorService) RegenerateRecoveryCodes(userID, code string, client LoginClient) ([]string, error) {
+	user, err := s.enabledUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.guardedVerify(user, code, "", client); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.ReplaceRecoveryCodes(user.UserID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Status 查询两步验证状态和剩余恢复码数量
+func (s *TwoFactorService) Status(userID string) (map[string]interface{}, error) {
+	user, err := s.userRepo.FindByUserID(userID)
+	if err != nil {
+		return nil, errors.New("用户不存在")
+	}
+	remaining, err := s.userRepo.CountUnusedRecoveryCodes(user.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"enabled":                  user.TwoFactorEnabled,
+		"recovery_codes_remaining": remaining,
+	}, nil
+}
+
+// CreateChallenge 第一步验证通过后创建挑战令牌，用户凭令牌和第二因素换取正式的登录令牌
+// method 为第一步的登录方式，用于登录记录
+func (s *TwoFactorService) CreateChallenge(userID, method string) (*TwoFactorChallenge, error) {
+	token, err := pkg.RandomToken(twoFactorChallengeLength)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	key := TwoFactorChallengePrefix + token
+	pipe := pkg.RDB.TxPipeline()
+	pipe.HSet(ctx, key, "user_id", userID, "method", method, "attempts", 0)
+	pipe.Expire(ctx, key, twoFactorChallengeTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorChallenge{
+		TwoFactorRequired: true,
+		ChallengeToken:    token,
+		ExpiresIn:         int64(twoFactorChallengeTTL.Seconds()),
+	}, nil
+}
+
+// VerifyChallenge 校验挑战令牌和第二因素（TOTP 验证码或恢复码），成功后令牌作废
+// 返回用户和第一步的登录方式
+func (s *TwoFactorService) VerifyChallenge(challengeToken, code string, client LoginClient) (*model.User, string, error) {
+	ctx := context.Background()
+	key := TwoFactorChallengePrefix + challengeToken
+	challenge, err := pkg.RDB.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, "", err
+	}
+	if challenge["user_id"] == "" {
+		return nil, "", errors.New("登录已过期，请重新登录")
+	}
+
+	method := challenge["method"]
+	if method == "" {
+		method = model.LoginMethodPassword
+	}
+
+	user, err := s.enabledUser(challenge["user_id"])
+	if err != nil {
+		return nil, "", err
+	}
+	if err := s.guardedVerify(user, code, method, client); err != nil {
+		_ = twoFactorChallengeScript.Run(ctx, pkg.RDB, []string{key}, twoFactorMaxAttempts).Err()
+		return nil, "", err
+	}
+
+	// 同一挑战令牌只能换取一次登录令牌
+	deleted, err := pkg.RDB.Del(ctx, key).Result()
+	if err != nil {
+		return nil, "", err
+	}
+	if deleted == 0 {
+		return nil, "", errors.New("登录已过期，请重新登录")
+	}
+	return user, method, nil
+}
+
+// enabledUser 获取已开启两步验证的用户
+func (s *TwoFactorService) enabledUser(userID string) (*model.User, error) {
+	user, err := s.userRepo.FindByUserID(userID)
+	if err != nil {
+		return nil, errors.New("用户不存在")
+	}
+	if !user.TwoFactorEnabled {
+		return nil, errors.New("未开启两步验证")
+	}
+	return user, nil
+}
+
+// guardedVerify 账号未锁定时校验第二因素，错误计入账号和IP的失败次数
+// method 为登录方式，登录流程之外的校验传空字符串
+func (s *TwoFactorService) guardedVerify(user *model.User, code, method string, client LoginClient) error {
+	if err := s.loginGuard.Check(user.UserID, client.IP); err != nil {
+		return err
+	}
+	if err := s.verifySecondFactor(user, code); err != nil {
+		s.loginGuard.RecordUserFailure(user, method, client, "两步验证失败: "+err.Error())
+		return err
+	}
+	return nil
+}
+
+// verifySecondFactor 校验 TOTP 验证码或恢复码
+func (s *TwoFactorService) verifySecondFactor(user *model.User, code string) error {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return errors.New("请输入验证码或恢复码")
+	}
+	if len(code) == pkg.TOTPDigits {
+		if s.checkTOTP(user.UserID, user.TwoFactorSecret, code) {
+			return nil
+		}
+		return errors.New("验证码错误")
+	}
+
+	ok, err := s.userRepo.UseRecoveryCode(user.UserID, hashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("恢复码错误或已使用")
+	}
+	return nil
+}
+
+// checkTOTP 校验 TOTP 验证码，同一时间步的验证码只能使用一次
+func (s *TwoFactorService) checkTOTP(userID, secret, code string) bool {
+	step, ok := pkg.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return false
+	}
+	key := TwoFactorUsedPrefix + userID + ":" + strconv.FormatInt(step, 10)
+	fresh, err := pkg.RDB.SetNX(context.Background(), key, 1, 3*pkg.TOTPPeriod*time.Second).Result()
+	return err == nil && fresh
+}
+
+// generateRecoveryCodes 生成恢复码（xxxxx-xxxxx）及其哈希
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	alphabet := big.NewInt(int64(len(recoveryCodeAlphabet)))
+	for i := 0; i < recoveryCodeCount; i++ {
+		var b strings.Builder
+		for j := 0; j < recoveryCodeLength; j++ {
+			if j == recoveryCodeLength/2 {
+				b.WriteByte('-')
+			}
+			n, err := rand.Int(rand.Reader, alphabet)
+			if err != nil {
+				return nil, nil, err
+			}
+			b.WriteByte(recoveryCodeAlphabet[n.Int64()])
+		}
+		code := b.String()
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode 恢复码规范化（忽略大小写、空格和连字符）后取哈希
+func hashRecoveryCode(code string) string {
+	normalized := strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(strings.TrimSpace(code)))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
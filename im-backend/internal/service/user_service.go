@@ -3,22 +3,31 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
 	"im-backend/internal/model"
+	"im-backend/internal/pkg"
 	"im-backend/internal/repository"
+	"log"
+	"net/mail"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// EmailChangePrefix 待确认的邮箱修改，键为 前缀+用户ID，有效期与验证码一致
+const EmailChangePrefix = "email_change:"
+
 type UserService struct {
 	Repo        *repository.UserRepository
 	RDB         *redis.Client
 	CodeService *CodeService
+	LoginGuard  *LoginGuard
 }
 
-func NewUserService(repo *repository.UserRepository, rdb *redis.Client, codeService *CodeService) *UserService {
-	return &UserService{Repo: repo, RDB: rdb, CodeService: codeService}
+func NewUserService(repo *repository.UserRepository, rdb *redis.Client, codeService *CodeService, loginGuard *LoginGuard) *UserService {
+	return &UserService{Repo: repo, RDB: rdb, CodeService: codeService, LoginGuard: loginGuard}
 }
 
 //func NewUserService(repo *repository.UserRepository, rdb RedisClient, codeService *CodeService) *UserService {
@@ -27,25 +36,27 @@ func NewUserService(repo *repository.UserRepository, rdb *redis.Client, codeServ
 
 // Register ----------------- 注册 -----------------
 func (s *UserService) Register(ctx context.Context, email, code, userID, nickname string) error {
-	// 校验验证码
-	ok, err := s.CodeService.VerifyCode(email, code)
-	if err != nil {
-		return err
-	}
-	if !ok {
-		return errors.New("验证码错误或已过期")
-	}
-
 	// 检查邮箱是否已注册
 	if _, err := s.Repo.FindByEmail(email); err == nil {
 		return errors.New("邮箱已被注册")
 	}
 
 	// 检查用户ID是否已存在
-	if _, err := s.Repo.FindByUserID(userID); err == nil {
+	if exists, err := s.Repo.UserIDExists(userID); err != nil {
+		return err
+	} else if exists {
 		return errors.New("用户ID已存在")
 	}
 
+	// 校验并消耗验证码（一次性使用）
+	ok, err := s.CodeService.ConsumeCode(email, CodePurposeRegister, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("验证码错误或已过期")
+	}
+
 	// 创建用户
 	user := &model.User{
 		UserID:    userID,
@@ -53,20 +64,13 @@ func (s *UserService) Register(ctx context.Context, email, code, userID, nicknam
 		Nickname:  nickname,
 		CreatedAt: time.Now(),
 	}
-	if err := s.Repo.Create(user); err != nil {
-		return err
-	}
-
-	// 注册成功后清除验证码
-	_ = s.RDB.Del(ctx, CodePrefix+email).Err()
-
-	return nil
+	return s.Repo.Create(user)
 }
 
 // Login ----------------- 登录 -----------------
 func (s *UserService) Login(ctx context.Context, email, code string) (*model.User, error) {
-	// 校验验证码
-	ok, err := s.CodeService.VerifyCode(email, code)
+	// 校验并消耗验证码（一次性使用）
+	ok, err := s.CodeService.ConsumeCode(email, CodePurposeLogin, code)
 	if err != nil {
 		return nil, err
 	}
@@ -80,9 +84,6 @@ func (s *UserService) Login(ctx context.Context, email, code string) (*model.Use
 		return nil, errors.New("用户不存在，请先注册")
 	}
 
-	// 登录成功后清除验证码
-	_ = s.RDB.Del(ctx, CodePrefix+email).Err()
-
 	return user, nil
 }
 
@@ -103,7 +104,9 @@ func (s *UserService) RegisterWithPassword(ctx context.Context, email, userID, n
 		return errors.New("邮箱已被注册")
 	}
 	// 检查用户ID是否已存在
-	if _, err := s.Repo.FindByUserID(userID); err == nil {
+	if exists, err := s.Repo.UserIDExists(userID); err != nil {
+		return err
+	} else if exists {
 		return errors.New("用户ID已存在")
 	}
 
@@ -148,17 +151,101 @@ func (s *UserService) LoginWithPassword(ctx context.Context, account, password s
 	return user, nil
 }
 
-// SetPassword 设置或修改密码
-func (s *UserService) SetPassword(ctx context.Context, email, password string) error {
-	// 校验密码长度
-	if len(password) < 8 {
+// ChangePassword 修改密码：已设置密码时需要提供当前密码或重置验证码，未设置密码（验证码注册）时需要验证码
+// 修改成功后注销除当前会话外的全部登录会话
+func (s *UserService) ChangePassword(ctx context.Context, userID, sessionID, oldPassword, code, newPassword string, client LoginClient) error {
+	// 先校验新密码，避免新密码不合规时消耗验证码或计入当前密码的失败次数
+	if len(newPassword) < 8 {
+		return errors.New("密码长度至少8位")
+	}
+
+	user, err := s.Repo.FindByUserID(userID)
+	if err != nil || user == nil {
+		return errors.New("用户不存在")
+	}
+
+	switch {
+	case oldPassword != "" && user.Password != "":
+		ok, err := s.LoginGuard.CheckPassword(user, oldPassword, client)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("当前密码错误")
+		}
+	case code != "":
+		ok, err := s.CodeService.ConsumeCode(user.Email, CodePurposeReset, code)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("验证码错误或已过期")
+		}
+	case user.Password != "":
+		return errors.New("请提供当前密码或验证码")
+	default:
+		return errors.New("请提供验证码")
+	}
+
+	if err := s.updatePassword(user, newPassword); err != nil {
+		return err
+	}
+	if err := pkg.RevokeUserTokens(user.UserID, sessionID, s.RDB); err != nil {
+		log.Printf("⚠️ 注销用户 %s 的其他会话失败: %v", user.UserID, err)
+	}
+	s.notifyPasswordChanged(user.Email)
+	return nil
+}
+
+// SendResetCode 发送重置密码验证码
+// 无论邮箱是否注册、是否在冷却中、邮件是否发送成功都返回 nil，错误只记录日志；
+// 邮件在后台发送，响应时间也不随注册状态变化，避免被用来探测邮箱是否注册
+func (s *UserService) SendResetCode(ctx context.Context, email string) error {
+	if _, err := s.Repo.FindByEmail(email); err != nil {
+		return nil
+	}
+	go func() {
+		if err := s.CodeService.SendCode(email, CodePurposeReset); err != nil {
+			log.Printf("⚠️ 发送重置密码验证码失败: %v", err)
+		}
+	}()
+	return nil
+}
+
+// ResetPassword 忘记密码：通过邮箱验证码重置密码，并注销全部登录会话
+func (s *UserService) ResetPassword(ctx context.Context, email, code, newPassword string) error {
+	if len(newPassword) < 8 {
 		return errors.New("密码长度至少8位")
 	}
 
+	ok, err := s.CodeService.ConsumeCode(email, CodePurposeReset, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("验证码错误或已过期")
+	}
+
 	user, err := s.Repo.FindByEmail(email)
 	if err != nil || user == nil {
 		return errors.New("用户不存在")
 	}
+	if err := s.updatePassword(user, newPassword); err != nil {
+		return err
+	}
+	if err := pkg.RevokeUserTokens(user.UserID, "", s.RDB); err != nil {
+		log.Printf("⚠️ 注销用户 %s 的会话失败: %v", user.UserID, err)
+	}
+	s.notifyPasswordChanged(email)
+	return nil
+}
+
+// updatePassword 校验并保存新密码
+func (s *UserService) updatePassword(user *model.User, password string) error {
+	// 校验密码长度
+	if len(password) < 8 {
+		return errors.New("密码长度至少8位")
+	}
 
 	// 加密密码
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -170,14 +257,109 @@ func (s *UserService) SetPassword(ctx context.Context, email, password string) e
 	return s.Repo.UpdateField(user.UserID, "password", string(hashedPassword))
 }
 
-// FindByEmail 根据邮箱查找用户
-func (s *UserService) FindByEmail(email string) (interface{}, error) {
-	return s.Repo.FindByEmail(email)
+// notifyPasswordChanged 邮件通知用户密码已修改
+func (s *UserService) notifyPasswordChanged(email string) {
+	subject := "IM 系统密码已修改"
+	body := fmt.Sprintf("您的账号密码已于 %s 修改，其他设备上的登录已失效。如非本人操作，请立即通过忘记密码重置。",
+		time.Now().Format("2006-01-02 15:04:05"))
+	if err := pkg.SendEmail(email, subject, body); err != nil {
+		log.Printf("⚠️ 发送密码修改通知失败: %v", err)
+	}
+}
+
+// RequestEmailChange 修改邮箱第一步：向当前邮箱和新邮箱分别发送验证码
+func (s *UserService) RequestEmailChange(ctx context.Context, userID, newEmail string) error {
+	user, err := s.Repo.FindByUserID(userID)
+	if err != nil || user == nil {
+		return errors.New("用户不存在")
+	}
+
+	newEmail = strings.TrimSpace(newEmail)
+	if _, err := mail.ParseAddress(newEmail); err != nil || strings.ContainsAny(newEmail, "<> ") {
+		return errors.New("邮箱格式不正确")
+	}
+	if strings.EqualFold(newEmail, user.Email) {
+		return errors.New("新邮箱与当前邮箱相同")
+	}
+	if _, err := s.Repo.FindByEmail(newEmail); err == nil {
+		return errors.New("邮箱已被注册")
+	}
+
+	if err := s.CodeService.SendCode(user.Email, CodePurposeChangeEmail); err != nil {
+		return err
+	}
+	if err := s.CodeService.SendCode(newEmail, CodePurposeChangeEmail); err != nil {
+		return err
+	}
+	return s.RDB.Set(ctx, EmailChangePrefix+user.UserID, newEmail, codeTTL).Err()
+}
+
+// ConfirmEmailChange 修改邮箱第二步：两个邮箱的验证码都正确后更新邮箱，并注销全部登录会话
+func (s *UserService) ConfirmEmailChange(ctx context.Context, userID, oldCode, newCode string) (*model.User, error) {
+	user, err := s.Repo.FindByUserID(userID)
+	if err != nil || user == nil {
+		return nil, errors.New("用户不存在")
+	}
+	newEmail, err := s.RDB.Get(ctx, EmailChangePrefix+user.UserID).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, errors.New("修改邮箱请求已过期，请重新获取验证码")
+	} else if err != nil {
+		return nil, err
+	}
+
+	// 先分别预校验，两个都正确后再消耗，避免一个正确一个错误时白白作废正确的验证码
+	email := user.Email
+	for _, check := range []struct{ email, code string }{{email, oldCode}, {newEmail, newCode}} {
+		ok, err := s.CodeService.VerifyCode(check.email, CodePurposeChangeEmail, check.code)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("%s 的验证码错误或已过期", check.email)
+		}
+	}
+	for _, check := range []struct{ email, code string }{{email, oldCode}, {newEmail, newCode}} {
+		ok, err := s.CodeService.ConsumeCode(check.email, CodePurposeChangeEmail, check.code)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("%s 的验证码错误或已过期", check.email)
+		}
+	}
+
+	// 邮箱有唯一索引，并发注册同一邮箱时更新失败
+	if _, err := s.Repo.FindByEmail(newEmail); err == nil {
+		return nil, errors.New("邮箱已被注册")
+	}
+	if err := s.Repo.UpdateField(user.UserID, "email", newEmail); err != nil {
+		return nil, err
+	}
+	s.RDB.Del(ctx, EmailChangePrefix+user.UserID)
+	user.Email = newEmail
+
+	if err := pkg.RevokeUserTokens(user.UserID, "", s.RDB); err != nil {
+		log.Printf("⚠️ 注销用户 %s 的会话失败: %v", user.UserID, err)
+	}
+
+	go s.notifyEmailChanged(email, newEmail)
+	log.Printf("✅ 用户 %s 已修改邮箱", user.UserID)
+	return user, nil
+}
+
+// notifyEmailChanged 邮件通知原邮箱账号邮箱已修改
+func (s *UserService) notifyEmailChanged(oldEmail, newEmail string) {
+	subject := "IM 系统账号邮箱已修改"
+	body := fmt.Sprintf("您的账号邮箱已于 %s 修改为 %s，原邮箱不能再用于登录，所有设备上的登录已失效。如非本人操作，请立即联系管理员。",
+		time.Now().Format("2006-01-02 15:04:05"), newEmail)
+	if err := pkg.SendEmail(oldEmail, subject, body); err != nil {
+		log.Printf("⚠️ 发送邮箱修改通知失败: %v", err)
+	}
 }
 
 // UpdateProfile 更新用户资料
-func (s *UserService) UpdateProfile(ctx context.Context, email string, nickname, avatar *string) error {
-	user, err := s.Repo.FindByEmail(email)
+func (s *UserService) UpdateProfile(ctx context.Context, userID string, nickname, avatar *string) error {
+	user, err := s.Repo.FindByUserID(userID)
 	if err != nil || user == nil {
 		return errors.New("用户不存在")
 	}
@@ -194,3 +376,80 @@ func (s *UserService) UpdateProfile(ctx context.Context, email string, nickname,
 
 	return s.Repo.Update(user)
 }
+
+// 好友验证问题长度限制（字符数）
+const (
+	friendQuestionMaxLength = 100
+	friendAnswerMaxLength   = 50
+)
+
+// PrivacyUpdate 隐私设置修改，为空的字段保持不变
+type PrivacyUpdate struct {
+	SearchByID          *bool   `json:"search_by_id"`
+	SearchByEmail       *bool   `json:"search_by_email"`
+	FriendQuestion      *string `json:"friend_question"` // 设为空字符串表示取消验证问题
+	FriendAnswer        *string `json:"friend_answer"`   // 设置新问题时必填
+	AllowGroupStrangers *bool   `json:"allow_group_strangers"`
+	StrangerMoments     *bool   `json:"stranger_moments"`
+}
+
+// GetPrivacy 获取隐私设置
+func (s *UserService) GetPrivacy(ctx context.Context, userID string) (*model.UserPrivacy, error) {
+	return s.Repo.GetPrivacy(userID)
+}
+
+// UpdatePrivacy 修改隐私设置
+func (s *UserService) UpdatePrivacy(ctx context.Context, userID string, update PrivacyUpdate) (*model.UserPrivacy, error) {
+	privacy, err := s.Repo.GetPrivacy(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.SearchByID != nil {
+		privacy.SearchByID = *update.SearchByID
+	}
+	if update.SearchByEmail != nil {
+		privacy.SearchByEmail = *update.SearchByEmail
+	}
+	if update.AllowGroupStrangers != nil {
+		privacy.AllowGroupStrangers = *update.AllowGroupStrangers
+	}
+	if update.StrangerMoments != nil {
+		privacy.StrangerMoments = *update.StrangerMoments
+	}
+
+	if update.FriendQuestion != nil {
+		question := strings.TrimSpace(*update.FriendQuestion)
+		if len([]rune(question)) > friendQuestionMaxLength {
+			return nil, fmt.Errorf("问题不能超过%d个字符", friendQuestionMaxLength)
+		}
+		if question == "" {
+			privacy.FriendAnswerHash = ""
+		} else if question != privacy.FriendQuestion && update.FriendAnswer == nil {
+			return nil, errors.New("设置验证问题时需要同时设置答案")
+		}
+		privacy.FriendQuestion = question
+	}
+	if update.FriendAnswer != nil {
+		if privacy.FriendQuestion == "" {
+			return nil, errors.New("请先设置验证问题")
+		}
+		answer := strings.TrimSpace(*update.FriendAnswer)
+		if answer == "" {
+			return nil, errors.New("答案不能为空")
+		}
+		if len([]rune(answer)) > friendAnswerMaxLength {
+			return nil, fmt.Errorf("答案不能超过%d个字符", friendAnswerMaxLength)
+		}
+		hash, err := hashFriendAnswer(answer)
+		if err != nil {
+			return nil, err
+		}
+		privacy.FriendAnswerHash = hash
+	}
+
+	if err := s.Repo.SavePrivacy(privacy); err != nil {
+		return nil, err
+	}
+	return privacy, nil
+}